@@ -57,6 +57,14 @@ func main() {
 		cleanupService := services.NewChatCleanupService(db, log)
 		go cleanupService.StartPeriodicCleanup(ctx)
 		log.Info().Msg("✅ Chat cleanup service started")
+
+		timerScheduler := services.NewWorkflowTimerScheduler(db, log)
+		go timerScheduler.StartPeriodicFiring(ctx)
+		log.Info().Msg("✅ Workflow timer scheduler started")
+
+		jobExecutor := services.NewWorkflowJobExecutor(db, log)
+		go jobExecutor.StartPeriodicExecution(ctx)
+		log.Info().Msg("✅ Workflow job executor started")
 	}
 
 	// Start server in a goroutine
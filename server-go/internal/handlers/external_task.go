@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// ExternalTaskHandler handles the requests of external task workers
+type ExternalTaskHandler struct {
+	taskSvc       *services.ExternalTaskService
+	completionSvc *services.ExternalTaskCompletionService
+	logger        *zerolog.Logger
+}
+
+// NewExternalTaskHandler creates a new ExternalTaskHandler
+func NewExternalTaskHandler(
+	db *database.Database,
+	logger *zerolog.Logger,
+	workflowSvc *services.WorkflowService,
+	instanceSvc *services.WorkflowInstanceService,
+	executionSvc *services.WorkflowExecutionService,
+) *ExternalTaskHandler {
+	engineSvc := services.NewWorkflowEngineService(db, logger, workflowSvc, instanceSvc, executionSvc)
+	return &ExternalTaskHandler{
+		taskSvc:       services.NewExternalTaskService(db, logger),
+		completionSvc: services.NewExternalTaskCompletionService(db, logger, workflowSvc, instanceSvc, engineSvc),
+		logger:        logger,
+	}
+}
+
+// validExternalTaskStatuses 列表查询允许的状态过滤值
+var validExternalTaskStatuses = map[string]bool{
+	models.ExternalTaskStatusPending:   true,
+	models.ExternalTaskStatusCompleted: true,
+	models.ExternalTaskStatusFailed:    true,
+	models.ExternalTaskStatusCancelled: true,
+}
+
+// ListExternalTasks lists external tasks, optionally filtered by status, topic and instance
+// status=failed 即重试次数用尽、等待人工处理的任务
+func (h *ExternalTaskHandler) ListExternalTasks(c *gin.Context) {
+	page := 1
+	pageSize := 20
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil && parsed > 0 {
+			pageSize = parsed
+		}
+	}
+
+	filter := services.ExternalTaskFilter{
+		Status:     c.Query("status"),
+		Topic:      c.Query("topic"),
+		InstanceId: c.Query("instanceId"),
+	}
+	if filter.Status != "" && !validExternalTaskStatuses[filter.Status] {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid status: %s", filter.Status),
+		))
+		return
+	}
+
+	tasks, metadata, err := h.taskSvc.ListExternalTasks(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to list external tasks")
+		h.respondError(c, err, "Failed to list external tasks")
+		return
+	}
+
+	response := models.NewSuccessResponse(tasks)
+	response.Metadata = metadata
+	c.JSON(http.StatusOK, response)
+}
+
+// FetchAndLock locks pending external tasks of the worker's topics and returns them with their variables
+// 没有可拉取的任务时返回空列表，工作者稍后再次拉取
+func (h *ExternalTaskHandler) FetchAndLock(c *gin.Context) {
+	var req services.FetchAndLockRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	tasks, err := h.taskSvc.FetchAndLock(c.Request.Context(), req)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workerId", req.WorkerId).Msg("Failed to fetch and lock external tasks")
+		h.respondError(c, err, "Failed to fetch and lock external tasks")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(tasks))
+}
+
+// CompleteTask completes an external task locked by the worker and advances its instance
+func (h *ExternalTaskHandler) CompleteTask(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	var req services.CompleteExternalTaskRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	completion, err := h.completionSvc.CompleteTask(c.Request.Context(), taskID, req)
+	if err != nil {
+		h.logger.Error().Err(err).Str("taskId", taskID).Str("workerId", req.WorkerId).Msg("Failed to complete external task")
+		h.respondError(c, err, "Failed to complete external task")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(completion))
+}
+
+// HandleFailure records a failed attempt of an external task locked by the worker
+func (h *ExternalTaskHandler) HandleFailure(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	var req services.ExternalTaskFailureRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	task, err := h.taskSvc.HandleFailure(c.Request.Context(), taskID, req)
+	h.respondTask(c, task, err, "Failed to record external task failure")
+}
+
+// ExtendLock extends the lock of an external task held by the worker
+func (h *ExternalTaskHandler) ExtendLock(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	var req struct {
+		WorkerId    string `json:"workerId" binding:"required"`
+		NewDuration int64  `json:"newDuration" binding:"required"` // 从现在起锁的有效期（毫秒）
+	}
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	task, err := h.taskSvc.ExtendLock(c.Request.Context(), taskID, req.WorkerId, time.Duration(req.NewDuration)*time.Millisecond)
+	h.respondTask(c, task, err, "Failed to extend external task lock")
+}
+
+// SetRetries moves a failed external task back to pending so the workers fetch it again
+func (h *ExternalTaskHandler) SetRetries(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	var req struct {
+		Retries int `json:"retries" binding:"required"`
+	}
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	task, err := h.taskSvc.SetRetries(c.Request.Context(), taskID, req.Retries)
+	h.respondTask(c, task, err, "Failed to set external task retries")
+}
+
+// bindJSON binds the request body and responds with 400 when it is invalid
+func (h *ExternalTaskHandler) bindJSON(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid request body: %v", err),
+		))
+		return false
+	}
+	return true
+}
+
+// respondTask responds with the updated task of a failure, extend-lock or retries operation
+func (h *ExternalTaskHandler) respondTask(c *gin.Context, task *models.ExternalTask, err error, fallbackMessage string) {
+	if err != nil {
+		h.logger.Error().Err(err).Str("taskId", c.Param("taskId")).Msg(fallbackMessage)
+		h.respondError(c, err, fallbackMessage)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(task))
+}
+
+// respondError maps service errors to HTTP responses by their error code prefix
+func (h *ExternalTaskHandler) respondError(c *gin.Context, err error, fallbackMessage string) {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "database not available"):
+		c.JSON(http.StatusServiceUnavailable, models.NewErrorResponse(
+			models.ErrDatabaseError,
+			"Database is not available. Please ensure PostgreSQL is running and configured.",
+		))
+	case strings.HasPrefix(message, models.ErrExternalTaskNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrExternalTaskNotFound, "External task not found"))
+	case strings.HasPrefix(message, models.ErrWorkflowNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrWorkflowNotFound, "Workflow not found"))
+	case strings.HasPrefix(message, models.ErrWorkflowInstanceNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrWorkflowInstanceNotFound, "Workflow instance not found"))
+	case strings.HasPrefix(message, models.ErrInvalidExternalTaskState):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInvalidExternalTaskState, message))
+	case strings.HasPrefix(message, models.ErrInstanceSuspended):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInstanceSuspended, message))
+	case strings.HasPrefix(message, models.ErrInvalidInstanceState):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInvalidInstanceState, message))
+	case strings.HasPrefix(message, models.ErrInstanceVersionConflict):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInstanceVersionConflict, message))
+	case strings.HasPrefix(message, models.ErrUnhandledBpmnError):
+		c.JSON(http.StatusUnprocessableEntity, models.NewErrorResponse(models.ErrUnhandledBpmnError, message))
+	case strings.HasPrefix(message, models.ErrInvalidVariables):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidVariables, message))
+	case strings.HasPrefix(message, models.ErrInvalidRequest):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidRequest, message))
+	default:
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrInternalError, fallbackMessage))
+	}
+}
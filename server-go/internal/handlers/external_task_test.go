@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupExternalTaskHandlerTest(t *testing.T) *gin.Engine {
+	logger := zerolog.Nop()
+	db := database.NewDatabase(&logger)
+
+	handler := NewExternalTaskHandler(db, &logger,
+		services.NewWorkflowService(db, &logger),
+		services.NewWorkflowInstanceService(db, &logger),
+		services.NewWorkflowExecutionService(db, &logger),
+	)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	externalTasks := router.Group("/api/external-tasks")
+	externalTasks.GET("", handler.ListExternalTasks)
+	externalTasks.POST("/fetch-and-lock", handler.FetchAndLock)
+	externalTasks.POST("/:taskId/complete", handler.CompleteTask)
+	externalTasks.POST("/:taskId/failure", handler.HandleFailure)
+	externalTasks.POST("/:taskId/extend-lock", handler.ExtendLock)
+	externalTasks.POST("/:taskId/retries", handler.SetRetries)
+
+	return router
+}
+
+func TestExternalTaskHandler_InvalidRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"invalid status", "GET", "/api/external-tasks?status=dead", ""},
+		{"fetch without topics", "POST", "/api/external-tasks/fetch-and-lock", `{"workerId":"scorer-1","lockDuration":30000}`},
+		{"fetch with empty topics", "POST", "/api/external-tasks/fetch-and-lock", `{"workerId":"scorer-1","topics":[],"lockDuration":30000}`},
+		{"fetch without lock duration", "POST", "/api/external-tasks/fetch-and-lock", `{"workerId":"scorer-1","topics":["credit-scoring"]}`},
+		{"complete without worker", "POST", "/api/external-tasks/task-1/complete", `{"variables":{"score":720}}`},
+		{"negative retries", "POST", "/api/external-tasks/task-1/failure", `{"workerId":"scorer-1","retries":-1}`},
+		{"extend lock without duration", "POST", "/api/external-tasks/task-1/extend-lock", `{"workerId":"scorer-1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupExternalTaskHandlerTest(t)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var response models.APIResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+		})
+	}
+}
+
+func TestExternalTaskHandler_DatabaseUnavailable(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"list failed tasks", "GET", "/api/external-tasks?status=failed", ""},
+		{"fetch and lock", "POST", "/api/external-tasks/fetch-and-lock", `{"workerId":"scorer-1","topics":["credit-scoring"],"lockDuration":30000}`},
+		{"complete", "POST", "/api/external-tasks/task-1/complete", `{"workerId":"scorer-1","variables":{"score":720}}`},
+		{"failure", "POST", "/api/external-tasks/task-1/failure", `{"workerId":"scorer-1","errorMessage":"model unavailable","retries":2,"retryTimeout":60000}`},
+		{"extend lock", "POST", "/api/external-tasks/task-1/extend-lock", `{"workerId":"scorer-1","newDuration":30000}`},
+		{"set retries", "POST", "/api/external-tasks/task-1/retries", `{"retries":3}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupExternalTaskHandlerTest(t)
+
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			var response models.APIResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, models.ErrDatabaseError, response.Error.Code)
+		})
+	}
+}
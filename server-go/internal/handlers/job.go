@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// JobHandler handles the asynchronous job requests
+type JobHandler struct {
+	jobSvc *services.WorkflowJobService
+	logger *zerolog.Logger
+}
+
+// NewJobHandler creates a new JobHandler
+func NewJobHandler(db *database.Database, logger *zerolog.Logger) *JobHandler {
+	return &JobHandler{
+		jobSvc: services.NewWorkflowJobService(db, logger),
+		logger: logger,
+	}
+}
+
+// validJobStatuses 列表查询允许的状态过滤值
+var validJobStatuses = map[string]bool{
+	models.JobStatusPending:   true,
+	models.JobStatusRunning:   true,
+	models.JobStatusCompleted: true,
+	models.JobStatusDead:      true,
+	models.JobStatusCancelled: true,
+}
+
+// ListJobs lists jobs, optionally filtered by status and instance
+// status=dead 即死信队列中等待人工处理的作业
+func (h *JobHandler) ListJobs(c *gin.Context) {
+	page := 1
+	pageSize := 20
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil && parsed > 0 {
+			pageSize = parsed
+		}
+	}
+
+	status := c.Query("status")
+	if status != "" && !validJobStatuses[status] {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid status: %s", status),
+		))
+		return
+	}
+
+	jobs, metadata, err := h.jobSvc.ListJobs(c.Request.Context(), status, c.Query("instanceId"), page, pageSize)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to list jobs")
+		h.respondError(c, err, "Failed to list jobs")
+		return
+	}
+
+	response := models.NewSuccessResponse(jobs)
+	response.Metadata = metadata
+	c.JSON(http.StatusOK, response)
+}
+
+// RetryJob moves a dead job back to pending so the workers execute it again
+func (h *JobHandler) RetryJob(c *gin.Context) {
+	jobID := c.Param("jobId")
+
+	job, err := h.jobSvc.RetryJob(c.Request.Context(), jobID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("jobId", jobID).Msg("Failed to retry job")
+		h.respondError(c, err, "Failed to retry job")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(job))
+}
+
+// respondError maps service errors to HTTP responses by their error code prefix
+func (h *JobHandler) respondError(c *gin.Context, err error, fallbackMessage string) {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "database not available"):
+		c.JSON(http.StatusServiceUnavailable, models.NewErrorResponse(
+			models.ErrDatabaseError,
+			"Database is not available. Please ensure PostgreSQL is running and configured.",
+		))
+	case strings.HasPrefix(message, models.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrJobNotFound, "Job not found"))
+	case strings.HasPrefix(message, models.ErrInvalidJobState):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInvalidJobState, message))
+	default:
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrInternalError, fallbackMessage))
+	}
+}
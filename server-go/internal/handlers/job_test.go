@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupJobHandlerTest(t *testing.T) *gin.Engine {
+	logger := zerolog.Nop()
+	db := database.NewDatabase(&logger)
+
+	handler := NewJobHandler(db, &logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/jobs", handler.ListJobs)
+	router.POST("/api/jobs/:jobId/retry", handler.RetryJob)
+
+	return router
+}
+
+func TestJobHandler_ListJobs_InvalidStatus(t *testing.T) {
+	router := setupJobHandlerTest(t)
+
+	req, _ := http.NewRequest("GET", "/api/jobs?status=failed", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+}
+
+func TestJobHandler_DatabaseUnavailable(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"list dead jobs", "GET", "/api/jobs?status=dead"},
+		{"retry job", "POST", "/api/jobs/job-1/retry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupJobHandlerTest(t)
+
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			var response models.APIResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, models.ErrDatabaseError, response.Error.Code)
+		})
+	}
+}
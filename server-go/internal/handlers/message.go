@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// MessageHandler handles message correlation requests
+type MessageHandler struct {
+	correlationService *services.MessageCorrelationService
+	logger             *zerolog.Logger
+}
+
+// NewMessageHandler creates a new MessageHandler
+func NewMessageHandler(
+	db *database.Database,
+	logger *zerolog.Logger,
+	workflowSvc *services.WorkflowService,
+	instanceSvc *services.WorkflowInstanceService,
+	executionSvc *services.WorkflowExecutionService,
+) *MessageHandler {
+	engineSvc := services.NewWorkflowEngineService(db, logger, workflowSvc, instanceSvc, executionSvc)
+	return &MessageHandler{
+		correlationService: services.NewMessageCorrelationService(db, logger, workflowSvc, instanceSvc, engineSvc),
+		logger:             logger,
+	}
+}
+
+// CorrelateMessage delivers a message to the instances waiting for it
+func (h *MessageHandler) CorrelateMessage(c *gin.Context) {
+	var req services.CorrelateMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid request body: %v", err),
+		))
+		return
+	}
+
+	correlations, err := h.correlationService.CorrelateMessage(c.Request.Context(), req)
+	if err != nil {
+		h.logger.Error().Err(err).
+			Str("messageName", req.MessageName).
+			Str("businessKey", req.BusinessKey).
+			Msg("Failed to correlate message")
+
+		switch {
+		case strings.HasPrefix(err.Error(), models.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidRequest, err.Error()))
+		case strings.HasPrefix(err.Error(), models.ErrMessageNotCorrelated):
+			c.JSON(http.StatusNotFound, models.NewErrorResponse(
+				models.ErrMessageNotCorrelated,
+				fmt.Sprintf("No instance is waiting for message %s", req.MessageName),
+			))
+		default:
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+				models.ErrInternalError,
+				"Failed to correlate message",
+			))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(correlations))
+}
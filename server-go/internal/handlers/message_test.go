@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMessageHandlerTest(t *testing.T) *gin.Engine {
+	logger := zerolog.Nop()
+	db := database.NewDatabase(&logger)
+
+	workflowSvc := services.NewWorkflowService(db, &logger)
+	instanceSvc := services.NewWorkflowInstanceService(db, &logger)
+	executionSvc := services.NewWorkflowExecutionService(db, &logger)
+
+	handler := NewMessageHandler(db, &logger, workflowSvc, instanceSvc, executionSvc)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/messages", handler.CorrelateMessage)
+
+	return router
+}
+
+func TestMessageHandler_CorrelateMessage_MissingMessageName(t *testing.T) {
+	router := setupMessageHandlerTest(t)
+
+	body, _ := json.Marshal(map[string]interface{}{"businessKey": "order-1"})
+	req, _ := http.NewRequest("POST", "/api/messages", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+}
+
+func TestMessageHandler_CorrelateMessage_MissingCorrelation(t *testing.T) {
+	router := setupMessageHandlerTest(t)
+
+	body, _ := json.Marshal(map[string]interface{}{"messageName": "PaymentReceived"})
+	req, _ := http.NewRequest("POST", "/api/messages", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+}
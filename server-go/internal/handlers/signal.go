@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// SignalHandler handles signal broadcast requests
+type SignalHandler struct {
+	engineSvc *services.WorkflowEngineService
+	logger    *zerolog.Logger
+}
+
+// NewSignalHandler creates a new SignalHandler
+func NewSignalHandler(
+	db *database.Database,
+	logger *zerolog.Logger,
+	workflowSvc *services.WorkflowService,
+	instanceSvc *services.WorkflowInstanceService,
+	executionSvc *services.WorkflowExecutionService,
+) *SignalHandler {
+	return &SignalHandler{
+		engineSvc: services.NewWorkflowEngineService(db, logger, workflowSvc, instanceSvc, executionSvc),
+		logger:    logger,
+	}
+}
+
+// BroadcastSignal broadcasts a signal to every instance waiting for it and starts the workflows with a matching signal start event
+// 请求体可省略，variables 合并到被唤醒和新启动实例的流程变量中
+func (h *SignalHandler) BroadcastSignal(c *gin.Context) {
+	signalName := c.Param("name")
+
+	var req struct {
+		Variables map[string]interface{} `json:"variables,omitempty"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+				models.ErrInvalidRequest,
+				fmt.Sprintf("Invalid request body: %v", err),
+			))
+			return
+		}
+	}
+
+	broadcast, err := h.engineSvc.BroadcastSignal(c.Request.Context(), signalName, req.Variables)
+	if err != nil {
+		h.logger.Error().Err(err).Str("signalName", signalName).Msg("Failed to broadcast signal")
+
+		switch {
+		case strings.Contains(err.Error(), "database not available"):
+			c.JSON(http.StatusServiceUnavailable, models.NewErrorResponse(
+				models.ErrDatabaseError,
+				"Database is not available. Please ensure PostgreSQL is running and configured.",
+			))
+		case strings.HasPrefix(err.Error(), models.ErrInvalidRequest):
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidRequest, err.Error()))
+		default:
+			c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
+				models.ErrInternalError,
+				"Failed to broadcast signal",
+			))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(broadcast))
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSignalHandlerTest(t *testing.T) *gin.Engine {
+	logger := zerolog.Nop()
+	db := database.NewDatabase(&logger)
+
+	workflowSvc := services.NewWorkflowService(db, &logger)
+	instanceSvc := services.NewWorkflowInstanceService(db, &logger)
+	executionSvc := services.NewWorkflowExecutionService(db, &logger)
+
+	handler := NewSignalHandler(db, &logger, workflowSvc, instanceSvc, executionSvc)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/signals/:name", handler.BroadcastSignal)
+
+	return router
+}
+
+func TestSignalHandler_BroadcastSignal_InvalidBody(t *testing.T) {
+	router := setupSignalHandlerTest(t)
+
+	req, _ := http.NewRequest("POST", "/api/signals/ProductRecall", bytes.NewBufferString(`{"variables":`))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+}
+
+func TestSignalHandler_BroadcastSignal_NoDatabase(t *testing.T) {
+	router := setupSignalHandlerTest(t)
+
+	// 请求体可以省略
+	req, _ := http.NewRequest("POST", "/api/signals/ProductRecall", nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrDatabaseError, response.Error.Code)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// UserTaskHandler handles the human task inbox requests
+type UserTaskHandler struct {
+	taskSvc       *services.UserTaskService
+	completionSvc *services.UserTaskCompletionService
+	logger        *zerolog.Logger
+}
+
+// NewUserTaskHandler creates a new UserTaskHandler
+func NewUserTaskHandler(
+	db *database.Database,
+	logger *zerolog.Logger,
+	workflowSvc *services.WorkflowService,
+	instanceSvc *services.WorkflowInstanceService,
+	executionSvc *services.WorkflowExecutionService,
+) *UserTaskHandler {
+	engineSvc := services.NewWorkflowEngineService(db, logger, workflowSvc, instanceSvc, executionSvc)
+	return &UserTaskHandler{
+		taskSvc:       services.NewUserTaskService(db, logger),
+		completionSvc: services.NewUserTaskCompletionService(db, logger, workflowSvc, instanceSvc, engineSvc),
+		logger:        logger,
+	}
+}
+
+// validUserTaskStatuses 列表查询允许的状态过滤值
+var validUserTaskStatuses = map[string]bool{
+	models.UserTaskStatusPending:   true,
+	models.UserTaskStatusCompleted: true,
+	models.UserTaskStatusCancelled: true,
+}
+
+// ListTasks lists the user tasks of a user: tasks assigned to them and tasks they can claim
+// 默认只返回待处理任务，groups 为逗号分隔的用户组
+func (h *UserTaskHandler) ListTasks(c *gin.Context) {
+	page := 1
+	pageSize := 20
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil && parsed > 0 {
+			pageSize = parsed
+		}
+	}
+
+	filter := services.UserTaskFilter{
+		User:       c.Query("user"),
+		InstanceId: c.Query("instanceId"),
+		Status:     c.DefaultQuery("status", models.UserTaskStatusPending),
+	}
+	for _, group := range strings.Split(c.Query("groups"), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			filter.Groups = append(filter.Groups, group)
+		}
+	}
+	if !validUserTaskStatuses[filter.Status] {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid status: %s", filter.Status),
+		))
+		return
+	}
+
+	tasks, metadata, err := h.taskSvc.ListUserTasks(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		h.logger.Error().Err(err).Str("user", filter.User).Msg("Failed to list user tasks")
+		h.respondError(c, err, "Failed to list user tasks")
+		return
+	}
+
+	response := models.NewSuccessResponse(tasks)
+	response.Metadata = metadata
+	c.JSON(http.StatusOK, response)
+}
+
+// GetTask retrieves a user task by ID
+func (h *UserTaskHandler) GetTask(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	task, err := h.taskSvc.GetUserTask(c.Request.Context(), taskID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("taskId", taskID).Msg("Failed to get user task")
+		h.respondError(c, err, "Failed to get user task")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(task))
+}
+
+// ClaimTask assigns a user task to the user
+func (h *UserTaskHandler) ClaimTask(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	var req struct {
+		UserId string   `json:"userId" binding:"required"`
+		Groups []string `json:"groups,omitempty"` // 用户所在的组，用于匹配候选组
+	}
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	task, err := h.taskSvc.ClaimUserTask(c.Request.Context(), taskID, req.UserId, req.Groups)
+	h.respondTask(c, task, err, "claim")
+}
+
+// UnclaimTask returns a claimed user task to its candidates
+func (h *UserTaskHandler) UnclaimTask(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	var req struct {
+		UserId string `json:"userId" binding:"required"`
+	}
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	task, err := h.taskSvc.UnclaimUserTask(c.Request.Context(), taskID, req.UserId)
+	h.respondTask(c, task, err, "unclaim")
+}
+
+// DelegateTask hands a user task over to another user
+func (h *UserTaskHandler) DelegateTask(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	var req struct {
+		UserId     string `json:"userId" binding:"required"`
+		DelegateTo string `json:"delegateTo" binding:"required"`
+	}
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	task, err := h.taskSvc.DelegateUserTask(c.Request.Context(), taskID, req.UserId, req.DelegateTo)
+	h.respondTask(c, task, err, "delegate")
+}
+
+// CompleteTask completes a user task and advances its instance
+func (h *UserTaskHandler) CompleteTask(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	var req services.CompleteUserTaskRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	completion, err := h.completionSvc.CompleteTask(c.Request.Context(), taskID, req)
+	if err != nil {
+		h.logger.Error().Err(err).Str("taskId", taskID).Str("userId", req.UserId).Msg("Failed to complete user task")
+		h.respondError(c, err, "Failed to complete user task")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(completion))
+}
+
+// bindJSON binds the request body and responds with 400 when it is invalid
+func (h *UserTaskHandler) bindJSON(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid request body: %v", err),
+		))
+		return false
+	}
+	return true
+}
+
+// respondTask responds with the updated task of a claim, unclaim or delegate operation
+func (h *UserTaskHandler) respondTask(c *gin.Context, task *models.UserTask, err error, action string) {
+	if err != nil {
+		h.logger.Error().Err(err).Str("taskId", c.Param("taskId")).Str("action", action).Msg("Failed to update user task")
+		h.respondError(c, err, fmt.Sprintf("Failed to %s user task", action))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(task))
+}
+
+// respondError maps service errors to HTTP responses by their error code prefix
+func (h *UserTaskHandler) respondError(c *gin.Context, err error, fallbackMessage string) {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "database not available"):
+		c.JSON(http.StatusServiceUnavailable, models.NewErrorResponse(
+			models.ErrDatabaseError,
+			"Database is not available. Please ensure PostgreSQL is running and configured.",
+		))
+	case strings.HasPrefix(message, models.ErrUserTaskNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrUserTaskNotFound, "User task not found"))
+	case strings.HasPrefix(message, models.ErrWorkflowNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrWorkflowNotFound, "Workflow not found"))
+	case strings.HasPrefix(message, models.ErrWorkflowInstanceNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrWorkflowInstanceNotFound, "Workflow instance not found"))
+	case strings.HasPrefix(message, models.ErrInvalidTaskState):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInvalidTaskState, message))
+	case strings.HasPrefix(message, models.ErrInstanceSuspended):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInstanceSuspended, message))
+	case strings.HasPrefix(message, models.ErrInvalidInstanceState):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInvalidInstanceState, message))
+	case strings.HasPrefix(message, models.ErrInstanceVersionConflict):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInstanceVersionConflict, message))
+	case strings.HasPrefix(message, models.ErrUnhandledBpmnError):
+		c.JSON(http.StatusUnprocessableEntity, models.NewErrorResponse(models.ErrUnhandledBpmnError, message))
+	case strings.HasPrefix(message, models.ErrInvalidVariables):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidVariables, message))
+	case strings.HasPrefix(message, models.ErrInvalidRequest):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidRequest, message))
+	default:
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrInternalError, fallbackMessage))
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupUserTaskHandlerTest(t *testing.T) *gin.Engine {
+	logger := zerolog.Nop()
+	db := database.NewDatabase(&logger)
+
+	workflowSvc := services.NewWorkflowService(db, &logger)
+	instanceSvc := services.NewWorkflowInstanceService(db, &logger)
+	executionSvc := services.NewWorkflowExecutionService(db, &logger)
+
+	handler := NewUserTaskHandler(db, &logger, workflowSvc, instanceSvc, executionSvc)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/tasks", handler.ListTasks)
+	router.POST("/api/tasks/:taskId/claim", handler.ClaimTask)
+	router.POST("/api/tasks/:taskId/delegate", handler.DelegateTask)
+	router.POST("/api/tasks/:taskId/complete", handler.CompleteTask)
+
+	return router
+}
+
+func TestUserTaskHandler_ListTasks_InvalidStatus(t *testing.T) {
+	router := setupUserTaskHandlerTest(t)
+
+	req, _ := http.NewRequest("GET", "/api/tasks?user=alice&status=done", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+}
+
+func TestUserTaskHandler_InvalidRequestBody(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body map[string]interface{}
+	}{
+		{"claim without userId", "/api/tasks/task-1/claim", map[string]interface{}{"groups": []string{"managers"}}},
+		{"delegate without delegateTo", "/api/tasks/task-1/delegate", map[string]interface{}{"userId": "alice"}},
+		{"complete without userId", "/api/tasks/task-1/complete", map[string]interface{}{"outcome": "Boundary_Approved"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupUserTaskHandlerTest(t)
+
+			body, _ := json.Marshal(tt.body)
+			req, _ := http.NewRequest("POST", tt.path, bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			var response models.APIResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+		})
+	}
+}
+
+func TestUserTaskHandler_ClaimTask_DatabaseUnavailable(t *testing.T) {
+	router := setupUserTaskHandlerTest(t)
+
+	body, _ := json.Marshal(map[string]interface{}{"userId": "alice"})
+	req, _ := http.NewRequest("POST", "/api/tasks/task-1/claim", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrDatabaseError, response.Error.Code)
+}
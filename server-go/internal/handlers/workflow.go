@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
 	"github.com/bpmn-explorer/server/internal/services"
 	"github.com/bpmn-explorer/server/pkg/database"
 	"github.com/gin-gonic/gin"
@@ -63,6 +64,24 @@ func (h *WorkflowHandler) CreateWorkflow(c *gin.Context) {
 	c.JSON(http.StatusCreated, models.NewSuccessResponse(workflow))
 }
 
+// ValidateWorkflow validates BPMN XML and returns every issue found, without saving anything
+// 编辑器根据每个问题的 elementId 高亮出问题的元素；XML 有问题时仍返回 200，valid 为 false
+func (h *WorkflowHandler) ValidateWorkflow(c *gin.Context) {
+	var req struct {
+		BpmnXml string `json:"bpmnXml" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			"Invalid request body",
+		))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(parser.Validate(req.BpmnXml)))
+}
+
 // GetWorkflow retrieves a workflow by ID
 func (h *WorkflowHandler) GetWorkflow(c *gin.Context) {
 	workflowID := c.Param("workflowId")
@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/bpmn-explorer/server/internal/models"
 	"github.com/bpmn-explorer/server/internal/services"
@@ -11,6 +12,9 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// maxConflictRetries 服务端处理实例版本冲突时的最大重试次数
+const maxConflictRetries = 3
+
 // WorkflowExecutorHandler handles workflow execution requests
 type WorkflowExecutorHandler struct {
 	engineService *services.WorkflowEngineService
@@ -59,6 +63,8 @@ func (h *WorkflowExecutorHandler) ExecuteWorkflow(c *gin.Context) {
 		BusinessParams   map[string]interface{} `json:"businessParams,omitempty"`
 		Workflow         *models.Workflow       `json:"workflow,omitempty"`         // Optional: for mock mode
 		WorkflowInstance *models.WorkflowInstance `json:"workflowInstance,omitempty"` // Optional: for mock mode
+		// RetryOnConflict 可选：占用实例时发生版本冲突后重新读取实例并重试的次数（最多 3 次），默认不重试
+		RetryOnConflict int `json:"retryOnConflict,omitempty"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -68,6 +74,13 @@ func (h *WorkflowExecutorHandler) ExecuteWorkflow(c *gin.Context) {
 		))
 		return
 	}
+	if req.RetryOnConflict < 0 || req.RetryOnConflict > maxConflictRetries {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("retryOnConflict must be between 0 and %d", maxConflictRetries),
+		))
+		return
+	}
 
 	// 调用执行引擎
 	var result *services.ExecuteResult
@@ -92,40 +105,55 @@ func (h *WorkflowExecutorHandler) ExecuteWorkflow(c *gin.Context) {
 			Str("workflowInstanceId", workflowInstanceId).
 			Msg("Fetching workflow and instance from database")
 
-		// 1. Get workflow instance from database
-		instance, err := h.instanceSvc.GetWorkflowInstanceByID(c.Request.Context(), workflowInstanceId)
-		if err != nil {
-			h.logger.Error().Err(err).
-				Str("workflowInstanceId", workflowInstanceId).
-				Msg("Failed to get workflow instance")
-			c.JSON(http.StatusNotFound, models.NewErrorResponse(
-				models.ErrWorkflowInstanceNotFound,
-				"Workflow instance not found",
-			))
-			return
-		}
+		// 实例版本冲突时，按调用方的要求重新读取实例和流程后重试
+		for attempt := 0; ; attempt++ {
+			// 1. Get workflow instance from database
+			// 使用外层 err，确保执行引擎返回的错误不会被遮蔽
+			var instance *models.WorkflowInstance
+			var workflow *models.Workflow
+			instance, err = h.instanceSvc.GetWorkflowInstanceByID(c.Request.Context(), workflowInstanceId)
+			if err != nil {
+				h.logger.Error().Err(err).
+					Str("workflowInstanceId", workflowInstanceId).
+					Msg("Failed to get workflow instance")
+				c.JSON(http.StatusNotFound, models.NewErrorResponse(
+					models.ErrWorkflowInstanceNotFound,
+					"Workflow instance not found",
+				))
+				return
+			}
 
-		// 2. Get workflow from database
-		workflow, err := h.workflowSvc.GetWorkflowByID(c.Request.Context(), instance.WorkflowId)
-		if err != nil {
-			h.logger.Error().Err(err).
-				Str("workflowId", instance.WorkflowId).
-				Msg("Failed to get workflow")
-			c.JSON(http.StatusNotFound, models.NewErrorResponse(
-				models.ErrWorkflowNotFound,
-				"Workflow not found",
-			))
-			return
-		}
+			// 2. Get workflow from database
+			workflow, err = h.workflowSvc.GetWorkflowByID(c.Request.Context(), instance.WorkflowId)
+			if err != nil {
+				h.logger.Error().Err(err).
+					Str("workflowId", instance.WorkflowId).
+					Msg("Failed to get workflow")
+				c.JSON(http.StatusNotFound, models.NewErrorResponse(
+					models.ErrWorkflowNotFound,
+					"Workflow not found",
+				))
+				return
+			}
 
-		// 3. Call execution engine with prepared data
-		result, err = h.engineService.ExecuteFromNode(
-			c.Request.Context(),
-			workflow,
-			instance,
-			req.FromNodeId,
-			req.BusinessParams,
-		)
+			// 3. Call execution engine with prepared data
+			result, err = h.engineService.ExecuteFromNode(
+				c.Request.Context(),
+				workflow,
+				instance,
+				req.FromNodeId,
+				req.BusinessParams,
+			)
+
+			// 只重试占用实例时的冲突：此时还没有执行任何节点；最终更新的冲突发生在业务副作用之后，重试会重复调用业务接口
+			if err == nil || !services.IsClaimConflict(err) || attempt >= req.RetryOnConflict {
+				break
+			}
+			h.logger.Warn().Err(err).
+				Str("workflowInstanceId", workflowInstanceId).
+				Int("attempt", attempt+1).
+				Msg("Workflow instance version conflict, retrying execution")
+		}
 	}
 
 	if err != nil {
@@ -151,6 +179,46 @@ func (h *WorkflowExecutorHandler) ExecuteWorkflow(c *gin.Context) {
 			return
 		}
 
+		if strings.HasPrefix(err.Error(), models.ErrInstanceVersionConflict) {
+			c.JSON(http.StatusConflict, models.NewErrorResponse(
+				models.ErrInstanceVersionConflict,
+				"Workflow instance was modified by another request, please reload and retry",
+			))
+			return
+		}
+
+		if strings.HasPrefix(err.Error(), models.ErrUnhandledBpmnError) {
+			c.JSON(http.StatusUnprocessableEntity, models.NewErrorResponse(
+				models.ErrUnhandledBpmnError,
+				err.Error(),
+			))
+			return
+		}
+
+		if strings.HasPrefix(err.Error(), models.ErrInstanceSuspended) {
+			c.JSON(http.StatusConflict, models.NewErrorResponse(
+				models.ErrInstanceSuspended,
+				"Workflow instance is suspended",
+			))
+			return
+		}
+
+		if strings.HasPrefix(err.Error(), models.ErrInvalidInstanceState) {
+			c.JSON(http.StatusConflict, models.NewErrorResponse(
+				models.ErrInvalidInstanceState,
+				err.Error(),
+			))
+			return
+		}
+
+		if strings.HasPrefix(err.Error(), models.ErrInvalidVariables) {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+				models.ErrInvalidVariables,
+				err.Error(),
+			))
+			return
+		}
+
 		// 其他错误返回 500
 		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(
 			models.ErrInternalError,
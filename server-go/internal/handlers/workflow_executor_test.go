@@ -69,6 +69,27 @@ func TestWorkflowExecutorHandler_ExecuteWorkflow_MissingInstanceId(t *testing.T)
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+func TestWorkflowExecutorHandler_ExecuteWorkflow_RetryOnConflictOutOfRange(t *testing.T) {
+	_, router := setupWorkflowExecutorHandlerTest(t)
+
+	reqBody := map[string]interface{}{
+		"fromNodeId":      "ServiceTask_1",
+		"retryOnConflict": maxConflictRetries + 1,
+	}
+	body, _ := json.Marshal(reqBody)
+	req, _ := http.NewRequest("POST", "/api/execute/test-instance-id", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+}
+
 func TestWorkflowExecutorHandler_ExecuteWorkflow_ValidRequest(t *testing.T) {
 	_, router := setupWorkflowExecutorHandlerTest(t)
 
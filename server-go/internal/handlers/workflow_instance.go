@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// WorkflowInstanceHandler handles workflow instance lifecycle requests
+type WorkflowInstanceHandler struct {
+	engineService *services.WorkflowEngineService
+	workflowSvc   *services.WorkflowService
+	instanceSvc   *services.WorkflowInstanceService
+	logger        *zerolog.Logger
+}
+
+// NewWorkflowInstanceHandler creates a new WorkflowInstanceHandler
+func NewWorkflowInstanceHandler(
+	db *database.Database,
+	logger *zerolog.Logger,
+	workflowSvc *services.WorkflowService,
+	instanceSvc *services.WorkflowInstanceService,
+	executionSvc *services.WorkflowExecutionService,
+) *WorkflowInstanceHandler {
+	return &WorkflowInstanceHandler{
+		engineService: services.NewWorkflowEngineService(
+			db,
+			logger,
+			workflowSvc,
+			instanceSvc,
+			executionSvc,
+		),
+		workflowSvc: workflowSvc,
+		instanceSvc: instanceSvc,
+		logger:      logger,
+	}
+}
+
+// validInstanceStatuses 列表查询允许的状态过滤值
+var validInstanceStatuses = map[string]bool{
+	models.InstanceStatusPending:   true,
+	models.InstanceStatusRunning:   true,
+	models.InstanceStatusCompleted: true,
+	models.InstanceStatusFailed:    true,
+	models.InstanceStatusCancelled: true,
+	models.InstanceStatusSuspended: true,
+}
+
+// StartInstance creates a workflow instance and executes it from a start event
+func (h *WorkflowInstanceHandler) StartInstance(c *gin.Context) {
+	workflowID := c.Param("workflowId")
+
+	var req struct {
+		Name        string                 `json:"name"`
+		StartNodeId string                 `json:"startNodeId"` // Optional: defaults to the first start event
+		Variables   map[string]interface{} `json:"variables,omitempty"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid request body: %v", err),
+		))
+		return
+	}
+
+	workflow, err := h.workflowSvc.GetWorkflowByID(c.Request.Context(), workflowID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workflowId", workflowID).Msg("Failed to get workflow")
+		h.respondError(c, err, "Workflow not found")
+		return
+	}
+
+	instance, result, err := h.engineService.StartInstance(c.Request.Context(), workflow, req.Name, req.StartNodeId, req.Variables)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workflowId", workflowID).Msg("Failed to start workflow instance")
+		h.respondError(c, err, "Failed to start workflow instance")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(gin.H{
+		"instance": instance,
+		"result":   result,
+	}))
+}
+
+// ListInstances lists workflow instances filtered by workflow, status and creation date
+func (h *WorkflowInstanceHandler) ListInstances(c *gin.Context) {
+	// Parse pagination parameters
+	page := 1
+	pageSize := 20
+	if p := c.Query("page"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
+			page = parsed
+		}
+	}
+	if ps := c.Query("pageSize"); ps != "" {
+		if parsed, err := strconv.Atoi(ps); err == nil && parsed > 0 {
+			pageSize = parsed
+		}
+	}
+
+	filter := services.WorkflowInstanceFilter{
+		WorkflowId: c.Query("workflowId"),
+		Status:     c.Query("status"),
+	}
+	if filter.Status != "" && !validInstanceStatuses[filter.Status] {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid status: %s", filter.Status),
+		))
+		return
+	}
+
+	// 日期过滤使用 RFC3339 格式
+	for param, target := range map[string]**time.Time{
+		"createdAfter":  &filter.CreatedAfter,
+		"createdBefore": &filter.CreatedBefore,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+				models.ErrInvalidRequest,
+				fmt.Sprintf("Invalid %s: expected RFC3339 timestamp", param),
+			))
+			return
+		}
+		*target = &parsed
+	}
+
+	instances, metadata, err := h.instanceSvc.ListWorkflowInstances(c.Request.Context(), filter, page, pageSize)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to list workflow instances")
+		h.respondError(c, err, "Failed to list workflow instances")
+		return
+	}
+
+	response := models.NewSuccessResponse(instances)
+	response.Metadata = metadata
+	c.JSON(http.StatusOK, response)
+}
+
+// GetInstance retrieves a workflow instance by ID
+func (h *WorkflowInstanceHandler) GetInstance(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+
+	instance, err := h.instanceSvc.GetWorkflowInstanceByID(c.Request.Context(), instanceID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("instanceId", instanceID).Msg("Failed to get workflow instance")
+		h.respondError(c, err, "Failed to get workflow instance")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(instance))
+}
+
+// CancelInstance cancels a workflow instance
+func (h *WorkflowInstanceHandler) CancelInstance(c *gin.Context) {
+	h.changeStatus(c, "cancel", h.instanceSvc.CancelWorkflowInstance)
+}
+
+// SuspendInstance suspends a workflow instance
+func (h *WorkflowInstanceHandler) SuspendInstance(c *gin.Context) {
+	h.changeStatus(c, "suspend", h.instanceSvc.SuspendWorkflowInstance)
+}
+
+// ResumeInstance resumes a suspended workflow instance
+func (h *WorkflowInstanceHandler) ResumeInstance(c *gin.Context) {
+	h.changeStatus(c, "resume", h.instanceSvc.ResumeWorkflowInstance)
+}
+
+// RollbackInstance moves the instance back to a node and runs the compensation handlers of the tasks completed since then
+func (h *WorkflowInstanceHandler) RollbackInstance(c *gin.Context) {
+	instanceID := c.Param("instanceId")
+
+	var req struct {
+		ToNodeId string `json:"toNodeId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid request body: %v", err),
+		))
+		return
+	}
+
+	instance, err := h.instanceSvc.GetWorkflowInstanceByID(c.Request.Context(), instanceID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("instanceId", instanceID).Msg("Failed to get workflow instance")
+		h.respondError(c, err, "Failed to get workflow instance")
+		return
+	}
+
+	workflow, err := h.workflowSvc.GetWorkflowByID(c.Request.Context(), instance.WorkflowId)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workflowId", instance.WorkflowId).Msg("Failed to get workflow")
+		h.respondError(c, err, "Workflow not found")
+		return
+	}
+
+	result, err := h.engineService.RollbackToNode(c.Request.Context(), workflow, instance, req.ToNodeId)
+	if err != nil {
+		h.logger.Error().Err(err).Str("instanceId", instanceID).Str("toNodeId", req.ToNodeId).Msg("Failed to roll back workflow instance")
+		h.respondError(c, err, "Failed to roll back workflow instance")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(result))
+}
+
+// changeStatus applies a lifecycle operation to the instance in the path
+func (h *WorkflowInstanceHandler) changeStatus(
+	c *gin.Context,
+	action string,
+	apply func(ctx context.Context, instanceID string) (*models.WorkflowInstance, error),
+) {
+	instanceID := c.Param("instanceId")
+
+	instance, err := apply(c.Request.Context(), instanceID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("instanceId", instanceID).Str("action", action).Msg("Failed to change workflow instance status")
+		h.respondError(c, err, fmt.Sprintf("Failed to %s workflow instance", action))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(instance))
+}
+
+// respondError maps service errors to HTTP responses by their error code prefix
+func (h *WorkflowInstanceHandler) respondError(c *gin.Context, err error, fallbackMessage string) {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "database not available"):
+		c.JSON(http.StatusServiceUnavailable, models.NewErrorResponse(
+			models.ErrDatabaseError,
+			"Database is not available. Please ensure PostgreSQL is running and configured.",
+		))
+	case strings.HasPrefix(message, models.ErrWorkflowNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrWorkflowNotFound, "Workflow not found"))
+	case strings.HasPrefix(message, models.ErrWorkflowInstanceNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrWorkflowInstanceNotFound, "Workflow instance not found"))
+	case strings.HasPrefix(message, models.ErrInstanceSuspended):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInstanceSuspended, message))
+	case strings.HasPrefix(message, models.ErrInvalidInstanceState):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInvalidInstanceState, message))
+	case strings.HasPrefix(message, models.ErrInstanceVersionConflict):
+		c.JSON(http.StatusConflict, models.NewErrorResponse(models.ErrInstanceVersionConflict, message))
+	case strings.HasPrefix(message, models.ErrUnhandledBpmnError):
+		c.JSON(http.StatusUnprocessableEntity, models.NewErrorResponse(models.ErrUnhandledBpmnError, message))
+	case strings.HasPrefix(message, models.ErrInvalidNodeId):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidNodeId, message))
+	case strings.HasPrefix(message, models.ErrInvalidVariables):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidVariables, message))
+	case strings.HasPrefix(message, models.ErrInvalidRequest):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidRequest, message))
+	default:
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrInternalError, fallbackMessage))
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWorkflowInstanceHandlerTest(t *testing.T) *gin.Engine {
+	logger := zerolog.Nop()
+	db := database.NewDatabase(&logger)
+
+	workflowSvc := services.NewWorkflowService(db, &logger)
+	instanceSvc := services.NewWorkflowInstanceService(db, &logger)
+	executionSvc := services.NewWorkflowExecutionService(db, &logger)
+
+	handler := NewWorkflowInstanceHandler(db, &logger, workflowSvc, instanceSvc, executionSvc)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/workflows/:workflowId/instances", handler.StartInstance)
+	router.GET("/api/instances", handler.ListInstances)
+	router.POST("/api/instances/:instanceId/suspend", handler.SuspendInstance)
+
+	return router
+}
+
+func TestWorkflowInstanceHandler_StartInstance_InvalidRequest(t *testing.T) {
+	router := setupWorkflowInstanceHandlerTest(t)
+
+	req, _ := http.NewRequest("POST", "/api/workflows/test-workflow-id/instances", bytes.NewBuffer([]byte("invalid json")))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+}
+
+func TestWorkflowInstanceHandler_ListInstances_InvalidFilter(t *testing.T) {
+	router := setupWorkflowInstanceHandlerTest(t)
+
+	for _, query := range []string{"status=unknown", "createdAfter=yesterday"} {
+		req, _ := http.NewRequest("GET", "/api/instances?"+query, nil)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		var response models.APIResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+	}
+}
+
+func TestWorkflowInstanceHandler_SuspendInstance_DatabaseUnavailable(t *testing.T) {
+	router := setupWorkflowInstanceHandlerTest(t)
+
+	req, _ := http.NewRequest("POST", "/api/instances/test-instance-id/suspend", nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrDatabaseError, response.Error.Code)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWorkflowHandlerTest(t *testing.T) *gin.Engine {
+	logger := zerolog.Nop()
+	db := database.NewDatabase(&logger)
+
+	handler := NewWorkflowHandler(db, &logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/workflows/validate", handler.ValidateWorkflow)
+
+	return router
+}
+
+func TestWorkflowHandler_ValidateWorkflow(t *testing.T) {
+	router := setupWorkflowHandlerTest(t)
+
+	bpmnXML := `<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="StartEvent_1"/>
+    <bpmn:parallelGateway id="Gateway_1"/>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Gateway_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+	body, _ := json.Marshal(map[string]string{"bpmnXml": bpmnXML})
+
+	req, _ := http.NewRequest("POST", "/api/workflows/validate", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// 校验不需要数据库
+	require.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Success bool                    `json:"success"`
+		Data    models.ValidationReport `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.False(t, response.Data.Valid)
+	require.NotEmpty(t, response.Data.Issues)
+	assert.Equal(t, "Gateway_1", response.Data.Issues[0].ElementId)
+	assert.Equal(t, "GATEWAY_NO_OUTGOING", response.Data.Issues[0].Rule)
+	assert.Equal(t, models.ValidationSeverityError, response.Data.Issues[0].Severity)
+}
+
+func TestWorkflowHandler_ValidateWorkflow_InvalidRequest(t *testing.T) {
+	router := setupWorkflowHandlerTest(t)
+
+	req, _ := http.NewRequest("POST", "/api/workflows/validate", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/services"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// WorkflowVersionHandler handles workflow deployment and version requests
+type WorkflowVersionHandler struct {
+	service      *services.WorkflowVersionService
+	migrationSvc *services.WorkflowMigrationService
+	logger       *zerolog.Logger
+}
+
+// NewWorkflowVersionHandler creates a new WorkflowVersionHandler
+func NewWorkflowVersionHandler(db *database.Database, logger *zerolog.Logger) *WorkflowVersionHandler {
+	return &WorkflowVersionHandler{
+		service:      services.NewWorkflowVersionService(db, logger),
+		migrationSvc: services.NewWorkflowMigrationService(db, logger),
+		logger:       logger,
+	}
+}
+
+// DeployWorkflow snapshots the current workflow XML as a new active version
+func (h *WorkflowVersionHandler) DeployWorkflow(c *gin.Context) {
+	workflowID := c.Param("workflowId")
+
+	version, err := h.service.DeployWorkflow(c.Request.Context(), workflowID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workflowId", workflowID).Msg("Failed to deploy workflow")
+		h.respondError(c, err, "Failed to deploy workflow")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.NewSuccessResponse(version))
+}
+
+// ListVersions lists the deployed versions of a workflow
+func (h *WorkflowVersionHandler) ListVersions(c *gin.Context) {
+	workflowID := c.Param("workflowId")
+
+	versions, err := h.service.ListWorkflowVersions(c.Request.Context(), workflowID)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workflowId", workflowID).Msg("Failed to list workflow versions")
+		h.respondError(c, err, "Failed to list workflow versions")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(versions))
+}
+
+// GetVersion retrieves one deployed version of a workflow
+func (h *WorkflowVersionHandler) GetVersion(c *gin.Context) {
+	workflowID := c.Param("workflowId")
+	version, ok := parseVersionParam(c, c.Param("version"), "version")
+	if !ok {
+		return
+	}
+
+	workflowVersion, err := h.service.GetWorkflowVersion(c.Request.Context(), workflowID, version)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workflowId", workflowID).Int("version", version).Msg("Failed to get workflow version")
+		h.respondError(c, err, "Failed to get workflow version")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(workflowVersion))
+}
+
+// ActivateVersion sets a deployed version as the one new instances start on
+func (h *WorkflowVersionHandler) ActivateVersion(c *gin.Context) {
+	workflowID := c.Param("workflowId")
+	version, ok := parseVersionParam(c, c.Param("version"), "version")
+	if !ok {
+		return
+	}
+
+	workflowVersion, err := h.service.SetActiveVersion(c.Request.Context(), workflowID, version)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workflowId", workflowID).Int("version", version).Msg("Failed to activate workflow version")
+		h.respondError(c, err, "Failed to activate workflow version")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(workflowVersion))
+}
+
+// DiffVersions compares the nodes and sequence flows of two versions (?from=1&to=2)
+func (h *WorkflowVersionHandler) DiffVersions(c *gin.Context) {
+	workflowID := c.Param("workflowId")
+	fromVersion, ok := parseVersionParam(c, c.Query("from"), "from")
+	if !ok {
+		return
+	}
+	toVersion, ok := parseVersionParam(c, c.Query("to"), "to")
+	if !ok {
+		return
+	}
+
+	diff, err := h.service.DiffWorkflowVersions(c.Request.Context(), workflowID, fromVersion, toVersion)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workflowId", workflowID).Msg("Failed to diff workflow versions")
+		h.respondError(c, err, "Failed to diff workflow versions")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(diff))
+}
+
+// MigrateInstances moves active instances from one version to another, or reports what would happen with dryRun
+func (h *WorkflowVersionHandler) MigrateInstances(c *gin.Context) {
+	workflowID := c.Param("workflowId")
+
+	var plan services.InstanceMigrationPlan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("Invalid request body: %v", err),
+		))
+		return
+	}
+
+	report, err := h.migrationSvc.MigrateInstances(c.Request.Context(), workflowID, plan)
+	if err != nil {
+		h.logger.Error().Err(err).Str("workflowId", workflowID).Msg("Failed to migrate workflow instances")
+		h.respondError(c, err, "Failed to migrate workflow instances")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NewSuccessResponse(report))
+}
+
+// parseVersionParam parses a positive version number, writing a 400 response if invalid
+func parseVersionParam(c *gin.Context, value, name string) (int, bool) {
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(
+			models.ErrInvalidRequest,
+			fmt.Sprintf("%s must be a positive version number", name),
+		))
+		return 0, false
+	}
+	return version, true
+}
+
+// respondError maps service errors to HTTP responses by their error code prefix
+func (h *WorkflowVersionHandler) respondError(c *gin.Context, err error, fallbackMessage string) {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "database not available"):
+		c.JSON(http.StatusServiceUnavailable, models.NewErrorResponse(
+			models.ErrDatabaseError,
+			"Database is not available. Please ensure PostgreSQL is running and configured.",
+		))
+	case strings.HasPrefix(message, models.ErrWorkflowNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrWorkflowNotFound, "Workflow not found"))
+	case strings.HasPrefix(message, models.ErrWorkflowVersionNotFound):
+		c.JSON(http.StatusNotFound, models.NewErrorResponse(models.ErrWorkflowVersionNotFound, message))
+	case strings.HasPrefix(message, models.ErrInvalidNodeId):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidNodeId, message))
+	case strings.HasPrefix(message, models.ErrInvalidRequest):
+		c.JSON(http.StatusBadRequest, models.NewErrorResponse(models.ErrInvalidRequest, message))
+	default:
+		c.JSON(http.StatusInternalServerError, models.NewErrorResponse(models.ErrInternalError, fallbackMessage))
+	}
+}
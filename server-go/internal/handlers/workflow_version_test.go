@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWorkflowVersionHandlerTest(t *testing.T) *gin.Engine {
+	logger := zerolog.Nop()
+	db := database.NewDatabase(&logger)
+
+	handler := NewWorkflowVersionHandler(db, &logger)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/workflows/:workflowId/versions/:version", handler.GetVersion)
+	router.GET("/api/workflows/:workflowId/diff", handler.DiffVersions)
+
+	return router
+}
+
+func TestWorkflowVersionHandler_InvalidVersion(t *testing.T) {
+	router := setupWorkflowVersionHandlerTest(t)
+
+	for _, path := range []string{
+		"/api/workflows/test-workflow-id/versions/latest",
+		"/api/workflows/test-workflow-id/versions/0",
+		"/api/workflows/test-workflow-id/diff?from=1",
+	} {
+		req, _ := http.NewRequest("GET", path, nil)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		var response models.APIResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, models.ErrInvalidRequest, response.Error.Code)
+	}
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// CallActivity links a child instance started by a call activity to its parent instance
+type CallActivity struct {
+	Id               string                 `json:"id" db:"id"`
+	ParentInstanceId string                 `json:"parentInstanceId" db:"parent_instance_id"`
+	ParentWorkflowId string                 `json:"parentWorkflowId" db:"parent_workflow_id"`
+	ParentNodeId     string                 `json:"parentNodeId" db:"parent_node_id"` // 父流程中的调用活动节点 ID
+	ChildInstanceId  string                 `json:"childInstanceId" db:"child_instance_id"`
+	Variables        map[string]interface{} `json:"variables" db:"variables"` // 调用时父实例的流程变量
+	Status           string                 `json:"status" db:"status"`
+	ErrorMessage     string                 `json:"errorMessage,omitempty" db:"error_message"`
+	CreatedAt        time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time              `json:"updatedAt" db:"updated_at"`
+}
+
+// CallActivityStatus constants
+const (
+	CallActivityStatusPending   = "pending"
+	CallActivityStatusCompleted = "completed"
+	CallActivityStatusFailed    = "failed"
+	CallActivityStatusCancelled = "cancelled"
+)
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// ExternalTask represents a service task executed by a worker that fetches and locks it over HTTP
+type ExternalTask struct {
+	Id            string                 `json:"id" db:"id"`
+	InstanceId    string                 `json:"instanceId" db:"instance_id"`
+	WorkflowId    string                 `json:"workflowId" db:"workflow_id"`
+	NodeId        string                 `json:"nodeId" db:"node_id"` // ServiceTask 节点 ID
+	Topic         string                 `json:"topic" db:"topic"`
+	Variables     map[string]interface{} `json:"variables" db:"variables"` // 创建任务时的流程变量
+	Status        string                 `json:"status" db:"status"`
+	WorkerId      string                 `json:"workerId,omitempty" db:"worker_id"`
+	LockExpiresAt *time.Time             `json:"lockExpiresAt,omitempty" db:"lock_expires_at"`
+	Retries       *int                   `json:"retries,omitempty" db:"retries"` // 工作者报告的剩余重试次数
+	ErrorMessage  string                 `json:"errorMessage,omitempty" db:"error_message"`
+	ErrorDetails  string                 `json:"errorDetails,omitempty" db:"error_details"`
+	CreatedAt     time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time              `json:"updatedAt" db:"updated_at"`
+}
+
+// ExternalTaskStatus constants
+const (
+	ExternalTaskStatusPending   = "pending"
+	ExternalTaskStatusCompleted = "completed"
+	ExternalTaskStatusFailed    = "failed" // 重试次数用尽，需要人工设置重试次数
+	ExternalTaskStatusCancelled = "cancelled"
+)
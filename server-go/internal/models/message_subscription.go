@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// MessageSubscription represents an instance waiting for a message at a message event
+type MessageSubscription struct {
+	Id          string                 `json:"id" db:"id"`
+	InstanceId  string                 `json:"instanceId" db:"instance_id"`
+	WorkflowId  string                 `json:"workflowId" db:"workflow_id"`
+	NodeId      string                 `json:"nodeId" db:"node_id"`            // 消息事件节点 ID
+	ScopeNodeId string                 `json:"scopeNodeId" db:"scope_node_id"` // 令牌所在节点 ID
+	MessageName string                 `json:"messageName" db:"message_name"`
+	BusinessKey string                 `json:"businessKey,omitempty" db:"business_key"`
+	Variables   map[string]interface{} `json:"variables" db:"variables"`
+	Status      string                 `json:"status" db:"status"`
+	CreatedAt   time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time              `json:"updatedAt" db:"updated_at"`
+}
+
+// MessageSubscriptionStatus constants
+const (
+	SubscriptionStatusPending    = "pending"
+	SubscriptionStatusCorrelated = "correlated"
+	SubscriptionStatusCancelled  = "cancelled"
+)
+
+// BusinessKeyVariable 流程变量中作为业务键的变量名，消息订阅创建时从该变量读取业务键
+const BusinessKeyVariable = "businessKey"
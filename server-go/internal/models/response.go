@@ -39,6 +39,19 @@ const (
 	ErrBoundaryEventNoAttachment = "BOUNDARY_EVENT_NO_ATTACHMENT"
 	ErrSkippedStep               = "SKIPPED_STEP"
 	ErrFallbackNotAllowed        = "FALLBACK_NOT_ALLOWED"
+	ErrMessageNotCorrelated      = "MESSAGE_NOT_CORRELATED"
+	ErrInstanceSuspended         = "INSTANCE_SUSPENDED"
+	ErrInvalidInstanceState      = "INVALID_INSTANCE_STATE"
+	ErrWorkflowVersionNotFound   = "WORKFLOW_VERSION_NOT_FOUND"
+	ErrInstanceVersionConflict   = "INSTANCE_VERSION_CONFLICT"
+	ErrUnhandledBpmnError        = "UNHANDLED_BPMN_ERROR"
+	ErrUserTaskNotFound          = "USER_TASK_NOT_FOUND"
+	ErrInvalidTaskState          = "INVALID_TASK_STATE"
+	ErrJobNotFound               = "JOB_NOT_FOUND"
+	ErrInvalidJobState           = "INVALID_JOB_STATE"
+	ErrExternalTaskNotFound      = "EXTERNAL_TASK_NOT_FOUND"
+	ErrInvalidExternalTaskState  = "INVALID_EXTERNAL_TASK_STATE"
+	ErrInvalidVariables          = "INVALID_VARIABLES"
 )
 
 // NewSuccessResponse creates a success response
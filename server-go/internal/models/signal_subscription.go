@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// SignalSubscription represents an instance waiting for a signal at a signal event
+type SignalSubscription struct {
+	Id          string                 `json:"id" db:"id"`
+	InstanceId  string                 `json:"instanceId" db:"instance_id"`
+	WorkflowId  string                 `json:"workflowId" db:"workflow_id"`
+	NodeId      string                 `json:"nodeId" db:"node_id"`            // 信号事件节点 ID
+	ScopeNodeId string                 `json:"scopeNodeId" db:"scope_node_id"` // 令牌所在节点 ID
+	SignalName  string                 `json:"signalName" db:"signal_name"`
+	Variables   map[string]interface{} `json:"variables" db:"variables"`
+	Status      string                 `json:"status" db:"status"`
+	CreatedAt   time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt   time.Time              `json:"updatedAt" db:"updated_at"`
+}
+
+// SubscriptionStatusTriggered 信号订阅已被广播认领，待定和取消状态与消息订阅共用
+const SubscriptionStatusTriggered = "triggered"
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// UserTask represents a human task created when a token reaches a userTask
+type UserTask struct {
+	Id              string                 `json:"id" db:"id"`
+	InstanceId      string                 `json:"instanceId" db:"instance_id"`
+	WorkflowId      string                 `json:"workflowId" db:"workflow_id"`
+	NodeId          string                 `json:"nodeId" db:"node_id"` // userTask 节点 ID
+	Name            string                 `json:"name" db:"name"`
+	Assignee        string                 `json:"assignee,omitempty" db:"assignee"` // 为空表示候选人均可认领
+	Owner           string                 `json:"owner,omitempty" db:"owner"`       // 委派前的处理人
+	CandidateUsers  []string               `json:"candidateUsers" db:"candidate_users"`
+	CandidateGroups []string               `json:"candidateGroups" db:"candidate_groups"`
+	DueDate         *time.Time             `json:"dueDate,omitempty" db:"due_date"`
+	Priority        int                    `json:"priority" db:"priority"`
+	FormKey         string                 `json:"formKey,omitempty" db:"form_key"`
+	Variables       map[string]interface{} `json:"variables" db:"variables"` // 创建任务时的流程变量
+	Status          string                 `json:"status" db:"status"`
+	CreatedAt       time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time              `json:"updatedAt" db:"updated_at"`
+}
+
+// UserTaskStatus constants
+const (
+	UserTaskStatusPending   = "pending"
+	UserTaskStatusCompleted = "completed"
+	UserTaskStatusCancelled = "cancelled"
+)
+
+// DefaultUserTaskPriority 未配置优先级时人工任务的优先级
+const DefaultUserTaskPriority = 50
@@ -0,0 +1,22 @@
+package models
+
+// ValidationIssue is a single problem found when validating a BPMN definition
+type ValidationIssue struct {
+	ElementId string `json:"elementId,omitempty"` // 出问题的 BPMN 元素 ID，文档级问题（如 XML 无法解析）为空
+	Severity  string `json:"severity"`
+	Rule      string `json:"rule"` // 规则代码，例如 UNREACHABLE_NODE
+	Message   string `json:"message"`
+}
+
+// ValidationReport lists every issue of a BPMN definition
+// Valid 为 false 表示至少存在一个 error 级别的问题；warning 只提示可能的建模错误
+type ValidationReport struct {
+	Valid  bool              `json:"valid"`
+	Issues []ValidationIssue `json:"issues"`
+}
+
+// ValidationSeverity constants
+const (
+	ValidationSeverityError   = "error"
+	ValidationSeverityWarning = "warning"
+)
@@ -38,6 +38,156 @@ type Node struct {
 	BusinessApiUrl          string   `json:"businessApiUrl,omitempty" db:"business_api_url"`  // ServiceTask 的业务接口 URL（从扩展属性解析）
 	AttachedNodeId          string   `json:"attachedNodeId,omitempty" db:"attached_node_id"` // BoundaryEvent 依附的节点 ID
 	CanFallback             bool     `json:"canFallback" db:"can_fallback"`                  // 是否允许回滚，默认 true
+	InputMappings           []VariableMapping `json:"inputMappings,omitempty" db:"input_mappings"`   // ServiceTask 输入映射：流程变量 -> 请求参数（CallActivity：父流程变量 -> 子流程变量）
+	OutputMappings          []VariableMapping `json:"outputMappings,omitempty" db:"output_mappings"` // ServiceTask 输出映射：响应 -> 流程变量（CallActivity：子流程变量 -> 父流程变量）
+	RetryPolicy             *RetryPolicy      `json:"retryPolicy,omitempty" db:"retry_policy"`       // ServiceTask 调用的重试策略，为空时只调用一次
+	TimerDefinition         *TimerDefinition  `json:"timerDefinition,omitempty" db:"timer_definition"` // 定时器事件定义（中间捕获事件、边界事件）
+	CancelActivity          bool              `json:"cancelActivity,omitempty" db:"cancel_activity"`   // 边界事件是否中断依附的节点，默认 true
+	MessageRef              string            `json:"messageRef,omitempty" db:"message_ref"`           // 消息事件引用的消息 ID（messageEventDefinition）
+	SignalRef               string            `json:"signalRef,omitempty" db:"signal_ref"`             // 信号事件引用的信号 ID（signalEventDefinition）
+	DefaultFlowId           string            `json:"defaultFlowId,omitempty" db:"default_flow_id"`    // 网关的默认出边（default 属性），没有条件满足时使用
+	ErrorDefinition         *ErrorDefinition  `json:"errorDefinition,omitempty" db:"error_definition"` // 错误事件定义（错误结束事件抛出、错误边界事件捕获）
+	ErrorMappings           []ErrorMapping    `json:"errorMappings,omitempty" db:"error_mappings"`     // ServiceTask 响应到业务错误码的映射
+	CompensationApiUrl      string            `json:"compensationApiUrl,omitempty" db:"compensation_api_url"`   // ServiceTask 的补偿接口 URL（xflow:compensation），用于撤销已完成任务的业务副作用
+	CompensateDefinition    *CompensateDefinition `json:"compensateDefinition,omitempty" db:"compensate_definition"` // 补偿抛出事件定义（中间抛出事件、结束事件）
+	MultiInstance           *MultiInstance        `json:"multiInstance,omitempty" db:"multi_instance"`               // 多实例（循环）配置（multiInstanceLoopCharacteristics），为空时只执行一次
+	Script                  *Script               `json:"script,omitempty" db:"script"`                              // ScriptTask 的脚本
+	CalledElement           *CalledElement        `json:"calledElement,omitempty" db:"called_element"`              // CallActivity 调用的流程
+	TaskAssignment          *TaskAssignment       `json:"taskAssignment,omitempty" db:"task_assignment"`            // UserTask 的处理人、候选人、期限、优先级和表单
+	AsyncBefore             bool                  `json:"asyncBefore,omitempty" db:"async_before"`                  // 执行前停下，由后台作业执行（xflow:asyncBefore）
+	AsyncAfter              bool                  `json:"asyncAfter,omitempty" db:"async_after"`                    // 执行后停下，由后台作业推进到后续节点（xflow:asyncAfter）
+	ExternalTopic           string                `json:"externalTopic,omitempty" db:"external_topic"`              // 外部任务的主题（type="external" 的 ServiceTask），由工作者拉取执行
+	ProcessId               string                `json:"processId,omitempty" db:"process_id"`                      // 节点所属的 process（协作图中每个泳池对应一个 process）
+	Lane                    *Lane                 `json:"lane,omitempty" db:"lane"`                                 // 节点所在的泳道，UserTask 没有配置处理人和候选人时由泳道的候选组认领
+}
+
+// Lane 泳道（从 process 的 laneSet 解析），嵌套泳道中的节点属于最内层的泳道
+type Lane struct {
+	Id   string `json:"id" db:"id"`
+	Name string `json:"name,omitempty" db:"name"`
+	// CandidateGroups 泳道上的 xflow:candidateGroups，未配置时为泳道名称
+	CandidateGroups []string `json:"candidateGroups,omitempty" db:"candidate_groups"`
+}
+
+// TaskAssignment UserTask 的人工任务配置（userTask 上的 xflow 属性或 xflow:task 扩展元素）
+// Assignee、CandidateUsers、CandidateGroups 和 DueDate 可以写成 ${expression}，创建任务时基于流程变量求值
+type TaskAssignment struct {
+	// Assignee 处理人，为空时由候选人认领
+	Assignee string `json:"assignee,omitempty" db:"assignee"`
+	// CandidateUsers 可以认领任务的用户
+	CandidateUsers []string `json:"candidateUsers,omitempty" db:"candidate_users"`
+	// CandidateGroups 可以认领任务的用户组
+	CandidateGroups []string `json:"candidateGroups,omitempty" db:"candidate_groups"`
+	// DueDate 期限：ISO-8601 时长（从任务创建开始计算）或 RFC3339 日期
+	DueDate string `json:"dueDate,omitempty" db:"due_date"`
+	// Priority 优先级，数值越大越优先
+	Priority int `json:"priority" db:"priority"`
+	// FormKey 处理任务时使用的表单标识
+	FormKey string `json:"formKey,omitempty" db:"form_key"`
+}
+
+// CalledElement CallActivity 调用的流程（calledElement 属性和 xflow:call 扩展元素）
+type CalledElement struct {
+	// WorkflowId 被调用流程的 ID
+	WorkflowId string `json:"workflowId" db:"workflow_id"`
+	// Version 固定调用的流程版本，0 表示启动子实例时流程的激活版本
+	Version int `json:"version,omitempty" db:"version"`
+}
+
+// Script ScriptTask 的脚本（expr 语法），在引擎内计算流程变量，不调用外部服务
+type Script struct {
+	// Source 脚本原文
+	Source string `json:"source" db:"source"`
+	// Assignments 脚本由逐行的 target = expression 组成时的赋值列表，按顺序执行；为空表示整个脚本是一个 expr 程序
+	Assignments []ScriptAssignment `json:"assignments,omitempty" db:"assignments"`
+	// ResultVariable 保存程序结果的变量名；为空时程序必须返回 map，其中的键值写入流程变量
+	ResultVariable string `json:"resultVariable,omitempty" db:"result_variable"`
+	// TimeoutMs 脚本执行超时时间（毫秒）
+	TimeoutMs int64 `json:"timeoutMs" db:"timeout_ms"`
+}
+
+// ScriptAssignment 脚本中的一条赋值
+type ScriptAssignment struct {
+	Target     string `json:"target" db:"target"`
+	Expression string `json:"expression" db:"expression"`
+}
+
+// MultiInstance 多实例活动配置（从 multiInstanceLoopCharacteristics 解析）
+// 每个实例使用独立的变量副本，元素变量和 loopCounter 只在实例内可见，输出按实例顺序聚合到 OutputCollection
+type MultiInstance struct {
+	// IsSequential 是否逐个执行实例；否则所有实例并行执行
+	IsSequential bool `json:"isSequential" db:"is_sequential"`
+	// Collection 集合表达式（expr 语法），基于流程变量求值，每个元素对应一个实例
+	Collection string `json:"collection,omitempty" db:"collection"`
+	// LoopCardinality 实例数量表达式，没有 Collection 时使用
+	LoopCardinality string `json:"loopCardinality,omitempty" db:"loop_cardinality"`
+	// ElementVariable 实例内保存当前元素的变量名
+	ElementVariable string `json:"elementVariable,omitempty" db:"element_variable"`
+	// CompletionCondition 完成条件（expr 语法），每个实例完成后求值，为真时不再执行剩余实例
+	CompletionCondition string `json:"completionCondition,omitempty" db:"completion_condition"`
+	// OutputElement 实例完成后基于实例变量求值的输出表达式
+	OutputElement string `json:"outputElement,omitempty" db:"output_element"`
+	// OutputCollection 保存所有实例输出的流程变量名
+	OutputCollection string `json:"outputCollection,omitempty" db:"output_collection"`
+}
+
+// CompensateDefinition 补偿事件定义（从 compensateEventDefinition 解析）
+type CompensateDefinition struct {
+	// ActivityRef 只补偿指定的任务，为空时补偿所在范围内所有已完成的任务
+	ActivityRef string `json:"activityRef,omitempty" db:"activity_ref"`
+}
+
+// ErrorDefinition 错误事件定义（从 errorEventDefinition 解析）
+type ErrorDefinition struct {
+	// ErrorRef 引用的 error 元素 ID，边界事件为空时捕获所有错误
+	ErrorRef string `json:"errorRef,omitempty" db:"error_ref"`
+	// ErrorCode 引用的 error 元素的错误码
+	ErrorCode string `json:"errorCode,omitempty" db:"error_code"`
+}
+
+// ErrorMapping ServiceTask 业务错误映射（从 xflow:error 扩展元素解析）
+type ErrorMapping struct {
+	// Code 抛出的错误码
+	Code string `json:"code" db:"code"`
+	// When 条件表达式（expr 语法），基于响应（statusCode、body、headers）求值
+	When string `json:"when" db:"when"`
+}
+
+// 定时器类型
+const (
+	TimerTypeDuration = "timeDuration" // 等待一段时间，如 P3D
+	TimerTypeDate     = "timeDate"     // 在指定时间点触发，如 2026-01-01T09:00:00Z
+	TimerTypeCycle    = "timeCycle"    // 周期触发，如 R3/PT1H
+)
+
+// TimerDefinition 定时器事件定义（从 timerEventDefinition 解析）
+type TimerDefinition struct {
+	// Type 定时器类型：timeDuration、timeDate、timeCycle
+	Type string `json:"type" db:"type"`
+	// Expression ISO-8601 表达式
+	Expression string `json:"expression" db:"expression"`
+}
+
+// RetryPolicy ServiceTask 调用的重试策略（从 xflow:retry 扩展元素解析）
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数（包含首次调用）
+	MaxAttempts int `json:"maxAttempts" db:"max_attempts"`
+	// TimeoutMs 单次调用超时时间（毫秒），0 表示使用默认 HTTP 客户端超时
+	TimeoutMs int64 `json:"timeoutMs,omitempty" db:"timeout_ms"`
+	// BackoffMs 首次重试前的等待时间（毫秒）
+	BackoffMs int64 `json:"backoffMs,omitempty" db:"backoff_ms"`
+	// BackoffMultiplier 每次重试后等待时间的放大倍数
+	BackoffMultiplier float64 `json:"backoffMultiplier,omitempty" db:"backoff_multiplier"`
+	// RetryableStatusCodes 需要重试的 HTTP 状态码，网络错误和超时总是会重试
+	RetryableStatusCodes []int `json:"retryableStatusCodes,omitempty" db:"retryable_status_codes"`
+}
+
+// VariableMapping 变量映射（从 xflow:input / xflow:output 扩展元素解析）
+type VariableMapping struct {
+	// Source 源表达式（expr 语法），输入映射基于流程变量求值，输出映射基于响应（statusCode、body、headers）求值
+	Source string `json:"source" db:"source"`
+	// Target 目标名称，输入映射为请求参数名，输出映射为流程变量名
+	Target string `json:"target" db:"target"`
 }
 
 // SequenceFlow 序列流
@@ -47,7 +197,14 @@ type SequenceFlow struct {
 	SourceNodeId      string `json:"sourceNodeId" db:"source_node_id"`
 	TargetNodeId      string `json:"targetNodeId" db:"target_node_id"`
 	ConditionExpression string `json:"conditionExpression,omitempty" db:"condition_expression"`
-	Priority          uint32 `json:"priority" db:"priority"`
+	Priority          uint32 `json:"priority" db:"priority"` // 网关求值顺序：数值小的优先，0 表示未设置，排在设置了优先级的出边之后
+}
+
+// Error 错误元素（definitions 下的 error 定义）
+type Error struct {
+	Id        string `json:"id" db:"id"`
+	Name      string `json:"name" db:"name"`
+	ErrorCode string `json:"errorCode" db:"error_code"`
 }
 
 // Message 消息元素（用于流程定义中的消息元素）
@@ -56,12 +213,54 @@ type Message struct {
 	Name string `json:"name" db:"name"`
 }
 
-// VariableDeclaration 变量声明
+// Signal 信号元素（definitions 下的 signal 定义），信号按名称广播给所有等待的实例
+type Signal struct {
+	Id   string `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+}
+
+// Participant 协作图中的参与者（泳池），ProcessId 为空表示不在本引擎执行的外部参与者（黑盒泳池）
+type Participant struct {
+	Id        string `json:"id" db:"id"`
+	Name      string `json:"name" db:"name"`
+	ProcessId string `json:"processId,omitempty" db:"process_id"`
+}
+
+// MessageFlow 泳池之间的消息流
+// 源节点完成时沿消息流发送消息：目标为开始事件时启动目标泳池的流程，为捕获事件时唤醒在该事件上等待的令牌；
+// 源或目标为参与者（黑盒泳池）时消息在引擎之外收发
+type MessageFlow struct {
+	Id         string `json:"id" db:"id"`
+	Name       string `json:"name,omitempty" db:"name"`
+	SourceRef  string `json:"sourceRef" db:"source_ref"` // 源节点或参与者 ID
+	TargetRef  string `json:"targetRef" db:"target_ref"` // 目标节点或参与者 ID
+	MessageRef string `json:"messageRef,omitempty" db:"message_ref"`
+}
+
+// 变量类型，取值与 google/protobuf/descriptor.h 的 FieldDescriptor::CppType 一致；0 表示未声明类型
+const (
+	VariableTypeInt32   uint32 = 1
+	VariableTypeInt64   uint32 = 2
+	VariableTypeUint32  uint32 = 3
+	VariableTypeUint64  uint32 = 4
+	VariableTypeDouble  uint32 = 5
+	VariableTypeFloat   uint32 = 6
+	VariableTypeBool    uint32 = 7
+	VariableTypeEnum    uint32 = 8
+	VariableTypeString  uint32 = 9
+	VariableTypeMessage uint32 = 10 // 对象（JSON object）
+)
+
+// VariableDeclaration 变量声明（从 process 的 xflow:declarations 扩展元素解析）
 type VariableDeclaration struct {
 	// Name 变量名
 	Name string `json:"name,omitempty" db:"name"`
 	// Type 类型，定义在google/protobuf/descriptor.h的FieldDescriptor::CppType
 	Type uint32 `json:"type,omitempty" db:"type"`
+	// Required 实例启动时必须提供（或有默认值）
+	Required bool `json:"required,omitempty" db:"required"`
+	// Default 启动时未提供变量时使用的默认值，已按 Type 转换
+	Default interface{} `json:"default,omitempty" db:"default"`
 }
 
 // ============================================================================
@@ -86,6 +285,18 @@ type WorkflowDefinition struct {
 
 	// 消息定义：message_id -> Message
 	Messages map[string]Message `json:"messages" db:"messages"`
+
+	// 错误定义：error_id -> Error
+	Errors map[string]Error `json:"errors" db:"errors"`
+
+	// 信号定义：signal_id -> Signal
+	Signals map[string]Signal `json:"signals" db:"signals"`
+
+	// 协作图的参与者（泳池）：participant_id -> Participant
+	Participants map[string]Participant `json:"participants,omitempty" db:"participants"`
+
+	// 泳池之间的消息流：message_flow_id -> MessageFlow
+	MessageFlows map[string]MessageFlow `json:"messageFlows,omitempty" db:"message_flows"`
 	// ============================================================================
 	// 变量声明
 	// ============================================================================
@@ -10,6 +10,7 @@ type WorkflowInstance struct {
 	Status          string    `json:"status" db:"status"`
 	CurrentNodeIds []string  `json:"currentNodeIds" db:"current_node_ids"`
 	InstanceVersion int       `json:"instanceVersion" db:"instance_version"`
+	WorkflowVersion int       `json:"workflowVersion,omitempty" db:"workflow_version"` // 实例固定的流程版本，0 表示未部署版本
 	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt       time.Time `json:"updatedAt" db:"updated_at"`
 }
@@ -21,5 +22,6 @@ const (
 	InstanceStatusCompleted = "completed"
 	InstanceStatusFailed    = "failed"
 	InstanceStatusCancelled = "cancelled"
+	InstanceStatusSuspended = "suspended"
 )
 
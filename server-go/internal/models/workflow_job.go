@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// WorkflowJob represents an asynchronous continuation of a workflow instance
+type WorkflowJob struct {
+	Id            string                 `json:"id" db:"id"`
+	InstanceId    string                 `json:"instanceId" db:"instance_id"`
+	WorkflowId    string                 `json:"workflowId" db:"workflow_id"`
+	NodeId        string                 `json:"nodeId" db:"node_id"`   // 令牌停留的节点 ID
+	JobType       string                 `json:"jobType" db:"job_type"` // async-before 或 async-after
+	Variables     map[string]interface{} `json:"variables" db:"variables"`
+	Status        string                 `json:"status" db:"status"`
+	Attempts      int                    `json:"attempts" db:"attempts"`
+	MaxAttempts   int                    `json:"maxAttempts" db:"max_attempts"`
+	DueAt         time.Time              `json:"dueAt" db:"due_at"`
+	LockOwner     string                 `json:"lockOwner,omitempty" db:"lock_owner"`
+	LockExpiresAt *time.Time             `json:"lockExpiresAt,omitempty" db:"lock_expires_at"`
+	LastError     string                 `json:"lastError,omitempty" db:"last_error"`
+	CreatedAt     time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time              `json:"updatedAt" db:"updated_at"`
+}
+
+// WorkflowJob type constants
+const (
+	JobTypeAsyncBefore = "async-before"
+	JobTypeAsyncAfter  = "async-after"
+)
+
+// WorkflowJobStatus constants
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusDead      = "dead" // 重试次数用尽，需要人工重试
+	JobStatusCancelled = "cancelled"
+)
+
+// DefaultJobMaxAttempts 作业默认最多执行次数
+const DefaultJobMaxAttempts = 3
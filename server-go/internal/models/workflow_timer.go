@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// WorkflowTimer represents a due timer of a timer catch event or timer boundary event
+type WorkflowTimer struct {
+	Id           string                 `json:"id" db:"id"`
+	InstanceId   string                 `json:"instanceId" db:"instance_id"`
+	WorkflowId   string                 `json:"workflowId" db:"workflow_id"`
+	NodeId       string                 `json:"nodeId" db:"node_id"`            // 定时器事件节点 ID
+	ScopeNodeId  string                 `json:"scopeNodeId" db:"scope_node_id"` // 令牌所在节点 ID
+	DueAt        time.Time              `json:"dueAt" db:"due_at"`
+	FireCount    int                    `json:"fireCount" db:"fire_count"`
+	Variables    map[string]interface{} `json:"variables" db:"variables"`
+	Status       string                 `json:"status" db:"status"`
+	ErrorMessage string                 `json:"errorMessage,omitempty" db:"error_message"`
+	CreatedAt    time.Time              `json:"createdAt" db:"created_at"`
+	UpdatedAt    time.Time              `json:"updatedAt" db:"updated_at"`
+}
+
+// WorkflowTimerStatus constants
+const (
+	TimerStatusPending   = "pending"
+	TimerStatusFiring    = "firing"
+	TimerStatusFired     = "fired"
+	TimerStatusCancelled = "cancelled"
+	TimerStatusFailed    = "failed"
+)
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// WorkflowVersion represents an immutable deployed snapshot of a workflow definition
+type WorkflowVersion struct {
+	Id         string              `json:"id" db:"id"`
+	WorkflowId string              `json:"workflowId" db:"workflow_id"`
+	Version    int                 `json:"version" db:"version"`
+	BpmnXml    string              `json:"bpmnXml" db:"bpmn_xml"`
+	Definition *WorkflowDefinition `json:"definition,omitempty" db:"definition"` // 部署时解析的流程定义快照
+	IsActive   bool                `json:"isActive" db:"is_active"`
+	CreatedAt  time.Time           `json:"createdAt" db:"created_at"`
+}
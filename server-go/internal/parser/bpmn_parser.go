@@ -3,7 +3,11 @@ package parser
 import (
 	"encoding/xml"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bpmn-explorer/server/internal/models"
 )
@@ -27,62 +31,118 @@ const (
 	NodeTypeEventBasedGateway       uint32 = 10
 	NodeTypeBoundaryEvent           uint32 = 11
 	NodeTypeTask                    uint32 = 12 // 普通 Task（抽象任务）
+	NodeTypeInclusiveGateway        uint32 = 13
+	NodeTypeScriptTask              uint32 = 14
+	NodeTypeCallActivity            uint32 = 15
 )
 
+// defaultScriptTimeout ScriptTask 未配置超时时间时的默认值
+const defaultScriptTimeout = time.Second
+
+// scriptAssignmentPattern 匹配 target = expression 形式的一行脚本（不匹配 == 比较）
+var scriptAssignmentPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*=([^=].*)$`)
+
 // XML 结构体定义，用于解析 BPMN XML
 // 注意：encoding/xml 使用本地名称（不带前缀），命名空间通过 XMLName 的 Space 字段处理
 
 type definitions struct {
 	XMLName xml.Name `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL definitions"`
-	Process process  `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL process"`
+	Processes     []process      `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL process"` // 协作图中每个泳池对应一个 process
+	Collaboration *collaboration `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL collaboration"`
+	Messages []message `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL message"` // 标准 BPMN 中消息定义在 definitions 下
+	Errors   []bpmnError `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL error"`
+	Signals  []signal    `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL signal"`
 }
 
 type process struct {
 	XMLName xml.Name `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL process"`
 	ID      string   `xml:"id,attr"`
 	Name    string   `xml:"name,attr"`
+	flowElements
+	Messages []message `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL message"`
+	LaneSets []laneSet `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL laneSet"`
+	ExtensionElements extensionElements `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL extensionElements"`
+}
+
+// flowElements 流程元素容器，process 和 subProcess 共用，支持子流程递归嵌套
+type flowElements struct {
 	// 支持多种节点类型
 	StartEvents              []startEvent              `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL startEvent"`
 	EndEvents                []endEvent                `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL endEvent"`
 	Tasks                    []task                    `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL task"`
 	UserTasks                []userTask                `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL userTask"`
 	ServiceTasks             []serviceTask             `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL serviceTask"`
+	ScriptTasks              []scriptTask              `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL scriptTask"`
+	CallActivities           []callActivity            `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL callActivity"`
 	ExclusiveGateways        []exclusiveGateway        `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL exclusiveGateway"`
 	ParallelGateways         []parallelGateway         `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL parallelGateway"`
+	InclusiveGateways        []inclusiveGateway        `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL inclusiveGateway"`
 	SubProcesses             []subProcess              `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL subProcess"`
 	IntermediateCatchEvents  []intermediateCatchEvent  `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL intermediateCatchEvent"`
+	IntermediateThrowEvents  []intermediateThrowEvent  `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL intermediateThrowEvent"`
 	EventBasedGateways       []eventBasedGateway       `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL eventBasedGateway"`
 	BoundaryEvents           []boundaryEvent           `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL boundaryEvent"`
 	SequenceFlows            []sequenceFlow            `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL sequenceFlow"`
-	Messages                 []message                 `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL message"`
 }
 
 type baseElement struct {
-	ID       string   `xml:"id,attr"`
-	Name     string   `xml:"name,attr"`
-	Incoming []string `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL incoming"`
-	Outgoing []string `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL outgoing"`
+	ID       string     `xml:"id,attr"`
+	Name     string     `xml:"name,attr"`
+	Incoming []string   `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL incoming"`
+	Outgoing []string   `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL outgoing"`
+	Attrs    []xml.Attr `xml:",any,attr"` // 其他属性，包括 xflow 扩展属性
 }
 
 type startEvent struct {
 	baseElement
+	SignalEventDefinition *signalEventDefinition `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL signalEventDefinition"`
 }
 
 type endEvent struct {
 	baseElement
+	ErrorEventDefinition      *errorEventDefinition      `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL errorEventDefinition"`
+	CompensateEventDefinition *compensateEventDefinition `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL compensateEventDefinition"`
+	SignalEventDefinition     *signalEventDefinition     `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL signalEventDefinition"`
 }
 
 type task struct {
 	baseElement
+	LoopCharacteristics *multiInstanceLoopCharacteristics `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL multiInstanceLoopCharacteristics"`
 }
 
 type userTask struct {
 	baseElement
+	ExtensionElements   extensionElements                 `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL extensionElements"`
+	LoopCharacteristics *multiInstanceLoopCharacteristics `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL multiInstanceLoopCharacteristics"`
 }
 
 type serviceTask struct {
 	baseElement
-	ExtensionElements extensionElements `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL extensionElements"`
+	ExtensionElements   extensionElements                 `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL extensionElements"`
+	LoopCharacteristics *multiInstanceLoopCharacteristics `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL multiInstanceLoopCharacteristics"`
+}
+
+type scriptTask struct {
+	baseElement
+	ScriptFormat        string                            `xml:"scriptFormat,attr"`
+	Script              string                            `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL script"`
+	ExtensionElements   extensionElements                 `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL extensionElements"`
+	LoopCharacteristics *multiInstanceLoopCharacteristics `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL multiInstanceLoopCharacteristics"`
+}
+
+type callActivity struct {
+	baseElement
+	CalledElement       string                            `xml:"calledElement,attr"`
+	ExtensionElements   extensionElements                 `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL extensionElements"`
+	LoopCharacteristics *multiInstanceLoopCharacteristics `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL multiInstanceLoopCharacteristics"`
+}
+
+// multiInstanceLoopCharacteristics 多实例配置，集合和输出通过 xflow:loop 扩展元素声明
+type multiInstanceLoopCharacteristics struct {
+	IsSequential        bool              `xml:"isSequential,attr"`
+	LoopCardinality     string            `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL loopCardinality"`
+	CompletionCondition string            `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL completionCondition"`
+	ExtensionElements   extensionElements `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL extensionElements"`
 }
 
 type extensionElements struct {
@@ -92,23 +152,76 @@ type extensionElements struct {
 type extensionValue struct {
 	XMLName xml.Name
 	Value   string `xml:"value,attr"`
-	Content string `xml:",chardata"`
+	Source  string `xml:"source,attr"`
+	Target  string     `xml:"target,attr"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",chardata"`
+	Children []extensionValue `xml:",any"` // 嵌套的扩展元素，例如 xflow:declarations 中的 xflow:declaration
+}
+
+// attr 返回扩展元素上指定名称的其他属性值
+func (e extensionValue) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return strings.TrimSpace(a.Value)
+		}
+	}
+	return ""
 }
 
 type exclusiveGateway struct {
 	baseElement
+	Default string `xml:"default,attr"`
 }
 
 type parallelGateway struct {
 	baseElement
 }
 
+type inclusiveGateway struct {
+	baseElement
+	Default string `xml:"default,attr"`
+}
+
 type subProcess struct {
 	baseElement
+	flowElements
+	LoopCharacteristics *multiInstanceLoopCharacteristics `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL multiInstanceLoopCharacteristics"`
 }
 
 type intermediateCatchEvent struct {
 	baseElement
+	TimerEventDefinition   *timerEventDefinition   `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL timerEventDefinition"`
+	MessageEventDefinition *messageEventDefinition `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL messageEventDefinition"`
+	SignalEventDefinition  *signalEventDefinition  `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL signalEventDefinition"`
+}
+
+type intermediateThrowEvent struct {
+	baseElement
+	CompensateEventDefinition *compensateEventDefinition `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL compensateEventDefinition"`
+	SignalEventDefinition     *signalEventDefinition     `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL signalEventDefinition"`
+}
+
+type compensateEventDefinition struct {
+	ActivityRef string `xml:"activityRef,attr"`
+}
+
+type messageEventDefinition struct {
+	MessageRef string `xml:"messageRef,attr"`
+}
+
+type signalEventDefinition struct {
+	SignalRef string `xml:"signalRef,attr"`
+}
+
+type errorEventDefinition struct {
+	ErrorRef string `xml:"errorRef,attr"`
+}
+
+type timerEventDefinition struct {
+	TimeDuration string `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL timeDuration"`
+	TimeDate     string `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL timeDate"`
+	TimeCycle    string `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL timeCycle"`
 }
 
 type eventBasedGateway struct {
@@ -117,8 +230,12 @@ type eventBasedGateway struct {
 
 type boundaryEvent struct {
 	baseElement
-	AttachedToRef string `xml:"attachedToRef,attr"`
-	CancelActivity bool   `xml:"cancelActivity,attr"`
+	AttachedToRef        string                `xml:"attachedToRef,attr"`
+	CancelActivity       string                `xml:"cancelActivity,attr"`
+	TimerEventDefinition   *timerEventDefinition   `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL timerEventDefinition"`
+	MessageEventDefinition *messageEventDefinition `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL messageEventDefinition"`
+	ErrorEventDefinition   *errorEventDefinition   `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL errorEventDefinition"`
+	SignalEventDefinition  *signalEventDefinition  `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL signalEventDefinition"`
 }
 
 type sequenceFlow struct {
@@ -143,26 +260,62 @@ type message struct {
 	Name    string   `xml:"name,attr"`
 }
 
+type signal struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name,attr"`
+}
+
+type bpmnError struct {
+	ID        string `xml:"id,attr"`
+	Name      string `xml:"name,attr"`
+	ErrorCode string `xml:"errorCode,attr"`
+}
+
 // ParseBPMN 解析 BPMN XML 内容并返回 WorkflowDefinition
+// 遇到问题时返回第一个错误，需要完整的问题列表时使用 Validate
 func ParseBPMN(bpmnContent string) (*models.WorkflowDefinition, error) {
+	c := &issueCollector{}
+	wd, _ := buildDefinition(bpmnContent, c)
+	if c.firstErr != nil {
+		return nil, c.firstErr
+	}
+	return wd, nil
+}
+
+// buildDefinition 解析 BPMN XML 并构建 WorkflowDefinition，问题记录到 c 中
+// XML 无法解析或缺少 process 元素时返回 nil；其余问题不中断构建，返回的定义和解析出的 XML 结构可继续用于校验
+func buildDefinition(bpmnContent string, c *issueCollector) (*models.WorkflowDefinition, *definitions) {
 	if strings.TrimSpace(bpmnContent) == "" {
-		return nil, fmt.Errorf("BPMN content is empty")
+		c.addError("", RuleInvalidXML, fmt.Errorf("BPMN content is empty"))
+		return nil, nil
 	}
 
 	var def definitions
 	if err := xml.Unmarshal([]byte(bpmnContent), &def); err != nil {
-		return nil, fmt.Errorf("failed to parse XML: %w", err)
+		c.addError("", RuleInvalidXML, fmt.Errorf("failed to parse XML: %w", err))
+		return nil, nil
 	}
 
 	// 检查是否有 process 元素
-	if def.Process.ID == "" {
-		return nil, fmt.Errorf("missing required element: process")
+	if len(def.Processes) == 0 {
+		c.addError("", RuleMissingProcess, fmt.Errorf("missing required element: process"))
+		return nil, nil
+	}
+	for _, proc := range def.Processes {
+		if proc.ID == "" {
+			c.addError("", RuleMissingProcess, fmt.Errorf("missing required element: process"))
+			return nil, nil
+		}
 	}
 
 	wd := &models.WorkflowDefinition{
 		Nodes:              make(map[string]models.Node),
 		SequenceFlows:      make(map[string]models.SequenceFlow),
 		Messages:           make(map[string]models.Message),
+		Errors:             make(map[string]models.Error),
+		Signals:            make(map[string]models.Signal),
+		Participants:       make(map[string]models.Participant),
+		MessageFlows:       make(map[string]models.MessageFlow),
 		StartEvents:        []string{},
 		EndEvents:          []string{},
 		VariableDeclarations: []models.VariableDeclaration{},
@@ -170,41 +323,71 @@ func ParseBPMN(bpmnContent string) (*models.WorkflowDefinition, error) {
 		ReverseAdjacencyList: make(map[string][]string),
 	}
 
-	// 解析节点
-	parseNodes(&def.Process, wd)
+	// 解析错误定义（错误事件解析时需要引用其错误码）
+	parseErrors(def.Errors, wd)
+
+	// 解析信号定义（信号事件解析时需要引用其名称）
+	parseSignals(def.Signals, wd)
 
-	// 解析序列流
-	parseSequenceFlows(&def.Process, wd)
+	// 解析每个 process 的节点（递归解析子流程内部元素）、序列流、消息和泳道
+	for i := range def.Processes {
+		proc := &def.Processes[i]
+		parseNodes(&proc.flowElements, proc.ID, "", wd, c)
+		parseSequenceFlows(&proc.flowElements, wd)
+		parseMessages(proc.Messages, wd)
+		parseLanes(proc.LaneSets, wd, c)
+		parseVariableDeclarations(proc, wd, c)
+	}
 
 	// 解析消息
-	parseMessages(&def.Process, wd)
+	parseMessages(def.Messages, wd)
+
+	// 解析协作图的参与者和消息流（需要引用已解析的节点）
+	parseCollaboration(def.Collaboration, wd, c)
 
 	// 构建邻接表
 	buildAdjacencyLists(wd)
 
 	// 验证 UserTask 约束
-	if err := validateUserTaskConstraints(wd); err != nil {
-		return nil, err
-	}
+	validateUserTaskConstraints(wd, c)
+
+	// 验证网关的默认出边
+	validateGatewayFlows(wd, c)
+
+	// 验证补偿事件引用的任务
+	validateCompensateEvents(wd, c)
 
 	// 识别开始和结束事件
 	identifyStartAndEndEvents(wd)
 
-	return wd, nil
+	return wd, &def
 }
 
 // parseNodes 解析所有节点
-func parseNodes(proc *process, wd *models.WorkflowDefinition) {
+// processId 为节点所属 process 的 ID，parentId 为节点所属子流程的 ID，顶层流程的节点 parentId 为空
+// 元素配置有误时记录到 c 中并继续解析，节点仍然加入 wd，以便校验报告检查其余规则
+func parseNodes(proc *flowElements, processId, parentId string, wd *models.WorkflowDefinition, c *issueCollector) {
 	// 解析开始事件
 	for _, se := range proc.StartEvents {
 		node := models.Node{
 			Id:                      se.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    se.Name,
 			Type:                    NodeTypeStartEvent,
 			IncomingSequenceFlowIds: se.Incoming,
 			OutgoingSequenceFlowIds: se.Outgoing,
 			CanFallback:             true,
 		}
+		// 信号开始事件：收到广播的信号时启动新实例，只能定义在顶层流程中
+		signalRef, err := parseSignalRef(se.SignalEventDefinition, wd)
+		if err != nil {
+			c.addError(se.ID, RuleInvalidElement, fmt.Errorf("invalid signal on StartEvent %s: %w", se.ID, err))
+		}
+		if signalRef != "" && parentId != "" {
+			c.addError(se.ID, RuleInvalidElement, fmt.Errorf("signal StartEvent %s is not supported inside SubProcess %s", se.ID, parentId))
+		}
+		node.SignalRef = signalRef
 		wd.Nodes[node.Id] = node
 	}
 
@@ -212,12 +395,28 @@ func parseNodes(proc *process, wd *models.WorkflowDefinition) {
 	for _, ee := range proc.EndEvents {
 		node := models.Node{
 			Id:                      ee.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    ee.Name,
 			Type:                    NodeTypeEndEvent,
 			IncomingSequenceFlowIds: ee.Incoming,
 			OutgoingSequenceFlowIds: ee.Outgoing,
 			CanFallback:             true,
 		}
+		// 错误结束事件：到达时抛出错误
+		errorDef, err := parseErrorDefinition(ee.ErrorEventDefinition, wd)
+		if err != nil {
+			c.addError(ee.ID, RuleInvalidElement, fmt.Errorf("invalid error on EndEvent %s: %w", ee.ID, err))
+		}
+		node.ErrorDefinition = errorDef
+		// 补偿结束事件：到达时补偿已完成的任务
+		if ee.CompensateEventDefinition != nil {
+			node.CompensateDefinition = &models.CompensateDefinition{ActivityRef: ee.CompensateEventDefinition.ActivityRef}
+		}
+		// 信号结束事件：到达时广播信号
+		if node.SignalRef, err = parseSignalRef(ee.SignalEventDefinition, wd); err != nil {
+			c.addError(ee.ID, RuleInvalidElement, fmt.Errorf("invalid signal on EndEvent %s: %w", ee.ID, err))
+		}
 		wd.Nodes[node.Id] = node
 	}
 
@@ -225,12 +424,22 @@ func parseNodes(proc *process, wd *models.WorkflowDefinition) {
 	for _, t := range proc.Tasks {
 		node := models.Node{
 			Id:                      t.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    t.Name,
 			Type:                    NodeTypeTask,
 			IncomingSequenceFlowIds: t.Incoming,
 			OutgoingSequenceFlowIds: t.Outgoing,
 			CanFallback:             true,
 		}
+		multiInstance, err := parseMultiInstance(t.LoopCharacteristics)
+		if err != nil {
+			c.addError(t.ID, RuleInvalidElement, fmt.Errorf("invalid multi-instance on Task %s: %w", t.ID, err))
+		}
+		node.MultiInstance = multiInstance
+		if err := parseAsyncContinuation(&node, t.Attrs); err != nil {
+			c.addError(t.ID, RuleInvalidElement, fmt.Errorf("invalid async continuation on Task %s: %w", t.ID, err))
+		}
 		wd.Nodes[node.Id] = node
 	}
 
@@ -238,12 +447,26 @@ func parseNodes(proc *process, wd *models.WorkflowDefinition) {
 	for _, ut := range proc.UserTasks {
 		node := models.Node{
 			Id:                      ut.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    ut.Name,
 			Type:                    NodeTypeUserTask,
 			IncomingSequenceFlowIds: ut.Incoming,
 			OutgoingSequenceFlowIds: ut.Outgoing,
 			CanFallback:             true,
 		}
+		// 多实例在一次执行内完成所有实例，等待人工处理的任务无法做到
+		if ut.LoopCharacteristics != nil {
+			c.addError(ut.ID, RuleInvalidElement, fmt.Errorf("multi-instance is not supported on UserTask %s", ut.ID))
+		}
+		assignment, err := parseTaskAssignment(ut)
+		if err != nil {
+			c.addError(ut.ID, RuleInvalidElement, fmt.Errorf("invalid task assignment on UserTask %s: %w", ut.ID, err))
+		}
+		node.TaskAssignment = assignment
+		if err := parseAsyncContinuation(&node, ut.Attrs); err != nil {
+			c.addError(ut.ID, RuleInvalidElement, fmt.Errorf("invalid async continuation on UserTask %s: %w", ut.ID, err))
+		}
 		wd.Nodes[node.Id] = node
 	}
 
@@ -251,28 +474,132 @@ func parseNodes(proc *process, wd *models.WorkflowDefinition) {
 	for _, st := range proc.ServiceTasks {
 		node := models.Node{
 			Id:                      st.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    st.Name,
 			Type:                    NodeTypeServiceTask,
 			IncomingSequenceFlowIds: st.Incoming,
 			OutgoingSequenceFlowIds: st.Outgoing,
 			CanFallback:             true,
 		}
-		// 从扩展属性中提取业务接口 URL
-		if len(st.ExtensionElements.Values) > 0 {
-			for _, ext := range st.ExtensionElements.Values {
-				// 查找 xflow:Url 或 url 元素
-				localName := ext.XMLName.Local
-				if localName == "url" || localName == "Url" || strings.HasSuffix(ext.XMLName.Space, "xflow-extension") {
-					// 优先使用 value 属性，如果没有则使用内容
-					if ext.Value != "" {
-						node.BusinessApiUrl = ext.Value
-					} else if ext.Content != "" {
-						node.BusinessApiUrl = strings.TrimSpace(ext.Content)
-					}
-					break
+		// 从扩展属性中提取业务接口 URL 和变量映射
+		for _, ext := range st.ExtensionElements.Values {
+			localName := ext.XMLName.Local
+			switch {
+			case localName == "input":
+				// xflow:input 将流程变量映射为请求参数
+				node.InputMappings = append(node.InputMappings, models.VariableMapping{Source: ext.Source, Target: ext.Target})
+			case localName == "output":
+				// xflow:output 将响应映射为流程变量
+				node.OutputMappings = append(node.OutputMappings, models.VariableMapping{Source: ext.Source, Target: ext.Target})
+			case localName == "error":
+				// xflow:error 将响应映射为业务错误码，例如 <xflow:error code="PAYMENT_DECLINED" when="statusCode == 402"/>
+				mapping := models.ErrorMapping{Code: ext.attr("code"), When: ext.attr("when")}
+				if mapping.Code == "" || mapping.When == "" {
+					c.addError(st.ID, RuleInvalidElement, fmt.Errorf("xflow:error on ServiceTask %s requires code and when", st.ID))
+					continue
+				}
+				node.ErrorMappings = append(node.ErrorMappings, mapping)
+			case localName == "compensation":
+				// xflow:compensation 定义撤销本任务业务副作用的补偿接口
+				if ext.Value != "" {
+					node.CompensationApiUrl = ext.Value
+				} else {
+					node.CompensationApiUrl = strings.TrimSpace(ext.Content)
+				}
+			case localName == "retry":
+				// xflow:retry 定义调用失败时的重试、退避和超时策略
+				policy, err := parseRetryPolicy(ext)
+				if err != nil {
+					c.addError(st.ID, RuleInvalidElement, fmt.Errorf("invalid retry policy on ServiceTask %s: %w", st.ID, err))
+				}
+				node.RetryPolicy = policy
+			case node.BusinessApiUrl == "" &&
+				(localName == "url" || localName == "Url" || strings.HasSuffix(ext.XMLName.Space, "xflow-extension")):
+				// 查找 xflow:Url 或 url 元素，优先使用 value 属性，如果没有则使用内容
+				if ext.Value != "" {
+					node.BusinessApiUrl = ext.Value
+				} else if ext.Content != "" {
+					node.BusinessApiUrl = strings.TrimSpace(ext.Content)
 				}
 			}
 		}
+		multiInstance, err := parseMultiInstance(st.LoopCharacteristics)
+		if err != nil {
+			c.addError(st.ID, RuleInvalidElement, fmt.Errorf("invalid multi-instance on ServiceTask %s: %w", st.ID, err))
+		}
+		node.MultiInstance = multiInstance
+		if err := parseExternalTask(&node, st.Attrs); err != nil {
+			c.addError(st.ID, RuleInvalidElement, fmt.Errorf("invalid external task on ServiceTask %s: %w", st.ID, err))
+		}
+		if err := parseAsyncContinuation(&node, st.Attrs); err != nil {
+			c.addError(st.ID, RuleInvalidElement, fmt.Errorf("invalid async continuation on ServiceTask %s: %w", st.ID, err))
+		}
+		wd.Nodes[node.Id] = node
+	}
+
+	// 解析脚本任务
+	for _, st := range proc.ScriptTasks {
+		node := models.Node{
+			Id:                      st.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
+			Name:                    st.Name,
+			Type:                    NodeTypeScriptTask,
+			IncomingSequenceFlowIds: st.Incoming,
+			OutgoingSequenceFlowIds: st.Outgoing,
+			CanFallback:             true,
+		}
+		script, err := parseScript(st)
+		if err != nil {
+			c.addError(st.ID, RuleInvalidElement, fmt.Errorf("invalid script on ScriptTask %s: %w", st.ID, err))
+		}
+		node.Script = script
+		multiInstance, err := parseMultiInstance(st.LoopCharacteristics)
+		if err != nil {
+			c.addError(st.ID, RuleInvalidElement, fmt.Errorf("invalid multi-instance on ScriptTask %s: %w", st.ID, err))
+		}
+		node.MultiInstance = multiInstance
+		if err := parseAsyncContinuation(&node, st.Attrs); err != nil {
+			c.addError(st.ID, RuleInvalidElement, fmt.Errorf("invalid async continuation on ScriptTask %s: %w", st.ID, err))
+		}
+		wd.Nodes[node.Id] = node
+	}
+
+	// 解析调用活动
+	for _, ca := range proc.CallActivities {
+		node := models.Node{
+			Id:                      ca.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
+			Name:                    ca.Name,
+			Type:                    NodeTypeCallActivity,
+			IncomingSequenceFlowIds: ca.Incoming,
+			OutgoingSequenceFlowIds: ca.Outgoing,
+			CanFallback:             true,
+		}
+		// 调用活动等待子实例结束，多实例无法在一次执行内完成
+		if ca.LoopCharacteristics != nil {
+			c.addError(ca.ID, RuleInvalidElement, fmt.Errorf("multi-instance is not supported on CallActivity %s", ca.ID))
+		}
+		calledElement, err := parseCalledElement(ca)
+		if err != nil {
+			c.addError(ca.ID, RuleInvalidElement, fmt.Errorf("invalid calledElement on CallActivity %s: %w", ca.ID, err))
+		}
+		node.CalledElement = calledElement
+		for _, ext := range ca.ExtensionElements.Values {
+			switch ext.XMLName.Local {
+			case "input":
+				// xflow:input 将父流程变量映射为子流程的初始变量
+				node.InputMappings = append(node.InputMappings, models.VariableMapping{Source: ext.Source, Target: ext.Target})
+			case "output":
+				// xflow:output 将子流程结束时的变量映射回父流程变量
+				node.OutputMappings = append(node.OutputMappings, models.VariableMapping{Source: ext.Source, Target: ext.Target})
+			}
+		}
+		if err := parseAsyncContinuation(&node, ca.Attrs); err != nil {
+			c.addError(ca.ID, RuleInvalidElement, fmt.Errorf("invalid async continuation on CallActivity %s: %w", ca.ID, err))
+		}
 		wd.Nodes[node.Id] = node
 	}
 
@@ -280,11 +607,14 @@ func parseNodes(proc *process, wd *models.WorkflowDefinition) {
 	for _, eg := range proc.ExclusiveGateways {
 		node := models.Node{
 			Id:                      eg.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    eg.Name,
 			Type:                    NodeTypeExclusiveGateway,
 			IncomingSequenceFlowIds: eg.Incoming,
 			OutgoingSequenceFlowIds: eg.Outgoing,
 			CanFallback:             true,
+			DefaultFlowId:           eg.Default,
 		}
 		wd.Nodes[node.Id] = node
 	}
@@ -293,6 +623,8 @@ func parseNodes(proc *process, wd *models.WorkflowDefinition) {
 	for _, pg := range proc.ParallelGateways {
 		node := models.Node{
 			Id:                      pg.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    pg.Name,
 			Type:                    NodeTypeParallelGateway,
 			IncomingSequenceFlowIds: pg.Incoming,
@@ -302,29 +634,91 @@ func parseNodes(proc *process, wd *models.WorkflowDefinition) {
 		wd.Nodes[node.Id] = node
 	}
 
+	// 解析包容网关
+	for _, ig := range proc.InclusiveGateways {
+		node := models.Node{
+			Id:                      ig.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
+			Name:                    ig.Name,
+			Type:                    NodeTypeInclusiveGateway,
+			IncomingSequenceFlowIds: ig.Incoming,
+			OutgoingSequenceFlowIds: ig.Outgoing,
+			CanFallback:             true,
+			DefaultFlowId:           ig.Default,
+		}
+		wd.Nodes[node.Id] = node
+	}
+
 	// 解析子流程
 	for _, sp := range proc.SubProcesses {
 		node := models.Node{
 			Id:                      sp.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    sp.Name,
 			Type:                    NodeTypeSubProcess,
 			IncomingSequenceFlowIds: sp.Incoming,
 			OutgoingSequenceFlowIds: sp.Outgoing,
 			CanFallback:             true,
 		}
+		multiInstance, err := parseMultiInstance(sp.LoopCharacteristics)
+		if err != nil {
+			c.addError(sp.ID, RuleInvalidElement, fmt.Errorf("invalid multi-instance on SubProcess %s: %w", sp.ID, err))
+		}
+		node.MultiInstance = multiInstance
 		wd.Nodes[node.Id] = node
+
+		// 递归解析子流程内部的节点
+		parseNodes(&sp.flowElements, processId, sp.ID, wd, c)
 	}
 
 	// 解析中间捕获事件
 	for _, ice := range proc.IntermediateCatchEvents {
 		node := models.Node{
 			Id:                      ice.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    ice.Name,
 			Type:                    NodeTypeIntermediateCatchEvent,
 			IncomingSequenceFlowIds: ice.Incoming,
 			OutgoingSequenceFlowIds: ice.Outgoing,
 			CanFallback:             true,
 		}
+		timer, err := parseTimerDefinition(ice.TimerEventDefinition)
+		if err != nil {
+			c.addError(ice.ID, RuleInvalidElement, fmt.Errorf("invalid timer on IntermediateCatchEvent %s: %w", ice.ID, err))
+		}
+		node.TimerDefinition = timer
+		if ice.MessageEventDefinition != nil {
+			node.MessageRef = ice.MessageEventDefinition.MessageRef
+		}
+		if node.SignalRef, err = parseSignalRef(ice.SignalEventDefinition, wd); err != nil {
+			c.addError(ice.ID, RuleInvalidElement, fmt.Errorf("invalid signal on IntermediateCatchEvent %s: %w", ice.ID, err))
+		}
+		wd.Nodes[node.Id] = node
+	}
+
+	// 解析中间抛出事件
+	for _, ite := range proc.IntermediateThrowEvents {
+		node := models.Node{
+			Id:                      ite.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
+			Name:                    ite.Name,
+			Type:                    NodeTypeIntermediateEvent,
+			IncomingSequenceFlowIds: ite.Incoming,
+			OutgoingSequenceFlowIds: ite.Outgoing,
+			CanFallback:             true,
+		}
+		if ite.CompensateEventDefinition != nil {
+			node.CompensateDefinition = &models.CompensateDefinition{ActivityRef: ite.CompensateEventDefinition.ActivityRef}
+		}
+		signalRef, err := parseSignalRef(ite.SignalEventDefinition, wd)
+		if err != nil {
+			c.addError(ite.ID, RuleInvalidElement, fmt.Errorf("invalid signal on IntermediateThrowEvent %s: %w", ite.ID, err))
+		}
+		node.SignalRef = signalRef
 		wd.Nodes[node.Id] = node
 	}
 
@@ -332,6 +726,8 @@ func parseNodes(proc *process, wd *models.WorkflowDefinition) {
 	for _, ebg := range proc.EventBasedGateways {
 		node := models.Node{
 			Id:                      ebg.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    ebg.Name,
 			Type:                    NodeTypeEventBasedGateway,
 			IncomingSequenceFlowIds: ebg.Incoming,
@@ -345,19 +741,400 @@ func parseNodes(proc *process, wd *models.WorkflowDefinition) {
 	for _, be := range proc.BoundaryEvents {
 		node := models.Node{
 			Id:                      be.ID,
+			ParentId:                parentId,
+			ProcessId:               processId,
 			Name:                    be.Name,
 			Type:                    NodeTypeBoundaryEvent,
 			IncomingSequenceFlowIds: be.Incoming,
 			OutgoingSequenceFlowIds: be.Outgoing,
 			AttachedNodeId:          be.AttachedToRef,
 			CanFallback:             true,
+			CancelActivity:          be.CancelActivity != "false", // BPMN 默认中断依附的节点
+		}
+		timer, err := parseTimerDefinition(be.TimerEventDefinition)
+		if err != nil {
+			c.addError(be.ID, RuleInvalidElement, fmt.Errorf("invalid timer on BoundaryEvent %s: %w", be.ID, err))
+		}
+		node.TimerDefinition = timer
+		if be.MessageEventDefinition != nil {
+			node.MessageRef = be.MessageEventDefinition.MessageRef
+		}
+		if node.SignalRef, err = parseSignalRef(be.SignalEventDefinition, wd); err != nil {
+			c.addError(be.ID, RuleInvalidElement, fmt.Errorf("invalid signal on BoundaryEvent %s: %w", be.ID, err))
+		}
+		errorDef, err := parseErrorDefinition(be.ErrorEventDefinition, wd)
+		if err != nil {
+			c.addError(be.ID, RuleInvalidElement, fmt.Errorf("invalid error on BoundaryEvent %s: %w", be.ID, err))
+		}
+		if errorDef != nil {
+			// 错误边界事件总是中断依附的节点
+			node.ErrorDefinition = errorDef
+			node.CancelActivity = true
 		}
 		wd.Nodes[node.Id] = node
 	}
 }
 
-// parseSequenceFlows 解析序列流
-func parseSequenceFlows(proc *process, wd *models.WorkflowDefinition) {
+// parseErrorDefinition 解析 errorEventDefinition，并解析引用的 error 元素的错误码
+// 没有 errorCode 的 error 元素使用其 ID 作为错误码
+func parseErrorDefinition(def *errorEventDefinition, wd *models.WorkflowDefinition) (*models.ErrorDefinition, error) {
+	if def == nil {
+		return nil, nil
+	}
+
+	errorDef := &models.ErrorDefinition{ErrorRef: def.ErrorRef}
+	if def.ErrorRef == "" {
+		return errorDef, nil
+	}
+	bpmnErr, exists := wd.Errors[def.ErrorRef]
+	if !exists {
+		return nil, fmt.Errorf("error %s not found", def.ErrorRef)
+	}
+	errorDef.ErrorCode = bpmnErr.ErrorCode
+	if errorDef.ErrorCode == "" {
+		errorDef.ErrorCode = bpmnErr.Id
+	}
+	return errorDef, nil
+}
+
+// parseSignalRef 解析 signalEventDefinition 引用的信号 ID，引用的 signal 元素必须存在
+func parseSignalRef(def *signalEventDefinition, wd *models.WorkflowDefinition) (string, error) {
+	if def == nil {
+		return "", nil
+	}
+	if def.SignalRef == "" {
+		return "", fmt.Errorf("signalEventDefinition requires signalRef")
+	}
+	if _, exists := wd.Signals[def.SignalRef]; !exists {
+		return "", fmt.Errorf("signal %s not found", def.SignalRef)
+	}
+	return def.SignalRef, nil
+}
+
+// parseTimerDefinition 解析 timerEventDefinition，并校验 ISO-8601 表达式
+func parseTimerDefinition(def *timerEventDefinition) (*models.TimerDefinition, error) {
+	if def == nil {
+		return nil, nil
+	}
+
+	var timer *models.TimerDefinition
+	switch {
+	case strings.TrimSpace(def.TimeDuration) != "":
+		timer = &models.TimerDefinition{Type: models.TimerTypeDuration, Expression: strings.TrimSpace(def.TimeDuration)}
+	case strings.TrimSpace(def.TimeDate) != "":
+		timer = &models.TimerDefinition{Type: models.TimerTypeDate, Expression: strings.TrimSpace(def.TimeDate)}
+	case strings.TrimSpace(def.TimeCycle) != "":
+		timer = &models.TimerDefinition{Type: models.TimerTypeCycle, Expression: strings.TrimSpace(def.TimeCycle)}
+	default:
+		return nil, fmt.Errorf("timerEventDefinition requires timeDuration, timeDate or timeCycle")
+	}
+
+	if _, err := TimerDueDate(timer, time.Now()); err != nil {
+		return nil, err
+	}
+	return timer, nil
+}
+
+// parseRetryPolicy 解析 xflow:retry 扩展元素
+// 例如 <xflow:retry maxAttempts="3" timeout="PT5S" backoff="500ms" backoffMultiplier="2" retryableStatusCodes="502,503,504"/>
+func parseRetryPolicy(ext extensionValue) (*models.RetryPolicy, error) {
+	policy := &models.RetryPolicy{
+		MaxAttempts:       1,
+		BackoffMultiplier: 1,
+	}
+
+	if v := ext.attr("maxAttempts"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("maxAttempts must be a positive integer, got %q", v)
+		}
+		policy.MaxAttempts = n
+	}
+
+	if v := ext.attr("timeout"); v != "" {
+		d, err := ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("timeout: %w", err)
+		}
+		policy.TimeoutMs = d.Milliseconds()
+	}
+
+	if v := ext.attr("backoff"); v != "" {
+		d, err := ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("backoff: %w", err)
+		}
+		policy.BackoffMs = d.Milliseconds()
+	}
+
+	if v := ext.attr("backoffMultiplier"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 1 {
+			return nil, fmt.Errorf("backoffMultiplier must be a number >= 1, got %q", v)
+		}
+		policy.BackoffMultiplier = f
+	}
+
+	if v := ext.attr("retryableStatusCodes"); v != "" {
+		for _, part := range strings.Split(v, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || code < 100 || code > 599 {
+				return nil, fmt.Errorf("invalid retryable status code %q", part)
+			}
+			policy.RetryableStatusCodes = append(policy.RetryableStatusCodes, code)
+		}
+	}
+
+	return policy, nil
+}
+
+// parseScript 解析 ScriptTask 的脚本和 xflow:script 扩展元素
+// 例如 <xflow:script resultVariable="total" timeout="500ms"/>；每一行都是 target = expression 时按赋值列表执行
+func parseScript(st scriptTask) (*models.Script, error) {
+	if st.ScriptFormat != "" && !strings.EqualFold(st.ScriptFormat, "expr") {
+		return nil, fmt.Errorf("unsupported scriptFormat %q, only expr is supported", st.ScriptFormat)
+	}
+
+	script := &models.Script{
+		Source:    strings.TrimSpace(st.Script),
+		TimeoutMs: defaultScriptTimeout.Milliseconds(),
+	}
+	if script.Source == "" {
+		return nil, fmt.Errorf("script is empty")
+	}
+
+	for _, ext := range st.ExtensionElements.Values {
+		if ext.XMLName.Local != "script" {
+			continue
+		}
+		script.ResultVariable = ext.attr("resultVariable")
+		if v := ext.attr("timeout"); v != "" {
+			d, err := ParseDuration(v)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("timeout must be a positive duration, got %q", v)
+			}
+			script.TimeoutMs = d.Milliseconds()
+		}
+	}
+
+	var assignments []models.ScriptAssignment
+	for _, line := range strings.Split(script.Source, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		match := scriptAssignmentPattern.FindStringSubmatch(line)
+		if match == nil {
+			// 不是赋值列表，整个脚本作为一个程序执行
+			assignments = nil
+			break
+		}
+		assignments = append(assignments, models.ScriptAssignment{Target: match[1], Expression: strings.TrimSpace(match[2])})
+	}
+	script.Assignments = assignments
+
+	if len(script.Assignments) > 0 && script.ResultVariable != "" {
+		return nil, fmt.Errorf("resultVariable cannot be used with target = expression assignments")
+	}
+	return script, nil
+}
+
+// parseCalledElement 解析调用活动引用的流程
+// calledElement 为被调用流程的 ID，可通过 <xflow:call version="3"/> 固定调用的流程版本
+func parseCalledElement(ca callActivity) (*models.CalledElement, error) {
+	calledElement := &models.CalledElement{WorkflowId: strings.TrimSpace(ca.CalledElement)}
+	if calledElement.WorkflowId == "" {
+		return nil, fmt.Errorf("calledElement is required")
+	}
+
+	for _, ext := range ca.ExtensionElements.Values {
+		if ext.XMLName.Local != "call" {
+			continue
+		}
+		if v := ext.attr("version"); v != "" {
+			version, err := strconv.Atoi(v)
+			if err != nil || version <= 0 {
+				return nil, fmt.Errorf("version must be a positive integer, got %q", v)
+			}
+			calledElement.Version = version
+		}
+	}
+	return calledElement, nil
+}
+
+// parseTaskAssignment 解析 UserTask 的人工任务配置
+// 可写在 userTask 的 xflow 属性上，例如 <bpmn:userTask xflow:assignee="alice" xflow:candidateGroups="sales,finance">，
+// 或写成 <xflow:task assignee="${initiator}" candidateUsers="bob" dueDate="P2D" priority="80" formKey="approve-form"/>，
+// 两处同时配置时以扩展元素为准；没有任何配置时返回 nil
+func parseTaskAssignment(ut userTask) (*models.TaskAssignment, error) {
+	values := make(map[string]string)
+	for _, a := range ut.Attrs {
+		if a.Name.Space == xflowNamespace && !asyncContinuationAttrs[a.Name.Local] {
+			values[a.Name.Local] = strings.TrimSpace(a.Value)
+		}
+	}
+	for _, ext := range ut.ExtensionElements.Values {
+		if ext.XMLName.Local != "task" {
+			continue
+		}
+		for _, a := range ext.Attrs {
+			values[a.Name.Local] = strings.TrimSpace(a.Value)
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	assignment := &models.TaskAssignment{
+		Assignee:        values["assignee"],
+		CandidateUsers:  splitTaskList(values["candidateUsers"]),
+		CandidateGroups: splitTaskList(values["candidateGroups"]),
+		DueDate:         values["dueDate"],
+		Priority:        models.DefaultUserTaskPriority,
+		FormKey:         values["formKey"],
+	}
+
+	if v := values["priority"]; v != "" {
+		priority, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("priority must be an integer, got %q", v)
+		}
+		assignment.Priority = priority
+	}
+
+	// 表达式形式的期限在创建任务时才能求值
+	if assignment.DueDate != "" && !IsTaskExpression(assignment.DueDate) {
+		if _, err := TaskDueDate(assignment.DueDate, time.Now()); err != nil {
+			return nil, fmt.Errorf("dueDate: %w", err)
+		}
+	}
+	return assignment, nil
+}
+
+// asyncContinuationAttrs 异步延续的 xflow 属性，不属于人工任务配置
+var asyncContinuationAttrs = map[string]bool{"asyncBefore": true, "asyncAfter": true}
+
+// parseAsyncContinuation 解析活动上的 xflow:asyncBefore 和 xflow:asyncAfter 属性
+// asyncBefore 的活动在执行前、asyncAfter 的活动在执行后停下，由后台作业继续执行；
+// UserTask 和 CallActivity 本身就会等待，只支持 asyncBefore
+func parseAsyncContinuation(node *models.Node, attrs []xml.Attr) error {
+	for _, a := range attrs {
+		if a.Name.Space != xflowNamespace || !asyncContinuationAttrs[a.Name.Local] {
+			continue
+		}
+		value, err := strconv.ParseBool(strings.TrimSpace(a.Value))
+		if err != nil {
+			return fmt.Errorf("%s must be true or false, got %q", a.Name.Local, a.Value)
+		}
+		if a.Name.Local == "asyncBefore" {
+			node.AsyncBefore = value
+		} else {
+			node.AsyncAfter = value
+		}
+	}
+	if node.AsyncAfter && (node.Type == NodeTypeUserTask || node.Type == NodeTypeCallActivity) {
+		return fmt.Errorf("asyncAfter is not supported, the activity already waits")
+	}
+	return nil
+}
+
+// parseExternalTask 解析 ServiceTask 上的 type 和 topic 属性（也可写成 xflow:type、xflow:topic）
+// type="external" 的任务不调用业务接口，令牌停在节点上，由工作者按主题拉取、锁定并完成
+func parseExternalTask(node *models.Node, attrs []xml.Attr) error {
+	var taskType, topic string
+	for _, a := range attrs {
+		if a.Name.Space != "" && a.Name.Space != xflowNamespace {
+			continue
+		}
+		switch a.Name.Local {
+		case "type":
+			taskType = strings.TrimSpace(a.Value)
+		case "topic":
+			topic = strings.TrimSpace(a.Value)
+		}
+	}
+
+	switch {
+	case taskType == "" && topic == "":
+		return nil
+	case taskType != "external":
+		if taskType == "" {
+			return fmt.Errorf("topic requires type=\"external\"")
+		}
+		return fmt.Errorf("unsupported type %q", taskType)
+	case topic == "":
+		return fmt.Errorf("topic is required")
+	case node.MultiInstance != nil:
+		return fmt.Errorf("multi-instance is not supported")
+	}
+	node.ExternalTopic = topic
+	return nil
+}
+
+// IsTaskExpression reports whether a task assignment value is a ${expression}
+func IsTaskExpression(value string) bool {
+	return strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}")
+}
+
+// TaskDueDate computes the due date of a user task from an ISO-8601 duration or an RFC3339 date
+func TaskDueDate(value string, from time.Time) (time.Time, error) {
+	timer := &models.TimerDefinition{Type: models.TimerTypeDate, Expression: value}
+	if strings.HasPrefix(strings.ToUpper(value), "P") {
+		timer.Type = models.TimerTypeDuration
+	}
+	return TimerDueDate(timer, from)
+}
+
+// splitTaskList 拆分逗号分隔的候选人/候选组列表，忽略空项；整个值是表达式时不拆分
+func splitTaskList(value string) []string {
+	if IsTaskExpression(value) {
+		return []string{value}
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseMultiInstance 解析 multiInstanceLoopCharacteristics
+// 例如 <xflow:loop collection="cart.items" elementVariable="item" outputElement="score" outputCollection="scores"/>
+func parseMultiInstance(def *multiInstanceLoopCharacteristics) (*models.MultiInstance, error) {
+	if def == nil {
+		return nil, nil
+	}
+
+	multiInstance := &models.MultiInstance{
+		IsSequential:        def.IsSequential,
+		LoopCardinality:     strings.TrimSpace(def.LoopCardinality),
+		CompletionCondition: strings.TrimSpace(def.CompletionCondition),
+	}
+	for _, ext := range def.ExtensionElements.Values {
+		if ext.XMLName.Local != "loop" {
+			continue
+		}
+		multiInstance.Collection = ext.attr("collection")
+		multiInstance.ElementVariable = ext.attr("elementVariable")
+		multiInstance.OutputElement = ext.attr("outputElement")
+		multiInstance.OutputCollection = ext.attr("outputCollection")
+	}
+
+	if multiInstance.Collection == "" && multiInstance.LoopCardinality == "" {
+		return nil, fmt.Errorf("xflow:loop collection or loopCardinality is required")
+	}
+	if multiInstance.Collection != "" && multiInstance.LoopCardinality != "" {
+		return nil, fmt.Errorf("xflow:loop collection and loopCardinality cannot both be set")
+	}
+	if (multiInstance.OutputElement == "") != (multiInstance.OutputCollection == "") {
+		return nil, fmt.Errorf("outputElement and outputCollection must be set together")
+	}
+	return multiInstance, nil
+}
+
+// parseSequenceFlows 解析序列流（包括子流程内部的序列流）
+func parseSequenceFlows(proc *flowElements, wd *models.WorkflowDefinition) {
 	for _, sf := range proc.SequenceFlows {
 		flow := models.SequenceFlow{
 			Id:                sf.ID,
@@ -369,11 +1146,15 @@ func parseSequenceFlows(proc *process, wd *models.WorkflowDefinition) {
 		}
 		wd.SequenceFlows[flow.Id] = flow
 	}
+
+	for i := range proc.SubProcesses {
+		parseSequenceFlows(&proc.SubProcesses[i].flowElements, wd)
+	}
 }
 
 // parseMessages 解析消息
-func parseMessages(proc *process, wd *models.WorkflowDefinition) {
-	for _, msg := range proc.Messages {
+func parseMessages(messages []message, wd *models.WorkflowDefinition) {
+	for _, msg := range messages {
 		message := models.Message{
 			Id:   msg.ID,
 			Name: msg.Name,
@@ -382,6 +1163,31 @@ func parseMessages(proc *process, wd *models.WorkflowDefinition) {
 	}
 }
 
+// parseSignals 解析信号定义，没有名称的信号使用其 ID 作为名称
+func parseSignals(signals []signal, wd *models.WorkflowDefinition) {
+	for _, sig := range signals {
+		name := sig.Name
+		if name == "" {
+			name = sig.ID
+		}
+		wd.Signals[sig.ID] = models.Signal{
+			Id:   sig.ID,
+			Name: name,
+		}
+	}
+}
+
+// parseErrors 解析错误定义
+func parseErrors(errors []bpmnError, wd *models.WorkflowDefinition) {
+	for _, e := range errors {
+		wd.Errors[e.ID] = models.Error{
+			Id:        e.ID,
+			Name:      e.Name,
+			ErrorCode: e.ErrorCode,
+		}
+	}
+}
+
 // buildAdjacencyLists 构建邻接表
 func buildAdjacencyLists(wd *models.WorkflowDefinition) {
 	// 初始化邻接表
@@ -409,17 +1215,110 @@ func buildAdjacencyLists(wd *models.WorkflowDefinition) {
 		// 添加到反向邻接表
 		wd.ReverseAdjacencyList[targetID] = append(wd.ReverseAdjacencyList[targetID], sourceID)
 	}
+
+	// 构建子流程穿越边
+	for subProcessID, subProcess := range wd.Nodes {
+		if subProcess.Type != NodeTypeSubProcess {
+			continue
+		}
+
+		// 子流程的后继节点
+		var successors []string
+		for _, flowID := range subProcess.OutgoingSequenceFlowIds {
+			if flow, exists := wd.SequenceFlows[flowID]; exists {
+				if _, exists := wd.Nodes[flow.TargetNodeId]; exists {
+					successors = append(successors, flow.TargetNodeId)
+				}
+			}
+		}
+
+		for nodeID, node := range wd.Nodes {
+			if node.ParentId != subProcessID {
+				continue
+			}
+			switch node.Type {
+			case NodeTypeStartEvent:
+				// 穿越边：subProcess -> 内部 startEvent
+				addEdge(wd, subProcessID, nodeID)
+			case NodeTypeEndEvent:
+				// 穿越边：内部 endEvent -> subProcess 后继
+				for _, successorID := range successors {
+					addEdge(wd, nodeID, successorID)
+				}
+			}
+		}
+	}
+
+	// 构建边界事件穿越边：依附节点 -> 边界事件
+	for nodeID, node := range wd.Nodes {
+		if node.Type != NodeTypeBoundaryEvent {
+			continue
+		}
+		if _, exists := wd.Nodes[node.AttachedNodeId]; exists {
+			addEdge(wd, node.AttachedNodeId, nodeID)
+		}
+	}
+}
+
+// addEdge 同时向正向和反向邻接表添加一条边
+func addEdge(wd *models.WorkflowDefinition, sourceID, targetID string) {
+	wd.AdjacencyList[sourceID] = append(wd.AdjacencyList[sourceID], targetID)
+	wd.ReverseAdjacencyList[targetID] = append(wd.ReverseAdjacencyList[targetID], sourceID)
+}
+
+// validateGatewayFlows 验证网关的 default 属性引用的是该网关自身的出边，
+// 并且没有默认流的排他网关最多只有一条无条件出边（否则无法确定走哪条）
+func validateGatewayFlows(wd *models.WorkflowDefinition, c *issueCollector) {
+	for nodeID, node := range wd.Nodes {
+		if node.DefaultFlowId == "" {
+			if node.Type != NodeTypeExclusiveGateway {
+				continue
+			}
+			unconditioned := 0
+			for _, flowID := range node.OutgoingSequenceFlowIds {
+				if flow, exists := wd.SequenceFlows[flowID]; exists && flow.ConditionExpression == "" {
+					unconditioned++
+				}
+			}
+			if unconditioned > 1 {
+				c.addError(nodeID, RuleAmbiguousGateway, fmt.Errorf("ExclusiveGateway %s has %d outgoing flows without condition and no default flow", nodeID, unconditioned))
+			}
+			continue
+		}
+		flow, exists := wd.SequenceFlows[node.DefaultFlowId]
+		if !exists {
+			c.addError(nodeID, RuleGatewayDefaultFlow, fmt.Errorf("gateway %s default flow %s not found", nodeID, node.DefaultFlowId))
+		} else if flow.SourceNodeId != nodeID {
+			c.addError(nodeID, RuleGatewayDefaultFlow, fmt.Errorf("gateway %s default flow %s is not an outgoing flow of the gateway", nodeID, node.DefaultFlowId))
+		}
+	}
+}
+
+// validateCompensateEvents 验证补偿事件的 activityRef 引用的是声明了补偿处理的任务
+func validateCompensateEvents(wd *models.WorkflowDefinition, c *issueCollector) {
+	for nodeID, node := range wd.Nodes {
+		if node.CompensateDefinition == nil || node.CompensateDefinition.ActivityRef == "" {
+			continue
+		}
+		activity, exists := wd.Nodes[node.CompensateDefinition.ActivityRef]
+		if !exists {
+			c.addError(nodeID, RuleCompensateReference, fmt.Errorf("compensate event %s references unknown activity %s", nodeID, node.CompensateDefinition.ActivityRef))
+		} else if activity.CompensationApiUrl == "" {
+			c.addError(nodeID, RuleCompensateReference, fmt.Errorf("compensate event %s references activity %s without compensation handler", nodeID, activity.Id))
+		}
+	}
 }
 
 // validateUserTaskConstraints 验证 UserTask 的 outgoing 连线约束
 // 确保所有 UserTask 的 outgoing 连线都从 BoundaryEvent 出发
-func validateUserTaskConstraints(wd *models.WorkflowDefinition) error {
+func validateUserTaskConstraints(wd *models.WorkflowDefinition, c *issueCollector) {
 	// 1. 构建 BoundaryEvent 索引：attachedNodeId -> []boundaryEventIDs
 	boundaryEvents := make(map[string][]string)
 	for nodeID, node := range wd.Nodes {
 		if node.Type == NodeTypeBoundaryEvent {
 			if node.AttachedNodeId == "" {
-				return fmt.Errorf("BoundaryEvent %s missing attachedToRef", nodeID)
+				c.addError(nodeID, RuleInvalidElement, fmt.Errorf("BoundaryEvent %s missing attachedToRef", nodeID))
+				continue
 			}
 			boundaryEvents[node.AttachedNodeId] = append(
 				boundaryEvents[node.AttachedNodeId], nodeID)
@@ -440,32 +1339,36 @@ func validateUserTaskConstraints(wd *models.WorkflowDefinition) error {
 		for _, flowID := range node.OutgoingSequenceFlowIds {
 			flow, exists := wd.SequenceFlows[flowID]
 			if !exists {
-				return fmt.Errorf("SequenceFlow %s not found", flowID)
+				c.addError(nodeID, RuleUserTaskFlow, fmt.Errorf("SequenceFlow %s not found", flowID))
+				continue
 			}
 
 			// 验证失败：连线直接从 UserTask 出发
 			if flow.SourceNodeId == nodeID {
-				return fmt.Errorf(
+				c.addError(nodeID, RuleUserTaskFlow, fmt.Errorf(
 					"UserTask %s has direct outgoing flow %s. "+
 						"All outgoing flows from UserTask must originate from BoundaryEvent",
-					nodeID, flowID)
+					nodeID, flowID))
 			}
 		}
 
 		// 检查是否有 BoundaryEvent
 		if len(boundaryEvents[nodeID]) == 0 {
-			return fmt.Errorf(
+			c.addError(nodeID, RuleUserTaskFlow, fmt.Errorf(
 				"UserTask %s has outgoing flows but no BoundaryEvent attached",
-				nodeID)
+				nodeID))
 		}
 	}
-
-	return nil
 }
 
 // identifyStartAndEndEvents 识别开始和结束事件
+// 只包含顶层流程的事件，子流程内部的开始和结束事件通过穿越边访问
+// 开始事件按 ID 排序且普通开始事件排在信号开始事件和消息流启动的开始事件之前，未指定开始事件时从第一个普通开始事件启动
 func identifyStartAndEndEvents(wd *models.WorkflowDefinition) {
 	for nodeID, node := range wd.Nodes {
+		if node.ParentId != "" {
+			continue
+		}
 		switch node.Type {
 		case NodeTypeStartEvent:
 			wd.StartEvents = append(wd.StartEvents, nodeID)
@@ -473,5 +1376,13 @@ func identifyStartAndEndEvents(wd *models.WorkflowDefinition) {
 			wd.EndEvents = append(wd.EndEvents, nodeID)
 		}
 	}
+	sort.Slice(wd.StartEvents, func(i, j int) bool {
+		iTriggered := wd.Nodes[wd.StartEvents[i]].SignalRef != "" || isMessageFlowTarget(wd, wd.StartEvents[i])
+		jTriggered := wd.Nodes[wd.StartEvents[j]].SignalRef != "" || isMessageFlowTarget(wd, wd.StartEvents[j])
+		if iTriggered != jTriggered {
+			return jTriggered
+		}
+		return wd.StartEvents[i] < wd.StartEvents[j]
+	})
 }
 
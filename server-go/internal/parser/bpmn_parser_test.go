@@ -2,6 +2,8 @@ package parser
 
 import (
 	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
 )
 
 func TestParseBPMN(t *testing.T) {
@@ -392,6 +394,1406 @@ func TestValidateUserTaskConstraints_MultipleBoundaryEvents(t *testing.T) {
 	}
 }
 
+func TestParseBPMN_SubProcess(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="Start_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:subProcess id="Sub_1" name="Review">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:startEvent id="SubStart_1">
+        <bpmn:outgoing>SubFlow_1</bpmn:outgoing>
+      </bpmn:startEvent>
+      <bpmn:task id="SubTask_1">
+        <bpmn:incoming>SubFlow_1</bpmn:incoming>
+        <bpmn:outgoing>SubFlow_2</bpmn:outgoing>
+      </bpmn:task>
+      <bpmn:endEvent id="SubEnd_1">
+        <bpmn:incoming>SubFlow_2</bpmn:incoming>
+      </bpmn:endEvent>
+      <bpmn:sequenceFlow id="SubFlow_1" sourceRef="SubStart_1" targetRef="SubTask_1" />
+      <bpmn:sequenceFlow id="SubFlow_2" sourceRef="SubTask_1" targetRef="SubEnd_1" />
+    </bpmn:subProcess>
+    <bpmn:endEvent id="End_1">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="Start_1" targetRef="Sub_1" />
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Sub_1" targetRef="End_1" />
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	// 验证子流程内部节点和 ParentId
+	for _, nodeID := range []string{"SubStart_1", "SubTask_1", "SubEnd_1"} {
+		node, exists := wd.Nodes[nodeID]
+		if !exists {
+			t.Fatalf("Expected node %s inside subProcess", nodeID)
+		}
+		if node.ParentId != "Sub_1" {
+			t.Errorf("Expected node %s parentId Sub_1, got '%s'", nodeID, node.ParentId)
+		}
+	}
+	if wd.Nodes["Sub_1"].ParentId != "" {
+		t.Errorf("Expected top-level subProcess to have no parentId, got '%s'", wd.Nodes["Sub_1"].ParentId)
+	}
+
+	// 验证子流程内部的序列流
+	if _, exists := wd.SequenceFlows["SubFlow_1"]; !exists {
+		t.Error("Expected sequence flow SubFlow_1 inside subProcess")
+	}
+
+	// 验证开始和结束事件只包含顶层事件
+	if len(wd.StartEvents) != 1 || wd.StartEvents[0] != "Start_1" {
+		t.Errorf("Expected only Start_1 as start event, got %v", wd.StartEvents)
+	}
+	if len(wd.EndEvents) != 1 || wd.EndEvents[0] != "End_1" {
+		t.Errorf("Expected only End_1 as end event, got %v", wd.EndEvents)
+	}
+
+	// 验证穿越边
+	if !containsID(wd.AdjacencyList["Sub_1"], "SubStart_1") {
+		t.Errorf("Expected crossing edge Sub_1 -> SubStart_1, got %v", wd.AdjacencyList["Sub_1"])
+	}
+	if !containsID(wd.AdjacencyList["SubEnd_1"], "End_1") {
+		t.Errorf("Expected crossing edge SubEnd_1 -> End_1, got %v", wd.AdjacencyList["SubEnd_1"])
+	}
+	if !containsID(wd.ReverseAdjacencyList["SubStart_1"], "Sub_1") {
+		t.Errorf("Expected reverse crossing edge SubStart_1 <- Sub_1, got %v", wd.ReverseAdjacencyList["SubStart_1"])
+	}
+}
+
+func TestParseBPMN_ServiceTaskMappings(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="Service_1">
+      <bpmn:extensionElements>
+        <xflow:input source="customer.id" target="customerId"/>
+        <xflow:url value="http://example.com/api/score"/>
+        <xflow:output source="body.score" target="riskScore"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	node := wd.Nodes["Service_1"]
+	if node.BusinessApiUrl != "http://example.com/api/score" {
+		t.Errorf("Expected business API URL, got '%s'", node.BusinessApiUrl)
+	}
+	if len(node.InputMappings) != 1 || node.InputMappings[0].Source != "customer.id" || node.InputMappings[0].Target != "customerId" {
+		t.Errorf("Unexpected input mappings: %+v", node.InputMappings)
+	}
+	if len(node.OutputMappings) != 1 || node.OutputMappings[0].Source != "body.score" || node.OutputMappings[0].Target != "riskScore" {
+		t.Errorf("Unexpected output mappings: %+v", node.OutputMappings)
+	}
+}
+
+func TestParseBPMN_ServiceTaskRetryPolicy(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="Service_1">
+      <bpmn:extensionElements>
+        <xflow:url value="http://example.com/api/score"/>
+        <xflow:retry maxAttempts="4" timeout="PT5S" backoff="500ms" backoffMultiplier="2" retryableStatusCodes="502, 503"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:serviceTask id="Service_2"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	node := wd.Nodes["Service_1"]
+	if node.BusinessApiUrl != "http://example.com/api/score" {
+		t.Errorf("Expected business API URL, got '%s'", node.BusinessApiUrl)
+	}
+	policy := node.RetryPolicy
+	if policy == nil {
+		t.Fatal("Expected retry policy to be parsed")
+	}
+	if policy.MaxAttempts != 4 || policy.TimeoutMs != 5000 || policy.BackoffMs != 500 || policy.BackoffMultiplier != 2 {
+		t.Errorf("Unexpected retry policy: %+v", policy)
+	}
+	if len(policy.RetryableStatusCodes) != 2 || policy.RetryableStatusCodes[0] != 502 || policy.RetryableStatusCodes[1] != 503 {
+		t.Errorf("Unexpected retryable status codes: %v", policy.RetryableStatusCodes)
+	}
+	if wd.Nodes["Service_2"].RetryPolicy != nil {
+		t.Error("Expected no retry policy on Service_2")
+	}
+}
+
+func TestParseBPMN_ServiceTaskRetryPolicy_Invalid(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="Service_1">
+      <bpmn:extensionElements>
+        <xflow:retry maxAttempts="0"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	_, err := ParseBPMN(bpmnXML)
+	if err == nil {
+		t.Fatal("Expected error for invalid retry policy")
+	}
+	if !contains(err.Error(), "Service_1") {
+		t.Errorf("Expected error to mention node ID, got: %v", err)
+	}
+}
+
+func TestParseBPMN_TimerEvents(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:intermediateCatchEvent id="Timer_Wait" name="Wait 3 days">
+      <bpmn:timerEventDefinition>
+        <bpmn:timeDuration>P3D</bpmn:timeDuration>
+      </bpmn:timerEventDefinition>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:userTask id="UserTask_Review"/>
+    <bpmn:boundaryEvent id="Timer_Remind" attachedToRef="UserTask_Review" cancelActivity="false">
+      <bpmn:timerEventDefinition>
+        <bpmn:timeCycle>R3/PT1H</bpmn:timeCycle>
+      </bpmn:timerEventDefinition>
+    </bpmn:boundaryEvent>
+    <bpmn:boundaryEvent id="Timer_Escalate" attachedToRef="UserTask_Review">
+      <bpmn:timerEventDefinition>
+        <bpmn:timeDate>2026-02-01T08:00:00Z</bpmn:timeDate>
+      </bpmn:timerEventDefinition>
+    </bpmn:boundaryEvent>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	wait := wd.Nodes["Timer_Wait"]
+	if wait.TimerDefinition == nil || wait.TimerDefinition.Type != models.TimerTypeDuration || wait.TimerDefinition.Expression != "P3D" {
+		t.Errorf("Unexpected timer on Timer_Wait: %+v", wait.TimerDefinition)
+	}
+
+	remind := wd.Nodes["Timer_Remind"]
+	if remind.TimerDefinition == nil || remind.TimerDefinition.Type != models.TimerTypeCycle {
+		t.Errorf("Unexpected timer on Timer_Remind: %+v", remind.TimerDefinition)
+	}
+	if remind.CancelActivity {
+		t.Error("Expected Timer_Remind to be non-interrupting")
+	}
+
+	escalate := wd.Nodes["Timer_Escalate"]
+	if escalate.TimerDefinition == nil || escalate.TimerDefinition.Type != models.TimerTypeDate {
+		t.Errorf("Unexpected timer on Timer_Escalate: %+v", escalate.TimerDefinition)
+	}
+	if !escalate.CancelActivity {
+		t.Error("Expected Timer_Escalate to be interrupting by default")
+	}
+}
+
+func TestParseBPMN_TimerEvents_Invalid(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:intermediateCatchEvent id="Timer_Wait">
+      <bpmn:timerEventDefinition>
+        <bpmn:timeDuration>three days</bpmn:timeDuration>
+      </bpmn:timerEventDefinition>
+    </bpmn:intermediateCatchEvent>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	_, err := ParseBPMN(bpmnXML)
+	if err == nil {
+		t.Fatal("Expected error for invalid timer duration")
+	}
+	if !contains(err.Error(), "Timer_Wait") {
+		t.Errorf("Expected error to mention node ID, got: %v", err)
+	}
+}
+
+func TestParseBPMN_MessageEvents(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:message id="Message_Paid" name="PaymentReceived"/>
+  <bpmn:process id="Process_1">
+    <bpmn:intermediateCatchEvent id="Catch_Paid">
+      <bpmn:messageEventDefinition messageRef="Message_Paid"/>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:userTask id="UserTask_Review"/>
+    <bpmn:boundaryEvent id="Boundary_Cancelled" attachedToRef="UserTask_Review">
+      <bpmn:messageEventDefinition messageRef="Message_Cancelled"/>
+    </bpmn:boundaryEvent>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	if ref := wd.Nodes["Catch_Paid"].MessageRef; ref != "Message_Paid" {
+		t.Errorf("Expected Catch_Paid messageRef Message_Paid, got '%s'", ref)
+	}
+	if ref := wd.Nodes["Boundary_Cancelled"].MessageRef; ref != "Message_Cancelled" {
+		t.Errorf("Expected Boundary_Cancelled messageRef Message_Cancelled, got '%s'", ref)
+	}
+	if wd.Nodes["UserTask_Review"].MessageRef != "" {
+		t.Error("Expected UserTask_Review to have no messageRef")
+	}
+	if !containsID(wd.AdjacencyList["UserTask_Review"], "Boundary_Cancelled") {
+		t.Errorf("Expected crossing edge UserTask_Review -> Boundary_Cancelled, got %v", wd.AdjacencyList["UserTask_Review"])
+	}
+	if msg, exists := wd.Messages["Message_Paid"]; !exists || msg.Name != "PaymentReceived" {
+		t.Errorf("Expected definitions-level message Message_Paid to be parsed, got %+v", wd.Messages)
+	}
+}
+
+func TestParseBPMN_InclusiveGateway(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:inclusiveGateway id="Split_1" name="Notify" default="Flow_Default">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_Email</bpmn:outgoing>
+      <bpmn:outgoing>Flow_Default</bpmn:outgoing>
+    </bpmn:inclusiveGateway>
+    <bpmn:endEvent id="End_Email">
+      <bpmn:incoming>Flow_Email</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:endEvent id="End_Default">
+      <bpmn:incoming>Flow_Default</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Split_1"/>
+    <bpmn:sequenceFlow id="Flow_Email" sourceRef="Split_1" targetRef="End_Email">
+      <bpmn:conditionExpression>emailOptIn</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_Default" sourceRef="Split_1" targetRef="End_Default"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	gateway, exists := wd.Nodes["Split_1"]
+	if !exists {
+		t.Fatal("Expected inclusive gateway Split_1 to be parsed")
+	}
+	if gateway.Type != NodeTypeInclusiveGateway {
+		t.Errorf("Expected node type %d, got %d", NodeTypeInclusiveGateway, gateway.Type)
+	}
+	if gateway.DefaultFlowId != "Flow_Default" {
+		t.Errorf("Expected default flow Flow_Default, got '%s'", gateway.DefaultFlowId)
+	}
+	if len(gateway.OutgoingSequenceFlowIds) != 2 {
+		t.Errorf("Expected 2 outgoing flows, got %d", len(gateway.OutgoingSequenceFlowIds))
+	}
+}
+
+func TestParseBPMN_InclusiveGateway_InvalidDefaultFlow(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:inclusiveGateway id="Split_1" default="Flow_1">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+    </bpmn:inclusiveGateway>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Split_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	_, err := ParseBPMN(bpmnXML)
+	if err == nil {
+		t.Fatal("Expected error for default flow that does not leave the gateway")
+	}
+	if !contains(err.Error(), "Split_1") {
+		t.Errorf("Expected error to mention gateway ID, got: %v", err)
+	}
+}
+
+func TestParseBPMN_ExclusiveGateway_DefaultAndPriority(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:exclusiveGateway id="Gateway_1" default="Flow_Default">
+      <bpmn:outgoing>Flow_Default</bpmn:outgoing>
+      <bpmn:outgoing>Flow_High</bpmn:outgoing>
+    </bpmn:exclusiveGateway>
+    <bpmn:endEvent id="End_Default">
+      <bpmn:incoming>Flow_Default</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:endEvent id="End_High">
+      <bpmn:incoming>Flow_High</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_Default" sourceRef="Gateway_1" targetRef="End_Default"/>
+    <bpmn:sequenceFlow id="Flow_High" sourceRef="Gateway_1" targetRef="End_High" priority="1">
+      <bpmn:conditionExpression>amount > 100</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	if gateway := wd.Nodes["Gateway_1"]; gateway.DefaultFlowId != "Flow_Default" {
+		t.Errorf("Expected default flow Flow_Default, got '%s'", gateway.DefaultFlowId)
+	}
+	if flow := wd.SequenceFlows["Flow_High"]; flow.Priority != 1 {
+		t.Errorf("Expected Flow_High priority 1, got %d", flow.Priority)
+	}
+}
+
+func TestParseBPMN_ExclusiveGateway_MultipleUnconditionedFlows(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:exclusiveGateway id="Gateway_1">
+      <bpmn:outgoing>Flow_A</bpmn:outgoing>
+      <bpmn:outgoing>Flow_B</bpmn:outgoing>
+    </bpmn:exclusiveGateway>
+    <bpmn:endEvent id="End_A">
+      <bpmn:incoming>Flow_A</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:endEvent id="End_B">
+      <bpmn:incoming>Flow_B</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_A" sourceRef="Gateway_1" targetRef="End_A"/>
+    <bpmn:sequenceFlow id="Flow_B" sourceRef="Gateway_1" targetRef="End_B"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	_, err := ParseBPMN(bpmnXML)
+	if err == nil {
+		t.Fatal("Expected error for exclusive gateway with several unconditioned flows and no default")
+	}
+	if !contains(err.Error(), "Gateway_1") {
+		t.Errorf("Expected error to mention gateway ID, got: %v", err)
+	}
+}
+
+func TestParseBPMN_ErrorEvents(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:error id="Error_Declined" name="Declined" errorCode="PAYMENT_DECLINED"/>
+  <bpmn:error id="Error_NoCode"/>
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="ServiceTask_Charge">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+      <bpmn:extensionElements>
+        <xflow:url value="http://example.com/charge"/>
+        <xflow:error code="PAYMENT_DECLINED" when="statusCode == 402"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:boundaryEvent id="Boundary_Declined" attachedToRef="ServiceTask_Charge" cancelActivity="false">
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:errorEventDefinition errorRef="Error_Declined"/>
+    </bpmn:boundaryEvent>
+    <bpmn:boundaryEvent id="Boundary_Any" attachedToRef="ServiceTask_Charge">
+      <bpmn:errorEventDefinition/>
+    </bpmn:boundaryEvent>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:endEvent id="ErrorEnd_1">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+      <bpmn:errorEventDefinition errorRef="Error_NoCode"/>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="ServiceTask_Charge" targetRef="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Boundary_Declined" targetRef="ErrorEnd_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	if len(wd.Errors) != 2 {
+		t.Errorf("Expected 2 errors, got %d", len(wd.Errors))
+	}
+
+	task := wd.Nodes["ServiceTask_Charge"]
+	if len(task.ErrorMappings) != 1 || task.ErrorMappings[0].Code != "PAYMENT_DECLINED" || task.ErrorMappings[0].When != "statusCode == 402" {
+		t.Errorf("Expected one PAYMENT_DECLINED error mapping, got %+v", task.ErrorMappings)
+	}
+
+	declined := wd.Nodes["Boundary_Declined"]
+	if declined.ErrorDefinition == nil || declined.ErrorDefinition.ErrorCode != "PAYMENT_DECLINED" {
+		t.Errorf("Expected Boundary_Declined to catch PAYMENT_DECLINED, got %+v", declined.ErrorDefinition)
+	}
+	if !declined.CancelActivity {
+		t.Error("Expected error boundary event to always cancel the activity")
+	}
+
+	catchAll := wd.Nodes["Boundary_Any"]
+	if catchAll.ErrorDefinition == nil || catchAll.ErrorDefinition.ErrorRef != "" {
+		t.Errorf("Expected Boundary_Any to catch all errors, got %+v", catchAll.ErrorDefinition)
+	}
+
+	// 没有 errorCode 的 error 使用其 ID 作为错误码
+	errorEnd := wd.Nodes["ErrorEnd_1"]
+	if errorEnd.ErrorDefinition == nil || errorEnd.ErrorDefinition.ErrorCode != "Error_NoCode" {
+		t.Errorf("Expected ErrorEnd_1 to throw Error_NoCode, got %+v", errorEnd.ErrorDefinition)
+	}
+	if wd.Nodes["EndEvent_1"].ErrorDefinition != nil {
+		t.Error("Expected plain EndEvent to have no error definition")
+	}
+}
+
+func TestParseBPMN_ErrorEvents_UnknownErrorRef(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:task id="Task_1"/>
+    <bpmn:boundaryEvent id="Boundary_1" attachedToRef="Task_1">
+      <bpmn:errorEventDefinition errorRef="Error_Missing"/>
+    </bpmn:boundaryEvent>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	_, err := ParseBPMN(bpmnXML)
+	if err == nil {
+		t.Fatal("Expected error for unknown errorRef")
+	}
+	if !contains(err.Error(), "Boundary_1") || !contains(err.Error(), "Error_Missing") {
+		t.Errorf("Expected error to mention boundary event and error ID, got: %v", err)
+	}
+}
+
+func TestParseBPMN_CompensateEvents(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="ServiceTask_Charge">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+      <bpmn:extensionElements>
+        <xflow:url value="http://example.com/charge"/>
+        <xflow:compensation value="http://example.com/refund"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:intermediateThrowEvent id="Throw_Refund">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:compensateEventDefinition activityRef="ServiceTask_Charge"/>
+    </bpmn:intermediateThrowEvent>
+    <bpmn:endEvent id="EndEvent_Compensate">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+      <bpmn:compensateEventDefinition/>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="ServiceTask_Charge" targetRef="Throw_Refund"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Throw_Refund" targetRef="EndEvent_Compensate"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	if url := wd.Nodes["ServiceTask_Charge"].CompensationApiUrl; url != "http://example.com/refund" {
+		t.Errorf("Expected compensation URL http://example.com/refund, got %s", url)
+	}
+
+	throwEvent := wd.Nodes["Throw_Refund"]
+	if throwEvent.Type != NodeTypeIntermediateEvent {
+		t.Errorf("Expected Throw_Refund to be IntermediateEvent, got %d", throwEvent.Type)
+	}
+	if throwEvent.CompensateDefinition == nil || throwEvent.CompensateDefinition.ActivityRef != "ServiceTask_Charge" {
+		t.Errorf("Expected Throw_Refund to compensate ServiceTask_Charge, got %+v", throwEvent.CompensateDefinition)
+	}
+
+	endEvent := wd.Nodes["EndEvent_Compensate"]
+	if endEvent.CompensateDefinition == nil || endEvent.CompensateDefinition.ActivityRef != "" {
+		t.Errorf("Expected EndEvent_Compensate to compensate all activities, got %+v", endEvent.CompensateDefinition)
+	}
+}
+
+func TestParseBPMN_CompensateEvents_InvalidActivityRef(t *testing.T) {
+	tests := []struct {
+		name        string
+		activityRef string
+		expected    string
+	}{
+		{"unknown activity", "Task_Missing", "unknown activity Task_Missing"},
+		{"activity without handler", "Task_1", "without compensation handler"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:task id="Task_1"/>
+    <bpmn:intermediateThrowEvent id="Throw_1">
+      <bpmn:compensateEventDefinition activityRef="` + tt.activityRef + `"/>
+    </bpmn:intermediateThrowEvent>
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid compensate activityRef")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseBPMN_MultiInstance(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="ServiceTask_Score">
+      <bpmn:extensionElements>
+        <xflow:url value="http://example.com/score"/>
+      </bpmn:extensionElements>
+      <bpmn:multiInstanceLoopCharacteristics isSequential="true">
+        <bpmn:extensionElements>
+          <xflow:loop collection="cart.items" elementVariable="item" outputElement="score" outputCollection="scores"/>
+        </bpmn:extensionElements>
+        <bpmn:completionCondition>nrOfCompletedInstances >= 3</bpmn:completionCondition>
+      </bpmn:multiInstanceLoopCharacteristics>
+    </bpmn:serviceTask>
+    <bpmn:subProcess id="SubProcess_1">
+      <bpmn:multiInstanceLoopCharacteristics>
+        <bpmn:loopCardinality>retries</bpmn:loopCardinality>
+      </bpmn:multiInstanceLoopCharacteristics>
+    </bpmn:subProcess>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	mi := wd.Nodes["ServiceTask_Score"].MultiInstance
+	if mi == nil {
+		t.Fatal("Expected ServiceTask_Score to be multi-instance")
+	}
+	if !mi.IsSequential || mi.Collection != "cart.items" || mi.ElementVariable != "item" ||
+		mi.OutputElement != "score" || mi.OutputCollection != "scores" || mi.CompletionCondition != "nrOfCompletedInstances >= 3" {
+		t.Errorf("Unexpected multi-instance configuration: %+v", mi)
+	}
+
+	mi = wd.Nodes["SubProcess_1"].MultiInstance
+	if mi == nil || mi.IsSequential || mi.LoopCardinality != "retries" {
+		t.Errorf("Expected parallel SubProcess_1 with loopCardinality retries, got %+v", mi)
+	}
+}
+
+func TestParseBPMN_MultiInstance_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		element  string
+		expected string
+	}{
+		{
+			name:     "missing collection",
+			element:  `<bpmn:task id="Task_1"><bpmn:multiInstanceLoopCharacteristics/></bpmn:task>`,
+			expected: "collection or loopCardinality is required",
+		},
+		{
+			name: "output collection without output element",
+			element: `<bpmn:task id="Task_1"><bpmn:multiInstanceLoopCharacteristics>
+        <bpmn:extensionElements><xflow:loop collection="items" outputCollection="results"/></bpmn:extensionElements>
+      </bpmn:multiInstanceLoopCharacteristics></bpmn:task>`,
+			expected: "outputElement and outputCollection must be set together",
+		},
+		{
+			name: "user task",
+			element: `<bpmn:userTask id="UserTask_1"><bpmn:multiInstanceLoopCharacteristics>
+        <bpmn:extensionElements><xflow:loop collection="items"/></bpmn:extensionElements>
+      </bpmn:multiInstanceLoopCharacteristics></bpmn:userTask>`,
+			expected: "multi-instance is not supported on UserTask UserTask_1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    ` + tt.element + `
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid multi-instance configuration")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseBPMN_ScriptTask(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:scriptTask id="Script_Assign" scriptFormat="expr">
+      <bpmn:script>
+        // 计算订单总价
+        total = sum(map(items, .price))
+        vip = total >= 1000
+      </bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:scriptTask id="Script_Program">
+      <bpmn:extensionElements>
+        <xflow:script resultVariable="level" timeout="PT2S"/>
+      </bpmn:extensionElements>
+      <bpmn:script>score == 100 ? "gold" : "silver"</bpmn:script>
+    </bpmn:scriptTask>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	assign := wd.Nodes["Script_Assign"]
+	if assign.Type != NodeTypeScriptTask || assign.Script == nil {
+		t.Fatalf("Expected Script_Assign to be a ScriptTask with a script, got %+v", assign)
+	}
+	if len(assign.Script.Assignments) != 2 ||
+		assign.Script.Assignments[0].Target != "total" || assign.Script.Assignments[0].Expression != "sum(map(items, .price))" ||
+		assign.Script.Assignments[1].Target != "vip" || assign.Script.Assignments[1].Expression != "total >= 1000" {
+		t.Errorf("Unexpected assignments: %+v", assign.Script.Assignments)
+	}
+	if assign.Script.TimeoutMs != 1000 {
+		t.Errorf("Expected default timeout 1000ms, got %d", assign.Script.TimeoutMs)
+	}
+
+	program := wd.Nodes["Script_Program"].Script
+	if len(program.Assignments) != 0 || program.ResultVariable != "level" || program.TimeoutMs != 2000 {
+		t.Errorf("Expected program script with resultVariable level and timeout 2000ms, got %+v", program)
+	}
+}
+
+func TestParseBPMN_ScriptTask_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		element  string
+		expected string
+	}{
+		{"empty script", `<bpmn:scriptTask id="Script_1"><bpmn:script>  </bpmn:script></bpmn:scriptTask>`, "script is empty"},
+		{"unsupported format", `<bpmn:scriptTask id="Script_1" scriptFormat="javascript"><bpmn:script>x = 1</bpmn:script></bpmn:scriptTask>`, "unsupported scriptFormat"},
+		{
+			"result variable with assignments",
+			`<bpmn:scriptTask id="Script_1"><bpmn:extensionElements><xflow:script resultVariable="y"/></bpmn:extensionElements><bpmn:script>x = 1</bpmn:script></bpmn:scriptTask>`,
+			"resultVariable cannot be used",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    ` + tt.element + `
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid ScriptTask")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseBPMN_CallActivity(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:callActivity id="Call_KYC" name="KYC Check" calledElement="kyc-workflow">
+      <bpmn:extensionElements>
+        <xflow:call version="3"/>
+        <xflow:input source="customer.id" target="customerId"/>
+        <xflow:output source="kycStatus" target="kyc"/>
+      </bpmn:extensionElements>
+    </bpmn:callActivity>
+    <bpmn:callActivity id="Call_Latest" calledElement="scoring-workflow"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	kyc := wd.Nodes["Call_KYC"]
+	if kyc.Type != NodeTypeCallActivity || kyc.CalledElement == nil {
+		t.Fatalf("Expected Call_KYC to be a CallActivity with a called element, got %+v", kyc)
+	}
+	if kyc.CalledElement.WorkflowId != "kyc-workflow" || kyc.CalledElement.Version != 3 {
+		t.Errorf("Expected kyc-workflow version 3, got %+v", kyc.CalledElement)
+	}
+	if len(kyc.InputMappings) != 1 || kyc.InputMappings[0].Source != "customer.id" || kyc.InputMappings[0].Target != "customerId" {
+		t.Errorf("Unexpected input mappings: %+v", kyc.InputMappings)
+	}
+	if len(kyc.OutputMappings) != 1 || kyc.OutputMappings[0].Source != "kycStatus" || kyc.OutputMappings[0].Target != "kyc" {
+		t.Errorf("Unexpected output mappings: %+v", kyc.OutputMappings)
+	}
+
+	// 未固定版本时使用被调用流程的激活版本
+	latest := wd.Nodes["Call_Latest"].CalledElement
+	if latest == nil || latest.WorkflowId != "scoring-workflow" || latest.Version != 0 {
+		t.Errorf("Expected scoring-workflow without a pinned version, got %+v", latest)
+	}
+}
+
+func TestParseBPMN_CallActivity_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		element  string
+		expected string
+	}{
+		{"missing calledElement", `<bpmn:callActivity id="Call_1"/>`, "calledElement is required"},
+		{
+			"invalid version",
+			`<bpmn:callActivity id="Call_1" calledElement="kyc"><bpmn:extensionElements><xflow:call version="latest"/></bpmn:extensionElements></bpmn:callActivity>`,
+			"version must be a positive integer",
+		},
+		{
+			"multi-instance",
+			`<bpmn:callActivity id="Call_1" calledElement="kyc"><bpmn:multiInstanceLoopCharacteristics><bpmn:loopCardinality>3</bpmn:loopCardinality></bpmn:multiInstanceLoopCharacteristics></bpmn:callActivity>`,
+			"multi-instance is not supported on CallActivity",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    ` + tt.element + `
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid CallActivity")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseBPMN_UserTaskAssignment(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:userTask id="UserTask_Approve" name="Approve" xflow:candidateGroups="sales, finance" xflow:priority="10">
+      <bpmn:extensionElements>
+        <xflow:task assignee="${initiator}" candidateUsers="bob,carol" dueDate="P2D" priority="80" formKey="approve-form"/>
+      </bpmn:extensionElements>
+    </bpmn:userTask>
+    <bpmn:userTask id="UserTask_Review" xflow:candidateUsers="${reviewers}"/>
+    <bpmn:userTask id="UserTask_Plain"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	approve := wd.Nodes["UserTask_Approve"].TaskAssignment
+	if approve == nil {
+		t.Fatal("Expected UserTask_Approve to have a task assignment")
+	}
+	if approve.Assignee != "${initiator}" || approve.DueDate != "P2D" || approve.FormKey != "approve-form" {
+		t.Errorf("Unexpected task assignment: %+v", approve)
+	}
+	// 扩展元素上的配置优先于 userTask 上的属性
+	if approve.Priority != 80 {
+		t.Errorf("Expected priority 80 from xflow:task, got %d", approve.Priority)
+	}
+	if len(approve.CandidateUsers) != 2 || !containsID(approve.CandidateUsers, "bob") || !containsID(approve.CandidateUsers, "carol") {
+		t.Errorf("Unexpected candidate users: %v", approve.CandidateUsers)
+	}
+	if len(approve.CandidateGroups) != 2 || !containsID(approve.CandidateGroups, "sales") || !containsID(approve.CandidateGroups, "finance") {
+		t.Errorf("Unexpected candidate groups: %v", approve.CandidateGroups)
+	}
+
+	review := wd.Nodes["UserTask_Review"].TaskAssignment
+	if review == nil || len(review.CandidateUsers) != 1 || review.CandidateUsers[0] != "${reviewers}" {
+		t.Errorf("Expected the candidate users expression to be kept as one item, got %+v", review)
+	}
+	if review != nil && review.Priority != 50 {
+		t.Errorf("Expected default priority 50, got %d", review.Priority)
+	}
+
+	if wd.Nodes["UserTask_Plain"].TaskAssignment != nil {
+		t.Errorf("Expected no task assignment on UserTask_Plain, got %+v", wd.Nodes["UserTask_Plain"].TaskAssignment)
+	}
+}
+
+func TestParseBPMN_UserTaskAssignment_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		element  string
+		expected string
+	}{
+		{"invalid priority", `<bpmn:userTask id="UserTask_1" xflow:priority="high"/>`, "priority must be an integer"},
+		{"invalid due date", `<bpmn:userTask id="UserTask_1" xflow:dueDate="tomorrow"/>`, "dueDate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    ` + tt.element + `
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid task assignment")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseBPMN_SignalEvents(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:signal id="Signal_Recall" name="ProductRecall"/>
+  <bpmn:signal id="Signal_Closed"/>
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="StartEvent_Recall">
+      <bpmn:signalEventDefinition signalRef="Signal_Recall"/>
+    </bpmn:startEvent>
+    <bpmn:startEvent id="StartEvent_1"/>
+    <bpmn:intermediateCatchEvent id="Catch_Closed">
+      <bpmn:signalEventDefinition signalRef="Signal_Closed"/>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:intermediateThrowEvent id="Throw_Recall">
+      <bpmn:signalEventDefinition signalRef="Signal_Recall"/>
+    </bpmn:intermediateThrowEvent>
+    <bpmn:userTask id="UserTask_Review"/>
+    <bpmn:boundaryEvent id="Boundary_Recall" attachedToRef="UserTask_Review" cancelActivity="false">
+      <bpmn:signalEventDefinition signalRef="Signal_Recall"/>
+    </bpmn:boundaryEvent>
+    <bpmn:endEvent id="End_Closed">
+      <bpmn:signalEventDefinition signalRef="Signal_Closed"/>
+    </bpmn:endEvent>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	expectedRefs := map[string]string{
+		"StartEvent_Recall": "Signal_Recall",
+		"Catch_Closed":      "Signal_Closed",
+		"Throw_Recall":      "Signal_Recall",
+		"Boundary_Recall":   "Signal_Recall",
+		"End_Closed":        "Signal_Closed",
+		"StartEvent_1":      "",
+	}
+	for nodeID, expected := range expectedRefs {
+		if ref := wd.Nodes[nodeID].SignalRef; ref != expected {
+			t.Errorf("Expected %s signalRef '%s', got '%s'", nodeID, expected, ref)
+		}
+	}
+	if wd.Nodes["Boundary_Recall"].CancelActivity {
+		t.Error("Expected Boundary_Recall to be non-interrupting")
+	}
+	if sig := wd.Signals["Signal_Recall"]; sig.Name != "ProductRecall" {
+		t.Errorf("Expected Signal_Recall name ProductRecall, got %+v", wd.Signals)
+	}
+	if sig := wd.Signals["Signal_Closed"]; sig.Name != "Signal_Closed" {
+		t.Errorf("Expected unnamed signal to use its ID as name, got %+v", sig)
+	}
+	// 普通开始事件排在信号开始事件之前
+	if len(wd.StartEvents) != 2 || wd.StartEvents[0] != "StartEvent_1" {
+		t.Errorf("Expected plain start event first, got %v", wd.StartEvents)
+	}
+}
+
+func TestParseBPMN_SignalEvents_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		element  string
+		expected string
+	}{
+		{"missing signalRef", `<bpmn:intermediateCatchEvent id="Catch_1"><bpmn:signalEventDefinition/></bpmn:intermediateCatchEvent>`, "requires signalRef"},
+		{"unknown signal", `<bpmn:intermediateThrowEvent id="Throw_1"><bpmn:signalEventDefinition signalRef="Signal_Unknown"/></bpmn:intermediateThrowEvent>`, "signal Signal_Unknown not found"},
+		{"signal start in subprocess", `<bpmn:subProcess id="Sub_1"><bpmn:startEvent id="Start_Sub"><bpmn:signalEventDefinition signalRef="Signal_1"/></bpmn:startEvent></bpmn:subProcess>`, "not supported inside SubProcess Sub_1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:signal id="Signal_1" name="Alarm"/>
+  <bpmn:process id="Process_1">
+    ` + tt.element + `
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid signal event")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseBPMN_AsyncContinuations(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="ServiceTask_Charge" xflow:asyncBefore="true" xflow:asyncAfter="true"/>
+    <bpmn:scriptTask id="ScriptTask_Total" scriptFormat="expr" xflow:asyncAfter="true">
+      <bpmn:script>total = 1</bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:userTask id="UserTask_Review" xflow:asyncBefore="true"/>
+    <bpmn:task id="Task_Plain"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	expected := map[string][2]bool{
+		"ServiceTask_Charge": {true, true},
+		"ScriptTask_Total":   {false, true},
+		"UserTask_Review":    {true, false},
+		"Task_Plain":         {false, false},
+	}
+	for nodeID, flags := range expected {
+		node := wd.Nodes[nodeID]
+		if node.AsyncBefore != flags[0] || node.AsyncAfter != flags[1] {
+			t.Errorf("Expected %s asyncBefore=%v asyncAfter=%v, got %v %v", nodeID, flags[0], flags[1], node.AsyncBefore, node.AsyncAfter)
+		}
+	}
+	// 异步属性不是人工任务配置
+	if wd.Nodes["UserTask_Review"].TaskAssignment != nil {
+		t.Errorf("Expected UserTask_Review to have no task assignment, got %+v", wd.Nodes["UserTask_Review"].TaskAssignment)
+	}
+}
+
+func TestParseBPMN_AsyncContinuations_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		element  string
+		expected string
+	}{
+		{"not a boolean", `<bpmn:serviceTask id="ServiceTask_1" xflow:asyncBefore="yes please"/>`, "asyncBefore must be true or false"},
+		{"asyncAfter on user task", `<bpmn:userTask id="UserTask_1" xflow:asyncAfter="true"/>`, "asyncAfter is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    ` + tt.element + `
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid async continuation")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseBPMN_ExternalTasks(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="ServiceTask_Score" type="external" topic="credit-scoring"/>
+    <bpmn:serviceTask id="ServiceTask_Notify" xflow:type="external" xflow:topic=" notify "/>
+    <bpmn:serviceTask id="ServiceTask_Charge">
+      <bpmn:extensionElements>
+        <xflow:url value="http://payments/charge"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	expected := map[string]string{
+		"ServiceTask_Score":  "credit-scoring",
+		"ServiceTask_Notify": "notify",
+		"ServiceTask_Charge": "",
+	}
+	for nodeID, topic := range expected {
+		if got := wd.Nodes[nodeID].ExternalTopic; got != topic {
+			t.Errorf("Expected %s external topic %q, got %q", nodeID, topic, got)
+		}
+	}
+}
+
+func TestParseBPMN_ExternalTasks_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		element  string
+		expected string
+	}{
+		{"missing topic", `<bpmn:serviceTask id="ServiceTask_1" type="external"/>`, "topic is required"},
+		{"topic without type", `<bpmn:serviceTask id="ServiceTask_1" topic="scoring"/>`, `topic requires type="external"`},
+		{"unsupported type", `<bpmn:serviceTask id="ServiceTask_1" type="connector" topic="scoring"/>`, `unsupported type "connector"`},
+		{"multi-instance", `<bpmn:serviceTask id="ServiceTask_1" type="external" topic="scoring">
+      <bpmn:multiInstanceLoopCharacteristics>
+        <bpmn:loopCardinality>3</bpmn:loopCardinality>
+      </bpmn:multiInstanceLoopCharacteristics>
+    </bpmn:serviceTask>`, "multi-instance is not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    ` + tt.element + `
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid external task")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseBPMN_Collaboration(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:collaboration id="Collaboration_1">
+    <bpmn:participant id="Participant_Customer" name="Customer" processRef="Process_Customer"/>
+    <bpmn:participant id="Participant_Supplier" name="Supplier" processRef="Process_Supplier"/>
+    <bpmn:participant id="Participant_Bank" name="Bank"/>
+    <bpmn:messageFlow id="MessageFlow_Order" sourceRef="Throw_Order" targetRef="Start_Supplier"/>
+    <bpmn:messageFlow id="MessageFlow_Payment" sourceRef="Participant_Bank" targetRef="Catch_Payment"/>
+    <bpmn:messageFlow id="MessageFlow_Invoice" sourceRef="Start_Supplier" targetRef="Participant_Bank"/>
+  </bpmn:collaboration>
+  <bpmn:process id="Process_Customer">
+    <bpmn:startEvent id="StartEvent_Order"/>
+    <bpmn:intermediateThrowEvent id="Throw_Order"/>
+    <bpmn:intermediateCatchEvent id="Catch_Payment"/>
+  </bpmn:process>
+  <bpmn:process id="Process_Supplier">
+    <bpmn:laneSet id="LaneSet_1">
+      <bpmn:lane id="Lane_Sales" name="Sales">
+        <bpmn:flowNodeRef>Start_Supplier</bpmn:flowNodeRef>
+        <bpmn:flowNodeRef>UserTask_Quote</bpmn:flowNodeRef>
+        <bpmn:childLaneSet id="LaneSet_2">
+          <bpmn:lane id="Lane_Approval" name="Approval" xflow:candidateGroups="managers, directors">
+            <bpmn:flowNodeRef>UserTask_Approve</bpmn:flowNodeRef>
+          </bpmn:lane>
+        </bpmn:childLaneSet>
+      </bpmn:lane>
+    </bpmn:laneSet>
+    <bpmn:startEvent id="Start_Supplier"/>
+    <bpmn:userTask id="UserTask_Quote"/>
+    <bpmn:userTask id="UserTask_Approve"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	if wd.Nodes["Throw_Order"].ProcessId != "Process_Customer" || wd.Nodes["UserTask_Quote"].ProcessId != "Process_Supplier" {
+		t.Errorf("Expected nodes to record their process, got %+v", wd.Nodes)
+	}
+	if lane := wd.Nodes["UserTask_Quote"].Lane; lane == nil || lane.Id != "Lane_Sales" || len(lane.CandidateGroups) != 1 || lane.CandidateGroups[0] != "Sales" {
+		t.Errorf("Expected UserTask_Quote in lane Sales with the lane name as group, got %+v", lane)
+	}
+	// 嵌套泳道覆盖父泳道
+	if lane := wd.Nodes["UserTask_Approve"].Lane; lane == nil || lane.Id != "Lane_Approval" || len(lane.CandidateGroups) != 2 || lane.CandidateGroups[1] != "directors" {
+		t.Errorf("Expected UserTask_Approve in lane Approval with groups managers,directors, got %+v", lane)
+	}
+	if wd.Nodes["Throw_Order"].Lane != nil {
+		t.Error("Expected Throw_Order to have no lane")
+	}
+
+	if len(wd.Participants) != 3 || wd.Participants["Participant_Supplier"].ProcessId != "Process_Supplier" || wd.Participants["Participant_Bank"].ProcessId != "" {
+		t.Errorf("Unexpected participants: %+v", wd.Participants)
+	}
+	if len(wd.MessageFlows) != 3 {
+		t.Errorf("Expected 3 message flows, got %+v", wd.MessageFlows)
+	}
+	// 目标为黑盒泳池的消息流不由引擎投递
+	if flows := MessageFlowsFrom(wd, "Start_Supplier"); len(flows) != 0 {
+		t.Errorf("Expected no deliverable message flows from Start_Supplier, got %+v", flows)
+	}
+	if flows := MessageFlowsFrom(wd, "Throw_Order"); len(flows) != 1 || flows[0].TargetRef != "Start_Supplier" {
+		t.Errorf("Expected MessageFlow_Order from Throw_Order, got %+v", flows)
+	}
+	// 消息启动的开始事件排在普通开始事件之后
+	if len(wd.StartEvents) != 2 || wd.StartEvents[0] != "StartEvent_Order" {
+		t.Errorf("Expected plain start event first, got %v", wd.StartEvents)
+	}
+}
+
+func TestParseBPMN_Collaboration_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		flow     string
+		expected string
+	}{
+		{"same process", `<bpmn:messageFlow id="MessageFlow_1" sourceRef="Task_A" targetRef="Catch_A"/>`, "connects nodes of the same process Process_A"},
+		{"task target", `<bpmn:messageFlow id="MessageFlow_1" sourceRef="Task_A" targetRef="Task_B"/>`, "target Task_B must be a top-level StartEvent"},
+		{"unknown target", `<bpmn:messageFlow id="MessageFlow_1" sourceRef="Task_A" targetRef="Catch_Missing"/>`, "references unknown target \"Catch_Missing\""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:collaboration id="Collaboration_1">
+    <bpmn:participant id="Participant_A" processRef="Process_A"/>
+    <bpmn:participant id="Participant_B" processRef="Process_B"/>
+    ` + tt.flow + `
+  </bpmn:collaboration>
+  <bpmn:process id="Process_A">
+    <bpmn:task id="Task_A"/>
+    <bpmn:intermediateCatchEvent id="Catch_A"/>
+  </bpmn:process>
+  <bpmn:process id="Process_B">
+    <bpmn:task id="Task_B"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid message flow")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseBPMN_VariableDeclarations(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:extensionElements>
+      <xflow:declarations>
+        <xflow:declaration name="Order amount" field="amount" type="Integer" required="true"/>
+        <xflow:declaration name="region" type="String" default="EU"/>
+        <xflow:declaration name="express" type="bool" default="false"/>
+        <xflow:declaration name="customer" type="Object" default='{"tier":"gold"}'/>
+        <xflow:declaration name="note"/>
+      </xflow:declarations>
+    </bpmn:extensionElements>
+    <bpmn:startEvent id="StartEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	wd, err := ParseBPMN(bpmnXML)
+	if err != nil {
+		t.Fatalf("Failed to parse BPMN: %v", err)
+	}
+
+	if len(wd.VariableDeclarations) != 5 {
+		t.Fatalf("Expected 5 variable declarations, got %+v", wd.VariableDeclarations)
+	}
+	// 编辑器生成的声明以 field 为变量名
+	if decl := FindVariableDeclaration(wd, "amount"); decl == nil || decl.Type != models.VariableTypeInt64 || !decl.Required || decl.Default != nil {
+		t.Errorf("Unexpected declaration of amount: %+v", decl)
+	}
+	if decl := FindVariableDeclaration(wd, "region"); decl == nil || decl.Type != models.VariableTypeString || decl.Required || decl.Default != "EU" {
+		t.Errorf("Unexpected declaration of region: %+v", decl)
+	}
+	if decl := FindVariableDeclaration(wd, "express"); decl == nil || decl.Type != models.VariableTypeBool || decl.Default != false {
+		t.Errorf("Unexpected declaration of express: %+v", decl)
+	}
+	if decl := FindVariableDeclaration(wd, "customer"); decl == nil || decl.Type != models.VariableTypeMessage {
+		t.Errorf("Unexpected declaration of customer: %+v", decl)
+	} else if customer, ok := decl.Default.(map[string]interface{}); !ok || customer["tier"] != "gold" {
+		t.Errorf("Expected customer default to be a JSON object, got %#v", decl.Default)
+	}
+	if decl := FindVariableDeclaration(wd, "note"); decl == nil || decl.Type != 0 {
+		t.Errorf("Expected untyped declaration of note, got %+v", decl)
+	}
+}
+
+func TestParseBPMN_VariableDeclarations_Invalid(t *testing.T) {
+	tests := []struct {
+		name         string
+		declarations string
+		expected     string
+	}{
+		{"missing name", `<xflow:declaration type="String"/>`, "declaration requires a name"},
+		{"unknown type", `<xflow:declaration name="amount" type="Decimal"/>`, `variable amount has unknown type "Decimal"`},
+		{"invalid default", `<xflow:declaration name="amount" type="Integer" default="ten"/>`, "default of variable amount is not a valid int64"},
+		{"invalid required", `<xflow:declaration name="amount" required="yes"/>`, "required of variable amount must be true or false"},
+		{"duplicate", `<xflow:declaration name="amount"/><xflow:declaration field="amount"/>`, "variable amount is declared more than once"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:extensionElements>
+      <xflow:declarations>` + tt.declarations + `</xflow:declarations>
+    </bpmn:extensionElements>
+    <bpmn:startEvent id="StartEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+			_, err := ParseBPMN(bpmnXML)
+			if err == nil {
+				t.Fatal("Expected error for invalid variable declaration")
+			}
+			if !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error to contain %q, got: %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestCheckTypedConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		expected  string
+	}{
+		{"declared variables", `amount &gt; 1000 &amp;&amp; region == "EU"`, ""},
+		{"untyped and produced variables", `note != nil &amp;&amp; approved &amp;&amp; score &gt; 2`, ""},
+		{"let variable", `let limit = 1000; amount &gt; limit`, ""},
+		{"integer arithmetic", `amount % 2 == 0`, ""},
+		{"typo", `amonut &gt; 1000`, "unknown variable amonut"},
+		{"mismatched types", `region &gt; 1000`, "mismatched types string and int"},
+		{"not a boolean", `amount + 1`, "expected bool"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:extensionElements>
+      <xflow:declarations>
+        <xflow:declaration name="amount" type="Integer"/>
+        <xflow:declaration name="region" type="String"/>
+        <xflow:declaration name="note"/>
+      </xflow:declarations>
+    </bpmn:extensionElements>
+    <bpmn:startEvent id="StartEvent_1"/>
+    <bpmn:scriptTask id="Script_1" scriptFormat="expr">
+      <bpmn:script>approved = amount &lt; 5000</bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:serviceTask id="ServiceTask_1">
+      <bpmn:extensionElements>
+        <xflow:url value="http://localhost:8080/api/score"/>
+        <xflow:output source="body.score" target="score"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:endEvent id="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="EndEvent_1">
+      <bpmn:conditionExpression>` + tt.condition + `</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+  </bpmn:process>
+</bpmn:definitions>`
+
+			// 解析不检查条件的类型，问题在部署和校验时报告
+			wd, err := ParseBPMN(bpmnXML)
+			if err != nil {
+				t.Fatalf("Expected BPMN to parse, got: %v", err)
+			}
+			err = CheckTypedConditions(wd)
+			report := Validate(bpmnXML)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("Expected condition to pass type checking, got: %v", err)
+				}
+				if findIssue(report, "Flow_1", RuleInvalidCondition) != nil {
+					t.Errorf("Expected no condition issue, got: %+v", report.Issues)
+				}
+				return
+			}
+			if err == nil || !contains(err.Error(), "invalid condition on SequenceFlow Flow_1") || !contains(err.Error(), tt.expected) {
+				t.Errorf("Expected condition error containing %q, got: %v", tt.expected, err)
+			}
+			if issue := findIssue(report, "Flow_1", RuleInvalidCondition); issue == nil || !contains(issue.Message, tt.expected) {
+				t.Errorf("Expected condition issue containing %q, got: %+v", tt.expected, report.Issues)
+			}
+		})
+	}
+}
+
+// containsID 检查 ID 列表是否包含指定 ID
+func containsID(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
 // contains 是一个辅助函数，用于检查字符串是否包含子字符串
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > len(substr) &&
@@ -0,0 +1,277 @@
+package parser
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/expr-lang/expr"
+)
+
+// 校验规则代码，编辑器按规则代码和元素 ID 高亮出问题的元素
+const (
+	RuleInvalidXML                 = "INVALID_XML"
+	RuleMissingProcess             = "MISSING_PROCESS"
+	RuleInvalidElement             = "INVALID_ELEMENT"
+	RuleDuplicateId                = "DUPLICATE_ID"
+	RuleStartEventCount            = "START_EVENT_COUNT"
+	RuleUnknownFlowReference       = "UNKNOWN_FLOW_REFERENCE"
+	RuleUnreachableNode            = "UNREACHABLE_NODE"
+	RuleDeadEnd                    = "DEAD_END"
+	RuleGatewayNoOutgoing          = "GATEWAY_NO_OUTGOING"
+	RuleGatewayDefaultFlow         = "GATEWAY_DEFAULT_FLOW"
+	RuleAmbiguousGateway           = "AMBIGUOUS_GATEWAY"
+	RuleInvalidCondition           = "INVALID_CONDITION"
+	RuleMissingBusinessApiUrl      = "MISSING_BUSINESS_API_URL"
+	RuleUserTaskFlow               = "USER_TASK_FLOW"
+	RuleCompensateReference        = "COMPENSATE_REFERENCE"
+	RuleInvalidMessageFlow         = "INVALID_MESSAGE_FLOW"
+	RuleUnknownLaneReference       = "UNKNOWN_LANE_REFERENCE"
+	RuleInvalidVariableDeclaration = "INVALID_VARIABLE_DECLARATION"
+)
+
+// issueCollector 收集解析和校验过程中发现的问题
+// firstErr 为第一个 error 级别的问题，ParseBPMN 直接返回它，保持原有的错误信息
+type issueCollector struct {
+	issues   []models.ValidationIssue
+	firstErr error
+}
+
+// addError 记录一个 error 级别的问题
+func (c *issueCollector) addError(elementId, rule string, err error) {
+	if c.firstErr == nil {
+		c.firstErr = err
+	}
+	c.issues = append(c.issues, models.ValidationIssue{
+		ElementId: elementId,
+		Severity:  models.ValidationSeverityError,
+		Rule:      rule,
+		Message:   err.Error(),
+	})
+}
+
+// addWarning 记录一个 warning 级别的问题
+func (c *issueCollector) addWarning(elementId, rule, format string, args ...interface{}) {
+	c.issues = append(c.issues, models.ValidationIssue{
+		ElementId: elementId,
+		Severity:  models.ValidationSeverityWarning,
+		Rule:      rule,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate 校验 BPMN XML 并返回全部问题，而不是像 ParseBPMN 那样在第一个错误处返回
+// 除 ParseBPMN 的检查外，还检查重复 ID、开始事件数量、连线引用、不可达节点、死路、
+// 没有出边的网关、无法编译的条件表达式和缺少业务接口 URL 的服务任务
+func Validate(bpmnContent string) *models.ValidationReport {
+	c := &issueCollector{}
+	if wd, def := buildDefinition(bpmnContent, c); wd != nil {
+		validateDuplicateIds(bpmnContent, c)
+		validateStartEventCount(wd, def, c)
+		validateFlowReferences(wd, c)
+		validateReachability(wd, c)
+		validateOutgoingFlows(wd, c)
+		validateConditions(wd, c)
+		validateServiceTasks(wd, c)
+	}
+
+	// error 在前，再按元素 ID 和规则排序，保证同一份 XML 的报告稳定
+	sort.SliceStable(c.issues, func(i, j int) bool {
+		a, b := c.issues[i], c.issues[j]
+		if a.Severity != b.Severity {
+			return a.Severity == models.ValidationSeverityError
+		}
+		if a.ElementId != b.ElementId {
+			return a.ElementId < b.ElementId
+		}
+		return a.Rule < b.Rule
+	})
+
+	report := &models.ValidationReport{Valid: true, Issues: []models.ValidationIssue{}}
+	for _, issue := range c.issues {
+		if issue.Severity == models.ValidationSeverityError {
+			report.Valid = false
+		}
+		report.Issues = append(report.Issues, issue)
+	}
+	return report
+}
+
+// validateDuplicateIds 检查 XML 中重复的 id 属性
+// 解析为 map 时重复 ID 的元素会互相覆盖，因此直接扫描 XML
+func validateDuplicateIds(bpmnContent string, c *issueCollector) {
+	decoder := xml.NewDecoder(strings.NewReader(bpmnContent))
+	seen := make(map[string]int)
+	var order []string
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// XML 已经成功解析过，这里不会出错
+			return
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Local != "id" || attr.Name.Space != "" || attr.Value == "" {
+				continue
+			}
+			if seen[attr.Value] == 0 {
+				order = append(order, attr.Value)
+			}
+			seen[attr.Value]++
+		}
+	}
+	for _, id := range order {
+		if seen[id] > 1 {
+			c.addError(id, RuleDuplicateId, fmt.Errorf("id %s is used by %d elements", id, seen[id]))
+		}
+	}
+}
+
+// validateStartEventCount 检查每个 process（协作图中的每个泳池）和每个子流程恰好有一个开始事件
+// 顶层的信号开始事件和消息流启动的开始事件由外部事件触发，不计入数量，但可以作为流程唯一的开始方式
+func validateStartEventCount(wd *models.WorkflowDefinition, def *definitions, c *issueCollector) {
+	messageFlowTargets := make(map[string]bool)
+	for _, flow := range wd.MessageFlows {
+		messageFlowTargets[flow.TargetRef] = true
+	}
+
+	names := make(map[string]string)
+	counts := make(map[string]int)
+	triggered := make(map[string]int)
+	for _, proc := range def.Processes {
+		names[proc.ID] = "process " + proc.ID
+		counts[proc.ID] = 0
+	}
+	for _, node := range wd.Nodes {
+		if node.Type == NodeTypeSubProcess {
+			names[node.Id] = "SubProcess " + node.Id
+			counts[node.Id] = 0
+		}
+	}
+	for _, node := range wd.Nodes {
+		if node.Type != NodeTypeStartEvent {
+			continue
+		}
+		switch {
+		case node.ParentId != "":
+			counts[node.ParentId]++
+		case node.SignalRef != "" || messageFlowTargets[node.Id]:
+			triggered[node.ProcessId]++
+		default:
+			counts[node.ProcessId]++
+		}
+	}
+	for scope, count := range counts {
+		switch {
+		case count == 0 && triggered[scope] == 0:
+			c.addError(scope, RuleStartEventCount, fmt.Errorf("%s has no StartEvent", names[scope]))
+		case count > 1:
+			c.addError(scope, RuleStartEventCount, fmt.Errorf("%s has %d StartEvents, expected exactly one", names[scope], count))
+		}
+	}
+}
+
+// validateFlowReferences 检查连线的 sourceRef 和 targetRef 引用存在的节点
+// buildAdjacencyLists 会忽略这样的连线，运行时令牌无法沿它流转
+func validateFlowReferences(wd *models.WorkflowDefinition, c *issueCollector) {
+	for flowID, flow := range wd.SequenceFlows {
+		if _, exists := wd.Nodes[flow.SourceNodeId]; !exists {
+			c.addError(flowID, RuleUnknownFlowReference, fmt.Errorf("SequenceFlow %s references unknown source %q", flowID, flow.SourceNodeId))
+		}
+		if _, exists := wd.Nodes[flow.TargetNodeId]; !exists {
+			c.addError(flowID, RuleUnknownFlowReference, fmt.Errorf("SequenceFlow %s references unknown target %q", flowID, flow.TargetNodeId))
+		}
+	}
+}
+
+// validateReachability 从顶层开始事件沿邻接表（含子流程和边界事件的穿越边）遍历，报告无法到达的节点
+func validateReachability(wd *models.WorkflowDefinition, c *issueCollector) {
+	if len(wd.StartEvents) == 0 {
+		return // 没有开始事件已经报告过
+	}
+	visited := make(map[string]bool)
+	queue := append([]string{}, wd.StartEvents...)
+	for _, id := range queue {
+		visited[id] = true
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, next := range wd.AdjacencyList[current] {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	for nodeID := range wd.Nodes {
+		if !visited[nodeID] {
+			c.addWarning(nodeID, RuleUnreachableNode, "node %s cannot be reached from any StartEvent", nodeID)
+		}
+	}
+}
+
+// validateOutgoingFlows 检查没有出边的节点
+// 网关没有出边时令牌无处可去，是 error；其他节点会隐式结束令牌，只给出 warning
+// UserTask 等节点的出边可以从依附的边界事件出发，依附了边界事件的节点不算死路
+func validateOutgoingFlows(wd *models.WorkflowDefinition, c *issueCollector) {
+	hasOutgoing := make(map[string]bool)
+	for _, flow := range wd.SequenceFlows {
+		hasOutgoing[flow.SourceNodeId] = true
+	}
+	for _, node := range wd.Nodes {
+		if node.Type == NodeTypeBoundaryEvent {
+			hasOutgoing[node.AttachedNodeId] = true
+		}
+	}
+
+	for nodeID, node := range wd.Nodes {
+		if hasOutgoing[nodeID] {
+			continue
+		}
+		switch node.Type {
+		case NodeTypeEndEvent:
+		case NodeTypeExclusiveGateway, NodeTypeParallelGateway, NodeTypeInclusiveGateway, NodeTypeEventBasedGateway:
+			c.addError(nodeID, RuleGatewayNoOutgoing, fmt.Errorf("gateway %s has no outgoing flows", nodeID))
+		default:
+			c.addWarning(nodeID, RuleDeadEnd, "node %s has no outgoing flows and is not an EndEvent", nodeID)
+		}
+	}
+}
+
+// validateConditions 检查连线的条件表达式能被 expr 编译
+// 没有变量声明时不知道流程变量，只检查语法；声明了变量的流程按声明的类型检查
+func validateConditions(wd *models.WorkflowDefinition, c *issueCollector) {
+	if len(wd.VariableDeclarations) > 0 {
+		validateTypedConditions(wd, c)
+		return
+	}
+	for flowID, flow := range wd.SequenceFlows {
+		if flow.ConditionExpression == "" {
+			continue
+		}
+		if _, err := expr.Compile(flow.ConditionExpression); err != nil {
+			c.addError(flowID, RuleInvalidCondition, fmt.Errorf("invalid condition on SequenceFlow %s: %w", flowID, err))
+		}
+	}
+}
+
+// validateServiceTasks 检查非外部任务的 ServiceTask 配置了业务接口 URL
+// 没有 URL 的任务只能在 Mock 模式下执行
+func validateServiceTasks(wd *models.WorkflowDefinition, c *issueCollector) {
+	for nodeID, node := range wd.Nodes {
+		if node.Type == NodeTypeServiceTask && node.ExternalTopic == "" && node.BusinessApiUrl == "" {
+			c.addWarning(nodeID, RuleMissingBusinessApiUrl, "ServiceTask %s has no business API URL and can only run with mock data", nodeID)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+)
+
+func TestValidate_ValidDefinition(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="StartEvent_1"/>
+    <bpmn:serviceTask id="ServiceTask_1">
+      <bpmn:extensionElements>
+        <xflow:url value="http://localhost:8080/api/orders"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:exclusiveGateway id="Gateway_1" default="Flow_3"/>
+    <bpmn:endEvent id="EndEvent_1"/>
+    <bpmn:endEvent id="EndEvent_2"/>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="ServiceTask_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="ServiceTask_1" targetRef="Gateway_1"/>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="Gateway_1" targetRef="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_4" sourceRef="Gateway_1" targetRef="EndEvent_2">
+      <bpmn:conditionExpression>amount > 1000 &amp;&amp; region == "EU"</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	report := Validate(bpmnXML)
+	if !report.Valid {
+		t.Errorf("Expected definition to be valid, got issues: %+v", report.Issues)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("Expected no issues, got %+v", report.Issues)
+	}
+}
+
+func TestValidate_ReportsEveryIssue(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="StartEvent_1"/>
+    <bpmn:exclusiveGateway id="Gateway_1"/>
+    <bpmn:serviceTask id="ServiceTask_1"/>
+    <bpmn:parallelGateway id="Gateway_2"/>
+    <bpmn:userTask id="UserTask_1">
+      <bpmn:multiInstanceLoopCharacteristics/>
+    </bpmn:userTask>
+    <bpmn:task id="Task_Dup"/>
+    <bpmn:task id="Task_Dup"/>
+    <bpmn:endEvent id="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Gateway_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Gateway_1" targetRef="ServiceTask_1">
+      <bpmn:conditionExpression>amount &gt;</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="Gateway_1" targetRef="EndEvent_1">
+      <bpmn:conditionExpression>amount &lt;= 10</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_4" sourceRef="StartEvent_1" targetRef="Task_Missing"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	report := Validate(bpmnXML)
+	if report.Valid {
+		t.Fatal("Expected definition to be invalid")
+	}
+
+	expected := []struct {
+		elementId string
+		rule      string
+		severity  string
+	}{
+		{"UserTask_1", RuleInvalidElement, models.ValidationSeverityError},
+		{"Task_Dup", RuleDuplicateId, models.ValidationSeverityError},
+		{"Flow_4", RuleUnknownFlowReference, models.ValidationSeverityError},
+		{"Flow_2", RuleInvalidCondition, models.ValidationSeverityError},
+		{"Gateway_2", RuleGatewayNoOutgoing, models.ValidationSeverityError},
+		{"Gateway_2", RuleUnreachableNode, models.ValidationSeverityWarning},
+		{"UserTask_1", RuleUnreachableNode, models.ValidationSeverityWarning},
+		{"ServiceTask_1", RuleDeadEnd, models.ValidationSeverityWarning},
+		{"ServiceTask_1", RuleMissingBusinessApiUrl, models.ValidationSeverityWarning},
+	}
+	for _, e := range expected {
+		issue := findIssue(report, e.elementId, e.rule)
+		if issue == nil {
+			t.Errorf("Expected %s issue on %s, got %+v", e.rule, e.elementId, report.Issues)
+			continue
+		}
+		if issue.Severity != e.severity {
+			t.Errorf("Expected %s issue on %s to be %s, got %s", e.rule, e.elementId, e.severity, issue.Severity)
+		}
+	}
+
+	// error 排在 warning 之前
+	seenWarning := false
+	for _, issue := range report.Issues {
+		if issue.Severity == models.ValidationSeverityWarning {
+			seenWarning = true
+		} else if seenWarning {
+			t.Errorf("Expected errors before warnings, got %+v", report.Issues)
+			break
+		}
+	}
+
+	// ParseBPMN 仍然只返回第一个错误
+	_, err := ParseBPMN(bpmnXML)
+	if err == nil || !contains(err.Error(), "multi-instance is not supported on UserTask UserTask_1") {
+		t.Errorf("Expected ParseBPMN to return the element error, got: %v", err)
+	}
+}
+
+func TestValidate_StartEventCount(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="StartEvent_1"/>
+    <bpmn:startEvent id="StartEvent_2"/>
+    <bpmn:subProcess id="SubProcess_1">
+      <bpmn:endEvent id="SubEnd_1"/>
+    </bpmn:subProcess>
+    <bpmn:endEvent id="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="SubProcess_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="StartEvent_2" targetRef="SubProcess_1"/>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="SubProcess_1" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	report := Validate(bpmnXML)
+	if report.Valid {
+		t.Fatal("Expected definition to be invalid")
+	}
+	if issue := findIssue(report, "SubProcess_1", RuleStartEventCount); issue == nil || issue.Severity != models.ValidationSeverityError {
+		t.Errorf("Expected START_EVENT_COUNT error on SubProcess_1, got %+v", report.Issues)
+	}
+	if issue := findIssue(report, "Process_1", RuleStartEventCount); issue == nil || issue.Severity != models.ValidationSeverityError {
+		t.Errorf("Expected START_EVENT_COUNT error on the process, got %+v", report.Issues)
+	}
+}
+
+func TestValidate_StartEventCount_TwoStartEvents(t *testing.T) {
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="StartEvent_1"/>
+    <bpmn:startEvent id="StartEvent_2"/>
+    <bpmn:endEvent id="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="StartEvent_2" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	report := Validate(bpmnXML)
+	if report.Valid {
+		t.Fatal("Expected definition with two start events to be invalid")
+	}
+	issue := findIssue(report, "Process_1", RuleStartEventCount)
+	if issue == nil || issue.Severity != models.ValidationSeverityError || !contains(issue.Message, "has 2 StartEvents") {
+		t.Errorf("Expected START_EVENT_COUNT error on the process, got %+v", report.Issues)
+	}
+}
+
+func TestValidate_StartEventCount_SignalStartEvent(t *testing.T) {
+	// 信号开始事件不计入数量：可以和普通开始事件并存，也可以是唯一的开始事件
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:signal id="Signal_Recall" name="ProductRecall"/>
+  <bpmn:process id="Process_1">
+    <bpmn:startEvent id="StartEvent_1"/>
+    <bpmn:startEvent id="Start_Recall">
+      <bpmn:signalEventDefinition signalRef="Signal_Recall"/>
+    </bpmn:startEvent>
+    <bpmn:endEvent id="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Start_Recall" targetRef="EndEvent_1"/>
+  </bpmn:process>
+  <bpmn:process id="Process_2">
+    <bpmn:startEvent id="Start_Recall_2">
+      <bpmn:signalEventDefinition signalRef="Signal_Recall"/>
+    </bpmn:startEvent>
+    <bpmn:endEvent id="EndEvent_2"/>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="Start_Recall_2" targetRef="EndEvent_2"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	report := Validate(bpmnXML)
+	for _, processId := range []string{"Process_1", "Process_2"} {
+		if issue := findIssue(report, processId, RuleStartEventCount); issue != nil {
+			t.Errorf("Expected no START_EVENT_COUNT issue on %s, got %+v", processId, issue)
+		}
+	}
+}
+
+func TestValidate_InvalidDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		rule string
+	}{
+		{"empty", "  ", RuleInvalidXML},
+		{"malformed", "<bpmn:definitions", RuleInvalidXML},
+		{"missing process", `<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL"/>`, RuleMissingProcess},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Validate(tt.xml)
+			if report.Valid {
+				t.Fatal("Expected document to be invalid")
+			}
+			if len(report.Issues) != 1 || report.Issues[0].Rule != tt.rule {
+				t.Errorf("Expected a single %s issue, got %+v", tt.rule, report.Issues)
+			}
+		})
+	}
+}
+
+// findIssue 查找指定元素和规则的问题
+func findIssue(report *models.ValidationReport, elementId, rule string) *models.ValidationIssue {
+	for i := range report.Issues {
+		if report.Issues[i].ElementId == elementId && report.Issues[i].Rule == rule {
+			return &report.Issues[i]
+		}
+	}
+	return nil
+}
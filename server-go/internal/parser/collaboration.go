@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bpmn-explorer/server/internal/models"
+)
+
+// collaboration 协作图：多个泳池（participant）及其之间的消息流
+type collaboration struct {
+	ID           string        `xml:"id,attr"`
+	Participants []participant `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL participant"`
+	MessageFlows []messageFlow `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL messageFlow"`
+}
+
+type participant struct {
+	ID         string `xml:"id,attr"`
+	Name       string `xml:"name,attr"`
+	ProcessRef string `xml:"processRef,attr"`
+}
+
+type messageFlow struct {
+	ID         string `xml:"id,attr"`
+	Name       string `xml:"name,attr"`
+	SourceRef  string `xml:"sourceRef,attr"`
+	TargetRef  string `xml:"targetRef,attr"`
+	MessageRef string `xml:"messageRef,attr"`
+}
+
+type laneSet struct {
+	Lanes []lane `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL lane"`
+}
+
+type lane struct {
+	ID           string     `xml:"id,attr"`
+	Name         string     `xml:"name,attr"`
+	Attrs        []xml.Attr `xml:",any,attr"`
+	FlowNodeRefs []string   `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL flowNodeRef"`
+	ChildLaneSet *laneSet   `xml:"http://www.omg.org/spec/BPMN/20100524/MODEL childLaneSet"`
+}
+
+// parseLanes 解析 laneSet，把泳道记录到其中的节点上
+// 泳道的候选组来自 xflow:candidateGroups 属性，未配置时使用泳道名称；嵌套泳道在父泳道之后解析，节点最终属于最内层的泳道
+func parseLanes(sets []laneSet, wd *models.WorkflowDefinition, c *issueCollector) {
+	for _, set := range sets {
+		for _, l := range set.Lanes {
+			laneDef := &models.Lane{Id: l.ID, Name: l.Name}
+			for _, a := range l.Attrs {
+				if a.Name.Space == xflowNamespace && a.Name.Local == "candidateGroups" {
+					laneDef.CandidateGroups = splitTaskList(strings.TrimSpace(a.Value))
+				}
+			}
+			if laneDef.CandidateGroups == nil && l.Name != "" {
+				laneDef.CandidateGroups = []string{l.Name}
+			}
+
+			for _, ref := range l.FlowNodeRefs {
+				nodeID := strings.TrimSpace(ref)
+				node, exists := wd.Nodes[nodeID]
+				if !exists {
+					// 泳道只影响认领，引用失效的节点不影响执行
+					c.addWarning(l.ID, RuleUnknownLaneReference, "lane %s references unknown node %s", l.ID, nodeID)
+					continue
+				}
+				node.Lane = laneDef
+				wd.Nodes[nodeID] = node
+			}
+
+			if l.ChildLaneSet != nil {
+				parseLanes([]laneSet{*l.ChildLaneSet}, wd, c)
+			}
+		}
+	}
+}
+
+// parseCollaboration 解析协作图的参与者和消息流
+// 消息流的目标节点必须是顶层开始事件（启动目标泳池的流程）或捕获事件、边界事件（唤醒等待的令牌），且不能连接同一个 process 内的节点
+func parseCollaboration(col *collaboration, wd *models.WorkflowDefinition, c *issueCollector) {
+	if col == nil {
+		return
+	}
+
+	for _, p := range col.Participants {
+		wd.Participants[p.ID] = models.Participant{
+			Id:        p.ID,
+			Name:      p.Name,
+			ProcessId: p.ProcessRef,
+		}
+	}
+
+	for _, mf := range col.MessageFlows {
+		flow := models.MessageFlow{
+			Id:         mf.ID,
+			Name:       mf.Name,
+			SourceRef:  mf.SourceRef,
+			TargetRef:  mf.TargetRef,
+			MessageRef: mf.MessageRef,
+		}
+		wd.MessageFlows[flow.Id] = flow
+
+		source, sourceIsNode := wd.Nodes[flow.SourceRef]
+		if _, isParticipant := wd.Participants[flow.SourceRef]; !sourceIsNode && !isParticipant {
+			c.addError(flow.Id, RuleUnknownFlowReference, fmt.Errorf("MessageFlow %s references unknown source %q", flow.Id, flow.SourceRef))
+		}
+		target, targetIsNode := wd.Nodes[flow.TargetRef]
+		if _, isParticipant := wd.Participants[flow.TargetRef]; !targetIsNode && !isParticipant {
+			c.addError(flow.Id, RuleUnknownFlowReference, fmt.Errorf("MessageFlow %s references unknown target %q", flow.Id, flow.TargetRef))
+		}
+		if !targetIsNode {
+			continue
+		}
+
+		if sourceIsNode && source.ProcessId == target.ProcessId {
+			c.addError(flow.Id, RuleInvalidMessageFlow, fmt.Errorf("MessageFlow %s connects nodes of the same process %s", flow.Id, target.ProcessId))
+		}
+		switch {
+		case target.Type == NodeTypeStartEvent && target.ParentId == "":
+		case target.Type == NodeTypeIntermediateCatchEvent, target.Type == NodeTypeBoundaryEvent:
+		default:
+			c.addError(flow.Id, RuleInvalidMessageFlow, fmt.Errorf(
+				"MessageFlow %s target %s must be a top-level StartEvent, IntermediateCatchEvent or BoundaryEvent", flow.Id, target.Id))
+		}
+	}
+}
+
+// MessageFlowsFrom returns the message flows leaving the node whose target is a node of the definition, ordered by ID
+// 目标为参与者（黑盒泳池）的消息流由引擎之外的系统接收，不在这里返回
+func MessageFlowsFrom(wd *models.WorkflowDefinition, nodeId string) []models.MessageFlow {
+	var flows []models.MessageFlow
+	for _, flow := range wd.MessageFlows {
+		if _, exists := wd.Nodes[flow.TargetRef]; exists && flow.SourceRef == nodeId {
+			flows = append(flows, flow)
+		}
+	}
+	sort.Slice(flows, func(i, j int) bool {
+		return flows[i].Id < flows[j].Id
+	})
+	return flows
+}
+
+// isMessageFlowTarget 检查节点是否为消息流的目标
+func isMessageFlowTarget(wd *models.WorkflowDefinition, nodeId string) bool {
+	for _, flow := range wd.MessageFlows {
+		if flow.TargetRef == nodeId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isoDurationPattern 匹配 ISO-8601 时长（不支持年和月，二者长度不固定）
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseDuration 解析 BPMN 扩展属性中的时长
+// 支持 ISO-8601 格式（如 PT30S、P1DT2H）以及 Go 格式（如 500ms、1m30s）
+func ParseDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("duration is empty")
+	}
+
+	if !strings.HasPrefix(strings.ToUpper(value), "P") {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", value, err)
+		}
+		if d < 0 {
+			return 0, fmt.Errorf("invalid duration %q: must not be negative", value)
+		}
+		return d, nil
+	}
+
+	matches := isoDurationPattern.FindStringSubmatch(strings.ToUpper(value))
+	if matches == nil || value == "P" || strings.HasSuffix(strings.ToUpper(value), "T") {
+		return 0, fmt.Errorf("invalid ISO-8601 duration %q", value)
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute}
+	var total time.Duration
+	for i, unit := range units {
+		if matches[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(matches[i+1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO-8601 duration %q: %w", value, err)
+		}
+		total += time.Duration(n) * unit
+	}
+	if matches[5] != "" {
+		seconds, err := strconv.ParseFloat(matches[5], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid ISO-8601 duration %q: %w", value, err)
+		}
+		total += time.Duration(seconds * float64(time.Second))
+	}
+
+	return total, nil
+}
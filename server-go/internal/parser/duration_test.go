@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"PT30S", 30 * time.Second, false},
+		{"PT1.5S", 1500 * time.Millisecond, false},
+		{"P1DT2H", 26 * time.Hour, false},
+		{"P1W", 7 * 24 * time.Hour, false},
+		{"PT10M", 10 * time.Minute, false},
+		{"500ms", 500 * time.Millisecond, false},
+		{"1m30s", 90 * time.Second, false},
+		{"", 0, true},
+		{"P", 0, true},
+		{"PT", 0, true},
+		{"P1M", 0, true},
+		{"-5s", 0, true},
+	}
+
+	for _, tt := range tests {
+		d, err := ParseDuration(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseDuration(%q): expected error", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDuration(%q): unexpected error: %v", tt.value, err)
+			continue
+		}
+		if d != tt.expected {
+			t.Errorf("ParseDuration(%q) = %v, expected %v", tt.value, d, tt.expected)
+		}
+	}
+}
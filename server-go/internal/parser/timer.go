@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+)
+
+// TimerDueDate 计算定时器从 from 开始后的首次触发时间
+func TimerDueDate(def *models.TimerDefinition, from time.Time) (time.Time, error) {
+	if def == nil {
+		return time.Time{}, fmt.Errorf("timer definition is empty")
+	}
+
+	switch def.Type {
+	case models.TimerTypeDuration:
+		d, err := ParseDuration(def.Expression)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return from.Add(d), nil
+
+	case models.TimerTypeDate:
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(def.Expression))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid ISO-8601 date %q: %w", def.Expression, err)
+		}
+		return t, nil
+
+	case models.TimerTypeCycle:
+		_, start, interval, err := ParseTimeCycle(def.Expression)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if !start.IsZero() && start.After(from) {
+			return start, nil
+		}
+		return from.Add(interval), nil
+
+	default:
+		return time.Time{}, fmt.Errorf("unsupported timer type %q", def.Type)
+	}
+}
+
+// ParseTimeCycle 解析 ISO-8601 重复间隔，如 R3/PT1H、R/P1D、R5/2026-01-01T09:00:00Z/PT10M
+// repetitions 为 -1 表示无限重复，start 为零值表示没有指定开始时间
+func ParseTimeCycle(value string) (repetitions int, start time.Time, interval time.Duration, err error) {
+	parts := strings.Split(strings.TrimSpace(value), "/")
+	if len(parts) < 2 || len(parts) > 3 || !strings.HasPrefix(strings.ToUpper(parts[0]), "R") {
+		return 0, time.Time{}, 0, fmt.Errorf("invalid ISO-8601 cycle %q", value)
+	}
+
+	repetitions = -1
+	if count := parts[0][1:]; count != "" {
+		repetitions, err = strconv.Atoi(count)
+		if err != nil || repetitions < 1 {
+			return 0, time.Time{}, 0, fmt.Errorf("invalid repetition count in cycle %q", value)
+		}
+	}
+
+	if len(parts) == 3 {
+		start, err = time.Parse(time.RFC3339, parts[1])
+		if err != nil {
+			return 0, time.Time{}, 0, fmt.Errorf("invalid start date in cycle %q: %w", value, err)
+		}
+	}
+
+	interval, err = ParseDuration(parts[len(parts)-1])
+	if err != nil {
+		return 0, time.Time{}, 0, fmt.Errorf("invalid interval in cycle %q: %w", value, err)
+	}
+	if interval <= 0 {
+		return 0, time.Time{}, 0, fmt.Errorf("interval in cycle %q must be positive", value)
+	}
+
+	return repetitions, start, interval, nil
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+)
+
+func TestTimerDueDate(t *testing.T) {
+	from := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		def      *models.TimerDefinition
+		expected time.Time
+		wantErr  bool
+	}{
+		{"duration", &models.TimerDefinition{Type: models.TimerTypeDuration, Expression: "P3D"}, from.Add(72 * time.Hour), false},
+		{"date", &models.TimerDefinition{Type: models.TimerTypeDate, Expression: "2026-02-01T08:00:00Z"}, time.Date(2026, 2, 1, 8, 0, 0, 0, time.UTC), false},
+		{"cycle", &models.TimerDefinition{Type: models.TimerTypeCycle, Expression: "R3/PT1H"}, from.Add(time.Hour), false},
+		{"cycle with future start", &models.TimerDefinition{Type: models.TimerTypeCycle, Expression: "R/2026-01-02T00:00:00Z/P1D"}, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{"invalid duration", &models.TimerDefinition{Type: models.TimerTypeDuration, Expression: "3 days"}, time.Time{}, true},
+		{"invalid date", &models.TimerDefinition{Type: models.TimerTypeDate, Expression: "tomorrow"}, time.Time{}, true},
+		{"unknown type", &models.TimerDefinition{Type: "cron", Expression: "* * * * *"}, time.Time{}, true},
+		{"nil", nil, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, err := TimerDueDate(tt.def, from)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got due date %v", due)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !due.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, due)
+			}
+		})
+	}
+}
+
+func TestParseTimeCycle(t *testing.T) {
+	repetitions, start, interval, err := ParseTimeCycle("R5/2026-01-01T09:00:00Z/PT10M")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if repetitions != 5 || interval != 10*time.Minute || !start.Equal(time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected cycle: repetitions=%d start=%v interval=%v", repetitions, start, interval)
+	}
+
+	repetitions, start, _, err = ParseTimeCycle("R/P1D")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if repetitions != -1 || !start.IsZero() {
+		t.Errorf("Expected infinite cycle without start, got repetitions=%d start=%v", repetitions, start)
+	}
+
+	for _, invalid := range []string{"PT1H", "R0/PT1H", "R3/PT0S", "R3/a/b/c", "Rx/PT1H"} {
+		if _, _, _, err := ParseTimeCycle(invalid); err == nil {
+			t.Errorf("Expected error for cycle %q", invalid)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+)
+
+// variableTypes 声明中的类型名称（不区分大小写）到 FieldDescriptor::CppType 的映射
+// 支持编辑器生成的 String、Integer、Boolean，以及 CppType 的名称
+var variableTypes = map[string]uint32{
+	"string":  models.VariableTypeString,
+	"integer": models.VariableTypeInt64,
+	"boolean": models.VariableTypeBool,
+	"double":  models.VariableTypeDouble,
+	"object":  models.VariableTypeMessage,
+	"int32":   models.VariableTypeInt32,
+	"int64":   models.VariableTypeInt64,
+	"uint32":  models.VariableTypeUint32,
+	"uint64":  models.VariableTypeUint64,
+	"float":   models.VariableTypeFloat,
+	"bool":    models.VariableTypeBool,
+	"enum":    models.VariableTypeEnum,
+	"message": models.VariableTypeMessage,
+}
+
+// VariableTypeName returns the readable name of a variable type for error messages
+func VariableTypeName(t uint32) string {
+	switch t {
+	case models.VariableTypeInt32:
+		return "int32"
+	case models.VariableTypeInt64:
+		return "int64"
+	case models.VariableTypeUint32:
+		return "uint32"
+	case models.VariableTypeUint64:
+		return "uint64"
+	case models.VariableTypeDouble:
+		return "double"
+	case models.VariableTypeFloat:
+		return "float"
+	case models.VariableTypeBool:
+		return "bool"
+	case models.VariableTypeEnum:
+		return "enum"
+	case models.VariableTypeString:
+		return "string"
+	case models.VariableTypeMessage:
+		return "object"
+	}
+	return "any"
+}
+
+// parseVariableDeclarations 解析 process 上声明的流程变量
+// 例如 <xflow:declarations><xflow:declaration field="amount" type="Integer" required="true" default="0"/></xflow:declarations>；
+// 编辑器生成的声明中 field 为变量名、name 为显示名称，没有 field 时使用 name 作为变量名
+func parseVariableDeclarations(proc *process, wd *models.WorkflowDefinition, c *issueCollector) {
+	for _, ext := range proc.ExtensionElements.Values {
+		if !strings.EqualFold(ext.XMLName.Local, "declarations") {
+			continue
+		}
+		for _, child := range ext.Children {
+			if !strings.EqualFold(child.XMLName.Local, "declaration") {
+				continue
+			}
+			decl, err := parseVariableDeclaration(child)
+			if err == nil && FindVariableDeclaration(wd, decl.Name) != nil {
+				err = fmt.Errorf("variable %s is declared more than once", decl.Name)
+			}
+			if err != nil {
+				c.addError(proc.ID, RuleInvalidVariableDeclaration, fmt.Errorf("invalid variable declaration on process %s: %w", proc.ID, err))
+				continue
+			}
+			wd.VariableDeclarations = append(wd.VariableDeclarations, *decl)
+		}
+	}
+}
+
+// parseVariableDeclaration 解析一条变量声明，默认值按声明的类型转换
+func parseVariableDeclaration(ext extensionValue) (*models.VariableDeclaration, error) {
+	decl := &models.VariableDeclaration{Name: ext.attr("field")}
+	if decl.Name == "" {
+		decl.Name = ext.attr("name")
+	}
+	if decl.Name == "" {
+		return nil, fmt.Errorf("declaration requires a name")
+	}
+
+	if v := ext.attr("type"); v != "" {
+		t, ok := variableTypes[strings.ToLower(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable %s has unknown type %q", decl.Name, v)
+		}
+		decl.Type = t
+	}
+	if v := ext.attr("required"); v != "" {
+		required, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("required of variable %s must be true or false, got %q", decl.Name, v)
+		}
+		decl.Required = required
+	}
+	// default 属性的空值无法和未配置区分，空字符串默认值不被支持
+	if v := ext.attr("default"); v != "" {
+		value, err := parseVariableDefault(decl.Type, v)
+		if err != nil {
+			return nil, fmt.Errorf("default of variable %s is not a valid %s: %w", decl.Name, VariableTypeName(decl.Type), err)
+		}
+		decl.Default = value
+	}
+	return decl, nil
+}
+
+// parseVariableDefault 把默认值转换为声明的类型；整数转换为 int64（无符号类型为 uint64），对象为 JSON object
+func parseVariableDefault(t uint32, raw string) (interface{}, error) {
+	switch t {
+	case models.VariableTypeInt32:
+		return strconv.ParseInt(raw, 10, 32)
+	case models.VariableTypeInt64:
+		return strconv.ParseInt(raw, 10, 64)
+	case models.VariableTypeUint32:
+		return strconv.ParseUint(raw, 10, 32)
+	case models.VariableTypeUint64:
+		return strconv.ParseUint(raw, 10, 64)
+	case models.VariableTypeDouble, models.VariableTypeFloat:
+		return strconv.ParseFloat(raw, 64)
+	case models.VariableTypeBool:
+		return strconv.ParseBool(raw)
+	case models.VariableTypeMessage:
+		var value map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	return raw, nil
+}
+
+// FindVariableDeclaration returns the declaration of the named variable, or nil when it is not declared
+func FindVariableDeclaration(wd *models.WorkflowDefinition, name string) *models.VariableDeclaration {
+	for i := range wd.VariableDeclarations {
+		if wd.VariableDeclarations[i].Name == name {
+			return &wd.VariableDeclarations[i]
+		}
+	}
+	return nil
+}
+
+// CheckTypedConditions checks the conditions of a workflow with variable declarations and returns the first problem
+// 部署时调用；解析（ParseBPMN）不做此检查，已保存和已部署的流程不会因此无法加载
+func CheckTypedConditions(wd *models.WorkflowDefinition) error {
+	c := &issueCollector{}
+	validateTypedConditions(wd, c)
+	return c.firstErr
+}
+
+// validateTypedConditions 按声明的变量类型检查序列流的条件表达式，没有变量声明的流程不检查
+// 条件只能引用声明的变量和流程自身写入的变量（输出映射、脚本和多实例的变量），引用其他变量（如拼写错误）即为错误；
+// 随事件传入的变量（完成人工任务、外部任务，消息和信号的载荷）流程无法推断，条件引用它们时必须声明。
+// 条件必须返回布尔值。流程自身写入的变量类型未知，不参与类型检查
+func validateTypedConditions(wd *models.WorkflowDefinition, c *issueCollector) {
+	if len(wd.VariableDeclarations) == 0 {
+		return
+	}
+
+	env := make(map[string]interface{})
+	known := producedVariables(wd)
+	for _, decl := range wd.VariableDeclarations {
+		known[decl.Name] = true
+		if value := zeroVariableValue(decl.Type); value != nil {
+			env[decl.Name] = value
+		}
+	}
+
+	// 按 ID 顺序检查，CheckTypedConditions 返回的第一个问题保持稳定
+	flowIDs := make([]string, 0, len(wd.SequenceFlows))
+	for flowID := range wd.SequenceFlows {
+		flowIDs = append(flowIDs, flowID)
+	}
+	sort.Strings(flowIDs)
+	for _, flowID := range flowIDs {
+		flow := wd.SequenceFlows[flowID]
+		if flow.ConditionExpression == "" {
+			continue
+		}
+		// 未在 env 中的变量按未知类型检查，是否存在由 unknownIdentifier 判断
+		program, err := expr.Compile(flow.ConditionExpression, expr.Env(env), expr.AllowUndefinedVariables(), expr.AsBool())
+		if err == nil {
+			node := program.Node()
+			if name := unknownIdentifier(&node, known); name != "" {
+				err = fmt.Errorf("unknown variable %s", name)
+			}
+		}
+		if err != nil {
+			c.addError(flowID, RuleInvalidCondition, fmt.Errorf("invalid condition on SequenceFlow %s: %w", flowID, err))
+		}
+	}
+}
+
+// producedVariables 返回流程自身写入的变量名：输出映射的目标、脚本的赋值目标和结果变量、多实例的元素变量和输出集合
+func producedVariables(wd *models.WorkflowDefinition) map[string]bool {
+	names := make(map[string]bool)
+	for _, node := range wd.Nodes {
+		for _, mapping := range node.OutputMappings {
+			names[mapping.Target] = true
+		}
+		if node.Script != nil {
+			for _, assignment := range node.Script.Assignments {
+				names[assignment.Target] = true
+			}
+			if node.Script.ResultVariable != "" {
+				names[node.Script.ResultVariable] = true
+			}
+		}
+		if mi := node.MultiInstance; mi != nil {
+			names["loopCounter"] = true
+			names["nrOfInstances"] = true
+			if mi.ElementVariable != "" {
+				names[mi.ElementVariable] = true
+			}
+			if mi.OutputCollection != "" {
+				names[mi.OutputCollection] = true
+			}
+		}
+	}
+	return names
+}
+
+// zeroVariableValue 返回类型检查时代表声明类型的值，未声明类型时返回 nil
+// 整数类型与引擎执行时变量的表示一致（int64/uint64，见 services.normalizeVariableValue）
+func zeroVariableValue(t uint32) interface{} {
+	switch t {
+	case models.VariableTypeInt32, models.VariableTypeInt64:
+		return int64(0)
+	case models.VariableTypeUint32, models.VariableTypeUint64:
+		return uint64(0)
+	case models.VariableTypeDouble, models.VariableTypeFloat:
+		return 0.0
+	case models.VariableTypeBool:
+		return false
+	case models.VariableTypeString, models.VariableTypeEnum:
+		return ""
+	case models.VariableTypeMessage:
+		return map[string]interface{}{}
+	}
+	return nil
+}
+
+// unknownIdentifier 返回表达式中第一个未知的变量名，全部已知时返回 ""
+// ast.Walk 先访问子节点，let 的局部变量可能在声明节点之前被引用，因此先收集全部局部变量再检查
+func unknownIdentifier(node *ast.Node, known map[string]bool) string {
+	locals := localsCollector{names: make(map[string]bool)}
+	ast.Walk(node, locals)
+	identifiers := &identifierVisitor{known: known, locals: locals.names}
+	ast.Walk(node, identifiers)
+	return identifiers.unknown
+}
+
+// localsCollector 收集 let 声明的局部变量名
+type localsCollector struct {
+	names map[string]bool
+}
+
+func (v localsCollector) Visit(node *ast.Node) {
+	if n, ok := (*node).(*ast.VariableDeclaratorNode); ok {
+		v.names[n.Name] = true
+	}
+}
+
+// identifierVisitor 查找表达式中既不是已知变量也不是局部变量的标识符
+type identifierVisitor struct {
+	known   map[string]bool
+	locals  map[string]bool
+	unknown string
+}
+
+func (v *identifierVisitor) Visit(node *ast.Node) {
+	if n, ok := (*node).(*ast.IdentifierNode); ok && v.unknown == "" && !v.known[n.Value] && !v.locals[n.Value] {
+		v.unknown = n.Value
+	}
+}
@@ -35,6 +35,13 @@ func SetupRouter(cfg *config.Config, db *database.Database, logger *zerolog.Logg
 	debugHandler := handlers.NewDebugHandler(db, logger)
 	executionHistoryHandler := handlers.NewExecutionHistoryHandler(db, logger)
 	chatHandler := handlers.NewChatConversationHandler(db, logger)
+	messageHandler := handlers.NewMessageHandler(db, logger, workflowSvc, instanceSvc, executionSvc)
+	signalHandler := handlers.NewSignalHandler(db, logger, workflowSvc, instanceSvc, executionSvc)
+	instanceHandler := handlers.NewWorkflowInstanceHandler(db, logger, workflowSvc, instanceSvc, executionSvc)
+	versionHandler := handlers.NewWorkflowVersionHandler(db, logger)
+	taskHandler := handlers.NewUserTaskHandler(db, logger, workflowSvc, instanceSvc, executionSvc)
+	jobHandler := handlers.NewJobHandler(db, logger)
+	externalTaskHandler := handlers.NewExternalTaskHandler(db, logger, workflowSvc, instanceSvc, executionSvc)
 
 	// Health check
 	router.GET("/health", handlers.HealthCheck(db))
@@ -54,9 +61,39 @@ func SetupRouter(cfg *config.Config, db *database.Database, logger *zerolog.Logg
 		workflows := api.Group("/workflows")
 		{
 			workflows.POST("", workflowHandler.CreateWorkflow)
+			workflows.POST("/validate", workflowHandler.ValidateWorkflow)
 			workflows.GET("/:workflowId", workflowHandler.GetWorkflow)
 			workflows.PUT("/:workflowId", workflowHandler.UpdateWorkflow)
 			workflows.GET("", workflowHandler.ListWorkflows)
+			workflows.POST("/:workflowId/instances", instanceHandler.StartInstance)
+			workflows.POST("/:workflowId/deploy", versionHandler.DeployWorkflow)
+			workflows.GET("/:workflowId/versions", versionHandler.ListVersions)
+			workflows.GET("/:workflowId/versions/:version", versionHandler.GetVersion)
+			workflows.POST("/:workflowId/versions/:version/activate", versionHandler.ActivateVersion)
+			workflows.GET("/:workflowId/diff", versionHandler.DiffVersions)
+			workflows.POST("/:workflowId/migrations", versionHandler.MigrateInstances)
+		}
+
+		// Workflow instance lifecycle
+		instances := api.Group("/instances")
+		{
+			instances.GET("", instanceHandler.ListInstances)
+			instances.GET("/:instanceId", instanceHandler.GetInstance)
+			instances.POST("/:instanceId/cancel", instanceHandler.CancelInstance)
+			instances.POST("/:instanceId/suspend", instanceHandler.SuspendInstance)
+			instances.POST("/:instanceId/resume", instanceHandler.ResumeInstance)
+			instances.POST("/:instanceId/rollback", instanceHandler.RollbackInstance)
+		}
+
+		// Human task inbox
+		tasks := api.Group("/tasks")
+		{
+			tasks.GET("", taskHandler.ListTasks)
+			tasks.GET("/:taskId", taskHandler.GetTask)
+			tasks.POST("/:taskId/claim", taskHandler.ClaimTask)
+			tasks.POST("/:taskId/unclaim", taskHandler.UnclaimTask)
+			tasks.POST("/:taskId/delegate", taskHandler.DelegateTask)
+			tasks.POST("/:taskId/complete", taskHandler.CompleteTask)
 		}
 
 		// Claude API proxy
@@ -69,6 +106,27 @@ func SetupRouter(cfg *config.Config, db *database.Database, logger *zerolog.Logg
 		api.POST("/execute", executorHandler.ExecuteWorkflowMock)                      // Mock mode: workflow and instance in body
 		api.POST("/execute/:workflowInstanceId", executorHandler.ExecuteWorkflow)      // Normal mode: fetch from database
 
+		// Message correlation
+		api.POST("/messages", messageHandler.CorrelateMessage)
+
+		// Signal broadcast
+		api.POST("/signals/:name", signalHandler.BroadcastSignal)
+
+		// Asynchronous jobs (dead jobs are retried manually)
+		api.GET("/jobs", jobHandler.ListJobs)
+		api.POST("/jobs/:jobId/retry", jobHandler.RetryJob)
+
+		// External tasks (pull-style ServiceTasks fetched and locked by workers)
+		externalTasks := api.Group("/external-tasks")
+		{
+			externalTasks.GET("", externalTaskHandler.ListExternalTasks)
+			externalTasks.POST("/fetch-and-lock", externalTaskHandler.FetchAndLock)
+			externalTasks.POST("/:taskId/complete", externalTaskHandler.CompleteTask)
+			externalTasks.POST("/:taskId/failure", externalTaskHandler.HandleFailure)
+			externalTasks.POST("/:taskId/extend-lock", externalTaskHandler.ExtendLock)
+			externalTasks.POST("/:taskId/retries", externalTaskHandler.SetRetries)
+		}
+
 		// Debug sessions
 		debug := api.Group("/workflows/:workflowId/debug")
 		{
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// CallActivityService handles persistence of the links between call activities and their child instances
+type CallActivityService struct {
+	db     *database.Database
+	logger *zerolog.Logger
+}
+
+// NewCallActivityService creates a new CallActivityService
+func NewCallActivityService(db *database.Database, logger *zerolog.Logger) *CallActivityService {
+	return &CallActivityService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateCallActivity stores a pending link from a parent call activity to its child instance
+func (s *CallActivityService) CreateCallActivity(ctx context.Context, callActivity *models.CallActivity) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	variables := callActivity.Variables
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal call activity variables: %w", err)
+	}
+
+	query := `
+		INSERT INTO call_activities (
+			id, parent_instance_id, parent_workflow_id, parent_node_id, child_instance_id,
+			variables, status, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, $8, $8)
+	`
+
+	callActivity.Id = uuid.New().String()
+	callActivity.Status = models.CallActivityStatusPending
+	_, err = s.db.ExecContext(ctx, query,
+		callActivity.Id, callActivity.ParentInstanceId, callActivity.ParentWorkflowId, callActivity.ParentNodeId,
+		callActivity.ChildInstanceId, string(variablesJSON), callActivity.Status, time.Now(),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).
+			Str("parentInstanceId", callActivity.ParentInstanceId).
+			Str("parentNodeId", callActivity.ParentNodeId).
+			Msg("Failed to create call activity")
+		return fmt.Errorf("failed to create call activity: %w", err)
+	}
+
+	s.logger.Info().
+		Str("parentInstanceId", callActivity.ParentInstanceId).
+		Str("parentNodeId", callActivity.ParentNodeId).
+		Str("childInstanceId", callActivity.ChildInstanceId).
+		Msg("Call activity created")
+	return nil
+}
+
+// FinishCallActivity marks the pending call activity of a child instance as completed or failed and returns it
+// 返回 nil 表示该实例不是子实例，或父实例已经不再等待它（已结束或已取消）
+// 状态检查与修改在同一条语句中完成，子实例的结束只会让父实例继续一次
+func (s *CallActivityService) FinishCallActivity(
+	ctx context.Context,
+	childInstanceId string,
+	status string,
+	errorMessage string,
+) (*models.CallActivity, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE call_activities
+		SET status = $1, error_message = NULLIF($2, ''), updated_at = $3
+		WHERE child_instance_id = $4 AND status = $5
+		RETURNING id, parent_instance_id, parent_workflow_id, parent_node_id, child_instance_id,
+		          variables, status, COALESCE(error_message, ''), created_at, updated_at
+	`
+
+	var callActivity models.CallActivity
+	var variablesBytes []byte
+	err := s.db.QueryRowContext(ctx, query,
+		status, errorMessage, time.Now(), childInstanceId, models.CallActivityStatusPending,
+	).Scan(
+		&callActivity.Id,
+		&callActivity.ParentInstanceId,
+		&callActivity.ParentWorkflowId,
+		&callActivity.ParentNodeId,
+		&callActivity.ChildInstanceId,
+		&variablesBytes,
+		&callActivity.Status,
+		&callActivity.ErrorMessage,
+		&callActivity.CreatedAt,
+		&callActivity.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		s.logger.Error().Err(err).Str("childInstanceId", childInstanceId).Msg("Failed to finish call activity")
+		return nil, fmt.Errorf("failed to finish call activity: %w", err)
+	}
+	if len(variablesBytes) > 0 {
+		if err := json.Unmarshal(variablesBytes, &callActivity.Variables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal call activity variables: %w", err)
+		}
+	}
+
+	return &callActivity, nil
+}
+
+// ReopenCallActivity sets a finished call activity back to pending
+// 子实例结束后父实例拒绝继续（版本冲突、挂起等）时使用，父实例仍在等待该子实例的结果
+func (s *CallActivityService) ReopenCallActivity(ctx context.Context, callActivityId string) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE call_activities
+		SET status = $1, error_message = NULL, updated_at = $2
+		WHERE id = $3 AND status IN ($4, $5)
+	`
+	if _, err := s.db.ExecContext(ctx, query,
+		models.CallActivityStatusPending, time.Now(), callActivityId, models.CallActivityStatusCompleted, models.CallActivityStatusFailed,
+	); err != nil {
+		s.logger.Error().Err(err).Str("callActivityId", callActivityId).Msg("Failed to reopen call activity")
+		return fmt.Errorf("failed to reopen call activity: %w", err)
+	}
+	return nil
+}
+
+// CancelStaleCallActivities cancels pending call activities whose token is no longer waiting at the call activity
+// Returns the child instances that should be cancelled with them
+func (s *CallActivityService) CancelStaleCallActivities(ctx context.Context, parentInstanceId string, activeNodeIds []string) ([]string, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	if activeNodeIds == nil {
+		activeNodeIds = []string{}
+	}
+
+	query := `
+		UPDATE call_activities
+		SET status = $1, updated_at = $2
+		WHERE parent_instance_id = $3 AND status = $4 AND NOT (parent_node_id = ANY($5))
+		RETURNING child_instance_id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		models.CallActivityStatusCancelled, time.Now(), parentInstanceId, models.CallActivityStatusPending, pq.Array(activeNodeIds),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("parentInstanceId", parentInstanceId).Msg("Failed to cancel stale call activities")
+		return nil, fmt.Errorf("failed to cancel stale call activities: %w", err)
+	}
+	defer rows.Close()
+
+	var childInstanceIds []string
+	for rows.Next() {
+		var childInstanceId string
+		if err := rows.Scan(&childInstanceId); err != nil {
+			return nil, fmt.Errorf("failed to scan call activity: %w", err)
+		}
+		childInstanceIds = append(childInstanceIds, childInstanceId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate call activities: %w", err)
+	}
+
+	return childInstanceIds, nil
+}
+
+// PendingCallActivityNodes returns the call activity nodes of a parent instance that are waiting for a child instance
+func (s *CallActivityService) PendingCallActivityNodes(ctx context.Context, parentInstanceId string) ([]string, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		SELECT parent_node_id
+		FROM call_activities
+		WHERE parent_instance_id = $1 AND status = $2
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, parentInstanceId, models.CallActivityStatusPending)
+	if err != nil {
+		s.logger.Error().Err(err).Str("parentInstanceId", parentInstanceId).Msg("Failed to query pending call activities")
+		return nil, fmt.Errorf("failed to query pending call activities: %w", err)
+	}
+	defer rows.Close()
+
+	var nodeIds []string
+	for rows.Next() {
+		var nodeId string
+		if err := rows.Scan(&nodeId); err != nil {
+			return nil, fmt.Errorf("failed to scan call activity: %w", err)
+		}
+		nodeIds = append(nodeIds, nodeId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate call activities: %w", err)
+	}
+
+	return nodeIds, nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -177,6 +178,45 @@ func (s *ExecutionHistoryService) GetExecutionHistories(
 	}
 	defer rows.Close()
 
+	histories, err := scanExecutionHistories(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return histories, total, nil
+}
+
+// ListInstanceExecutionHistories retrieves the execution histories of all executions of an instance in execution order
+func (s *ExecutionHistoryService) ListInstanceExecutionHistories(
+	ctx context.Context,
+	instanceId string,
+) ([]models.ExecutionHistory, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		SELECT h.id, h.execution_id, h.node_id, h.node_name, h.node_type,
+		       h.input_data, h.output_data, h.variables_before, h.variables_after,
+		       h.execution_time_ms, h.error_message, h.executed_at
+		FROM execution_histories h
+		JOIN workflow_executions e ON e.id = h.execution_id
+		WHERE e.instance_id = $1
+		ORDER BY h.executed_at ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, instanceId)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to list instance execution histories")
+		return nil, fmt.Errorf("failed to list instance execution histories: %w", err)
+	}
+	defer rows.Close()
+
+	return scanExecutionHistories(rows)
+}
+
+// scanExecutionHistories scans execution history rows and unmarshals their JSON columns
+func scanExecutionHistories(rows *sql.Rows) ([]models.ExecutionHistory, error) {
 	var histories []models.ExecutionHistory
 	for rows.Next() {
 		var history models.ExecutionHistory
@@ -200,27 +240,28 @@ func (s *ExecutionHistoryService) GetExecutionHistories(
 			&history.ExecutedAt,
 		)
 		if err != nil {
-			s.logger.Error().Err(err).Msg("Failed to scan execution history")
-			return nil, 0, fmt.Errorf("failed to scan execution history: %w", err)
+			return nil, fmt.Errorf("failed to scan execution history: %w", err)
 		}
 
 		// Unmarshal data
 		if err := history.UnmarshalInputData(inputDataBytes); err != nil {
-			return nil, 0, fmt.Errorf("failed to unmarshal input data: %w", err)
+			return nil, fmt.Errorf("failed to unmarshal input data: %w", err)
 		}
 		if err := history.UnmarshalOutputData(outputDataBytes); err != nil {
-			return nil, 0, fmt.Errorf("failed to unmarshal output data: %w", err)
+			return nil, fmt.Errorf("failed to unmarshal output data: %w", err)
 		}
 		if err := history.UnmarshalVariablesBefore(variablesBeforeBytes); err != nil {
-			return nil, 0, fmt.Errorf("failed to unmarshal variables before: %w", err)
+			return nil, fmt.Errorf("failed to unmarshal variables before: %w", err)
 		}
 		if err := history.UnmarshalVariablesAfter(variablesAfterBytes); err != nil {
-			return nil, 0, fmt.Errorf("failed to unmarshal variables after: %w", err)
+			return nil, fmt.Errorf("failed to unmarshal variables after: %w", err)
 		}
 
 		histories = append(histories, history)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate execution histories: %w", err)
+	}
 
-	return histories, total, nil
+	return histories, nil
 }
-
@@ -0,0 +1,504 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// externalTaskColumns 查询外部任务时返回的列，与 scanExternalTask 的顺序一致
+const externalTaskColumns = `id, instance_id, workflow_id, node_id, topic, variables, status, COALESCE(worker_id, ''),
+		       lock_expires_at, retries, COALESCE(error_message, ''), COALESCE(error_details, ''), created_at, updated_at`
+
+const (
+	// defaultExternalTaskFetchSize 拉取时未指定 maxTasks 时最多锁定的任务数量
+	defaultExternalTaskFetchSize = 10
+	// maxExternalTaskFetchSize 一次拉取最多锁定的任务数量
+	maxExternalTaskFetchSize = 100
+)
+
+// ExternalTaskService handles persistence of external tasks fetched and locked by workers
+type ExternalTaskService struct {
+	db     *database.Database
+	logger *zerolog.Logger
+}
+
+// NewExternalTaskService creates a new ExternalTaskService
+func NewExternalTaskService(db *database.Database, logger *zerolog.Logger) *ExternalTaskService {
+	return &ExternalTaskService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// FetchAndLockRequest represents a worker fetching tasks of its topics
+type FetchAndLockRequest struct {
+	WorkerId     string   `json:"workerId" binding:"required"`
+	Topics       []string `json:"topics" binding:"required"`
+	MaxTasks     int      `json:"maxTasks,omitempty"`              // 最多锁定的任务数量，默认 10，最大 100
+	LockDuration int64    `json:"lockDuration" binding:"required"` // 锁的有效期（毫秒），到期前需要完成、报告失败或延长锁
+}
+
+// ExternalTaskFailureRequest represents a worker reporting a failed attempt
+type ExternalTaskFailureRequest struct {
+	WorkerId     string `json:"workerId" binding:"required"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	ErrorDetails string `json:"errorDetails,omitempty"`
+	Retries      int    `json:"retries"`                // 剩余重试次数，为 0 时任务进入 failed 状态等待人工处理
+	RetryTimeout int64  `json:"retryTimeout,omitempty"` // 多久之后可以再次拉取（毫秒）
+}
+
+// ExternalTaskFilter represents the conditions for listing external tasks
+type ExternalTaskFilter struct {
+	Status     string
+	Topic      string
+	InstanceId string
+}
+
+// CreateExternalTask stores a pending external task
+// 同一实例的同一 ServiceTask 已存在待处理或失败的任务时不会重复创建
+func (s *ExternalTaskService) CreateExternalTask(ctx context.Context, task *models.ExternalTask) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	variables := task.Variables
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal external task variables: %w", err)
+	}
+
+	query := `
+		INSERT INTO external_tasks (id, instance_id, workflow_id, node_id, topic, variables, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, $8, $8)
+		ON CONFLICT (instance_id, node_id) WHERE status IN ('pending', 'failed') DO NOTHING
+	`
+
+	task.Id = uuid.New().String()
+	task.Status = models.ExternalTaskStatusPending
+	_, err = s.db.ExecContext(ctx, query,
+		task.Id, task.InstanceId, task.WorkflowId, task.NodeId, task.Topic, string(variablesJSON), task.Status, time.Now(),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", task.InstanceId).Str("nodeId", task.NodeId).Msg("Failed to create external task")
+		return fmt.Errorf("failed to create external task: %w", err)
+	}
+
+	s.logger.Info().
+		Str("instanceId", task.InstanceId).
+		Str("nodeId", task.NodeId).
+		Str("topic", task.Topic).
+		Msg("External task created")
+	return nil
+}
+
+// CancelStaleExternalTasks cancels pending and failed external tasks whose token is no longer waiting at the task
+// 已被锁定的任务同样取消，工作者之后完成时会被拒绝
+func (s *ExternalTaskService) CancelStaleExternalTasks(ctx context.Context, instanceId string, activeNodeIds []string) (int64, error) {
+	if s.db.DB == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+
+	if activeNodeIds == nil {
+		activeNodeIds = []string{}
+	}
+
+	query := `
+		UPDATE external_tasks
+		SET status = $1, updated_at = $2
+		WHERE instance_id = $3 AND status IN ($4, $5) AND NOT (node_id = ANY($6))
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		models.ExternalTaskStatusCancelled, time.Now(), instanceId,
+		models.ExternalTaskStatusPending, models.ExternalTaskStatusFailed, pq.Array(activeNodeIds),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale external tasks")
+		return 0, fmt.Errorf("failed to cancel stale external tasks: %w", err)
+	}
+
+	cancelled, _ := result.RowsAffected()
+	if cancelled > 0 {
+		s.logger.Info().Str("instanceId", instanceId).Int64("cancelled", cancelled).Msg("Stale external tasks cancelled")
+	}
+	return cancelled, nil
+}
+
+// FetchAndLock locks up to maxTasks unlocked pending tasks of the topics for the worker and returns them
+// 使用 FOR UPDATE SKIP LOCKED，多个工作者同时拉取时不会拿到同一个任务；
+// 锁已过期的任务可以被重新拉取，挂起实例的任务在恢复后才会被拉取
+func (s *ExternalTaskService) FetchAndLock(ctx context.Context, req FetchAndLockRequest) ([]models.ExternalTask, error) {
+	if req.WorkerId == "" {
+		return nil, fmt.Errorf("%s: workerId is required", models.ErrInvalidRequest)
+	}
+	if len(req.Topics) == 0 {
+		return nil, fmt.Errorf("%s: at least one topic is required", models.ErrInvalidRequest)
+	}
+	if req.LockDuration <= 0 {
+		return nil, fmt.Errorf("%s: lockDuration must be a positive number of milliseconds", models.ErrInvalidRequest)
+	}
+	maxTasks := req.MaxTasks
+	if maxTasks < 1 {
+		maxTasks = defaultExternalTaskFetchSize
+	}
+	if maxTasks > maxExternalTaskFetchSize {
+		maxTasks = maxExternalTaskFetchSize
+	}
+
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	now := time.Now()
+	query := `
+		UPDATE external_tasks
+		SET worker_id = $1, lock_expires_at = $2, updated_at = $3
+		WHERE id IN (
+			SELECT id FROM external_tasks
+			WHERE status = $4 AND topic = ANY($5)
+			  AND (lock_expires_at IS NULL OR lock_expires_at < $3)
+			  AND NOT EXISTS (
+			      SELECT 1 FROM workflow_instances i
+			      WHERE i.id = external_tasks.instance_id AND i.status = 'suspended'
+			  )
+			ORDER BY created_at
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + externalTaskColumns
+
+	rows, err := s.db.QueryContext(ctx, query,
+		req.WorkerId, now.Add(time.Duration(req.LockDuration)*time.Millisecond), now,
+		models.ExternalTaskStatusPending, pq.Array(req.Topics), maxTasks,
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("workerId", req.WorkerId).Msg("Failed to fetch and lock external tasks")
+		return nil, fmt.Errorf("failed to fetch and lock external tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []models.ExternalTask{}
+	for rows.Next() {
+		task, err := scanExternalTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan external task: %w", err)
+		}
+		tasks = append(tasks, *task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate external tasks: %w", err)
+	}
+
+	if len(tasks) > 0 {
+		s.logger.Info().Str("workerId", req.WorkerId).Strs("topics", req.Topics).Int("locked", len(tasks)).Msg("External tasks locked")
+	}
+	return tasks, nil
+}
+
+// CompleteExternalTask marks an external task locked by the worker as completed
+// 状态检查与修改在同一条语句中完成，同一任务只会被完成一次
+func (s *ExternalTaskService) CompleteExternalTask(ctx context.Context, taskId string, workerId string) (*models.ExternalTask, error) {
+	return s.updateExternalTask(ctx, "complete", taskId, workerId, `
+		UPDATE external_tasks
+		SET status = $4, lock_expires_at = NULL, updated_at = $3
+		WHERE id = $1 AND status = $5 AND worker_id = $2
+		RETURNING `+externalTaskColumns,
+		taskId, workerId, time.Now(), models.ExternalTaskStatusCompleted, models.ExternalTaskStatusPending,
+	)
+}
+
+// ReopenExternalTask sets a completed external task back to pending and unlocked
+// 完成任务后实例拒绝推进（版本冲突、挂起等）时使用，任务可以被重新拉取
+func (s *ExternalTaskService) ReopenExternalTask(ctx context.Context, taskId string) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE external_tasks
+		SET status = $1, worker_id = NULL, lock_expires_at = NULL, updated_at = $2
+		WHERE id = $3 AND status = $4
+	`
+	if _, err := s.db.ExecContext(ctx, query,
+		models.ExternalTaskStatusPending, time.Now(), taskId, models.ExternalTaskStatusCompleted,
+	); err != nil {
+		s.logger.Error().Err(err).Str("taskId", taskId).Msg("Failed to reopen external task")
+		return fmt.Errorf("failed to reopen external task: %w", err)
+	}
+	return nil
+}
+
+// HandleFailure records a failed attempt of an external task locked by the worker and releases the lock
+// 还有剩余重试次数时任务在 retryTimeout 之后可以再次拉取，否则进入 failed 状态，令牌仍停在节点上
+func (s *ExternalTaskService) HandleFailure(ctx context.Context, taskId string, req ExternalTaskFailureRequest) (*models.ExternalTask, error) {
+	if req.Retries < 0 || req.RetryTimeout < 0 {
+		return nil, fmt.Errorf("%s: retries and retryTimeout must not be negative", models.ErrInvalidRequest)
+	}
+
+	now := time.Now()
+	status := models.ExternalTaskStatusFailed
+	var retryAt *time.Time
+	if req.Retries > 0 {
+		status = models.ExternalTaskStatusPending
+		if req.RetryTimeout > 0 {
+			at := now.Add(time.Duration(req.RetryTimeout) * time.Millisecond)
+			retryAt = &at
+		}
+	}
+
+	return s.updateExternalTask(ctx, "fail", taskId, req.WorkerId, `
+		UPDATE external_tasks
+		SET status = $4, retries = $6, error_message = $7, error_details = $8,
+		    worker_id = NULL, lock_expires_at = $9, updated_at = $3
+		WHERE id = $1 AND status = $5 AND worker_id = $2
+		RETURNING `+externalTaskColumns,
+		taskId, req.WorkerId, now, status, models.ExternalTaskStatusPending,
+		req.Retries, req.ErrorMessage, req.ErrorDetails, retryAt,
+	)
+}
+
+// ExtendLock extends the lock of an external task held by the worker to lockDuration from now
+func (s *ExternalTaskService) ExtendLock(ctx context.Context, taskId string, workerId string, lockDuration time.Duration) (*models.ExternalTask, error) {
+	if lockDuration <= 0 {
+		return nil, fmt.Errorf("%s: newDuration must be a positive number of milliseconds", models.ErrInvalidRequest)
+	}
+
+	now := time.Now()
+	return s.updateExternalTask(ctx, "extend the lock of", taskId, workerId, `
+		UPDATE external_tasks
+		SET lock_expires_at = $4, updated_at = $3
+		WHERE id = $1 AND status = $5 AND worker_id = $2
+		RETURNING `+externalTaskColumns,
+		taskId, workerId, now, now.Add(lockDuration), models.ExternalTaskStatusPending,
+	)
+}
+
+// SetRetries moves a failed external task back to pending with the given retries
+// 用于处理重试次数用尽的任务，任务可以立即被重新拉取
+func (s *ExternalTaskService) SetRetries(ctx context.Context, taskId string, retries int) (*models.ExternalTask, error) {
+	if retries < 1 {
+		return nil, fmt.Errorf("%s: retries must be positive", models.ErrInvalidRequest)
+	}
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE external_tasks
+		SET status = $1, retries = $2, lock_expires_at = NULL, updated_at = $3
+		WHERE id = $4 AND status = $5
+		RETURNING ` + externalTaskColumns
+
+	task, err := scanExternalTask(s.db.QueryRowContext(ctx, query,
+		models.ExternalTaskStatusPending, retries, time.Now(), taskId, models.ExternalTaskStatusFailed,
+	))
+	if err == nil {
+		s.logger.Info().Str("taskId", taskId).Int("retries", retries).Msg("Failed external task scheduled for retry")
+		return task, nil
+	}
+	if err != sql.ErrNoRows {
+		s.logger.Error().Err(err).Str("taskId", taskId).Msg("Failed to set external task retries")
+		return nil, fmt.Errorf("failed to set external task retries: %w", err)
+	}
+
+	current, err := s.GetExternalTask(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s: only failed external tasks can be retried, task %s is %s", models.ErrInvalidExternalTaskState, taskId, current.Status)
+}
+
+// GetExternalTask retrieves an external task by ID
+func (s *ExternalTaskService) GetExternalTask(ctx context.Context, taskId string) (*models.ExternalTask, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `SELECT ` + externalTaskColumns + ` FROM external_tasks WHERE id = $1`
+	task, err := scanExternalTask(s.db.QueryRowContext(ctx, query, taskId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s: external task %s not found", models.ErrExternalTaskNotFound, taskId)
+		}
+		s.logger.Error().Err(err).Str("taskId", taskId).Msg("Failed to get external task")
+		return nil, fmt.Errorf("failed to get external task: %w", err)
+	}
+	return task, nil
+}
+
+// ListExternalTasks lists external tasks matching the filter with pagination
+// 按创建时间从早到晚排序
+func (s *ExternalTaskService) ListExternalTasks(
+	ctx context.Context,
+	filter ExternalTaskFilter,
+	page, pageSize int,
+) ([]models.ExternalTask, *models.Metadata, error) {
+	if s.db.DB == nil {
+		return nil, nil, fmt.Errorf("database not available")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	// 按提供的条件拼接 WHERE 子句
+	where := " WHERE 1=1"
+	var args []interface{}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if filter.Topic != "" {
+		args = append(args, filter.Topic)
+		where += fmt.Sprintf(" AND topic = $%d", len(args))
+	}
+	if filter.InstanceId != "" {
+		args = append(args, filter.InstanceId)
+		where += fmt.Sprintf(" AND instance_id = $%d", len(args))
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM external_tasks`+where, args...).Scan(&total); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to count external tasks")
+		return nil, nil, fmt.Errorf("failed to count external tasks: %w", err)
+	}
+
+	query := `
+		SELECT ` + externalTaskColumns + `
+		FROM external_tasks` + where + fmt.Sprintf(`
+		ORDER BY created_at ASC
+		LIMIT $%d OFFSET $%d
+	`, len(args)+1, len(args)+2)
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list external tasks")
+		return nil, nil, fmt.Errorf("failed to list external tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []models.ExternalTask{}
+	for rows.Next() {
+		task, err := scanExternalTask(rows)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Failed to scan external task")
+			return nil, nil, fmt.Errorf("failed to scan external task: %w", err)
+		}
+		tasks = append(tasks, *task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to iterate external tasks: %w", err)
+	}
+
+	metadata := &models.Metadata{
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		HasMore:  page*pageSize < total,
+	}
+	return tasks, metadata, nil
+}
+
+// updateExternalTask runs a conditional update on an external task locked by the worker and returns the updated task
+// 条件不满足时查询任务当前状态，区分任务不存在、已结束和被其他工作者锁定
+func (s *ExternalTaskService) updateExternalTask(
+	ctx context.Context,
+	action string,
+	taskId string,
+	workerId string,
+	query string,
+	args ...interface{},
+) (*models.ExternalTask, error) {
+	if workerId == "" {
+		return nil, fmt.Errorf("%s: workerId is required", models.ErrInvalidRequest)
+	}
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	task, err := scanExternalTask(s.db.QueryRowContext(ctx, query, args...))
+	if err == nil {
+		s.logger.Info().
+			Str("taskId", taskId).
+			Str("workerId", workerId).
+			Str("action", action).
+			Str("status", task.Status).
+			Msg("External task updated")
+		return task, nil
+	}
+	if err != sql.ErrNoRows {
+		s.logger.Error().Err(err).Str("taskId", taskId).Str("action", action).Msg("Failed to update external task")
+		return nil, fmt.Errorf("failed to %s external task: %w", action, err)
+	}
+
+	current, err := s.GetExternalTask(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case current.Status != models.ExternalTaskStatusPending:
+		return nil, fmt.Errorf("%s: cannot %s external task %s, it is %s", models.ErrInvalidExternalTaskState, action, taskId, current.Status)
+	case current.WorkerId == "":
+		return nil, fmt.Errorf("%s: cannot %s external task %s, it is not locked", models.ErrInvalidExternalTaskState, action, taskId)
+	default:
+		return nil, fmt.Errorf("%s: cannot %s external task %s, it is locked by %s", models.ErrInvalidExternalTaskState, action, taskId, current.WorkerId)
+	}
+}
+
+// scanExternalTask scans an external task selected with externalTaskColumns
+func scanExternalTask(row userTaskScanner) (*models.ExternalTask, error) {
+	var task models.ExternalTask
+	var lockExpiresAt sql.NullTime
+	var retries sql.NullInt64
+	var variablesBytes []byte
+	if err := row.Scan(
+		&task.Id,
+		&task.InstanceId,
+		&task.WorkflowId,
+		&task.NodeId,
+		&task.Topic,
+		&variablesBytes,
+		&task.Status,
+		&task.WorkerId,
+		&lockExpiresAt,
+		&retries,
+		&task.ErrorMessage,
+		&task.ErrorDetails,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if lockExpiresAt.Valid {
+		task.LockExpiresAt = &lockExpiresAt.Time
+	}
+	if retries.Valid {
+		remaining := int(retries.Int64)
+		task.Retries = &remaining
+	}
+	if len(variablesBytes) > 0 {
+		if err := json.Unmarshal(variablesBytes, &task.Variables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal external task variables: %w", err)
+		}
+	}
+	return &task, nil
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/rs/zerolog"
+)
+
+// ExternalTaskCompletionService completes external tasks and advances the instances waiting at them
+type ExternalTaskCompletionService struct {
+	logger      *zerolog.Logger
+	taskSvc     *ExternalTaskService
+	workflowSvc *WorkflowService
+	instanceSvc *WorkflowInstanceService
+	engineSvc   *WorkflowEngineService
+}
+
+// NewExternalTaskCompletionService creates a new ExternalTaskCompletionService
+func NewExternalTaskCompletionService(
+	db *database.Database,
+	logger *zerolog.Logger,
+	workflowSvc *WorkflowService,
+	instanceSvc *WorkflowInstanceService,
+	engineSvc *WorkflowEngineService,
+) *ExternalTaskCompletionService {
+	return &ExternalTaskCompletionService{
+		logger:      logger,
+		taskSvc:     NewExternalTaskService(db, logger),
+		workflowSvc: workflowSvc,
+		instanceSvc: instanceSvc,
+		engineSvc:   engineSvc,
+	}
+}
+
+// CompleteExternalTaskRequest represents a worker completing a locked external task
+type CompleteExternalTaskRequest struct {
+	WorkerId  string                 `json:"workerId" binding:"required"`
+	Variables map[string]interface{} `json:"variables,omitempty"` // 工作者返回的变量，合并到创建任务时的流程变量中
+}
+
+// ExternalTaskCompletion represents the result of completing an external task
+type ExternalTaskCompletion struct {
+	Task           *models.ExternalTask `json:"task"`
+	EngineResponse *EngineResponse      `json:"engineResponse"`
+}
+
+// CompleteTask completes an external task locked by the worker and advances the instance past the service task
+// 实例拒绝推进（版本冲突、挂起等）时任务恢复为未锁定的待处理状态，可以被重新拉取
+func (s *ExternalTaskCompletionService) CompleteTask(ctx context.Context, taskId string, req CompleteExternalTaskRequest) (*ExternalTaskCompletion, error) {
+	if req.WorkerId == "" {
+		return nil, fmt.Errorf("%s: workerId is required", models.ErrInvalidRequest)
+	}
+
+	task, err := s.taskSvc.GetExternalTask(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != models.ExternalTaskStatusPending {
+		return nil, fmt.Errorf("%s: cannot complete external task %s, it is %s", models.ErrInvalidExternalTaskState, taskId, task.Status)
+	}
+
+	instance, err := s.instanceSvc.GetWorkflowInstanceByID(ctx, task.InstanceId)
+	if err != nil {
+		return nil, err
+	}
+	if countNodeId(instance.CurrentNodeIds, task.NodeId) == 0 {
+		return nil, fmt.Errorf("%s: instance %s is no longer waiting at node %s", models.ErrInvalidInstanceState, instance.Id, task.NodeId)
+	}
+
+	workflow, err := s.workflowSvc.GetWorkflowByID(ctx, task.WorkflowId)
+	if err != nil {
+		return nil, err
+	}
+
+	completed, err := s.taskSvc.CompleteExternalTask(ctx, taskId, req.WorkerId)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建任务时的流程变量与工作者返回的变量合并，返回的变量优先
+	variables := make(map[string]interface{}, len(task.Variables)+len(req.Variables))
+	for key, value := range task.Variables {
+		variables[key] = value
+	}
+	for key, value := range req.Variables {
+		variables[key] = value
+	}
+
+	result, err := s.engineSvc.TriggerNode(ctx, workflow, instance, task.NodeId, variables)
+	if err != nil {
+		s.logger.Error().Err(err).
+			Str("taskId", taskId).
+			Str("instanceId", instance.Id).
+			Str("nodeId", task.NodeId).
+			Msg("Failed to resume instance from external task")
+		if !isExecutionFailure(err) {
+			if reopenErr := s.taskSvc.ReopenExternalTask(ctx, taskId); reopenErr != nil {
+				s.logger.Warn().Err(reopenErr).Str("taskId", taskId).Msg("Failed to reopen external task")
+			}
+		}
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("taskId", taskId).
+		Str("workerId", req.WorkerId).
+		Str("instanceId", instance.Id).
+		Str("nodeId", task.NodeId).
+		Msg("External task completed")
+	return &ExternalTaskCompletion{
+		Task:           completed,
+		EngineResponse: result.EngineResponse,
+	}, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var externalTaskColumnNames = []string{"id", "instance_id", "workflow_id", "node_id", "topic", "variables", "status", "worker_id",
+	"lock_expires_at", "retries", "error_message", "error_details", "created_at", "updated_at"}
+
+func setupExternalTaskServiceTest(t *testing.T) (*ExternalTaskService, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	database := database.NewDatabase(&logger)
+	database.DB = db
+
+	service := NewExternalTaskService(database, &logger)
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return service, mock, cleanup
+}
+
+// externalTaskRow returns a credit scoring task of instance-1 with the given status and lock holder
+func externalTaskRow(status string, workerId string) *sqlmock.Rows {
+	now := time.Now()
+	var lockExpiresAt interface{}
+	if workerId != "" {
+		lockExpiresAt = now.Add(time.Minute)
+	}
+	return sqlmock.NewRows(externalTaskColumnNames).
+		AddRow("task-1", "instance-1", "workflow-1", "ServiceTask_Score", "credit-scoring", []byte(`{"applicant":"a-1"}`),
+			status, workerId, lockExpiresAt, nil, "", "", now, now)
+}
+
+func TestExternalTaskService_CreateExternalTask_Success(t *testing.T) {
+	service, mock, cleanup := setupExternalTaskServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectExec(`INSERT INTO external_tasks (.+) ON CONFLICT \(instance_id, node_id\) WHERE status IN \('pending', 'failed'\) DO NOTHING`).
+		WithArgs(sqlmock.AnyArg(), "instance-1", "workflow-1", "ServiceTask_Score", "credit-scoring", `{"applicant":"a-1"}`,
+			models.ExternalTaskStatusPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	task := &models.ExternalTask{
+		InstanceId: "instance-1",
+		WorkflowId: "workflow-1",
+		NodeId:     "ServiceTask_Score",
+		Topic:      "credit-scoring",
+		Variables:  map[string]interface{}{"applicant": "a-1"},
+	}
+	err := service.CreateExternalTask(context.Background(), task)
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, task.Id)
+	assert.Equal(t, models.ExternalTaskStatusPending, task.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExternalTaskService_FetchAndLock_Success(t *testing.T) {
+	service, mock, cleanup := setupExternalTaskServiceTest(t)
+	defer cleanup()
+
+	// 只拉取未锁定或锁已过期的待处理任务
+	mock.ExpectQuery(`UPDATE external_tasks SET worker_id = \$1, lock_expires_at = \$2, updated_at = \$3 WHERE id IN \((.+) FOR UPDATE SKIP LOCKED \) RETURNING`).
+		WithArgs("scorer-1", timeAfter(time.Now().Add(30*time.Second)), sqlmock.AnyArg(),
+			models.ExternalTaskStatusPending, pq.Array([]string{"credit-scoring"}), defaultExternalTaskFetchSize).
+		WillReturnRows(externalTaskRow(models.ExternalTaskStatusPending, "scorer-1"))
+
+	tasks, err := service.FetchAndLock(context.Background(), FetchAndLockRequest{
+		WorkerId:     "scorer-1",
+		Topics:       []string{"credit-scoring"},
+		LockDuration: 30000,
+	})
+
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "scorer-1", tasks[0].WorkerId)
+	assert.Equal(t, map[string]interface{}{"applicant": "a-1"}, tasks[0].Variables)
+	require.NotNil(t, tasks[0].LockExpiresAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExternalTaskService_HandleFailure(t *testing.T) {
+	t.Run("task with retries left can be fetched after the timeout", func(t *testing.T) {
+		service, mock, cleanup := setupExternalTaskServiceTest(t)
+		defer cleanup()
+
+		mock.ExpectQuery(`UPDATE external_tasks SET status = \$4, retries = \$6`).
+			WithArgs("task-1", "scorer-1", sqlmock.AnyArg(), models.ExternalTaskStatusPending, models.ExternalTaskStatusPending,
+				2, "model unavailable", "", timeAfter(time.Now().Add(time.Minute))).
+			WillReturnRows(externalTaskRow(models.ExternalTaskStatusPending, ""))
+
+		task, err := service.HandleFailure(context.Background(), "task-1", ExternalTaskFailureRequest{
+			WorkerId:     "scorer-1",
+			ErrorMessage: "model unavailable",
+			Retries:      2,
+			RetryTimeout: 60000,
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, models.ExternalTaskStatusPending, task.Status)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("task without retries fails", func(t *testing.T) {
+		service, mock, cleanup := setupExternalTaskServiceTest(t)
+		defer cleanup()
+
+		mock.ExpectQuery(`UPDATE external_tasks SET status = \$4, retries = \$6`).
+			WithArgs("task-1", "scorer-1", sqlmock.AnyArg(), models.ExternalTaskStatusFailed, models.ExternalTaskStatusPending,
+				0, "invalid applicant", "stack trace", nil).
+			WillReturnRows(externalTaskRow(models.ExternalTaskStatusFailed, ""))
+
+		task, err := service.HandleFailure(context.Background(), "task-1", ExternalTaskFailureRequest{
+			WorkerId:     "scorer-1",
+			ErrorMessage: "invalid applicant",
+			ErrorDetails: "stack trace",
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, models.ExternalTaskStatusFailed, task.Status)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestExternalTaskService_UpdateExternalTask_Conflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  *sqlmock.Rows
+		expected string
+	}{
+		{"locked by another worker", externalTaskRow(models.ExternalTaskStatusPending, "scorer-2"), "it is locked by scorer-2"},
+		{"not locked", externalTaskRow(models.ExternalTaskStatusPending, ""), "it is not locked"},
+		{"already completed", externalTaskRow(models.ExternalTaskStatusCompleted, "scorer-1"), "it is completed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, mock, cleanup := setupExternalTaskServiceTest(t)
+			defer cleanup()
+
+			mock.ExpectQuery(`UPDATE external_tasks SET lock_expires_at = \$4`).
+				WillReturnError(sql.ErrNoRows)
+			mock.ExpectQuery(`SELECT (.+) FROM external_tasks WHERE id = \$1`).
+				WithArgs("task-1").
+				WillReturnRows(tt.current)
+
+			task, err := service.ExtendLock(context.Background(), "task-1", "scorer-1", time.Minute)
+
+			require.Error(t, err)
+			assert.Nil(t, task)
+			assert.Contains(t, err.Error(), models.ErrInvalidExternalTaskState)
+			assert.Contains(t, err.Error(), tt.expected)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestExternalTaskService_SetRetries(t *testing.T) {
+	service, mock, cleanup := setupExternalTaskServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`UPDATE external_tasks SET status = \$1, retries = \$2`).
+		WithArgs(models.ExternalTaskStatusPending, 3, sqlmock.AnyArg(), "task-1", models.ExternalTaskStatusFailed).
+		WillReturnRows(externalTaskRow(models.ExternalTaskStatusPending, ""))
+
+	task, err := service.SetRetries(context.Background(), "task-1", 3)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.ExternalTaskStatusPending, task.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExternalTaskService_DatabaseNotAvailable(t *testing.T) {
+	logger := zerolog.Nop()
+	service := NewExternalTaskService(database.NewDatabase(&logger), &logger)
+
+	_, err := service.FetchAndLock(context.Background(), FetchAndLockRequest{WorkerId: "scorer-1", Topics: []string{"credit-scoring"}, LockDuration: 1000})
+	assert.Error(t, err)
+
+	_, err = service.CompleteExternalTask(context.Background(), "task-1", "scorer-1")
+	assert.Error(t, err)
+}
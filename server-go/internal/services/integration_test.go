@@ -329,7 +329,7 @@ func TestIntegration_WorkflowInstanceService_CRUD(t *testing.T) {
 	// Test UpdateWorkflowInstance
 	newStatus := models.InstanceStatusRunning
 	newNodeIds := []string{"node1", "node2", "node3"}
-	updatedInstance, err := instanceService.UpdateWorkflowInstance(ctx, instance.Id, newStatus, newNodeIds)
+	updatedInstance, err := instanceService.UpdateWorkflowInstance(ctx, instance.Id, newStatus, newNodeIds, instance.InstanceVersion)
 	require.NoError(t, err)
 	assert.Equal(t, instance.Id, updatedInstance.Id)
 	assert.Equal(t, newStatus, updatedInstance.Status)
@@ -542,7 +542,7 @@ func TestIntegration_FullWorkflowLifecycle(t *testing.T) {
 	assert.Equal(t, models.ExecutionStatusPending, execution.Status)
 
 	// Step 4: Update instance to running
-	instance, err = instanceService.UpdateWorkflowInstance(ctx, instance.Id, models.InstanceStatusRunning, []string{"startNode"})
+	instance, err = instanceService.UpdateWorkflowInstance(ctx, instance.Id, models.InstanceStatusRunning, []string{"startNode"}, instance.InstanceVersion)
 	require.NoError(t, err)
 	assert.Equal(t, models.InstanceStatusRunning, instance.Status)
 	assert.Contains(t, instance.CurrentNodeIds, "startNode")
@@ -563,7 +563,7 @@ func TestIntegration_FullWorkflowLifecycle(t *testing.T) {
 	assert.NotNil(t, execution.CompletedAt)
 
 	// Step 7: Complete instance
-	instance, err = instanceService.UpdateWorkflowInstance(ctx, instance.Id, models.InstanceStatusCompleted, []string{"endNode"})
+	instance, err = instanceService.UpdateWorkflowInstance(ctx, instance.Id, models.InstanceStatusCompleted, []string{"endNode"}, instance.InstanceVersion)
 	require.NoError(t, err)
 	assert.Equal(t, models.InstanceStatusCompleted, instance.Status)
 
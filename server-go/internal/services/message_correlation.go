@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/rs/zerolog"
+)
+
+// MessageCorrelationService delivers messages to instances waiting at message events
+type MessageCorrelationService struct {
+	logger      *zerolog.Logger
+	messageSvc  *MessageSubscriptionService
+	workflowSvc *WorkflowService
+	instanceSvc *WorkflowInstanceService
+	engineSvc   *WorkflowEngineService
+}
+
+// NewMessageCorrelationService creates a new MessageCorrelationService
+func NewMessageCorrelationService(
+	db *database.Database,
+	logger *zerolog.Logger,
+	workflowSvc *WorkflowService,
+	instanceSvc *WorkflowInstanceService,
+	engineSvc *WorkflowEngineService,
+) *MessageCorrelationService {
+	return &MessageCorrelationService{
+		logger:      logger,
+		messageSvc:  NewMessageSubscriptionService(db, logger),
+		workflowSvc: workflowSvc,
+		instanceSvc: instanceSvc,
+		engineSvc:   engineSvc,
+	}
+}
+
+// CorrelateMessageRequest represents a message to deliver
+type CorrelateMessageRequest struct {
+	MessageName     string                 `json:"messageName" binding:"required"`
+	BusinessKey     string                 `json:"businessKey,omitempty"`
+	CorrelationKeys map[string]interface{} `json:"correlationKeys,omitempty"` // 与订阅时的流程变量匹配
+	Variables       map[string]interface{} `json:"variables,omitempty"`       // 随消息传入的变量，合并到流程变量中
+}
+
+// MessageCorrelation represents the result of delivering a message to one instance
+type MessageCorrelation struct {
+	InstanceId     string          `json:"instanceId"`
+	NodeId         string          `json:"nodeId"`
+	EngineResponse *EngineResponse `json:"engineResponse,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// CorrelateMessage delivers a message to every instance with a matching subscription
+// 按消息名称加业务键或变量匹配查找订阅，每个实例只推进一次
+func (s *MessageCorrelationService) CorrelateMessage(ctx context.Context, req CorrelateMessageRequest) ([]MessageCorrelation, error) {
+	if req.MessageName == "" {
+		return nil, fmt.Errorf("%s: messageName is required", models.ErrInvalidRequest)
+	}
+	if req.BusinessKey == "" && len(req.CorrelationKeys) == 0 {
+		return nil, fmt.Errorf("%s: businessKey or correlationKeys is required", models.ErrInvalidRequest)
+	}
+
+	subscriptions, err := s.messageSvc.ClaimSubscriptions(ctx, req.MessageName, req.BusinessKey, req.CorrelationKeys)
+	if err != nil {
+		return nil, err
+	}
+	if len(subscriptions) == 0 {
+		return nil, fmt.Errorf("%s: no instance is waiting for message %s", models.ErrMessageNotCorrelated, req.MessageName)
+	}
+
+	correlations := make([]MessageCorrelation, 0, len(subscriptions))
+	for i := range subscriptions {
+		correlations = append(correlations, s.deliver(ctx, &subscriptions[i], req.Variables))
+	}
+
+	s.logger.Info().
+		Str("messageName", req.MessageName).
+		Str("businessKey", req.BusinessKey).
+		Int("correlated", len(correlations)).
+		Msg("Message correlated")
+	return correlations, nil
+}
+
+// deliver resumes one instance at the subscribed message event
+func (s *MessageCorrelationService) deliver(
+	ctx context.Context,
+	subscription *models.MessageSubscription,
+	messageVariables map[string]interface{},
+) MessageCorrelation {
+	correlation := MessageCorrelation{
+		InstanceId: subscription.InstanceId,
+		NodeId:     subscription.NodeId,
+	}
+
+	instance, err := s.instanceSvc.GetWorkflowInstanceByID(ctx, subscription.InstanceId)
+	if err != nil {
+		correlation.Error = err.Error()
+		return correlation
+	}
+	if countNodeId(instance.CurrentNodeIds, subscription.ScopeNodeId) == 0 {
+		correlation.Error = fmt.Sprintf("instance is no longer waiting at node %s", subscription.ScopeNodeId)
+		return correlation
+	}
+
+	workflow, err := s.workflowSvc.GetWorkflowByID(ctx, subscription.WorkflowId)
+	if err != nil {
+		correlation.Error = err.Error()
+		return correlation
+	}
+
+	// 订阅时的流程变量与消息变量合并，消息变量优先
+	variables := make(map[string]interface{}, len(subscription.Variables)+len(messageVariables))
+	for key, value := range subscription.Variables {
+		variables[key] = value
+	}
+	for key, value := range messageVariables {
+		variables[key] = value
+	}
+
+	result, err := s.engineSvc.TriggerNode(ctx, workflow, instance, subscription.NodeId, variables)
+	if err != nil {
+		s.logger.Error().Err(err).
+			Str("instanceId", subscription.InstanceId).
+			Str("nodeId", subscription.NodeId).
+			Msg("Failed to resume instance from message")
+		// 实例拒绝推进（版本冲突等）时消息没有被消费，恢复订阅以便再次关联
+		if !isExecutionFailure(err) {
+			if releaseErr := s.messageSvc.ReleaseSubscription(ctx, subscription); releaseErr != nil {
+				s.logger.Warn().Err(releaseErr).Str("subscriptionId", subscription.Id).Msg("Failed to release message subscription")
+			}
+		}
+		correlation.Error = err.Error()
+		return correlation
+	}
+
+	correlation.EngineResponse = result.EngineResponse
+	return correlation
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// MessageSubscriptionService handles persistence of message subscriptions
+type MessageSubscriptionService struct {
+	db     *database.Database
+	logger *zerolog.Logger
+}
+
+// NewMessageSubscriptionService creates a new MessageSubscriptionService
+func NewMessageSubscriptionService(db *database.Database, logger *zerolog.Logger) *MessageSubscriptionService {
+	return &MessageSubscriptionService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Subscribe stores a pending message subscription
+// 同一实例的同一消息事件节点已存在待关联订阅时不会重复创建
+func (s *MessageSubscriptionService) Subscribe(ctx context.Context, subscription *models.MessageSubscription) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	variables := subscription.Variables
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription variables: %w", err)
+	}
+
+	query := `
+		INSERT INTO message_subscriptions (
+			id, instance_id, workflow_id, node_id, scope_node_id,
+			message_name, business_key, variables, status, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8::jsonb, $9, $10, $10)
+		ON CONFLICT (instance_id, node_id) WHERE status = 'pending' DO NOTHING
+	`
+
+	_, err = s.db.ExecContext(ctx, query,
+		uuid.New().String(), subscription.InstanceId, subscription.WorkflowId, subscription.NodeId, subscription.ScopeNodeId,
+		subscription.MessageName, subscription.BusinessKey, string(variablesJSON), models.SubscriptionStatusPending, time.Now(),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", subscription.InstanceId).Str("nodeId", subscription.NodeId).Msg("Failed to create message subscription")
+		return fmt.Errorf("failed to create message subscription: %w", err)
+	}
+
+	s.logger.Info().
+		Str("instanceId", subscription.InstanceId).
+		Str("nodeId", subscription.NodeId).
+		Str("messageName", subscription.MessageName).
+		Msg("Message subscription created")
+	return nil
+}
+
+// CancelStaleSubscriptions cancels pending subscriptions whose token is no longer waiting at the scope node
+func (s *MessageSubscriptionService) CancelStaleSubscriptions(ctx context.Context, instanceId string, activeNodeIds []string) (int64, error) {
+	if s.db.DB == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+
+	if activeNodeIds == nil {
+		activeNodeIds = []string{}
+	}
+
+	query := `
+		UPDATE message_subscriptions
+		SET status = $1, updated_at = $2
+		WHERE instance_id = $3 AND status = $4 AND NOT (scope_node_id = ANY($5))
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		models.SubscriptionStatusCancelled, time.Now(), instanceId, models.SubscriptionStatusPending, pq.Array(activeNodeIds),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale message subscriptions")
+		return 0, fmt.Errorf("failed to cancel stale message subscriptions: %w", err)
+	}
+
+	cancelled, _ := result.RowsAffected()
+	return cancelled, nil
+}
+
+// ClaimSubscriptions marks the matching subscriptions as correlated and returns them
+// 每个实例最多关联一个订阅（最早创建的）；同一令牌上的其他订阅（事件网关的其他分支）在同一事务中被取消，
+// 因此多条消息同时到达时只有第一条生效；挂起实例的订阅不参与关联
+func (s *MessageSubscriptionService) ClaimSubscriptions(
+	ctx context.Context,
+	messageName string,
+	businessKey string,
+	correlationKeys map[string]interface{},
+) ([]models.MessageSubscription, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	if correlationKeys == nil {
+		correlationKeys = make(map[string]interface{})
+	}
+	correlationJSON, err := json.Marshal(correlationKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal correlation keys: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, instance_id, workflow_id, node_id, scope_node_id, message_name,
+		       COALESCE(business_key, ''), variables, status, created_at, updated_at
+		FROM message_subscriptions
+		WHERE status = $1 AND message_name = $2
+		  AND ($3::text = '' OR business_key = $3)
+		  AND variables @> $4::jsonb
+		  AND NOT EXISTS (
+		      SELECT 1 FROM workflow_instances i
+		      WHERE i.id = message_subscriptions.instance_id AND i.status = 'suspended'
+		  )
+		ORDER BY created_at
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := tx.QueryContext(ctx, query, models.SubscriptionStatusPending, messageName, businessKey, string(correlationJSON))
+	if err != nil {
+		s.logger.Error().Err(err).Str("messageName", messageName).Msg("Failed to query message subscriptions")
+		return nil, fmt.Errorf("failed to query message subscriptions: %w", err)
+	}
+
+	var claimed []models.MessageSubscription
+	seenInstances := make(map[string]bool)
+	for rows.Next() {
+		subscription, err := scanMessageSubscription(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if seenInstances[subscription.InstanceId] {
+			continue
+		}
+		seenInstances[subscription.InstanceId] = true
+		claimed = append(claimed, *subscription)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate message subscriptions: %w", err)
+	}
+
+	now := time.Now()
+	for i := range claimed {
+		subscription := &claimed[i]
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE message_subscriptions SET status = $1, updated_at = $2 WHERE id = $3`,
+			models.SubscriptionStatusCorrelated, now, subscription.Id,
+		); err != nil {
+			return nil, fmt.Errorf("failed to correlate message subscription: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE message_subscriptions SET status = $1, updated_at = $2
+			 WHERE instance_id = $3 AND scope_node_id = $4 AND status = $5`,
+			models.SubscriptionStatusCancelled, now, subscription.InstanceId, subscription.ScopeNodeId, models.SubscriptionStatusPending,
+		); err != nil {
+			return nil, fmt.Errorf("failed to cancel competing message subscriptions: %w", err)
+		}
+		subscription.Status = models.SubscriptionStatusCorrelated
+		subscription.UpdatedAt = now
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit message correlation: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// ReleaseSubscription puts a correlated subscription back to pending when the instance refused to resume
+// 认领时一并取消的事件网关其他分支（同一令牌、同一时间取消）也恢复为待关联，消息可以再次关联
+func (s *MessageSubscriptionService) ReleaseSubscription(ctx context.Context, subscription *models.MessageSubscription) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE message_subscriptions SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4`,
+		models.SubscriptionStatusPending, now, subscription.Id, models.SubscriptionStatusCorrelated,
+	); err != nil {
+		return fmt.Errorf("failed to release message subscription: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE message_subscriptions SET status = $1, updated_at = $2
+		 WHERE instance_id = $3 AND scope_node_id = $4 AND status = $5 AND updated_at = $6`,
+		models.SubscriptionStatusPending, now, subscription.InstanceId, subscription.ScopeNodeId, models.SubscriptionStatusCancelled, subscription.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to release competing message subscriptions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit message subscription release: %w", err)
+	}
+	return nil
+}
+
+// scanMessageSubscription scans a message subscription row
+func scanMessageSubscription(rows *sql.Rows) (*models.MessageSubscription, error) {
+	var subscription models.MessageSubscription
+	var variablesBytes []byte
+	if err := rows.Scan(
+		&subscription.Id,
+		&subscription.InstanceId,
+		&subscription.WorkflowId,
+		&subscription.NodeId,
+		&subscription.ScopeNodeId,
+		&subscription.MessageName,
+		&subscription.BusinessKey,
+		&variablesBytes,
+		&subscription.Status,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan message subscription: %w", err)
+	}
+	if len(variablesBytes) > 0 {
+		if err := json.Unmarshal(variablesBytes, &subscription.Variables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal subscription variables: %w", err)
+		}
+	}
+	return &subscription, nil
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var subscriptionColumns = []string{"id", "instance_id", "workflow_id", "node_id", "scope_node_id", "message_name", "business_key", "variables", "status", "created_at", "updated_at"}
+
+func setupMessageSubscriptionServiceTest(t *testing.T) (*MessageSubscriptionService, sqlmock.Sqlmock, *database.Database, func()) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	database := database.NewDatabase(&logger)
+	database.DB = db
+
+	service := NewMessageSubscriptionService(database, &logger)
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return service, mock, database, cleanup
+}
+
+func TestMessageSubscriptionService_Subscribe_Success(t *testing.T) {
+	service, mock, _, cleanup := setupMessageSubscriptionServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectExec(`INSERT INTO message_subscriptions`).
+		WithArgs(sqlmock.AnyArg(), "instance-1", "workflow-1", "Catch_Paid", "Gateway_1", "PaymentReceived", "order-1", `{"businessKey":"order-1"}`, models.SubscriptionStatusPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := service.Subscribe(context.Background(), &models.MessageSubscription{
+		InstanceId:  "instance-1",
+		WorkflowId:  "workflow-1",
+		NodeId:      "Catch_Paid",
+		ScopeNodeId: "Gateway_1",
+		MessageName: "PaymentReceived",
+		BusinessKey: "order-1",
+		Variables:   map[string]interface{}{"businessKey": "order-1"},
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageSubscriptionService_ClaimSubscriptions_OnePerInstance(t *testing.T) {
+	service, mock, _, cleanup := setupMessageSubscriptionServiceTest(t)
+	defer cleanup()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM message_subscriptions`).
+		WithArgs(models.SubscriptionStatusPending, "PaymentReceived", "", `{"orderId":"1"}`).
+		WillReturnRows(sqlmock.NewRows(subscriptionColumns).
+			AddRow("sub-1", "instance-1", "workflow-1", "Catch_Paid", "Gateway_1", "PaymentReceived", "", []byte(`{"orderId":"1"}`), models.SubscriptionStatusPending, now, now).
+			AddRow("sub-2", "instance-1", "workflow-1", "Catch_Paid_Again", "UserTask_1", "PaymentReceived", "", []byte(`{"orderId":"1"}`), models.SubscriptionStatusPending, now, now).
+			AddRow("sub-3", "instance-2", "workflow-1", "Catch_Paid", "Gateway_1", "PaymentReceived", "", []byte(`{"orderId":"1"}`), models.SubscriptionStatusPending, now, now))
+	for _, sub := range []struct{ id, instanceId string }{{"sub-1", "instance-1"}, {"sub-3", "instance-2"}} {
+		mock.ExpectExec(`UPDATE message_subscriptions SET status`).
+			WithArgs(models.SubscriptionStatusCorrelated, sqlmock.AnyArg(), sub.id).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		// 同一令牌上的其他订阅（事件网关的其他分支）被取消
+		mock.ExpectExec(`UPDATE message_subscriptions SET status`).
+			WithArgs(models.SubscriptionStatusCancelled, sqlmock.AnyArg(), sub.instanceId, "Gateway_1", models.SubscriptionStatusPending).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	claimed, err := service.ClaimSubscriptions(context.Background(), "PaymentReceived", "", map[string]interface{}{"orderId": "1"})
+
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, "sub-1", claimed[0].Id)
+	assert.Equal(t, "sub-3", claimed[1].Id)
+	assert.Equal(t, models.SubscriptionStatusCorrelated, claimed[0].Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageCorrelationService_CorrelateMessage_MissingCorrelation(t *testing.T) {
+	_, _, db, cleanup := setupMessageSubscriptionServiceTest(t)
+	defer cleanup()
+
+	logger := zerolog.Nop()
+	service := NewMessageCorrelationService(db, &logger, nil, nil, nil)
+
+	_, err := service.CorrelateMessage(context.Background(), CorrelateMessageRequest{MessageName: "PaymentReceived"})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInvalidRequest)
+}
+
+func TestMessageCorrelationService_CorrelateMessage_NoSubscription(t *testing.T) {
+	_, mock, db, cleanup := setupMessageSubscriptionServiceTest(t)
+	defer cleanup()
+
+	logger := zerolog.Nop()
+	service := NewMessageCorrelationService(db, &logger, nil, nil, nil)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM message_subscriptions`).
+		WillReturnRows(sqlmock.NewRows(subscriptionColumns))
+	mock.ExpectCommit()
+
+	_, err := service.CorrelateMessage(context.Background(), CorrelateMessageRequest{
+		MessageName: "PaymentReceived",
+		BusinessKey: "order-1",
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrMessageNotCorrelated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageCorrelationService_CorrelateMessage_VersionConflict(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	logger := zerolog.Nop()
+	service := NewMessageCorrelationService(engineSvc.db, &logger, engineSvc.workflowSvc, engineSvc.instanceSvc, engineSvc)
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Order", BpmnXml: createOrderSignalBPMN(), Status: models.StatusActive}
+	engineSvc.workflowSvc.SetWorkflowInMemory(workflow)
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT (.+) FROM message_subscriptions`).
+		WillReturnRows(sqlmock.NewRows(subscriptionColumns).
+			AddRow("sub-1", "instance-1", workflow.Id, "Catch_Paid", "Gateway_Wait", "PaymentReceived", "order-1", []byte(`{}`), models.SubscriptionStatusPending, now, now))
+	mock.ExpectExec(`UPDATE message_subscriptions SET status`).
+		WithArgs(models.SubscriptionStatusCorrelated, sqlmock.AnyArg(), "sub-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE message_subscriptions SET status`).
+		WithArgs(models.SubscriptionStatusCancelled, sqlmock.AnyArg(), "instance-1", "Gateway_Wait", models.SubscriptionStatusPending).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow("instance-1", workflow.Id, "Order", models.InstanceStatusRunning, pq.Array([]string{"Gateway_Wait"}), 3, 0, now, now))
+
+	// 实例的另一个分支正在执行：占用版本失败
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), "instance-1", 3).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow("instance-1", workflow.Id, "Order", models.InstanceStatusRunning, pq.Array([]string{"Gateway_Wait"}), 4, 0, now, now))
+
+	// 订阅和被取消的事件网关分支恢复为待关联
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE message_subscriptions SET status`).
+		WithArgs(models.SubscriptionStatusPending, sqlmock.AnyArg(), "sub-1", models.SubscriptionStatusCorrelated).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE message_subscriptions SET status`).
+		WithArgs(models.SubscriptionStatusPending, sqlmock.AnyArg(), "instance-1", "Gateway_Wait", models.SubscriptionStatusCancelled, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	correlations, err := service.CorrelateMessage(context.Background(), CorrelateMessageRequest{
+		MessageName: "PaymentReceived",
+		BusinessKey: "order-1",
+	})
+
+	require.NoError(t, err)
+	require.Len(t, correlations, 1)
+	assert.Contains(t, correlations[0].Error, models.ErrInstanceVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
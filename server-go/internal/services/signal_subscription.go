@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// SignalSubscriptionService handles persistence of signal subscriptions
+type SignalSubscriptionService struct {
+	db     *database.Database
+	logger *zerolog.Logger
+}
+
+// NewSignalSubscriptionService creates a new SignalSubscriptionService
+func NewSignalSubscriptionService(db *database.Database, logger *zerolog.Logger) *SignalSubscriptionService {
+	return &SignalSubscriptionService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Subscribe stores a pending signal subscription
+// 同一实例的同一信号事件节点已存在待触发订阅时不会重复创建
+func (s *SignalSubscriptionService) Subscribe(ctx context.Context, subscription *models.SignalSubscription) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	variables := subscription.Variables
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal subscription variables: %w", err)
+	}
+
+	query := `
+		INSERT INTO signal_subscriptions (
+			id, instance_id, workflow_id, node_id, scope_node_id,
+			signal_name, variables, status, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8, $9, $9)
+		ON CONFLICT (instance_id, node_id) WHERE status = 'pending' DO NOTHING
+	`
+
+	_, err = s.db.ExecContext(ctx, query,
+		uuid.New().String(), subscription.InstanceId, subscription.WorkflowId, subscription.NodeId, subscription.ScopeNodeId,
+		subscription.SignalName, string(variablesJSON), models.SubscriptionStatusPending, time.Now(),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", subscription.InstanceId).Str("nodeId", subscription.NodeId).Msg("Failed to create signal subscription")
+		return fmt.Errorf("failed to create signal subscription: %w", err)
+	}
+
+	s.logger.Info().
+		Str("instanceId", subscription.InstanceId).
+		Str("nodeId", subscription.NodeId).
+		Str("signalName", subscription.SignalName).
+		Msg("Signal subscription created")
+	return nil
+}
+
+// CancelStaleSubscriptions cancels pending subscriptions whose token is no longer waiting at the scope node
+func (s *SignalSubscriptionService) CancelStaleSubscriptions(ctx context.Context, instanceId string, activeNodeIds []string) (int64, error) {
+	if s.db.DB == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+
+	if activeNodeIds == nil {
+		activeNodeIds = []string{}
+	}
+
+	query := `
+		UPDATE signal_subscriptions
+		SET status = $1, updated_at = $2
+		WHERE instance_id = $3 AND status = $4 AND NOT (scope_node_id = ANY($5))
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		models.SubscriptionStatusCancelled, time.Now(), instanceId, models.SubscriptionStatusPending, pq.Array(activeNodeIds),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale signal subscriptions")
+		return 0, fmt.Errorf("failed to cancel stale signal subscriptions: %w", err)
+	}
+
+	cancelled, _ := result.RowsAffected()
+	return cancelled, nil
+}
+
+// ClaimSubscriptions marks up to limit pending subscriptions of the signal created before the given time as triggered and returns them
+// 广播分批认领订阅，只认领广播开始前创建的订阅，被唤醒的实例再次等待同一信号时不会在本次广播中重复触发；
+// 并发广播通过 SKIP LOCKED 认领不同的订阅；挂起实例的订阅不参与广播
+func (s *SignalSubscriptionService) ClaimSubscriptions(
+	ctx context.Context,
+	signalName string,
+	createdBefore time.Time,
+	limit int,
+) ([]models.SignalSubscription, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE signal_subscriptions
+		SET status = $1, updated_at = $2
+		WHERE id IN (
+			SELECT id FROM signal_subscriptions
+			WHERE status = $3 AND signal_name = $4 AND created_at <= $5
+			  AND NOT EXISTS (
+			      SELECT 1 FROM workflow_instances i
+			      WHERE i.id = signal_subscriptions.instance_id AND i.status = 'suspended'
+			  )
+			ORDER BY created_at
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, instance_id, workflow_id, node_id, scope_node_id, signal_name,
+		          variables, status, created_at, updated_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		models.SubscriptionStatusTriggered, time.Now(), models.SubscriptionStatusPending, signalName, createdBefore, limit,
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("signalName", signalName).Msg("Failed to claim signal subscriptions")
+		return nil, fmt.Errorf("failed to claim signal subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var claimed []models.SignalSubscription
+	for rows.Next() {
+		subscription, err := scanSignalSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, *subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate signal subscriptions: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// ReleaseSubscriptions puts triggered subscriptions back to pending when their instances refused to resume
+// 实例拒绝推进（版本冲突等）时信号没有被消费，订阅在下一次广播中再次被认领
+func (s *SignalSubscriptionService) ReleaseSubscriptions(ctx context.Context, subscriptionIds []string) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE signal_subscriptions
+		SET status = $1, updated_at = $2
+		WHERE id = ANY($3) AND status = $4
+	`
+
+	if _, err := s.db.ExecContext(ctx, query,
+		models.SubscriptionStatusPending, time.Now(), pq.Array(subscriptionIds), models.SubscriptionStatusTriggered,
+	); err != nil {
+		s.logger.Error().Err(err).Strs("subscriptionIds", subscriptionIds).Msg("Failed to release signal subscriptions")
+		return fmt.Errorf("failed to release signal subscriptions: %w", err)
+	}
+	return nil
+}
+
+// scanSignalSubscription scans a signal subscription row
+func scanSignalSubscription(rows *sql.Rows) (*models.SignalSubscription, error) {
+	var subscription models.SignalSubscription
+	var variablesBytes []byte
+	if err := rows.Scan(
+		&subscription.Id,
+		&subscription.InstanceId,
+		&subscription.WorkflowId,
+		&subscription.NodeId,
+		&subscription.ScopeNodeId,
+		&subscription.SignalName,
+		&variablesBytes,
+		&subscription.Status,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan signal subscription: %w", err)
+	}
+	if len(variablesBytes) > 0 {
+		if err := json.Unmarshal(variablesBytes, &subscription.Variables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal subscription variables: %w", err)
+		}
+	}
+	return &subscription, nil
+}
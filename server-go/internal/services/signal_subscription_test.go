@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var signalSubscriptionColumns = []string{"id", "instance_id", "workflow_id", "node_id", "scope_node_id", "signal_name", "variables", "status", "created_at", "updated_at"}
+
+func setupSignalSubscriptionServiceTest(t *testing.T) (*SignalSubscriptionService, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	database := database.NewDatabase(&logger)
+	database.DB = db
+
+	service := NewSignalSubscriptionService(database, &logger)
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return service, mock, cleanup
+}
+
+func TestSignalSubscriptionService_Subscribe_Success(t *testing.T) {
+	service, mock, cleanup := setupSignalSubscriptionServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectExec(`INSERT INTO signal_subscriptions`).
+		WithArgs(sqlmock.AnyArg(), "instance-1", "workflow-1", "Boundary_Recall", "UserTask_Ship", "ProductRecall", `{"orderId":"o-1"}`, models.SubscriptionStatusPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := service.Subscribe(context.Background(), &models.SignalSubscription{
+		InstanceId:  "instance-1",
+		WorkflowId:  "workflow-1",
+		NodeId:      "Boundary_Recall",
+		ScopeNodeId: "UserTask_Ship",
+		SignalName:  "ProductRecall",
+		Variables:   map[string]interface{}{"orderId": "o-1"},
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSignalSubscriptionService_ClaimSubscriptions_Batch(t *testing.T) {
+	service, mock, cleanup := setupSignalSubscriptionServiceTest(t)
+	defer cleanup()
+
+	now := time.Now()
+	broadcastAt := now.Add(time.Second)
+	// 同一实例的多个令牌等待同一信号时都被认领
+	mock.ExpectQuery(`UPDATE signal_subscriptions SET status = \$1, updated_at = \$2 WHERE id IN \((.+) LIMIT \$6 FOR UPDATE SKIP LOCKED \) RETURNING`).
+		WithArgs(models.SubscriptionStatusTriggered, sqlmock.AnyArg(), models.SubscriptionStatusPending, "ProductRecall", broadcastAt, 2).
+		WillReturnRows(sqlmock.NewRows(signalSubscriptionColumns).
+			AddRow("sub-1", "instance-1", "workflow-1", "Catch_Recall", "Catch_Recall", "ProductRecall", []byte(`{"orderId":"o-1"}`), models.SubscriptionStatusTriggered, now, now).
+			AddRow("sub-2", "instance-1", "workflow-1", "Boundary_Recall", "UserTask_Ship", "ProductRecall", []byte(`{"orderId":"o-1"}`), models.SubscriptionStatusTriggered, now, now))
+
+	claimed, err := service.ClaimSubscriptions(context.Background(), "ProductRecall", broadcastAt, 2)
+
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, "Catch_Recall", claimed[0].NodeId)
+	assert.Equal(t, "UserTask_Ship", claimed[1].ScopeNodeId)
+	assert.Equal(t, map[string]interface{}{"orderId": "o-1"}, claimed[1].Variables)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSignalSubscriptionService_CancelStaleSubscriptions_NoDatabase(t *testing.T) {
+	logger := zerolog.Nop()
+	service := NewSignalSubscriptionService(database.NewDatabase(&logger), &logger)
+
+	_, err := service.CancelStaleSubscriptions(context.Background(), "instance-1", nil)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database not available")
+}
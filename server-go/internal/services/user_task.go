@@ -0,0 +1,388 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// userTaskColumns 查询人工任务时返回的列，与 scanUserTask 的顺序一致
+const userTaskColumns = `id, instance_id, workflow_id, node_id, name, COALESCE(assignee, ''), COALESCE(owner, ''),
+		       candidate_users, candidate_groups, due_date, priority, COALESCE(form_key, ''), variables, status, created_at, updated_at`
+
+// UserTaskService handles persistence of human tasks
+type UserTaskService struct {
+	db     *database.Database
+	logger *zerolog.Logger
+}
+
+// NewUserTaskService creates a new UserTaskService
+func NewUserTaskService(db *database.Database, logger *zerolog.Logger) *UserTaskService {
+	return &UserTaskService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// UserTaskFilter represents the conditions for listing user tasks
+type UserTaskFilter struct {
+	// User 只返回分配给该用户、或该用户（及其所在的 Groups）可以认领的任务
+	User       string
+	Groups     []string
+	InstanceId string
+	Status     string
+}
+
+// CreateUserTask stores a pending user task
+// 同一实例的同一 userTask 已存在待处理任务时不会重复创建
+func (s *UserTaskService) CreateUserTask(ctx context.Context, task *models.UserTask) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	variables := task.Variables
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user task variables: %w", err)
+	}
+	candidateUsers := task.CandidateUsers
+	if candidateUsers == nil {
+		candidateUsers = []string{}
+	}
+	candidateGroups := task.CandidateGroups
+	if candidateGroups == nil {
+		candidateGroups = []string{}
+	}
+
+	query := `
+		INSERT INTO user_tasks (
+			id, instance_id, workflow_id, node_id, name, assignee, candidate_users, candidate_groups,
+			due_date, priority, form_key, variables, status, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, NULLIF($11, ''), $12::jsonb, $13, $14, $14)
+		ON CONFLICT (instance_id, node_id) WHERE status = 'pending' DO NOTHING
+	`
+
+	task.Id = uuid.New().String()
+	task.Status = models.UserTaskStatusPending
+	_, err = s.db.ExecContext(ctx, query,
+		task.Id, task.InstanceId, task.WorkflowId, task.NodeId, task.Name, task.Assignee,
+		pq.Array(candidateUsers), pq.Array(candidateGroups), task.DueDate, task.Priority, task.FormKey,
+		string(variablesJSON), task.Status, time.Now(),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", task.InstanceId).Str("nodeId", task.NodeId).Msg("Failed to create user task")
+		return fmt.Errorf("failed to create user task: %w", err)
+	}
+
+	s.logger.Info().
+		Str("instanceId", task.InstanceId).
+		Str("nodeId", task.NodeId).
+		Str("assignee", task.Assignee).
+		Msg("User task created")
+	return nil
+}
+
+// CancelStaleUserTasks cancels pending user tasks whose token is no longer waiting at the user task
+func (s *UserTaskService) CancelStaleUserTasks(ctx context.Context, instanceId string, activeNodeIds []string) (int64, error) {
+	if s.db.DB == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+
+	if activeNodeIds == nil {
+		activeNodeIds = []string{}
+	}
+
+	query := `
+		UPDATE user_tasks
+		SET status = $1, updated_at = $2
+		WHERE instance_id = $3 AND status = $4 AND NOT (node_id = ANY($5))
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		models.UserTaskStatusCancelled, time.Now(), instanceId, models.UserTaskStatusPending, pq.Array(activeNodeIds),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale user tasks")
+		return 0, fmt.Errorf("failed to cancel stale user tasks: %w", err)
+	}
+
+	cancelled, _ := result.RowsAffected()
+	return cancelled, nil
+}
+
+// GetUserTask retrieves a user task by ID
+func (s *UserTaskService) GetUserTask(ctx context.Context, taskId string) (*models.UserTask, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `SELECT ` + userTaskColumns + ` FROM user_tasks WHERE id = $1`
+	task, err := scanUserTask(s.db.QueryRowContext(ctx, query, taskId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s: user task %s not found", models.ErrUserTaskNotFound, taskId)
+		}
+		s.logger.Error().Err(err).Str("taskId", taskId).Msg("Failed to get user task")
+		return nil, fmt.Errorf("failed to get user task: %w", err)
+	}
+	return task, nil
+}
+
+// ListUserTasks lists user tasks matching the filter with pagination
+// 按优先级从高到低、期限从早到晚排序
+func (s *UserTaskService) ListUserTasks(
+	ctx context.Context,
+	filter UserTaskFilter,
+	page, pageSize int,
+) ([]models.UserTask, *models.Metadata, error) {
+	if s.db.DB == nil {
+		return nil, nil, fmt.Errorf("database not available")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	// 按提供的条件拼接 WHERE 子句
+	where := " WHERE 1=1"
+	var args []interface{}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if filter.InstanceId != "" {
+		args = append(args, filter.InstanceId)
+		where += fmt.Sprintf(" AND instance_id = $%d", len(args))
+	}
+	if filter.User != "" || len(filter.Groups) > 0 {
+		groups := filter.Groups
+		if groups == nil {
+			groups = []string{}
+		}
+		// 分配给该用户的任务，或尚未分配且该用户是候选人、所在组是候选组的任务
+		args = append(args, filter.User, pq.Array(groups))
+		where += fmt.Sprintf(
+			" AND (assignee = $%d OR (assignee IS NULL AND ($%d = ANY(candidate_users) OR candidate_groups && $%d)))",
+			len(args)-1, len(args)-1, len(args),
+		)
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_tasks`+where, args...).Scan(&total); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to count user tasks")
+		return nil, nil, fmt.Errorf("failed to count user tasks: %w", err)
+	}
+
+	query := `
+		SELECT ` + userTaskColumns + `
+		FROM user_tasks` + where + fmt.Sprintf(`
+		ORDER BY priority DESC, due_date ASC NULLS LAST, created_at ASC
+		LIMIT $%d OFFSET $%d
+	`, len(args)+1, len(args)+2)
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list user tasks")
+		return nil, nil, fmt.Errorf("failed to list user tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []models.UserTask{}
+	for rows.Next() {
+		task, err := scanUserTask(rows)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Failed to scan user task")
+			return nil, nil, fmt.Errorf("failed to scan user task: %w", err)
+		}
+		tasks = append(tasks, *task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to iterate user tasks: %w", err)
+	}
+
+	metadata := &models.Metadata{
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		HasMore:  page*pageSize < total,
+	}
+	return tasks, metadata, nil
+}
+
+// ClaimUserTask assigns a pending user task to a user
+// 任务没有候选人和候选组时任何人都可以认领，否则用户必须是候选人或属于某个候选组
+func (s *UserTaskService) ClaimUserTask(ctx context.Context, taskId string, userId string, groups []string) (*models.UserTask, error) {
+	if groups == nil {
+		groups = []string{}
+	}
+	return s.updateUserTask(ctx, "claim", taskId, userId, `
+		UPDATE user_tasks
+		SET assignee = $1, updated_at = $2
+		WHERE id = $3 AND status = $4 AND (assignee IS NULL OR assignee = $1)
+		  AND ((cardinality(candidate_users) = 0 AND cardinality(candidate_groups) = 0)
+		       OR $1 = ANY(candidate_users) OR candidate_groups && $5)
+		RETURNING `+userTaskColumns,
+		userId, time.Now(), taskId, models.UserTaskStatusPending, pq.Array(groups),
+	)
+}
+
+// UnclaimUserTask returns a user task claimed by the user to its candidates
+func (s *UserTaskService) UnclaimUserTask(ctx context.Context, taskId string, userId string) (*models.UserTask, error) {
+	return s.updateUserTask(ctx, "unclaim", taskId, userId, `
+		UPDATE user_tasks
+		SET assignee = NULL, updated_at = $2
+		WHERE id = $3 AND status = $4 AND assignee = $1
+		RETURNING `+userTaskColumns,
+		userId, time.Now(), taskId, models.UserTaskStatusPending,
+	)
+}
+
+// DelegateUserTask hands a user task over to another user
+// 第一次委派时记录原处理人为 owner，多次委派不会覆盖
+func (s *UserTaskService) DelegateUserTask(ctx context.Context, taskId string, userId string, delegateTo string) (*models.UserTask, error) {
+	return s.updateUserTask(ctx, "delegate", taskId, userId, `
+		UPDATE user_tasks
+		SET owner = COALESCE(owner, assignee), assignee = $5, updated_at = $2
+		WHERE id = $3 AND status = $4 AND assignee = $1
+		RETURNING `+userTaskColumns,
+		userId, time.Now(), taskId, models.UserTaskStatusPending, delegateTo,
+	)
+}
+
+// CompleteUserTask marks a user task assigned to the user as completed
+// 状态检查与修改在同一条语句中完成，同一任务只会被完成一次
+func (s *UserTaskService) CompleteUserTask(ctx context.Context, taskId string, userId string) (*models.UserTask, error) {
+	return s.updateUserTask(ctx, "complete", taskId, userId, `
+		UPDATE user_tasks
+		SET status = $5, updated_at = $2
+		WHERE id = $3 AND status = $4 AND assignee = $1
+		RETURNING `+userTaskColumns,
+		userId, time.Now(), taskId, models.UserTaskStatusPending, models.UserTaskStatusCompleted,
+	)
+}
+
+// ReopenUserTask sets a completed user task back to pending
+// 完成任务后实例拒绝推进（版本冲突、挂起等）时使用，任务可以再次完成
+func (s *UserTaskService) ReopenUserTask(ctx context.Context, taskId string) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE user_tasks
+		SET status = $1, updated_at = $2
+		WHERE id = $3 AND status = $4
+	`
+	if _, err := s.db.ExecContext(ctx, query,
+		models.UserTaskStatusPending, time.Now(), taskId, models.UserTaskStatusCompleted,
+	); err != nil {
+		s.logger.Error().Err(err).Str("taskId", taskId).Msg("Failed to reopen user task")
+		return fmt.Errorf("failed to reopen user task: %w", err)
+	}
+	return nil
+}
+
+// updateUserTask runs a conditional update on a user task and returns the updated task
+// 条件不满足时查询任务当前状态，区分任务不存在、已结束、已被他人认领和用户无权处理
+func (s *UserTaskService) updateUserTask(
+	ctx context.Context,
+	action string,
+	taskId string,
+	userId string,
+	query string,
+	args ...interface{},
+) (*models.UserTask, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	task, err := scanUserTask(s.db.QueryRowContext(ctx, query, args...))
+	if err == nil {
+		s.logger.Info().
+			Str("taskId", taskId).
+			Str("userId", userId).
+			Str("action", action).
+			Str("assignee", task.Assignee).
+			Msg("User task updated")
+		return task, nil
+	}
+	if err != sql.ErrNoRows {
+		s.logger.Error().Err(err).Str("taskId", taskId).Str("action", action).Msg("Failed to update user task")
+		return nil, fmt.Errorf("failed to %s user task: %w", action, err)
+	}
+
+	current, err := s.GetUserTask(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case current.Status != models.UserTaskStatusPending:
+		return nil, fmt.Errorf("%s: cannot %s user task %s, it is %s", models.ErrInvalidTaskState, action, taskId, current.Status)
+	case current.Assignee != "" && current.Assignee != userId:
+		return nil, fmt.Errorf("%s: cannot %s user task %s, it is assigned to %s", models.ErrInvalidTaskState, action, taskId, current.Assignee)
+	case current.Assignee == "" && action != "claim":
+		return nil, fmt.Errorf("%s: cannot %s user task %s, it must be claimed first", models.ErrInvalidTaskState, action, taskId)
+	default:
+		return nil, fmt.Errorf("%s: user %s is not a candidate of user task %s", models.ErrInvalidTaskState, userId, taskId)
+	}
+}
+
+// userTaskScanner is implemented by *sql.Row and *sql.Rows
+type userTaskScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUserTask scans a user task selected with userTaskColumns
+func scanUserTask(row userTaskScanner) (*models.UserTask, error) {
+	var task models.UserTask
+	var dueDate sql.NullTime
+	var variablesBytes []byte
+	if err := row.Scan(
+		&task.Id,
+		&task.InstanceId,
+		&task.WorkflowId,
+		&task.NodeId,
+		&task.Name,
+		&task.Assignee,
+		&task.Owner,
+		pq.Array(&task.CandidateUsers),
+		pq.Array(&task.CandidateGroups),
+		&dueDate,
+		&task.Priority,
+		&task.FormKey,
+		&variablesBytes,
+		&task.Status,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if dueDate.Valid {
+		task.DueDate = &dueDate.Time
+	}
+	if len(variablesBytes) > 0 {
+		if err := json.Unmarshal(variablesBytes, &task.Variables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal user task variables: %w", err)
+		}
+	}
+	return &task, nil
+}
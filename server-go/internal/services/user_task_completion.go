@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/rs/zerolog"
+)
+
+// UserTaskCompletionService completes human tasks and advances the instances waiting at them
+type UserTaskCompletionService struct {
+	logger      *zerolog.Logger
+	taskSvc     *UserTaskService
+	workflowSvc *WorkflowService
+	instanceSvc *WorkflowInstanceService
+	engineSvc   *WorkflowEngineService
+}
+
+// NewUserTaskCompletionService creates a new UserTaskCompletionService
+func NewUserTaskCompletionService(
+	db *database.Database,
+	logger *zerolog.Logger,
+	workflowSvc *WorkflowService,
+	instanceSvc *WorkflowInstanceService,
+	engineSvc *WorkflowEngineService,
+) *UserTaskCompletionService {
+	return &UserTaskCompletionService{
+		logger:      logger,
+		taskSvc:     NewUserTaskService(db, logger),
+		workflowSvc: workflowSvc,
+		instanceSvc: instanceSvc,
+		engineSvc:   engineSvc,
+	}
+}
+
+// CompleteUserTaskRequest represents the completion of a user task
+type CompleteUserTaskRequest struct {
+	UserId    string                 `json:"userId" binding:"required"`
+	Outcome   string                 `json:"outcome,omitempty"`   // 完成时触发的边界事件 ID，任务只有一个可完成的边界事件时可省略
+	Variables map[string]interface{} `json:"variables,omitempty"` // 提交的变量，合并到创建任务时的流程变量中
+}
+
+// UserTaskCompletion represents the result of completing a user task
+type UserTaskCompletion struct {
+	Task           *models.UserTask `json:"task"`
+	Outcome        string           `json:"outcome"`
+	EngineResponse *EngineResponse  `json:"engineResponse"`
+}
+
+// CompleteTask completes a user task assigned to the user and resumes the instance through the chosen boundary event
+// 实例拒绝推进（版本冲突、挂起等）时任务恢复为待处理，可以再次完成
+func (s *UserTaskCompletionService) CompleteTask(ctx context.Context, taskId string, req CompleteUserTaskRequest) (*UserTaskCompletion, error) {
+	if req.UserId == "" {
+		return nil, fmt.Errorf("%s: userId is required", models.ErrInvalidRequest)
+	}
+
+	task, err := s.taskSvc.GetUserTask(ctx, taskId)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != models.UserTaskStatusPending {
+		return nil, fmt.Errorf("%s: cannot complete user task %s, it is %s", models.ErrInvalidTaskState, taskId, task.Status)
+	}
+
+	instance, err := s.instanceSvc.GetWorkflowInstanceByID(ctx, task.InstanceId)
+	if err != nil {
+		return nil, err
+	}
+	if countNodeId(instance.CurrentNodeIds, task.NodeId) == 0 {
+		return nil, fmt.Errorf("%s: instance %s is no longer waiting at node %s", models.ErrInvalidInstanceState, instance.Id, task.NodeId)
+	}
+
+	workflow, err := s.workflowSvc.GetWorkflowByID(ctx, task.WorkflowId)
+	if err != nil {
+		return nil, err
+	}
+	// 出口按实例固定的流程版本解析
+	pinned, err := s.engineSvc.resolveWorkflowVersion(ctx, workflow, instance.WorkflowVersion)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := parser.ParseBPMN(pinned.BpmnXml)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse BPMN XML: %w", err)
+	}
+	outcome, err := resolveTaskOutcome(wd, task.NodeId, req.Outcome)
+	if err != nil {
+		return nil, err
+	}
+
+	completed, err := s.taskSvc.CompleteUserTask(ctx, taskId, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建任务时的流程变量与提交的变量合并，提交的变量优先
+	variables := make(map[string]interface{}, len(task.Variables)+len(req.Variables))
+	for key, value := range task.Variables {
+		variables[key] = value
+	}
+	for key, value := range req.Variables {
+		variables[key] = value
+	}
+
+	result, err := s.engineSvc.TriggerNode(ctx, workflow, instance, outcome, variables)
+	if err != nil {
+		s.logger.Error().Err(err).
+			Str("taskId", taskId).
+			Str("instanceId", instance.Id).
+			Str("outcome", outcome).
+			Msg("Failed to resume instance from user task")
+		if !isExecutionFailure(err) {
+			if reopenErr := s.taskSvc.ReopenUserTask(ctx, taskId); reopenErr != nil {
+				s.logger.Warn().Err(reopenErr).Str("taskId", taskId).Msg("Failed to reopen user task")
+			}
+		}
+		return nil, err
+	}
+
+	s.logger.Info().
+		Str("taskId", taskId).
+		Str("userId", req.UserId).
+		Str("instanceId", instance.Id).
+		Str("outcome", outcome).
+		Msg("User task completed")
+	return &UserTaskCompletion{
+		Task:           completed,
+		Outcome:        outcome,
+		EngineResponse: result.EngineResponse,
+	}, nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var userTaskColumnNames = []string{"id", "instance_id", "workflow_id", "node_id", "name", "assignee", "owner", "candidate_users", "candidate_groups", "due_date", "priority", "form_key", "variables", "status", "created_at", "updated_at"}
+
+func setupUserTaskServiceTest(t *testing.T) (*UserTaskService, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	database := database.NewDatabase(&logger)
+	database.DB = db
+
+	service := NewUserTaskService(database, &logger)
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return service, mock, cleanup
+}
+
+// userTaskRow builds a user_tasks row for UserTask_Approve of instance-1
+func userTaskRow(assignee string, status string) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(userTaskColumnNames).
+		AddRow("task-1", "instance-1", "workflow-1", "UserTask_Approve", "Approve", assignee, "",
+			pq.Array([]string{"bob"}), pq.Array([]string{"managers"}), nil, 50, "approve-form",
+			[]byte(`{"amount":100}`), status, now, now)
+}
+
+func TestUserTaskService_CreateUserTask_Success(t *testing.T) {
+	service, mock, cleanup := setupUserTaskServiceTest(t)
+	defer cleanup()
+
+	dueDate := time.Now().Add(48 * time.Hour)
+	mock.ExpectExec(`INSERT INTO user_tasks`).
+		WithArgs(sqlmock.AnyArg(), "instance-1", "workflow-1", "UserTask_Approve", "Approve", "",
+			pq.Array([]string{"bob"}), pq.Array([]string{"managers"}), &dueDate, 80, "approve-form",
+			`{"amount":100}`, models.UserTaskStatusPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	task := &models.UserTask{
+		InstanceId:      "instance-1",
+		WorkflowId:      "workflow-1",
+		NodeId:          "UserTask_Approve",
+		Name:            "Approve",
+		CandidateUsers:  []string{"bob"},
+		CandidateGroups: []string{"managers"},
+		DueDate:         &dueDate,
+		Priority:        80,
+		FormKey:         "approve-form",
+		Variables:       map[string]interface{}{"amount": 100},
+	}
+	err := service.CreateUserTask(context.Background(), task)
+
+	require.NoError(t, err)
+	assert.NotEmpty(t, task.Id)
+	assert.Equal(t, models.UserTaskStatusPending, task.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserTaskService_ListUserTasks_MyTasks(t *testing.T) {
+	service, mock, cleanup := setupUserTaskServiceTest(t)
+	defer cleanup()
+
+	filter := UserTaskFilter{User: "bob", Groups: []string{"managers"}, Status: models.UserTaskStatusPending}
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM user_tasks WHERE 1=1 AND status = \$1 AND \(assignee = \$2 OR \(assignee IS NULL AND \(\$2 = ANY\(candidate_users\) OR candidate_groups && \$3\)\)\)`).
+		WithArgs(models.UserTaskStatusPending, "bob", pq.Array([]string{"managers"})).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`SELECT (.+) FROM user_tasks WHERE 1=1 (.+) ORDER BY priority DESC`).
+		WithArgs(models.UserTaskStatusPending, "bob", pq.Array([]string{"managers"}), 20, 0).
+		WillReturnRows(userTaskRow("", models.UserTaskStatusPending))
+
+	tasks, metadata, err := service.ListUserTasks(context.Background(), filter, 1, 20)
+
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, "task-1", tasks[0].Id)
+	assert.Equal(t, []string{"managers"}, tasks[0].CandidateGroups)
+	assert.Nil(t, tasks[0].DueDate)
+	assert.Equal(t, map[string]interface{}{"amount": float64(100)}, tasks[0].Variables)
+	assert.Equal(t, 1, metadata.Total)
+	assert.False(t, metadata.HasMore)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserTaskService_ClaimUserTask_Success(t *testing.T) {
+	service, mock, cleanup := setupUserTaskServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`UPDATE user_tasks SET assignee = \$1`).
+		WithArgs("alice", sqlmock.AnyArg(), "task-1", models.UserTaskStatusPending, pq.Array([]string{"managers"})).
+		WillReturnRows(userTaskRow("alice", models.UserTaskStatusPending))
+
+	task, err := service.ClaimUserTask(context.Background(), "task-1", "alice", []string{"managers"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "alice", task.Assignee)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserTaskService_UpdateUserTask_Conflicts(t *testing.T) {
+	tests := []struct {
+		name          string
+		assignee      string
+		status        string
+		apply         func(service *UserTaskService) (*models.UserTask, error)
+		expectedError string
+	}{
+		{
+			name:     "claim a task assigned to someone else",
+			assignee: "carol",
+			status:   models.UserTaskStatusPending,
+			apply: func(service *UserTaskService) (*models.UserTask, error) {
+				return service.ClaimUserTask(context.Background(), "task-1", "alice", nil)
+			},
+			expectedError: "it is assigned to carol",
+		},
+		{
+			name:   "claim without being a candidate",
+			status: models.UserTaskStatusPending,
+			apply: func(service *UserTaskService) (*models.UserTask, error) {
+				return service.ClaimUserTask(context.Background(), "task-1", "alice", []string{"sales"})
+			},
+			expectedError: "user alice is not a candidate of user task task-1",
+		},
+		{
+			name:   "complete an unclaimed task",
+			status: models.UserTaskStatusPending,
+			apply: func(service *UserTaskService) (*models.UserTask, error) {
+				return service.CompleteUserTask(context.Background(), "task-1", "bob")
+			},
+			expectedError: "it must be claimed first",
+		},
+		{
+			name:     "delegate a completed task",
+			assignee: "alice",
+			status:   models.UserTaskStatusCompleted,
+			apply: func(service *UserTaskService) (*models.UserTask, error) {
+				return service.DelegateUserTask(context.Background(), "task-1", "alice", "dave")
+			},
+			expectedError: "it is completed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, mock, cleanup := setupUserTaskServiceTest(t)
+			defer cleanup()
+
+			// 条件更新没有命中时读取任务当前状态说明原因
+			mock.ExpectQuery(`UPDATE user_tasks`).
+				WillReturnRows(sqlmock.NewRows(userTaskColumnNames))
+			mock.ExpectQuery(`SELECT (.+) FROM user_tasks WHERE id = \$1`).
+				WithArgs("task-1").
+				WillReturnRows(userTaskRow(tt.assignee, tt.status))
+
+			task, err := tt.apply(service)
+
+			require.Error(t, err)
+			assert.Nil(t, task)
+			assert.Contains(t, err.Error(), models.ErrInvalidTaskState)
+			assert.Contains(t, err.Error(), tt.expectedError)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserTaskService_GetUserTask_NotFound(t *testing.T) {
+	service, mock, cleanup := setupUserTaskServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT (.+) FROM user_tasks WHERE id = \$1`).
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows(userTaskColumnNames))
+
+	task, err := service.GetUserTask(context.Background(), "missing")
+
+	require.Error(t, err)
+	assert.Nil(t, task)
+	assert.Contains(t, err.Error(), models.ErrUserTaskNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+
+	"github.com/bpmn-explorer/server/internal/models"
+)
+
+// asyncContinuationKey 工作池执行作业时在上下文中携带作业，引擎据此在作业节点上继续而不是再次停留
+type asyncContinuationKey struct{}
+
+// asyncJob is a job to create for a token parked at an async continuation
+type asyncJob struct {
+	NodeId  string
+	JobType string
+}
+
+// withAsyncContinuation returns a context that continues the instance past the async continuation of the job
+func withAsyncContinuation(ctx context.Context, job *models.WorkflowJob) context.Context {
+	return context.WithValue(ctx, asyncContinuationKey{}, job)
+}
+
+// asyncContinuationFor returns the job type of the continuation carried by the context for the given node, or ""
+func asyncContinuationFor(ctx context.Context, instanceId string, nodeId string) string {
+	job, ok := ctx.Value(asyncContinuationKey{}).(*models.WorkflowJob)
+	if !ok || job.InstanceId != instanceId || job.NodeId != nodeId {
+		return ""
+	}
+	return job.JobType
+}
+
+// isAsyncNode checks whether the node has an async continuation
+func isAsyncNode(node models.Node) bool {
+	return node.AsyncBefore || node.AsyncAfter
+}
+
+// waitingNodeIds returns the parked tokens that wait for an event, excluding tokens parked at async continuations
+// 停在异步延续上的节点还没有执行，不能为它们登记定时器、消息、信号、人工任务和子实例
+func waitingNodeIds(parkedNodeIds []string, jobs []asyncJob) []string {
+	if len(jobs) == 0 {
+		return parkedNodeIds
+	}
+	waiting := parkedNodeIds
+	for _, job := range jobs {
+		waiting = removeNodeId(waiting, job.NodeId, 1)
+	}
+	return waiting
+}
+
+// syncJobs creates jobs for tokens parked at async continuations and cancels jobs whose token has left
+// 作业记录失败只输出日志，令牌仍停在节点上，可以手动从该节点继续执行
+func (s *WorkflowEngineService) syncJobs(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	workflowId string,
+	instanceId string,
+	jobs []asyncJob,
+	currentNodeIds []string,
+	variables map[string]interface{},
+) {
+	if !hasWaitingEvents(wd, isAsyncNode) {
+		return
+	}
+
+	if _, err := s.jobSvc.CancelStaleJobs(ctx, instanceId, currentNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale jobs")
+	}
+
+	for _, job := range jobs {
+		// 同一次执行中抛出的错误可能已经移除了该令牌
+		if countNodeId(currentNodeIds, job.NodeId) == 0 {
+			continue
+		}
+		err := s.jobSvc.CreateJob(ctx, &models.WorkflowJob{
+			InstanceId: instanceId,
+			WorkflowId: workflowId,
+			NodeId:     job.NodeId,
+			JobType:    job.JobType,
+			Variables:  variables,
+		})
+		if err != nil {
+			s.logger.Warn().Err(err).Str("instanceId", instanceId).Str("nodeId", job.NodeId).Msg("Failed to create job")
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createAsyncTestBPMN 脚本任务前后都是异步延续
+func createAsyncTestBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1" name="Async Process">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:scriptTask id="ScriptTask_Total" scriptFormat="expr" xflow:asyncBefore="true" xflow:asyncAfter="true">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:script>total = price * 2</bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="ScriptTask_Total"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="ScriptTask_Total" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+// expectAsyncExecution mocks one execution of an instance from claiming its version to the final instance update
+// variables 为执行记录中保存的变量（即请求传入的变量）
+func expectAsyncExecution(mock sqlmock.Sqlmock, instanceId string, workflowId string, variables string, fromNodeIds []string, historyNodeIds []string, status string, toNodeIds []string) {
+	now := time.Now()
+	executionColumns := []string{"id", "instance_id", "workflow_id", "status", "variables", "execution_version", "started_at", "completed_at", "error_message"}
+
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceId, 1).
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow(instanceId, workflowId, "Async Instance", models.InstanceStatusRunning, pq.Array(fromNodeIds), 2, 0, now, now))
+	mock.ExpectQuery(`SELECT instance_version FROM workflow_instances WHERE id`).
+		WithArgs(instanceId).
+		WillReturnRows(sqlmock.NewRows([]string{"instance_version"}).AddRow(2))
+	mock.ExpectQuery(`INSERT INTO workflow_executions`).
+		WillReturnRows(sqlmock.NewRows(executionColumns).
+			AddRow("exec-1", instanceId, workflowId, models.ExecutionStatusPending, []byte("{}"), 2, now, sql.NullTime{}, sql.NullString{}))
+	mock.ExpectQuery(`UPDATE workflow_executions`).
+		WillReturnRows(sqlmock.NewRows(executionColumns).
+			AddRow("exec-1", instanceId, workflowId, models.ExecutionStatusRunning, []byte(variables), 2, now, sql.NullTime{}, sql.NullString{}))
+	for _, nodeId := range historyNodeIds {
+		expectExecutionHistoryInsert(mock, "exec-1", nodeId, "")
+	}
+	mock.ExpectQuery(`UPDATE workflow_executions`).
+		WillReturnRows(sqlmock.NewRows(executionColumns).
+			AddRow("exec-1", instanceId, workflowId, models.ExecutionStatusRunning, []byte("{}"), 2, now, sql.NullTime{}, sql.NullString{}))
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), status, pq.Array(toNodeIds), instanceId, 2).
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow(instanceId, workflowId, "Async Instance", status, pq.Array(toNodeIds), 3, 0, now, now))
+}
+
+func TestWorkflowEngineService_AsyncContinuations(t *testing.T) {
+	instanceId := "instance-1"
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Async", BpmnXml: createAsyncTestBPMN(), Status: models.StatusActive}
+
+	t.Run("asyncBefore parks the token and creates a job", func(t *testing.T) {
+		engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+		defer cleanup()
+
+		expectAsyncExecution(mock, instanceId, workflow.Id, `{"price":21}`, []string{"StartEvent_1"},
+			[]string{"StartEvent_1", "ScriptTask_Total"}, models.InstanceStatusRunning, []string{"ScriptTask_Total"})
+		mock.ExpectExec(`UPDATE workflow_jobs`).
+			WithArgs(models.JobStatusCancelled, sqlmock.AnyArg(), instanceId, models.JobStatusPending, pq.Array([]string{"ScriptTask_Total"})).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO workflow_jobs`).
+			WithArgs(sqlmock.AnyArg(), instanceId, workflow.Id, "ScriptTask_Total", models.JobTypeAsyncBefore, `{"price":21}`,
+				models.JobStatusPending, models.DefaultJobMaxAttempts, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		instance := &models.WorkflowInstance{Id: instanceId, WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_1"}, InstanceVersion: 1}
+		result, err := engineSvc.ExecuteFromNode(context.Background(), workflow, instance, "StartEvent_1", map[string]interface{}{"price": 21})
+
+		require.NoError(t, err)
+		// 请求立即返回，脚本还没有执行
+		assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+		assert.Equal(t, []string{"ScriptTask_Total"}, result.EngineResponse.CurrentNodeIds)
+		assert.NotContains(t, result.EngineResponse.Variables, "total")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("asyncBefore job executes the node and parks after it", func(t *testing.T) {
+		engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+		defer cleanup()
+
+		expectAsyncExecution(mock, instanceId, workflow.Id, `{"price":21}`, []string{"ScriptTask_Total"},
+			[]string{"ScriptTask_Total"}, models.InstanceStatusRunning, []string{"ScriptTask_Total"})
+		mock.ExpectExec(`UPDATE workflow_jobs`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`INSERT INTO workflow_jobs`).
+			WithArgs(sqlmock.AnyArg(), instanceId, workflow.Id, "ScriptTask_Total", models.JobTypeAsyncAfter, `{"price":21,"total":42}`,
+				models.JobStatusPending, models.DefaultJobMaxAttempts, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		job := &models.WorkflowJob{InstanceId: instanceId, NodeId: "ScriptTask_Total", JobType: models.JobTypeAsyncBefore}
+		instance := &models.WorkflowInstance{Id: instanceId, WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"ScriptTask_Total"}, InstanceVersion: 1}
+		result, err := engineSvc.ExecuteFromNode(withAsyncContinuation(context.Background(), job), workflow, instance, "ScriptTask_Total", map[string]interface{}{"price": 21})
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ScriptTask_Total"}, result.EngineResponse.CurrentNodeIds)
+		assert.EqualValues(t, 42, result.EngineResponse.Variables["total"])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("asyncAfter job leaves the node without executing it again", func(t *testing.T) {
+		engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+		defer cleanup()
+
+		expectAsyncExecution(mock, instanceId, workflow.Id, `{"price":21,"total":40}`, []string{"ScriptTask_Total"},
+			[]string{"ScriptTask_Total"}, models.InstanceStatusCompleted, []string{})
+		mock.ExpectExec(`UPDATE workflow_jobs`).
+			WithArgs(models.JobStatusCancelled, sqlmock.AnyArg(), instanceId, models.JobStatusPending, pq.Array([]string{})).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		job := &models.WorkflowJob{InstanceId: instanceId, NodeId: "ScriptTask_Total", JobType: models.JobTypeAsyncAfter}
+		instance := &models.WorkflowInstance{Id: instanceId, WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"ScriptTask_Total"}, InstanceVersion: 1}
+		// 作业中保存的变量来自节点执行之后，脚本不会再次计算
+		result, err := engineSvc.ExecuteFromNode(withAsyncContinuation(context.Background(), job), workflow, instance, "ScriptTask_Total", map[string]interface{}{"price": 21, "total": 40})
+
+		require.NoError(t, err)
+		assert.Equal(t, models.InstanceStatusCompleted, result.EngineResponse.Status)
+		assert.EqualValues(t, 40, result.EngineResponse.Variables["total"])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWorkflowEngineService_AsyncContinuations_FullMockRunsInline(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Async", BpmnXml: createAsyncTestBPMN(), Status: models.StatusActive}
+	instance := &models.WorkflowInstance{Id: "instance-1", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_1"}}
+
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", map[string]interface{}{"price": 21})
+
+	// 全程 Mock 模式没有作业表，异步延续在请求中同步执行
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusCompleted, result.EngineResponse.Status)
+	assert.EqualValues(t, 42, result.EngineResponse.Variables["total"])
+}
@@ -0,0 +1,363 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+)
+
+// calledResult 子实例结束的结果，父实例从调用活动继续时使用
+type calledResult struct {
+	ParentInstanceId string
+	NodeId           string
+	Variables        map[string]interface{} // 子实例结束时的流程变量，按调用活动的输出映射写回父实例
+	Failed           bool
+	ErrorCode        string // 子实例未捕获的 BPMN 错误码，其他失败为空（只能被捕获所有错误的边界事件捕获）
+	ErrorMessage     string
+}
+
+type calledResultKey struct{}
+
+// inlineCalledInstanceKey 父实例启动子实例时在上下文中标记该子实例
+// 子实例在启动它的执行中结束时由父实例直接继续，返回父实例最新的执行结果
+type inlineCalledInstanceKey struct{}
+
+// maxCallDepth 同一次执行中嵌套启动子实例的层数上限
+// 子实例在启动它的执行中同步运行，没有上限时循环调用会耗尽 goroutine 的栈并使整个服务退出
+const maxCallDepth = 32
+
+// callChainKey 调用链：当前执行中嵌套启动子实例的层数，以及从最外层实例到当前实例的流程 ID
+type callChainKey struct{}
+
+// callChain is the chain of call activities that led to the current execution
+type callChain struct {
+	depth       int
+	workflowIds []string
+}
+
+// callChainFrom returns the call chain carried by the context
+func callChainFrom(ctx context.Context) callChain {
+	chain, _ := ctx.Value(callChainKey{}).(callChain)
+	return chain
+}
+
+// enterCallActivity checks the call chain before a call activity of workflowId starts its child instance
+// 返回子实例执行使用的调用链，以及父实例继续执行使用的调用链（层数同样加一，循环中反复调用同一流程时同样受上限约束）
+func enterCallActivity(ctx context.Context, workflowId string, node *models.Node) (child callChain, caller callChain, err error) {
+	chain := callChainFrom(ctx)
+	caller = callChain{depth: chain.depth + 1, workflowIds: chain.workflowIds}
+	workflowIds := append(append([]string{}, chain.workflowIds...), workflowId)
+	calledId := node.CalledElement.WorkflowId
+	for _, id := range workflowIds {
+		if id == calledId {
+			return child, caller, fmt.Errorf("call activity %s calls workflow %s recursively (call chain %s)",
+				node.Id, calledId, strings.Join(append(workflowIds, calledId), " -> "))
+		}
+	}
+	if chain.depth >= maxCallDepth {
+		return child, caller, fmt.Errorf("call activity %s exceeds the maximum call depth of %d", node.Id, maxCallDepth)
+	}
+	return callChain{depth: chain.depth + 1, workflowIds: workflowIds}, caller, nil
+}
+
+// withCalledResult returns a context that resumes the parent call activity with the child's result
+func withCalledResult(ctx context.Context, result *calledResult) context.Context {
+	return context.WithValue(ctx, calledResultKey{}, result)
+}
+
+// calledResultFor returns the child result carried by the context for the given call activity, or nil
+func calledResultFor(ctx context.Context, instanceId string, nodeId string) *calledResult {
+	result, ok := ctx.Value(calledResultKey{}).(*calledResult)
+	if !ok || result.ParentInstanceId != instanceId || result.NodeId != nodeId {
+		return nil
+	}
+	return result
+}
+
+// unhandledBpmnError is returned when no error boundary event catches a BPMN error
+// 子实例以该错误失败时，错误码在父实例的调用活动上再次抛出
+type unhandledBpmnError struct {
+	ErrorCode string
+	NodeId    string
+}
+
+func (e *unhandledBpmnError) Error() string {
+	if e.ErrorCode == "" {
+		// 子实例的非 BPMN 错误失败没有错误码
+		return fmt.Sprintf("%s: failure of the instance called by node %s was not caught by any error boundary event",
+			models.ErrUnhandledBpmnError, e.NodeId)
+	}
+	return fmt.Sprintf("%s: error %s thrown by node %s was not caught by any error boundary event",
+		models.ErrUnhandledBpmnError, e.ErrorCode, e.NodeId)
+}
+
+// isExecutionFailure reports whether an execution error means the instance itself failed
+// 版本冲突、挂起和无效请求只是拒绝了本次调用，实例仍停留在原来的节点上
+func isExecutionFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, code := range []string{
+		models.ErrInstanceVersionConflict,
+		models.ErrInstanceSuspended,
+		models.ErrInvalidRequest,
+		models.ErrInvalidNodeId,
+		models.ErrInvalidVariables,
+	} {
+		if strings.HasPrefix(err.Error(), code) {
+			return false
+		}
+	}
+	return true
+}
+
+// syncCallActivities starts child instances for tokens newly parked at call activities and cancels stale ones
+// 子实例在本次调用中就已结束时父实例会立即继续，返回父实例最新的执行结果；否则返回 nil
+func (s *WorkflowEngineService) syncCallActivities(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	workflow *models.Workflow,
+	instance *models.WorkflowInstance,
+	parkedNodeIds []string,
+	currentNodeIds []string,
+	variables map[string]interface{},
+) *ExecuteResult {
+	// 令牌已离开调用活动（如被边界事件中断）时，子实例一并取消
+	cancelled, err := s.callSvc.CancelStaleCallActivities(ctx, instance.Id, currentNodeIds)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instance.Id).Msg("Failed to cancel stale call activities")
+	}
+	for _, childInstanceId := range cancelled {
+		if _, err := s.instanceSvc.CancelWorkflowInstance(ctx, childInstanceId); err != nil {
+			s.logger.Warn().Err(err).Str("childInstanceId", childInstanceId).Msg("Failed to cancel child instance")
+		}
+	}
+
+	if !hasCallActivity(wd, parkedNodeIds) {
+		return nil
+	}
+	// 令牌重新停在已有子实例的调用活动上（如从调用活动重新执行）时，不再启动新的子实例
+	pendingNodeIds, err := s.callSvc.PendingCallActivityNodes(ctx, instance.Id)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instance.Id).Msg("Failed to load pending call activities")
+		return nil
+	}
+
+	var resumed *ExecuteResult
+	for _, nodeId := range parkedNodeIds {
+		node := wd.Nodes[nodeId]
+		if node.Type != parser.NodeTypeCallActivity || countNodeId(pendingNodeIds, nodeId) > 0 {
+			continue
+		}
+		result, err := s.startCalledInstance(ctx, workflow, instance, &node, variables)
+		if err != nil {
+			s.logger.Error().Err(err).
+				Str("instanceId", instance.Id).
+				Str("nodeId", nodeId).
+				Msg("Failed to continue instance after call activity")
+			continue
+		}
+		if result != nil {
+			resumed = result
+		}
+	}
+	return resumed
+}
+
+// hasCallActivity reports whether any of the nodes is a call activity
+func hasCallActivity(wd *models.WorkflowDefinition, nodeIds []string) bool {
+	for _, nodeId := range nodeIds {
+		if wd.Nodes[nodeId].Type == parser.NodeTypeCallActivity {
+			return true
+		}
+	}
+	return false
+}
+
+// startCalledInstance starts the child instance of a call activity and links it to the parent
+// 子实例无法启动时（被调用的流程或版本不存在、递归调用、嵌套过深等）同样视为子实例失败，在调用活动上抛出错误
+func (s *WorkflowEngineService) startCalledInstance(
+	ctx context.Context,
+	workflow *models.Workflow,
+	instance *models.WorkflowInstance,
+	node *models.Node,
+	variables map[string]interface{},
+) (*ExecuteResult, error) {
+	// 递归调用或嵌套过深时不启动子实例，调用活动直接失败
+	childChain, callerChain, err := enterCallActivity(ctx, workflow.Id, node)
+	ctx = context.WithValue(ctx, callChainKey{}, callerChain)
+	var child *models.WorkflowInstance
+	var calledWorkflow *models.Workflow
+	var childVariables map[string]interface{}
+	if err == nil {
+		child, calledWorkflow, childVariables, err = s.createCalledInstance(ctx, node, variables)
+	}
+	if err == nil {
+		err = s.callSvc.CreateCallActivity(ctx, &models.CallActivity{
+			ParentInstanceId: instance.Id,
+			ParentWorkflowId: workflow.Id,
+			ParentNodeId:     node.Id,
+			ChildInstanceId:  child.Id,
+			Variables:        variables,
+		})
+	}
+	if err != nil {
+		s.logger.Error().Err(err).
+			Str("instanceId", instance.Id).
+			Str("nodeId", node.Id).
+			Msg("Failed to start called instance")
+		return s.resumeCallActivity(ctx, workflow.Id, variables, &calledResult{
+			ParentInstanceId: instance.Id,
+			NodeId:           node.Id,
+			Failed:           true,
+			ErrorMessage:     err.Error(),
+		})
+	}
+
+	s.logger.Info().
+		Str("instanceId", instance.Id).
+		Str("nodeId", node.Id).
+		Str("childInstanceId", child.Id).
+		Str("calledWorkflowId", calledWorkflow.Id).
+		Int("calledVersion", child.WorkflowVersion).
+		Msg("Called instance started")
+
+	childCtx := context.WithValue(context.WithValue(ctx, inlineCalledInstanceKey{}, child.Id), callChainKey{}, childChain)
+	childResult, childErr := s.ExecuteFromNode(childCtx, calledWorkflow, child, child.CurrentNodeIds[0], childVariables)
+	return s.returnToCaller(ctx, child.Id, childResult, childErr)
+}
+
+// createCalledInstance creates the child instance of a call activity with the variables passed to it
+// 没有输入映射时子实例得到父实例全部流程变量的副本，否则只得到映射的变量
+func (s *WorkflowEngineService) createCalledInstance(
+	ctx context.Context,
+	node *models.Node,
+	variables map[string]interface{},
+) (*models.WorkflowInstance, *models.Workflow, map[string]interface{}, error) {
+	calledWorkflow, err := s.workflowSvc.GetWorkflowByID(ctx, node.CalledElement.WorkflowId)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	version := node.CalledElement.Version
+	if version == 0 {
+		version, err = s.versionSvc.ActiveVersion(ctx, calledWorkflow.Id)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	childVariables := cloneVariables(variables)
+	if len(node.InputMappings) > 0 {
+		childVariables = make(map[string]interface{}, len(node.InputMappings))
+		for _, mapping := range node.InputMappings {
+			value, err := evaluateMappingSource(mapping.Source, variables)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to evaluate input mapping %s of node %s: %w", mapping.Target, node.Id, err)
+			}
+			childVariables[mapping.Target] = value
+		}
+	}
+
+	child, err := s.createInstance(ctx, calledWorkflow, "", "", version, childVariables)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return child, calledWorkflow, childVariables, nil
+}
+
+// returnToCaller resumes the parent instance when a child instance started by a call activity completes or fails
+// 返回父实例继续执行的结果；实例未结束、不是子实例或父实例不再等待时返回 nil
+func (s *WorkflowEngineService) returnToCaller(
+	ctx context.Context,
+	instanceId string,
+	result *ExecuteResult,
+	executionErr error,
+) (*ExecuteResult, error) {
+	failed := isExecutionFailure(executionErr)
+	completed := executionErr == nil && result != nil && result.EngineResponse != nil &&
+		result.EngineResponse.Status == models.InstanceStatusCompleted
+	if !failed && !completed {
+		return nil, nil
+	}
+
+	status := models.CallActivityStatusCompleted
+	errorMessage := ""
+	if failed {
+		status = models.CallActivityStatusFailed
+		errorMessage = executionErr.Error()
+	}
+	callActivity, err := s.callSvc.FinishCallActivity(ctx, instanceId, status, errorMessage)
+	if err != nil || callActivity == nil {
+		return nil, err
+	}
+
+	called := &calledResult{
+		ParentInstanceId: callActivity.ParentInstanceId,
+		NodeId:           callActivity.ParentNodeId,
+		Failed:           failed,
+		ErrorMessage:     errorMessage,
+	}
+	if failed {
+		var bpmnErr *unhandledBpmnError
+		if errors.As(executionErr, &bpmnErr) {
+			called.ErrorCode = bpmnErr.ErrorCode
+		}
+	} else {
+		called.Variables = result.EngineResponse.Variables
+	}
+
+	s.logger.Info().
+		Str("childInstanceId", instanceId).
+		Str("parentInstanceId", callActivity.ParentInstanceId).
+		Str("parentNodeId", callActivity.ParentNodeId).
+		Str("status", status).
+		Msg("Called instance finished, resuming parent instance")
+	resumed, err := s.resumeCallActivity(ctx, callActivity.ParentWorkflowId, callActivity.Variables, called)
+	if err != nil && !isExecutionFailure(err) {
+		// 父实例拒绝继续时子实例的结果没有被消费，父实例仍在等待该调用活动
+		if reopenErr := s.callSvc.ReopenCallActivity(ctx, callActivity.Id); reopenErr != nil {
+			s.logger.Warn().Err(reopenErr).Str("callActivityId", callActivity.Id).Msg("Failed to reopen call activity")
+		}
+	}
+	return resumed, err
+}
+
+// resumeCallActivity triggers the call activity of the parent instance with the child's result
+// 父实例以调用时保存的流程变量继续，子实例的变量按调用活动的输出映射写回
+func (s *WorkflowEngineService) resumeCallActivity(
+	ctx context.Context,
+	parentWorkflowId string,
+	parentVariables map[string]interface{},
+	called *calledResult,
+) (*ExecuteResult, error) {
+	parent, err := s.instanceSvc.GetWorkflowInstanceByID(ctx, called.ParentInstanceId)
+	if err != nil {
+		return nil, err
+	}
+	parentWorkflow, err := s.workflowSvc.GetWorkflowByID(ctx, parentWorkflowId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.TriggerNode(withCalledResult(ctx, called), parentWorkflow, parent, called.NodeId, parentVariables)
+}
+
+// applyCalledResult writes the variables of a completed child instance into the parent's variables
+// 按调用活动的输出映射求值（基于子实例的流程变量），没有输出映射时不写回任何变量
+func applyCalledResult(node *models.Node, called *calledResult, variables map[string]interface{}) (map[string]interface{}, error) {
+	changes := make(map[string]interface{}, len(node.OutputMappings))
+	for _, mapping := range node.OutputMappings {
+		value, err := evaluateMappingSource(mapping.Source, called.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate output mapping %s of node %s: %w", mapping.Target, node.Id, err)
+		}
+		variables[mapping.Target] = value
+		changes[mapping.Target] = value
+	}
+	return changes, nil
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var callActivityInstanceColumns = []string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}
+
+var callActivityColumns = []string{"id", "parent_instance_id", "parent_workflow_id", "parent_node_id", "child_instance_id", "variables", "status", "error_message", "created_at", "updated_at"}
+
+// createCallActivityParentBPMN 开户流程：调用 KYC 流程，KYC 拒绝时转人工复核，其他失败转人工处理
+func createCallActivityParentBPMN(calledElement string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:error id="Error_Rejected" errorCode="KYC_REJECTED"/>
+  <bpmn:process id="Process_Onboarding" name="Onboarding">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:callActivity id="Call_KYC" name="KYC Check" calledElement="` + calledElement + `">
+      <bpmn:extensionElements>
+        <xflow:input source="customer.id" target="customerId"/>
+        <xflow:output source="kycStatus" target="kyc"/>
+      </bpmn:extensionElements>
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+    </bpmn:callActivity>
+    <bpmn:userTask id="UserTask_Open" name="Open Account">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:boundaryEvent id="Boundary_Rejected" attachedToRef="Call_KYC">
+      <bpmn:outgoing>Flow_Rejected</bpmn:outgoing>
+      <bpmn:errorEventDefinition errorRef="Error_Rejected"/>
+    </bpmn:boundaryEvent>
+    <bpmn:boundaryEvent id="Boundary_Any" attachedToRef="Call_KYC">
+      <bpmn:outgoing>Flow_Any</bpmn:outgoing>
+      <bpmn:errorEventDefinition/>
+    </bpmn:boundaryEvent>
+    <bpmn:userTask id="UserTask_Review" name="Review Rejection">
+      <bpmn:incoming>Flow_Rejected</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:userTask id="UserTask_Manual" name="Manual KYC">
+      <bpmn:incoming>Flow_Any</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Call_KYC"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Call_KYC" targetRef="UserTask_Open"/>
+    <bpmn:sequenceFlow id="Flow_Rejected" sourceRef="Boundary_Rejected" targetRef="UserTask_Review"/>
+    <bpmn:sequenceFlow id="Flow_Any" sourceRef="Boundary_Any" targetRef="UserTask_Manual"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+// createKYCBPMN KYC 流程：脚本判定结果，拒绝时以错误结束事件结束
+func createKYCBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:error id="Error_Rejected" errorCode="KYC_REJECTED"/>
+  <bpmn:process id="Process_KYC" name="KYC Check">
+    <bpmn:startEvent id="KYC_Start">
+      <bpmn:outgoing>KYC_Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:scriptTask id="KYC_Check" scriptFormat="expr">
+      <bpmn:incoming>KYC_Flow_1</bpmn:incoming>
+      <bpmn:outgoing>KYC_Flow_2</bpmn:outgoing>
+      <bpmn:script>kycStatus = customerId == "c-1" ? "approved" : "rejected"</bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:exclusiveGateway id="KYC_Gateway" default="KYC_Flow_Approved">
+      <bpmn:incoming>KYC_Flow_2</bpmn:incoming>
+      <bpmn:outgoing>KYC_Flow_Approved</bpmn:outgoing>
+      <bpmn:outgoing>KYC_Flow_Rejected</bpmn:outgoing>
+    </bpmn:exclusiveGateway>
+    <bpmn:endEvent id="KYC_End">
+      <bpmn:incoming>KYC_Flow_Approved</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:endEvent id="KYC_End_Rejected">
+      <bpmn:incoming>KYC_Flow_Rejected</bpmn:incoming>
+      <bpmn:errorEventDefinition errorRef="Error_Rejected"/>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="KYC_Flow_1" sourceRef="KYC_Start" targetRef="KYC_Check"/>
+    <bpmn:sequenceFlow id="KYC_Flow_2" sourceRef="KYC_Check" targetRef="KYC_Gateway"/>
+    <bpmn:sequenceFlow id="KYC_Flow_Approved" sourceRef="KYC_Gateway" targetRef="KYC_End"/>
+    <bpmn:sequenceFlow id="KYC_Flow_Rejected" sourceRef="KYC_Gateway" targetRef="KYC_End_Rejected">
+      <bpmn:conditionExpression>kycStatus == "rejected"</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+// expectParentInstance mocks loading the parent instance waiting at the call activity
+func expectParentInstance(mock sqlmock.Sqlmock, workflowId string) {
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("parent-instance-id").
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow("parent-instance-id", workflowId, "Onboarding", models.InstanceStatusRunning, pq.Array([]string{"Call_KYC"}), 2, 0, now, now))
+}
+
+func TestWorkflowEngineService_StartCalledInstance(t *testing.T) {
+	tests := []struct {
+		name          string
+		customerId    string
+		callStatus    string
+		expectedNodes []string
+		expectedKYC   interface{}
+	}{
+		{
+			name:          "completed child resumes the parent with output mappings",
+			customerId:    "c-1",
+			callStatus:    models.CallActivityStatusCompleted,
+			expectedNodes: []string{"UserTask_Open"},
+			expectedKYC:   "approved",
+		},
+		{
+			name:          "BPMN error of the child is thrown at the call activity",
+			customerId:    "c-2",
+			callStatus:    models.CallActivityStatusFailed,
+			expectedNodes: []string{"UserTask_Review"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+			defer cleanup()
+
+			parent := &models.Workflow{Id: "onboarding-workflow", Name: "Onboarding", BpmnXml: createCallActivityParentBPMN("kyc-workflow"), Status: models.StatusDraft}
+			kyc := &models.Workflow{Id: "kyc-workflow", Name: "KYC Check", BpmnXml: createKYCBPMN(), Status: models.StatusDraft}
+			engineSvc.workflowSvc.SetWorkflowInMemory(parent)
+			engineSvc.workflowSvc.SetWorkflowInMemory(kyc)
+
+			wd, err := parser.ParseBPMN(parent.BpmnXml)
+			require.NoError(t, err)
+			node := wd.Nodes["Call_KYC"]
+			instance := &models.WorkflowInstance{Id: "parent-instance-id", WorkflowId: parent.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"Call_KYC"}}
+			variables := map[string]interface{}{"customer": map[string]interface{}{"id": tt.customerId}}
+			now := time.Now()
+
+			// 子实例使用被调用流程的激活版本，父子关联保存父实例调用时的变量
+			mock.ExpectQuery(`SELECT version FROM workflow_versions WHERE workflow_id = \$1 AND is_active`).
+				WithArgs(kyc.Id).
+				WillReturnRows(sqlmock.NewRows([]string{"version"}))
+			mock.ExpectQuery(`INSERT INTO workflow_instances`).
+				WithArgs(sqlmock.AnyArg(), kyc.Id, kyc.Name, models.InstanceStatusPending, pq.Array([]string{}), 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+					AddRow("child-instance-id", kyc.Id, kyc.Name, models.InstanceStatusPending, pq.Array([]string{}), 1, 0, now, now))
+			mock.ExpectExec(`INSERT INTO call_activities`).
+				WithArgs(sqlmock.AnyArg(), instance.Id, parent.Id, "Call_KYC", "child-instance-id",
+					jsonContains(`"id":"`+tt.customerId+`"`), models.CallActivityStatusPending, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			// 子实例结束后认领父子关联并从调用活动继续父实例
+			mock.ExpectQuery(`UPDATE call_activities`).
+				WithArgs(tt.callStatus, sqlmock.AnyArg(), sqlmock.AnyArg(), "child-instance-id", models.CallActivityStatusPending).
+				WillReturnRows(sqlmock.NewRows(callActivityColumns).
+					AddRow("call-1", instance.Id, parent.Id, "Call_KYC", "child-instance-id", []byte(`{"customer":{"id":"`+tt.customerId+`"}}`), tt.callStatus, "", now, now))
+			expectParentInstance(mock, parent.Id)
+
+			result, err := engineSvc.startCalledInstance(newFullMockContext(), parent, instance, &node, variables)
+
+			require.NoError(t, err)
+			require.NotNil(t, result)
+			assert.Equal(t, tt.expectedNodes, result.EngineResponse.CurrentNodeIds)
+			assert.Equal(t, tt.expectedKYC, result.EngineResponse.Variables["kyc"])
+			// 子实例的其他变量不会写回父实例
+			assert.NotContains(t, result.EngineResponse.Variables, "customerId")
+			assert.Equal(t, map[string]interface{}{"id": tt.customerId}, result.EngineResponse.Variables["customer"])
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestWorkflowEngineService_StartCalledInstance_WorkflowNotFound(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	parent := &models.Workflow{Id: "onboarding-workflow", Name: "Onboarding", BpmnXml: createCallActivityParentBPMN("missing-workflow"), Status: models.StatusDraft}
+	engineSvc.workflowSvc.SetWorkflowInMemory(parent)
+
+	wd, err := parser.ParseBPMN(parent.BpmnXml)
+	require.NoError(t, err)
+	node := wd.Nodes["Call_KYC"]
+	instance := &models.WorkflowInstance{Id: "parent-instance-id", WorkflowId: parent.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"Call_KYC"}}
+
+	mock.ExpectQuery(`SELECT (.+) FROM workflows`).
+		WithArgs("missing-workflow").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "bpmn_xml", "version", "status", "created_by", "created_at", "updated_at"}))
+	expectParentInstance(mock, parent.Id)
+
+	result, err := engineSvc.startCalledInstance(newFullMockContext(), parent, instance, &node, map[string]interface{}{
+		"customer": map[string]interface{}{"id": "c-1"},
+	})
+
+	// 子实例无法启动时没有错误码，由捕获所有错误的边界事件处理
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Manual"}, result.EngineResponse.CurrentNodeIds)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_StartCalledInstance_RecursiveCall(t *testing.T) {
+	tests := []struct {
+		name          string
+		calledElement string
+		chain         callChain
+	}{
+		{
+			name:          "workflow calls itself",
+			calledElement: "onboarding-workflow",
+		},
+		{
+			name:          "workflow calls the workflow that called it",
+			calledElement: "kyc-workflow",
+			chain:         callChain{depth: 1, workflowIds: []string{"kyc-workflow"}},
+		},
+		{
+			name:          "call depth exceeds the limit",
+			calledElement: "kyc-workflow",
+			chain:         callChain{depth: maxCallDepth},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+			defer cleanup()
+
+			parent := &models.Workflow{Id: "onboarding-workflow", Name: "Onboarding", BpmnXml: createCallActivityParentBPMN(tt.calledElement), Status: models.StatusDraft}
+			engineSvc.workflowSvc.SetWorkflowInMemory(parent)
+
+			wd, err := parser.ParseBPMN(parent.BpmnXml)
+			require.NoError(t, err)
+			node := wd.Nodes["Call_KYC"]
+			instance := &models.WorkflowInstance{Id: "parent-instance-id", WorkflowId: parent.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"Call_KYC"}}
+
+			// 不启动子实例，调用活动直接失败并由捕获所有错误的边界事件处理
+			expectParentInstance(mock, parent.Id)
+
+			ctx := context.WithValue(newFullMockContext(), callChainKey{}, tt.chain)
+			result, err := engineSvc.startCalledInstance(ctx, parent, instance, &node, map[string]interface{}{
+				"customer": map[string]interface{}{"id": "c-1"},
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, []string{"UserTask_Manual"}, result.EngineResponse.CurrentNodeIds)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestWorkflowEngineService_TriggerNode_CalledFailureNotCaught(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	// 去掉捕获所有错误的边界事件后，其他错误码无法被捕获
+	bpmnXML := createCallActivityParentBPMN("kyc-workflow")
+	workflow := &models.Workflow{Id: "onboarding-workflow", Status: models.StatusDraft, BpmnXml: removeBoundaryAny(bpmnXML)}
+	instance := &models.WorkflowInstance{Id: "parent-instance-id", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"Call_KYC"}}
+
+	ctx := withCalledResult(newFullMockContext(), &calledResult{
+		ParentInstanceId: instance.Id,
+		NodeId:           "Call_KYC",
+		Failed:           true,
+		ErrorCode:        "SANCTIONS_HIT",
+		ErrorMessage:     "UNHANDLED_BPMN_ERROR: error SANCTIONS_HIT thrown by node KYC_End_Sanctions was not caught by any error boundary event",
+	})
+	_, err := engineSvc.TriggerNode(ctx, workflow, instance, "Call_KYC", map[string]interface{}{})
+
+	// 父实例同样以未捕获的 BPMN 错误失败，错误码继续向上传递
+	require.Error(t, err)
+	var bpmnErr *unhandledBpmnError
+	require.True(t, errors.As(err, &bpmnErr))
+	assert.Equal(t, "SANCTIONS_HIT", bpmnErr.ErrorCode)
+	assert.Equal(t, "Call_KYC", bpmnErr.NodeId)
+	assert.True(t, isExecutionFailure(err))
+}
+
+// removeBoundaryAny removes the catch-all error boundary event from the onboarding process
+func removeBoundaryAny(bpmnXML string) string {
+	start := strings.Index(bpmnXML, `<bpmn:boundaryEvent id="Boundary_Any"`)
+	end := strings.Index(bpmnXML, `<bpmn:userTask id="UserTask_Review"`)
+	return bpmnXML[:start] + bpmnXML[end:]
+}
+
+func TestWorkflowEngineService_ReturnToCaller_NotCalledInstance(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`UPDATE call_activities`).
+		WithArgs(models.CallActivityStatusCompleted, "", sqlmock.AnyArg(), "test-instance-id", models.CallActivityStatusPending).
+		WillReturnRows(sqlmock.NewRows(callActivityColumns))
+
+	result, err := engineSvc.returnToCaller(context.Background(), "test-instance-id", &ExecuteResult{
+		EngineResponse: &EngineResponse{Status: models.InstanceStatusCompleted},
+	}, nil)
+
+	require.NoError(t, err)
+	assert.Nil(t, result)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_ReturnToCaller_ParentVersionConflict(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	parent := &models.Workflow{Id: "onboarding-workflow", Name: "Onboarding", BpmnXml: createCallActivityParentBPMN("kyc-workflow"), Status: models.StatusDraft}
+	engineSvc.workflowSvc.SetWorkflowInMemory(parent)
+	now := time.Now()
+
+	mock.ExpectQuery(`UPDATE call_activities`).
+		WithArgs(models.CallActivityStatusCompleted, "", sqlmock.AnyArg(), "child-instance-id", models.CallActivityStatusPending).
+		WillReturnRows(sqlmock.NewRows(callActivityColumns).
+			AddRow("call-1", "parent-instance-id", parent.Id, "Call_KYC", "child-instance-id", []byte(`{}`), models.CallActivityStatusCompleted, "", now, now))
+	expectParentInstance(mock, parent.Id)
+	// 父实例的另一个分支正在执行：占用版本失败
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), "parent-instance-id", 2).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("parent-instance-id").
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow("parent-instance-id", parent.Id, "Onboarding", models.InstanceStatusRunning, pq.Array([]string{"Call_KYC"}), 3, 0, now, now))
+	// 调用活动恢复为等待状态，子实例的结果不会丢失
+	mock.ExpectExec(`UPDATE call_activities`).
+		WithArgs(models.CallActivityStatusPending, sqlmock.AnyArg(), "call-1", models.CallActivityStatusCompleted, models.CallActivityStatusFailed).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	result, err := engineSvc.returnToCaller(context.Background(), "child-instance-id", &ExecuteResult{
+		EngineResponse: &EngineResponse{Status: models.InstanceStatusCompleted, Variables: map[string]interface{}{"kycStatus": "approved"}},
+	}, nil)
+
+	require.Error(t, err)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), models.ErrInstanceVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIsExecutionFailure(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{nil, false},
+		{fmt.Errorf("%s: instance was modified concurrently", models.ErrInstanceVersionConflict), false},
+		{fmt.Errorf("%s: workflow instance is suspended", models.ErrInstanceSuspended), false},
+		{fmt.Errorf("%s: node X not found in workflow definition", models.ErrInvalidNodeId), false},
+		{fmt.Errorf("%s: variable express must be bool, got string", models.ErrInvalidVariables), false},
+		{&unhandledBpmnError{ErrorCode: "KYC_REJECTED", NodeId: "KYC_End_Rejected"}, true},
+		{fmt.Errorf("failed to execute node: connection refused"), true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, isExecutionFailure(tt.err), "%v", tt.err)
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+)
+
+// followMessageFlows sends the messages of the message flows leaving a node
+// 协作图的所有泳池在同一个实例中执行：目标为开始事件时立即在本实例中启动目标泳池的令牌；
+// 目标为捕获事件或边界事件时返回目标节点，由实例更新后的 deliverMessageFlows 唤醒在该事件上等待的令牌
+func followMessageFlows(wd *models.WorkflowDefinition, tokens *tokenState, nodeId string) (flowIds []string, targets []string) {
+	for _, flow := range parser.MessageFlowsFrom(wd, nodeId) {
+		flowIds = append(flowIds, flow.Id)
+		if wd.Nodes[flow.TargetRef].Type == parser.NodeTypeStartEvent {
+			tokens.queue = append(tokens.queue, flow.TargetRef)
+			continue
+		}
+		targets = append(targets, flow.TargetRef)
+	}
+	return flowIds, targets
+}
+
+// messageFlowScope returns the current node whose waiting token listens to the message flow target, or "" when no token waits for it
+func messageFlowScope(wd *models.WorkflowDefinition, currentNodeIds []string, targetId string) string {
+	isTarget := func(node models.Node) bool { return node.Id == targetId }
+	for _, nodeId := range currentNodeIds {
+		if len(waitingEventsForNode(wd, nodeId, isTarget)) > 0 {
+			return nodeId
+		}
+	}
+	return ""
+}
+
+// deliverMessageFlows resumes the tokens waiting at the targets of the message flows followed while executing an instance
+// 发送时目标事件上没有等待的令牌，消息即被丢弃，引擎不缓存消息；唤醒了令牌时返回本实例最新的执行结果，否则返回 nil
+func (s *WorkflowEngineService) deliverMessageFlows(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	workflow *models.Workflow,
+	instanceId string,
+	targets []string,
+	variables map[string]interface{},
+) *ExecuteResult {
+	var resumed *ExecuteResult
+	for _, targetId := range targets {
+		instance, err := s.instanceSvc.GetWorkflowInstanceByID(ctx, instanceId)
+		if err != nil {
+			s.logger.Error().Err(err).Str("instanceId", instanceId).Str("nodeId", targetId).Msg("Failed to load instance for message flow")
+			continue
+		}
+		if messageFlowScope(wd, instance.CurrentNodeIds, targetId) == "" {
+			s.logger.Warn().Str("instanceId", instanceId).Str("nodeId", targetId).Msg("No token is waiting at the message flow target, message dropped")
+			continue
+		}
+
+		result, err := s.TriggerNode(ctx, workflow, instance, targetId, variables)
+		if err != nil {
+			s.logger.Error().Err(err).Str("instanceId", instanceId).Str("nodeId", targetId).Msg("Failed to resume instance from message flow")
+			continue
+		}
+		resumed = result
+	}
+	return resumed
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createOrderCollaborationBPMN 客户和供应商两个泳池：客户下单后启动供应商流程并等待确认，供应商确认后结束并通知客户；
+// 客户结束时向银行（黑盒泳池）发送付款消息
+func createOrderCollaborationBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:collaboration id="Collaboration_1">
+    <bpmn:participant id="Participant_Customer" name="Customer" processRef="Process_Customer"/>
+    <bpmn:participant id="Participant_Supplier" name="Supplier" processRef="Process_Supplier"/>
+    <bpmn:participant id="Participant_Bank" name="Bank"/>
+    <bpmn:messageFlow id="MessageFlow_Order" sourceRef="Throw_Order" targetRef="Start_Supplier"/>
+    <bpmn:messageFlow id="MessageFlow_Confirm" sourceRef="End_Supplier" targetRef="Catch_Confirmation"/>
+    <bpmn:messageFlow id="MessageFlow_Payment" sourceRef="End_Customer" targetRef="Participant_Bank"/>
+  </bpmn:collaboration>
+  <bpmn:process id="Process_Customer">
+    <bpmn:startEvent id="StartEvent_Order">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:intermediateThrowEvent id="Throw_Order">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+    </bpmn:intermediateThrowEvent>
+    <bpmn:intermediateCatchEvent id="Catch_Confirmation">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+      <bpmn:outgoing>Flow_3</bpmn:outgoing>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:endEvent id="End_Customer">
+      <bpmn:incoming>Flow_3</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_Order" targetRef="Throw_Order"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Throw_Order" targetRef="Catch_Confirmation"/>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="Catch_Confirmation" targetRef="End_Customer"/>
+  </bpmn:process>
+  <bpmn:process id="Process_Supplier">
+    <bpmn:startEvent id="Start_Supplier">
+      <bpmn:outgoing>Flow_4</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:scriptTask id="Script_Confirm" scriptFormat="expr">
+      <bpmn:incoming>Flow_4</bpmn:incoming>
+      <bpmn:outgoing>Flow_5</bpmn:outgoing>
+      <bpmn:script>confirmed = true</bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:endEvent id="End_Supplier">
+      <bpmn:incoming>Flow_5</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_4" sourceRef="Start_Supplier" targetRef="Script_Confirm"/>
+    <bpmn:sequenceFlow id="Flow_5" sourceRef="Script_Confirm" targetRef="End_Supplier"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_MessageFlow_StartsTargetPool(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Order", BpmnXml: createOrderCollaborationBPMN(), Status: models.StatusActive}
+	instance := &models.WorkflowInstance{Id: "instance-1", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_Order"}}
+
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_Order", nil)
+
+	// 下单消息在本实例中启动供应商泳池；全程 Mock 模式不唤醒等待的令牌，客户仍在等待确认
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+	assert.Equal(t, []string{"Catch_Confirmation"}, result.EngineResponse.CurrentNodeIds)
+	assert.Equal(t, true, result.EngineResponse.Variables["confirmed"])
+}
+
+func TestWorkflowEngineService_MessageFlow_ResumesWaitingToken(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	instanceId := "instance-1"
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Order", BpmnXml: createOrderCollaborationBPMN(), Status: models.StatusActive}
+
+	// 客户下单，供应商在同一次执行中确认并结束，客户停在确认消息上
+	expectAsyncExecution(mock, instanceId, workflow.Id, `{}`, []string{"StartEvent_Order"},
+		[]string{"StartEvent_Order", "Throw_Order", "Start_Supplier", "Catch_Confirmation", "Script_Confirm", "End_Supplier"},
+		models.InstanceStatusRunning, []string{"Catch_Confirmation"})
+	// 实例更新后沿确认消息流唤醒客户
+	now := time.Now()
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids`).
+		WithArgs(instanceId).
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow(instanceId, workflow.Id, "Order", models.InstanceStatusRunning, pq.Array([]string{"Catch_Confirmation"}), 1, 0, now, now))
+	expectAsyncExecution(mock, instanceId, workflow.Id, `{"confirmed":true}`, []string{"Catch_Confirmation"},
+		[]string{"Catch_Confirmation"}, models.InstanceStatusCompleted, []string{})
+
+	instance := &models.WorkflowInstance{Id: instanceId, WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_Order"}, InstanceVersion: 1}
+	result, err := engineSvc.ExecuteFromNode(context.Background(), workflow, instance, "StartEvent_Order", nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusCompleted, result.EngineResponse.Status)
+	assert.Empty(t, result.EngineResponse.CurrentNodeIds)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMessageFlowScope(t *testing.T) {
+	wd, err := parser.ParseBPMN(createOrderSignalBPMN())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		currentNodeIds []string
+		targetId       string
+		expected       string
+	}{
+		{"catch event after event gateway", []string{"Gateway_Wait"}, "Catch_Paid", "Gateway_Wait"},
+		{"boundary event", []string{"UserTask_Ship"}, "Boundary_Shipped", "UserTask_Ship"},
+		{"no token waiting", []string{"UserTask_Ship"}, "Catch_Paid", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, messageFlowScope(wd, tt.currentNodeIds, tt.targetId))
+		})
+	}
+}
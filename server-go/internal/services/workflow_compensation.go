@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/interceptor"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+)
+
+// ListInstanceHistoriesParams holds parameters for ListInstanceHistories interceptor calls
+type ListInstanceHistoriesParams struct {
+	InstanceID string `json:"instanceId" intercept:"id"`
+}
+
+// CompensatedTask describes one completed task whose compensation handler has run
+type CompensatedTask struct {
+	NodeId     string `json:"nodeId"`
+	HistoryId  string `json:"historyId"` // 被补偿的执行历史记录 ID
+	StatusCode int    `json:"statusCode"`
+}
+
+// RollbackResult represents the result of rolling an instance back to a node
+type RollbackResult struct {
+	Instance    *models.WorkflowInstance `json:"instance"`
+	ExecutionId string                   `json:"executionId"`
+	Compensated []CompensatedTask        `json:"compensated"`
+}
+
+// compensationScope selects the completed tasks to compensate
+type compensationScope struct {
+	SinceNodeId string // 只补偿该节点最近一次执行及之后完成的任务，为空表示全部历史
+	ActivityRef string // 只补偿指定的任务
+	ScopeId     string // 只补偿该子流程内的任务，为空表示整个流程
+}
+
+// RollbackToNode moves the instance back to a node and undoes the side effects of the tasks completed since then
+// 从该节点最近一次执行起完成的任务按完成的逆序调用补偿处理，全部成功后实例的令牌停在该节点上
+func (s *WorkflowEngineService) RollbackToNode(
+	ctx context.Context,
+	workflow *models.Workflow,
+	instance *models.WorkflowInstance,
+	toNodeId string,
+) (*RollbackResult, error) {
+	if instance.Status == models.InstanceStatusSuspended {
+		return nil, fmt.Errorf("%s: workflow instance %s is suspended", models.ErrInstanceSuspended, instance.Id)
+	}
+	// 已取消、已完成或已失败的实例不能回滚，否则会被重新激活
+	if instance.Status != models.InstanceStatusPending && instance.Status != models.InstanceStatusRunning {
+		return nil, fmt.Errorf("%s: cannot roll back workflow instance %s in status %s", models.ErrInvalidInstanceState, instance.Id, instance.Status)
+	}
+
+	workflow, err := s.resolveWorkflowVersion(ctx, workflow, instance.WorkflowVersion)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := parser.ParseBPMN(workflow.BpmnXml)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse BPMN XML: %w", err)
+	}
+	if _, exists := wd.Nodes[toNodeId]; !exists {
+		return nil, fmt.Errorf("%s: node %s not found in workflow definition", models.ErrInvalidNodeId, toNodeId)
+	}
+
+	// 占用实例版本：在调用补偿处理之前条件更新实例，并发的回滚请求中只有一个能通过版本检查，补偿不会重复执行
+	instance, err = interceptor.Intercept(ctx,
+		"UpdateInstance",
+		s.updateInstance,
+		UpdateInstanceParams{
+			InstanceID:      instance.Id,
+			Status:          instance.Status,
+			NextNodes:       instance.CurrentNodeIds,
+			ExpectedVersion: instance.InstanceVersion,
+			Claim:           true,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	lease := s.holdExecutionLease(ctx, instance)
+	defer func() {
+		s.endExecutionLease(ctx, lease)
+	}()
+
+	// 补偿调用记录在一次新的执行中
+	execution, err := interceptor.Intercept(ctx,
+		"CreateExecution",
+		s.createExecution,
+		CreateExecutionParams{
+			InstanceID: instance.Id,
+			WorkflowID: workflow.Id,
+			Variables:  map[string]interface{}{},
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create execution: %w", err)
+	}
+
+	compensated, err := s.compensate(ctx, wd, instance.Id, execution.Id, execution.Variables, compensationScope{SinceNodeId: toNodeId})
+	if err != nil {
+		s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+		return nil, err
+	}
+
+	updatedInstance, err := interceptor.Intercept(ctx,
+		"UpdateInstance",
+		s.updateInstance,
+		UpdateInstanceParams{
+			InstanceID:      instance.Id,
+			Status:          models.InstanceStatusRunning,
+			NextNodes:       []string{toNodeId},
+			ExpectedVersion: instance.InstanceVersion,
+			Release:         true,
+		},
+	)
+	if err != nil {
+		s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+		if isInstanceVersionConflict(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update instance: %w", err)
+	}
+	lease.released = true
+	s.updateExecutionStatus(ctx, execution, models.ExecutionStatusCompleted, "")
+
+	// 回到等待节点时重新登记其定时器、消息订阅、信号订阅、人工任务和外部任务，取消已离开节点上的
+	s.syncTimers(ctx, wd, workflow.Id, instance.Id, []string{toNodeId}, updatedInstance.CurrentNodeIds, execution.Variables)
+	s.syncMessageSubscriptions(ctx, wd, workflow.Id, instance.Id, []string{toNodeId}, updatedInstance.CurrentNodeIds, execution.Variables)
+	s.syncSignalSubscriptions(ctx, wd, workflow.Id, instance.Id, []string{toNodeId}, updatedInstance.CurrentNodeIds, execution.Variables)
+	s.syncUserTasks(ctx, wd, workflow.Id, instance.Id, []string{toNodeId}, updatedInstance.CurrentNodeIds, execution.Variables)
+	s.syncExternalTasks(ctx, wd, workflow.Id, instance.Id, []string{toNodeId}, updatedInstance.CurrentNodeIds, execution.Variables)
+	s.syncJobs(ctx, wd, workflow.Id, instance.Id, nil, updatedInstance.CurrentNodeIds, execution.Variables)
+
+	s.logger.Info().
+		Str("instanceId", instance.Id).
+		Str("toNodeId", toNodeId).
+		Int("compensated", len(compensated)).
+		Msg("Workflow instance rolled back")
+
+	return &RollbackResult{
+		Instance:    updatedInstance,
+		ExecutionId: execution.Id,
+		Compensated: compensated,
+	}, nil
+}
+
+// compensate runs the compensation handlers of the completed tasks in the scope, in reverse order of completion
+// 已完成的任务来自实例的执行历史；已经补偿过的任务不会再次补偿，某个补偿失败时立即停止
+func (s *WorkflowEngineService) compensate(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	instanceId string,
+	executionId string,
+	variables map[string]interface{},
+	scope compensationScope,
+) ([]CompensatedTask, error) {
+	histories, err := interceptor.Intercept(ctx,
+		"ListInstanceHistories",
+		s.listInstanceHistories,
+		ListInstanceHistoriesParams{InstanceID: instanceId},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load execution histories: %w", err)
+	}
+
+	candidates, err := compensableHistories(wd, histories, scope)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v in workflow instance %s", models.ErrInvalidNodeId, err, instanceId)
+	}
+
+	compensated := []CompensatedTask{}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		history := candidates[i]
+		node := wd.Nodes[history.NodeId]
+
+		statusCode, err := s.callCompensationHandler(ctx, executionId, &node, &history, variables)
+		if err != nil {
+			return compensated, fmt.Errorf("failed to compensate node %s: %w", node.Id, err)
+		}
+		compensated = append(compensated, CompensatedTask{
+			NodeId:     node.Id,
+			HistoryId:  history.Id,
+			StatusCode: statusCode,
+		})
+	}
+
+	return compensated, nil
+}
+
+// compensableHistories selects the completed, not yet compensated task executions that fall in the scope
+// 每个任务只取节点级的成功记录：重试的单次尝试、业务错误和补偿调用本身都不是已完成的任务
+func compensableHistories(
+	wd *models.WorkflowDefinition,
+	histories []models.ExecutionHistory,
+	scope compensationScope,
+) ([]models.ExecutionHistory, error) {
+	compensatedIds := make(map[string]bool)
+	start := 0
+	if scope.SinceNodeId != "" {
+		start = -1
+	}
+
+	for i, history := range histories {
+		if isCompensationHistory(history) {
+			if historyId, ok := history.InputData["historyId"].(string); ok && history.ErrorMessage == "" {
+				compensatedIds[historyId] = true
+			}
+			continue
+		}
+		if history.NodeId == scope.SinceNodeId {
+			start = i
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("node %s has not been executed", scope.SinceNodeId)
+	}
+
+	var candidates []models.ExecutionHistory
+	for _, history := range histories[start:] {
+		if isCompensationHistory(history) || compensatedIds[history.Id] || history.ErrorMessage != "" {
+			continue
+		}
+		if _, isAttempt := history.InputData["attempt"]; isAttempt {
+			continue
+		}
+		if _, failed := history.OutputData["errorCode"]; failed {
+			continue
+		}
+
+		node, exists := wd.Nodes[history.NodeId]
+		if !exists || node.CompensationApiUrl == "" {
+			continue
+		}
+		// 多实例任务按实例补偿，跳过节点级的汇总记录
+		if _, isInstance := history.InputData["loopCounter"]; node.MultiInstance != nil && !isInstance {
+			continue
+		}
+		if scope.ActivityRef != "" && node.Id != scope.ActivityRef {
+			continue
+		}
+		if scope.ScopeId != "" && !isNodeInScope(wd, node.Id, scope.ScopeId) {
+			continue
+		}
+		candidates = append(candidates, history)
+	}
+	return candidates, nil
+}
+
+// isCompensationHistory checks if the history record was written by a compensation call
+func isCompensationHistory(history models.ExecutionHistory) bool {
+	compensation, _ := history.InputData["compensation"].(bool)
+	return compensation
+}
+
+// callCompensationHandler calls the compensation API of a task with its recorded input and output
+// 每次补偿调用都会写入执行历史，供之后的补偿跳过已经补偿过的任务
+func (s *WorkflowEngineService) callCompensationHandler(
+	ctx context.Context,
+	executionId string,
+	node *models.Node,
+	history *models.ExecutionHistory,
+	variables map[string]interface{},
+) (int, error) {
+	requestParams := map[string]interface{}{
+		"nodeId":    node.Id,
+		"historyId": history.Id,
+		"input":     history.InputData,
+		"output":    history.OutputData,
+		"variables": history.VariablesAfter,
+	}
+
+	startTime := time.Now()
+	response, err := interceptor.Intercept(ctx,
+		"CompensateTask",
+		s.executeServiceTaskWithParams,
+		ExecuteServiceTaskParams{
+			NodeID:         node.Id,
+			BusinessApiUrl: node.CompensationApiUrl,
+			BusinessParams: requestParams,
+			Variables:      variables,
+		},
+	)
+	if err == nil && response.StatusCode >= http.StatusBadRequest {
+		err = fmt.Errorf("compensation API returned status %d", response.StatusCode)
+	}
+
+	outputData := map[string]interface{}{}
+	statusCode := 0
+	if response != nil {
+		statusCode = response.StatusCode
+		outputData["statusCode"] = response.StatusCode
+		outputData["body"] = response.Body
+	}
+	s.recordNodeExecution(ctx, executionId, node,
+		map[string]interface{}{
+			"compensation":  true,
+			"historyId":     history.Id,
+			"requestParams": requestParams,
+		},
+		outputData, variables, variables, time.Since(startTime), err)
+
+	return statusCode, err
+}
+
+// listInstanceHistories is the default implementation for ListInstanceHistories interceptor calls
+func (s *WorkflowEngineService) listInstanceHistories(ctx context.Context, params ListInstanceHistoriesParams) ([]models.ExecutionHistory, error) {
+	return s.historySvc.ListInstanceExecutionHistories(ctx, params.InstanceID)
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createCompensationTestBPMN 预留库存、扣款两个带补偿处理的任务，之后的补偿抛出事件撤销它们
+func createCompensationTestBPMN(serviceURL string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1" name="Order">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:serviceTask id="ServiceTask_Reserve" name="Reserve Stock">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:extensionElements>
+        <xflow:url value="` + serviceURL + `/reserve"/>
+        <xflow:compensation value="` + serviceURL + `/release"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:serviceTask id="ServiceTask_Charge" name="Charge">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+      <bpmn:outgoing>Flow_3</bpmn:outgoing>
+      <bpmn:extensionElements>
+        <xflow:url value="` + serviceURL + `/charge"/>
+        <xflow:compensation value="` + serviceURL + `/refund"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:intermediateThrowEvent id="Throw_Compensate" name="Undo Order">
+      <bpmn:incoming>Flow_3</bpmn:incoming>
+      <bpmn:outgoing>Flow_4</bpmn:outgoing>
+      <bpmn:compensateEventDefinition/>
+    </bpmn:intermediateThrowEvent>
+    <bpmn:endEvent id="EndEvent_Cancelled">
+      <bpmn:incoming>Flow_4</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="ServiceTask_Reserve"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="ServiceTask_Reserve" targetRef="ServiceTask_Charge"/>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="ServiceTask_Charge" targetRef="Throw_Compensate"/>
+    <bpmn:sequenceFlow id="Flow_4" sourceRef="Throw_Compensate" targetRef="EndEvent_Cancelled"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+var compensationHistoryColumns = []string{"id", "execution_id", "node_id", "node_name", "node_type", "input_data", "output_data", "variables_before", "variables_after", "execution_time_ms", "error_message", "executed_at"}
+
+// expectInstanceHistories mocks the instance execution histories: start event, reserve, a charge retry attempt and charge
+func expectInstanceHistories(mock sqlmock.Sqlmock, instanceId string) {
+	now := time.Now()
+	mock.ExpectQuery(`FROM execution_histories h\s+JOIN workflow_executions e`).
+		WithArgs(instanceId).
+		WillReturnRows(sqlmock.NewRows(compensationHistoryColumns).
+			AddRow("h-start", "exec-0", "StartEvent_1", "", int(parser.NodeTypeStartEvent), []byte(`{}`), []byte(`{}`), []byte(`{}`), []byte(`{}`), 0, "", now).
+			AddRow("h-reserve", "exec-0", "ServiceTask_Reserve", "Reserve Stock", int(parser.NodeTypeServiceTask), []byte(`{}`), []byte(`{"statusCode":200,"body":{"reservationId":"R-1"}}`), []byte(`{}`), []byte(`{}`), 5, "", now.Add(time.Millisecond)).
+			AddRow("h-charge-1", "exec-0", "ServiceTask_Charge", "Charge", int(parser.NodeTypeServiceTask), []byte(`{"attempt":1}`), []byte(`{"statusCode":200}`), []byte(`{}`), []byte(`{}`), 5, "", now.Add(2*time.Millisecond)).
+			AddRow("h-charge", "exec-0", "ServiceTask_Charge", "Charge", int(parser.NodeTypeServiceTask), []byte(`{}`), []byte(`{"statusCode":200,"body":{"paymentId":"P-1"}}`), []byte(`{}`), []byte(`{}`), 5, "", now.Add(3*time.Millisecond)))
+}
+
+// newCompensationServer records the compensation calls as "path:historyId"
+func newCompensationServer(t *testing.T, statusCode int, calls *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		*calls = append(*calls, r.URL.Path+":"+body["historyId"].(string))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(statusCode)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": statusCode < 400})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCompensableHistories(t *testing.T) {
+	wd, err := parser.ParseBPMN(createCompensationTestBPMN("http://example.com"))
+	require.NoError(t, err)
+
+	history := func(id, nodeId string, input, output map[string]interface{}, errorMessage string) models.ExecutionHistory {
+		if input == nil {
+			input = map[string]interface{}{}
+		}
+		if output == nil {
+			output = map[string]interface{}{}
+		}
+		return models.ExecutionHistory{Id: id, NodeId: nodeId, InputData: input, OutputData: output, ErrorMessage: errorMessage}
+	}
+	histories := []models.ExecutionHistory{
+		history("h-start", "StartEvent_1", nil, nil, ""),
+		history("h-reserve", "ServiceTask_Reserve", nil, nil, ""),
+		history("h-charge-1", "ServiceTask_Charge", map[string]interface{}{"attempt": 1}, nil, "business API returned status 503"),
+		history("h-charge-failed", "ServiceTask_Charge", nil, nil, "failed to execute ServiceTask"),
+		history("h-charge", "ServiceTask_Charge", nil, nil, ""),
+	}
+
+	ids := func(histories []models.ExecutionHistory) []string {
+		var result []string
+		for _, h := range histories {
+			result = append(result, h.Id)
+		}
+		return result
+	}
+
+	// 只选择节点级的成功记录，且节点声明了补偿处理
+	candidates, err := compensableHistories(wd, histories, compensationScope{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"h-reserve", "h-charge"}, ids(candidates))
+
+	// 从指定节点最近一次执行开始
+	candidates, err = compensableHistories(wd, histories, compensationScope{SinceNodeId: "ServiceTask_Charge"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"h-charge"}, ids(candidates))
+
+	candidates, err = compensableHistories(wd, histories, compensationScope{ActivityRef: "ServiceTask_Reserve"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"h-reserve"}, ids(candidates))
+
+	// 已经成功补偿过的任务被跳过，失败的补偿不算
+	compensated := append(append([]models.ExecutionHistory{}, histories...),
+		history("c-1", "ServiceTask_Charge", map[string]interface{}{"compensation": true, "historyId": "h-charge"}, nil, ""),
+		history("c-2", "ServiceTask_Reserve", map[string]interface{}{"compensation": true, "historyId": "h-reserve"}, nil, "compensation API returned status 500"),
+	)
+	candidates, err = compensableHistories(wd, compensated, compensationScope{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"h-reserve"}, ids(candidates))
+
+	_, err = compensableHistories(wd, histories, compensationScope{SinceNodeId: "Throw_Compensate"})
+	assert.Error(t, err)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_CompensationThrowEvent(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	var calls []string
+	server := newCompensationServer(t, http.StatusOK, &calls)
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createCompensationTestBPMN(server.URL), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"Throw_Compensate"},
+	}
+	expectInstanceHistories(mock, instance.Id)
+
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "Throw_Compensate", nil)
+
+	require.NoError(t, err)
+	// 按完成的逆序补偿：先退款，再释放库存
+	assert.Equal(t, []string{"/refund:h-charge", "/release:h-reserve"}, calls)
+	assert.Equal(t, models.InstanceStatusCompleted, result.EngineResponse.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectRollbackClaim 回滚在调用补偿处理之前占用实例版本
+func expectRollbackClaim(mock sqlmock.Sqlmock, instanceId string, workflowId string) {
+	now := time.Now()
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, pq.Array([]string{"Throw_Compensate"}), instanceId, 4).
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow(instanceId, workflowId, "Order", models.InstanceStatusRunning, pq.Array([]string{"Throw_Compensate"}), 5, 0, now, now))
+}
+
+func TestWorkflowEngineService_RollbackToNode(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	var calls []string
+	server := newCompensationServer(t, http.StatusOK, &calls)
+
+	now := time.Now()
+	instanceId := "test-instance-id"
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createCompensationTestBPMN(server.URL), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:              instanceId,
+		WorkflowId:      workflow.Id,
+		Status:          models.InstanceStatusRunning,
+		CurrentNodeIds:  []string{"Throw_Compensate"},
+		InstanceVersion: 4,
+	}
+	executionColumns := []string{"id", "instance_id", "workflow_id", "status", "variables", "execution_version", "started_at", "completed_at", "error_message"}
+
+	expectRollbackClaim(mock, instanceId, workflow.Id)
+	mock.ExpectQuery(`SELECT instance_version FROM workflow_instances WHERE id`).
+		WithArgs(instanceId).
+		WillReturnRows(sqlmock.NewRows([]string{"instance_version"}).AddRow(5))
+	mock.ExpectQuery(`INSERT INTO workflow_executions`).
+		WillReturnRows(sqlmock.NewRows(executionColumns).
+			AddRow("exec-1", instanceId, workflow.Id, models.ExecutionStatusPending, []byte("{}"), 5, now, sql.NullTime{}, sql.NullString{}))
+	expectInstanceHistories(mock, instanceId)
+	expectExecutionHistoryInsert(mock, "exec-1", "ServiceTask_Charge", "")
+	expectExecutionHistoryInsert(mock, "exec-1", "ServiceTask_Reserve", "")
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, pq.Array([]string{"ServiceTask_Reserve"}), instanceId, 5).
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow(instanceId, workflow.Id, "Order", models.InstanceStatusRunning, pq.Array([]string{"ServiceTask_Reserve"}), 6, 0, now, now))
+	mock.ExpectQuery(`UPDATE workflow_executions`).
+		WithArgs(sqlmock.AnyArg(), models.ExecutionStatusCompleted, sqlmock.AnyArg(), "exec-1").
+		WillReturnRows(sqlmock.NewRows(executionColumns).
+			AddRow("exec-1", instanceId, workflow.Id, models.ExecutionStatusCompleted, []byte("{}"), 4, now, sql.NullTime{Valid: true, Time: now}, sql.NullString{}))
+
+	result, err := engineSvc.RollbackToNode(context.Background(), workflow, instance, "ServiceTask_Reserve")
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/refund:h-charge", "/release:h-reserve"}, calls)
+	assert.Equal(t, []string{"ServiceTask_Reserve"}, result.Instance.CurrentNodeIds)
+	assert.Equal(t, "exec-1", result.ExecutionId)
+	require.Len(t, result.Compensated, 2)
+	assert.Equal(t, "ServiceTask_Charge", result.Compensated[0].NodeId)
+	assert.Equal(t, "h-reserve", result.Compensated[1].HistoryId)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_RollbackToNode_CompensationFails(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	var calls []string
+	server := newCompensationServer(t, http.StatusInternalServerError, &calls)
+
+	now := time.Now()
+	instanceId := "test-instance-id"
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createCompensationTestBPMN(server.URL), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:              instanceId,
+		WorkflowId:      workflow.Id,
+		Status:          models.InstanceStatusRunning,
+		CurrentNodeIds:  []string{"Throw_Compensate"},
+		InstanceVersion: 4,
+	}
+	executionColumns := []string{"id", "instance_id", "workflow_id", "status", "variables", "execution_version", "started_at", "completed_at", "error_message"}
+
+	expectRollbackClaim(mock, instanceId, workflow.Id)
+	mock.ExpectQuery(`SELECT instance_version FROM workflow_instances WHERE id`).
+		WithArgs(instanceId).
+		WillReturnRows(sqlmock.NewRows([]string{"instance_version"}).AddRow(5))
+	mock.ExpectQuery(`INSERT INTO workflow_executions`).
+		WillReturnRows(sqlmock.NewRows(executionColumns).
+			AddRow("exec-1", instanceId, workflow.Id, models.ExecutionStatusPending, []byte("{}"), 5, now, sql.NullTime{}, sql.NullString{}))
+	expectInstanceHistories(mock, instanceId)
+	expectExecutionHistoryInsert(mock, "exec-1", "ServiceTask_Charge", "compensation API returned status 500")
+	// 补偿失败时停止，实例保持不变，执行标记为失败
+	mock.ExpectQuery(`UPDATE workflow_executions`).
+		WithArgs(sqlmock.AnyArg(), models.ExecutionStatusFailed, sqlmock.AnyArg(), sqlmock.AnyArg(), "exec-1").
+		WillReturnRows(sqlmock.NewRows(executionColumns).
+			AddRow("exec-1", instanceId, workflow.Id, models.ExecutionStatusFailed, []byte("{}"), 4, now, sql.NullTime{Valid: true, Time: now}, sql.NullString{}))
+
+	result, err := engineSvc.RollbackToNode(context.Background(), workflow, instance, "ServiceTask_Reserve")
+
+	require.Error(t, err)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), "failed to compensate node ServiceTask_Charge")
+	assert.Equal(t, []string{"/refund:h-charge"}, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_RollbackToNode_NodeNotExecuted(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createCompensationTestBPMN("http://example.com"), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusSuspended,
+		CurrentNodeIds: []string{"Throw_Compensate"},
+	}
+
+	_, err := engineSvc.RollbackToNode(context.Background(), workflow, instance, "ServiceTask_Reserve")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInstanceSuspended)
+
+	// 已取消的实例不会被回滚重新激活
+	instance.Status = models.InstanceStatusCancelled
+	_, err = engineSvc.RollbackToNode(context.Background(), workflow, instance, "ServiceTask_Reserve")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInvalidInstanceState)
+
+	instance.Status = models.InstanceStatusRunning
+	_, err = engineSvc.RollbackToNode(context.Background(), workflow, instance, "Missing_Node")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInvalidNodeId)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_RollbackToNode_VersionConflict(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	var calls []string
+	server := newCompensationServer(t, http.StatusOK, &calls)
+
+	now := time.Now()
+	instanceId := "test-instance-id"
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createCompensationTestBPMN(server.URL), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:              instanceId,
+		WorkflowId:      workflow.Id,
+		Status:          models.InstanceStatusRunning,
+		CurrentNodeIds:  []string{"Throw_Compensate"},
+		InstanceVersion: 4,
+	}
+
+	// 并发的回滚请求已经占用了实例版本：不调用任何补偿处理
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, pq.Array([]string{"Throw_Compensate"}), instanceId, 4).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids`).
+		WithArgs(instanceId).
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow(instanceId, workflow.Id, "Order", models.InstanceStatusRunning, pq.Array([]string{"Throw_Compensate"}), 5, 0, now, now))
+
+	result, err := engineSvc.RollbackToNode(context.Background(), workflow, instance, "ServiceTask_Reserve")
+
+	require.Error(t, err)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), models.ErrInstanceVersionConflict)
+	assert.Empty(t, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
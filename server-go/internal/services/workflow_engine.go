@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bpmn-explorer/server/internal/interceptor"
@@ -19,13 +23,30 @@ import (
 
 // WorkflowEngineService handles workflow execution engine logic
 type WorkflowEngineService struct {
-	db           *database.Database
-	logger       *zerolog.Logger
-	workflowSvc  *WorkflowService
-	instanceSvc  *WorkflowInstanceService
-	executionSvc *WorkflowExecutionService
-	httpClient   *http.Client
-	mockCaller   *MockServiceCaller
+	db              *database.Database
+	logger          *zerolog.Logger
+	workflowSvc     *WorkflowService
+	instanceSvc     *WorkflowInstanceService
+	executionSvc    *WorkflowExecutionService
+	historySvc      *ExecutionHistoryService
+	timerSvc        *WorkflowTimerService
+	messageSvc      *MessageSubscriptionService
+	callSvc         *CallActivityService
+	taskSvc         *UserTaskService
+	signalSvc       *SignalSubscriptionService
+	jobSvc          *WorkflowJobService
+	versionSvc      *WorkflowVersionService
+	externalTaskSvc *ExternalTaskService
+	httpClient      *http.Client
+	mockCaller      *MockServiceCaller
+}
+
+// defaultRetryableStatusCodes 重试策略未指定状态码时，对这些临时性错误进行重试
+var defaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
 }
 
 // --- Parameter Structs for Interceptor (New Architecture) ---
@@ -35,6 +56,12 @@ type UpdateInstanceParams struct {
 	InstanceID string   `json:"instanceId" intercept:"id"`
 	Status     string   `json:"status"`
 	NextNodes  []string `json:"nextNodes"` // Updated from Variables
+	// ExpectedVersion 乐观锁：大于 0 时仅在实例版本未被修改时更新
+	ExpectedVersion int `json:"expectedVersion,omitempty"`
+	// Claim 占用实例：同时要求实例没有被其他执行占用，并为本次执行设置执行租约
+	Claim bool `json:"claim,omitempty"`
+	// Release 执行结束：更新实例的同时释放执行租约
+	Release bool `json:"release,omitempty"`
 }
 
 // ExecuteServiceTaskParams holds parameters for ServiceTask execution
@@ -48,10 +75,25 @@ type ExecuteServiceTaskParams struct {
 // ExecuteNodeParams holds parameters for ExecuteNode interceptor calls
 type ExecuteNodeParams struct {
 	Node           *models.Node           `json:"node" intercept:"id"`
+	ExecutionID    string                 `json:"executionId,omitempty"`
 	BusinessParams map[string]interface{} `json:"businessParams"`
 	Variables      map[string]interface{} `json:"variables"`
 }
 
+// CreateExecutionHistoryParams holds parameters for CreateExecutionHistory interceptor calls
+type CreateExecutionHistoryParams struct {
+	ExecutionID     string                 `json:"executionId" intercept:"id"`
+	NodeID          string                 `json:"nodeId" intercept:"id"`
+	NodeName        string                 `json:"nodeName"`
+	NodeType        int                    `json:"nodeType"`
+	InputData       map[string]interface{} `json:"inputData"`
+	OutputData      map[string]interface{} `json:"outputData"`
+	VariablesBefore map[string]interface{} `json:"variablesBefore"`
+	VariablesAfter  map[string]interface{} `json:"variablesAfter"`
+	ExecutionTimeMs int                    `json:"executionTimeMs"`
+	ErrorMessage    string                 `json:"errorMessage"`
+}
+
 // CreateExecutionParams holds parameters for CreateExecution interceptor calls
 type CreateExecutionParams struct {
 	InstanceID string                 `json:"instanceId" intercept:"id"`
@@ -76,11 +118,20 @@ func NewWorkflowEngineService(
 	executionSvc *WorkflowExecutionService,
 ) *WorkflowEngineService {
 	return &WorkflowEngineService{
-		db:           db,
-		logger:       logger,
-		workflowSvc:  workflowSvc,
-		instanceSvc:  instanceSvc,
-		executionSvc: executionSvc,
+		db:              db,
+		logger:          logger,
+		workflowSvc:     workflowSvc,
+		instanceSvc:     instanceSvc,
+		executionSvc:    executionSvc,
+		historySvc:      NewExecutionHistoryService(db, logger),
+		timerSvc:        NewWorkflowTimerService(db, logger),
+		messageSvc:      NewMessageSubscriptionService(db, logger),
+		callSvc:         NewCallActivityService(db, logger),
+		taskSvc:         NewUserTaskService(db, logger),
+		signalSvc:       NewSignalSubscriptionService(db, logger),
+		jobSvc:          NewWorkflowJobService(db, logger),
+		versionSvc:      NewWorkflowVersionService(db, logger),
+		externalTaskSvc: NewExternalTaskService(db, logger),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -132,6 +183,170 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 	fromNodeId string,
 	businessParams map[string]interface{},
 ) (*ExecuteResult, error) {
+	return s.executeFromNode(ctx, workflow, instance, fromNodeId, businessParams, false)
+}
+
+// TriggerNode resumes the token waiting at a node as if its event has occurred
+// 与 ExecuteFromNode 不同，被触发的等待节点（如定时器中间捕获事件）不会再次停留，而是直接推进到后续节点
+func (s *WorkflowEngineService) TriggerNode(
+	ctx context.Context,
+	workflow *models.Workflow,
+	instance *models.WorkflowInstance,
+	nodeId string,
+	businessParams map[string]interface{},
+) (*ExecuteResult, error) {
+	return s.executeFromNode(ctx, workflow, instance, nodeId, businessParams, true)
+}
+
+// StartInstance creates a workflow instance and executes it from a start event with the initial variables
+// startNodeId 为空时使用流程的第一个开始事件
+func (s *WorkflowEngineService) StartInstance(
+	ctx context.Context,
+	workflow *models.Workflow,
+	name string,
+	startNodeId string,
+	variables map[string]interface{},
+) (*models.WorkflowInstance, *ExecuteResult, error) {
+	// 新实例使用当前激活的流程版本
+	activeVersion, err := s.versionSvc.ActiveVersion(ctx, workflow.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	instance, err := s.createInstance(ctx, workflow, name, startNodeId, activeVersion, variables)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.ExecuteFromNode(ctx, workflow, instance, instance.CurrentNodeIds[0], variables)
+	if err != nil {
+		return instance, nil, err
+	}
+
+	// 执行结果中的状态和当前节点即为实例的最新状态
+	instance.Status = result.EngineResponse.Status
+	instance.CurrentNodeIds = result.EngineResponse.CurrentNodeIds
+	return instance, result, nil
+}
+
+// createInstance creates a running instance of the given workflow version positioned at a start event
+// startNodeId 为空时使用流程的第一个开始事件；版本与流程当前的激活版本不同时（调用活动固定了版本），创建后重新固定实例的版本
+func (s *WorkflowEngineService) createInstance(
+	ctx context.Context,
+	workflow *models.Workflow,
+	name string,
+	startNodeId string,
+	version int,
+	variables map[string]interface{},
+) (*models.WorkflowInstance, error) {
+	versioned, err := s.resolveWorkflowVersion(ctx, workflow, version)
+	if err != nil {
+		return nil, err
+	}
+
+	wd, err := parser.ParseBPMN(versioned.BpmnXml)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse BPMN XML: %w", err)
+	}
+
+	if startNodeId == "" {
+		if len(wd.StartEvents) == 0 {
+			return nil, fmt.Errorf("%s: workflow has no start events", models.ErrInvalidRequest)
+		}
+		startNodeId = wd.StartEvents[0]
+	} else if node, exists := wd.Nodes[startNodeId]; !exists || node.Type != parser.NodeTypeStartEvent {
+		return nil, fmt.Errorf("%s: node %s is not a start event of the workflow", models.ErrInvalidNodeId, startNodeId)
+	}
+
+	// 启动变量在创建实例之前校验，不合法的启动请求不会留下停在开始事件上的实例
+	if _, err := prepareStartVariables(wd, variables); err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		name = workflow.Name
+	}
+
+	instance, err := s.instanceSvc.CreateWorkflowInstance(ctx, workflow.Id, name)
+	if err != nil {
+		return nil, err
+	}
+	if instance.WorkflowVersion != version {
+		instance, err = s.instanceSvc.MigrateWorkflowInstance(ctx, instance, version, []string{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	// 实例启动后即为运行中，引擎结束本次执行时一并写回数据库
+	instance.Status = models.InstanceStatusRunning
+	instance.CurrentNodeIds = []string{startNodeId}
+	return instance, nil
+}
+
+// resolveWorkflowVersion returns the workflow with the BPMN XML of the given deployed version
+// 版本为 0（部署前创建的实例）、数据库不可用或全程 Mock 模式时使用流程当前的 BPMN XML
+func (s *WorkflowEngineService) resolveWorkflowVersion(ctx context.Context, workflow *models.Workflow, version int) (*models.Workflow, error) {
+	if version == 0 || s.db == nil || s.db.DB == nil {
+		return workflow, nil
+	}
+	if config := interceptor.GetInterceptConfig(ctx); config != nil && config.GetMode("*") == interceptor.InterceptModeEnabled {
+		return workflow, nil
+	}
+
+	workflowVersion, err := s.versionSvc.GetWorkflowVersion(ctx, workflow.Id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	versioned := *workflow
+	versioned.BpmnXml = workflowVersion.BpmnXml
+	versioned.Version = strconv.Itoa(workflowVersion.Version)
+	return &versioned, nil
+}
+
+// executeFromNode runs the token loop from fromNodeId
+// triggered 为 true 时，起始节点的等待事件视为已经发生
+// 由调用活动启动的子实例完成或失败时，父实例从调用活动继续
+func (s *WorkflowEngineService) executeFromNode(
+	ctx context.Context,
+	workflow *models.Workflow,
+	instance *models.WorkflowInstance,
+	fromNodeId string,
+	businessParams map[string]interface{},
+	triggered bool,
+) (*ExecuteResult, error) {
+	result, err := s.runFromNode(ctx, workflow, instance, fromNodeId, businessParams, triggered)
+
+	// 在父实例启动子实例的执行中，由父实例处理子实例的结束
+	if inlineId, _ := ctx.Value(inlineCalledInstanceKey{}).(string); inlineId == instance.Id {
+		return result, err
+	}
+	if config := interceptor.GetInterceptConfig(ctx); config != nil && config.GetMode("*") == interceptor.InterceptModeEnabled {
+		return result, err
+	}
+	if _, resumeErr := s.returnToCaller(ctx, instance.Id, result, err); resumeErr != nil {
+		s.logger.Error().Err(resumeErr).Str("instanceId", instance.Id).Msg("Failed to resume parent instance of call activity")
+	}
+	return result, err
+}
+
+// runFromNode executes the nodes of one execution of an instance
+func (s *WorkflowEngineService) runFromNode(
+	ctx context.Context,
+	workflow *models.Workflow,
+	instance *models.WorkflowInstance,
+	fromNodeId string,
+	businessParams map[string]interface{},
+	triggered bool,
+) (*ExecuteResult, error) {
+	// 挂起的实例在恢复前不允许推进
+	if instance.Status == models.InstanceStatusSuspended {
+		return nil, fmt.Errorf("%s: workflow instance %s is suspended", models.ErrInstanceSuspended, instance.Id)
+	}
+	// 已取消、已完成或已失败的实例不再推进，不调用业务接口，也不改写其状态
+	if instance.Status != models.InstanceStatusPending && instance.Status != models.InstanceStatusRunning {
+		return nil, fmt.Errorf("%s: cannot execute workflow instance %s in status %s", models.ErrInvalidInstanceState, instance.Id, instance.Status)
+	}
+
 	// Create interceptor call recorder and add to context
 	recorder := NewInterceptorCallRecorder()
 	ctx = WithInterceptorRecorder(ctx, recorder)
@@ -150,7 +365,11 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 		"businessParams": businessParams,
 	}
 
-	// 3. 解析 BPMN XML
+	// 3. 解析 BPMN XML（实例固定在启动时的流程版本上）
+	workflow, err := s.resolveWorkflowVersion(ctx, workflow, instance.WorkflowVersion)
+	if err != nil {
+		return nil, err
+	}
 	wd, err := parser.ParseBPMN(workflow.BpmnXml)
 	if err != nil {
 		s.logger.Error().Err(err).Str("workflowId", workflow.Id).Msg("Failed to parse BPMN XML")
@@ -170,7 +389,15 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 			Msg("Empty fromNodeId provided, using first current node")
 	}
 
+	// 占用实例后持有执行租约直到最终更新，执行在此之前中止时放弃租约
+	var lease *executionLease
+	defer func() {
+		s.endExecutionLease(ctx, lease)
+	}()
+
 	// 3.6 补全 current_node_ids（如果为空且 fromNodeId 已提供）
+	// 初始化时的更新同时作为本次执行对实例版本的占用
+	claimed := false
 	if len(instance.CurrentNodeIds) == 0 {
 		if len(wd.StartEvents) == 0 {
 			return nil, fmt.Errorf("workflow has no start events")
@@ -201,14 +428,21 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 				"UpdateInstance",
 				s.updateInstance,
 				UpdateInstanceParams{
-					InstanceID: instance.Id,
-					Status:     instance.Status,
-					NextNodes:  wd.StartEvents,
+					InstanceID:      instance.Id,
+					Status:          instance.Status,
+					NextNodes:       wd.StartEvents,
+					ExpectedVersion: instance.InstanceVersion,
+					Claim:           true,
 				},
 			)
 			if err != nil {
+				if isInstanceVersionConflict(err) {
+					return nil, err
+				}
 				return nil, fmt.Errorf("failed to initialize current_node_ids: %w", err)
 			}
+			claimed = true
+			lease = s.holdExecutionLease(ctx, instance)
 		}
 	}
 
@@ -218,6 +452,24 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 		return nil, fmt.Errorf("%s: node %s not found in workflow definition", models.ErrInvalidNodeId, fromNodeId)
 	}
 
+	// 4.1 从顶层开始事件启动：按流程的变量声明补全默认值并校验启动变量
+	if node.Type == parser.NodeTypeStartEvent && node.ParentId == "" && !triggered {
+		if businessParams, err = prepareStartVariables(wd, businessParams); err != nil {
+			return nil, err
+		}
+	}
+
+	// 4.2 事件触发继续时（人工任务、外部任务、消息、信号等），随事件传入的变量必须符合其声明
+	if triggered {
+		// 检查时转换整数变量，不修改调用方传入的变量
+		if businessParams != nil {
+			businessParams = cloneVariables(businessParams)
+		}
+		if err := checkDeclaredVariables(wd, businessParams, variableNames(businessParams)); err != nil {
+			return nil, err
+		}
+	}
+
 	// 4.5 检查是否需要回滚
 	rollbackAction, err := s.CheckAndHandleRollback(wd, &node, instance.CurrentNodeIds)
 	if err != nil {
@@ -237,12 +489,6 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 		instance.CurrentNodeIds = rollbackAction.TargetNodeIds
 	}
 
-	// 5. 获取或创建执行记录 (使用拦截器)
-	variables := make(map[string]interface{})
-	if businessParams != nil {
-		variables = businessParams
-	}
-
 	// 检查是否为全程 Mock 模式
 	config := interceptor.GetInterceptConfig(ctx)
 	isFullMockMode := false
@@ -250,6 +496,34 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 		isFullMockMode = config.GetMode("*") == interceptor.InterceptModeEnabled
 	}
 
+	// 4.6 占用实例版本：在执行任何节点之前条件更新实例并取得执行租约，
+	// 并发请求中只有一个能通过版本检查；租约释放前其他请求即使读到了占用后的版本也无法占用，在产生业务副作用之前即返回冲突
+	if !isFullMockMode && !claimed {
+		instance, err = interceptor.Intercept(ctx,
+			"UpdateInstance",
+			s.updateInstance,
+			UpdateInstanceParams{
+				InstanceID:      instance.Id,
+				Status:          instance.Status,
+				NextNodes:       instance.CurrentNodeIds,
+				ExpectedVersion: instance.InstanceVersion,
+				Claim:           true,
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+		lease = s.holdExecutionLease(ctx, instance)
+	}
+
+	// 5. 获取或创建执行记录 (使用拦截器)
+	variables := make(map[string]interface{})
+	for key, value := range businessParams {
+		variables[key] = value
+	}
+	// 从其他节点继续时传入的变量来自保存的 JSON，声明为整数的变量同样转换为整数
+	normalizeDeclaredVariables(wd, variables)
+
 	var execution *models.WorkflowExecution
 
 	if isFullMockMode {
@@ -298,110 +572,337 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 
 	s.logger.Info().Str("executionId", execution.Id).Msg("Created execution record with Running status")
 
-	// 6. 执行节点并持续推进，直到遇到需要等待的节点
+	// 6. 以令牌方式执行节点并持续推进，直到所有令牌都停在需要等待的节点上
+	// 当前令牌从 current_node_ids 中取出，其余分支的令牌保持不变
+	tokens := &tokenState{
+		queue:     []string{fromNodeId},
+		remaining: s.consumeToken(wd, &node, instance.CurrentNodeIds),
+	}
 	var businessResponse *BusinessResponse
-	var nextNodeIds []string
-	currentNode := &node
-	currentNodeId := fromNodeId
+	var thrownSignals []string
+	var messageTargets []string
+	var asyncJobs []asyncJob
+	triggeredNodeId := ""
+	if triggered {
+		triggeredNodeId = fromNodeId
+	}
+	// 工作池执行作业时从作业节点继续：asyncBefore 的节点直接执行，asyncAfter 的节点已执行完成，直接离开
+	continuationNodeId := fromNodeId
+	continuation := asyncContinuationFor(ctx, instance.Id, fromNodeId)
+	// 异步作业需要持久化；多实例子流程的循环状态只在本次执行中，内部节点同步执行
+	asyncEnabled := func(nodeId string) bool {
+		return !isFullMockMode && loopingSubProcess(wd, tokens, nodeId) == ""
+	}
+
+	// 循环执行节点，直到队列中没有可以自动推进的令牌
+	for len(tokens.queue) > 0 {
+		currentNodeId := tokens.queue[0]
+		tokens.queue = tokens.queue[1:]
+		currentNode := wd.Nodes[currentNodeId]
+
+		// 6.1 汇聚型并行网关：等待每条入边都有令牌到达后才继续
+		if s.isConvergingParallelGateway(wd, &currentNode) {
+			flowId := tokens.takeInbound(currentNodeId)
+			s.loadJoinFlows(ctx, wd, instance.Id, tokens, isFullMockMode)
+			if !s.joinParallelGateway(wd, &currentNode, tokens, flowId) {
+				s.logger.Info().
+					Str("nodeId", currentNodeId).
+					Str("flowId", flowId).
+					Msg("ParallelGateway waiting for remaining incoming branches")
+				continue
+			}
+		}
+
+		// 汇聚型包容网关：只等待仍然可能到达网关的分支
+		if s.isConvergingInclusiveGateway(wd, &currentNode) {
+			flowId := tokens.takeInbound(currentNodeId)
+			s.loadJoinFlows(ctx, wd, instance.Id, tokens, isFullMockMode)
+			if !s.joinInclusiveGateway(wd, &currentNode, tokens, flowId) {
+				s.logger.Info().
+					Str("nodeId", currentNodeId).
+					Str("flowId", flowId).
+					Msg("InclusiveGateway waiting for active incoming branches")
+				continue
+			}
+		}
 
-	// 循环执行节点，直到遇到不能自动推进的节点
-	for {
 		s.logger.Info().
 			Str("nodeId", currentNodeId).
 			Uint32("nodeType", currentNode.Type).
 			Msg("Executing node")
 
-		// 6.1 执行当前节点（使用拦截器）
-		nodeResult, err := interceptor.Intercept(ctx,
-			"ExecuteNode",
-			s.ExecuteNode,
-			ExecuteNodeParams{
-				Node:           currentNode,
-				BusinessParams: businessParams,
-				Variables:      execution.Variables,
-			},
-		)
+		// 每个节点的执行情况写入执行历史：输入、输出、执行前后的变量、耗时和错误
+		nodeStartedAt := time.Now()
+		nodeInput := map[string]interface{}{}
+		if businessParams != nil {
+			nodeInput["businessParams"] = businessParams
+		}
+		nodeOutput := map[string]interface{}{}
+		variablesBefore := cloneVariables(execution.Variables)
+		recordNode := func(nodeErr error) {
+			s.recordNodeExecution(ctx, execution.Id, &currentNode, nodeInput, nodeOutput,
+				variablesBefore, execution.Variables, time.Since(nodeStartedAt), nodeErr)
+		}
+
+		// 只有作业节点第一次出现时是被作业继续的，同一次执行中再次到达该节点时正常处理
+		resumedJobType := ""
+		if currentNodeId == continuationNodeId {
+			resumedJobType = continuation
+			continuationNodeId = ""
+		}
+
+		// 异步延续（asyncBefore）：令牌停在节点上并创建作业，由工作池在请求之外执行节点
+		if currentNode.AsyncBefore && resumedJobType == "" && currentNodeId != triggeredNodeId && asyncEnabled(currentNodeId) {
+			tokens.parked = append(tokens.parked, currentNodeId)
+			asyncJobs = append(asyncJobs, asyncJob{NodeId: currentNodeId, JobType: models.JobTypeAsyncBefore})
+			nodeOutput["async"] = models.JobTypeAsyncBefore
+			recordNode(nil)
+			continue
+		}
+
+		// 6.2 执行当前节点（使用拦截器）
+		// 多实例任务在这里执行所有实例，多实例子流程在推进时逐个进入；asyncAfter 作业继续时节点已经执行过
+		var nodeResult *ExecuteResult
+		if resumedJobType == models.JobTypeAsyncAfter {
+			nodeOutput["resumedFrom"] = models.JobTypeAsyncAfter
+		} else if currentNode.MultiInstance != nil && currentNode.Type != parser.NodeTypeSubProcess {
+			var loop *multiInstanceResult
+			loop, err = s.executeMultiInstance(ctx, wd, &currentNode, execution.Id, businessParams, execution.Variables)
+			if loop != nil {
+				nodeOutput["instances"] = loop.Instances
+				nodeOutput["completedInstances"] = loop.Completed
+				nodeResult = &ExecuteResult{BusinessResponse: loop.FailedResponse}
+			}
+		} else {
+			nodeResult, err = interceptor.Intercept(ctx,
+				"ExecuteNode",
+				s.ExecuteNode,
+				ExecuteNodeParams{
+					Node:           &currentNode,
+					ExecutionID:    execution.Id,
+					BusinessParams: businessParams,
+					Variables:      execution.Variables,
+				},
+			)
+		}
 		if err != nil {
 			s.logger.Error().Err(err).Str("nodeId", currentNodeId).Msg("Failed to execute node")
+			recordNode(err)
 			// Update execution status to failed
 			s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
 			return nil, fmt.Errorf("failed to execute node: %w", err)
 		}
+		// 清空 businessParams，后续节点不需要外部参数
+		businessParams = nil
 
 		// Extract businessResponse from nodeResult
 		if nodeResult != nil && nodeResult.BusinessResponse != nil {
 			businessResponse = nodeResult.BusinessResponse
+			nodeOutput["statusCode"] = businessResponse.StatusCode
+			nodeOutput["body"] = businessResponse.Body
+
+			// 业务失败（错误状态码或匹配的 xflow:error 映射）作为 BPMN 错误抛出，令牌转到捕获它的错误边界事件
+			errorCode, err := s.matchBusinessError(&currentNode, nodeResult.BusinessResponse)
+			if err == nil && errorCode != "" {
+				nodeOutput["errorCode"] = errorCode
+				var boundaryEventId string
+				boundaryEventId, err = s.throwError(wd, tokens, &currentNode, errorCode)
+				if err == nil {
+					nodeOutput["nextNodeIds"] = []string{boundaryEventId}
+					recordNode(nil)
+					tokens.queue = append(tokens.queue, boundaryEventId)
+					continue
+				}
+			}
+			if err != nil {
+				s.logger.Error().Err(err).Str("nodeId", currentNodeId).Msg("ServiceTask business error was not handled")
+				recordNode(err)
+				s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+				return nil, err
+			}
+
+			// 将服务响应映射到执行变量，供后续网关条件和持久化使用；映射写入的变量必须符合其声明
+			err = s.applyOutputMappings(&currentNode, nodeResult.BusinessResponse, execution.Variables)
+			if err == nil {
+				err = checkDeclaredVariables(wd, execution.Variables, mappingTargets(currentNode.OutputMappings))
+			}
+			if err != nil {
+				s.logger.Error().Err(err).Str("nodeId", currentNodeId).Msg("Failed to apply output mappings")
+				recordNode(err)
+				s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+				return nil, fmt.Errorf("failed to apply output mappings: %w", err)
+			}
+		}
+
+		// ScriptTask 计算出的变量写入流程变量，变更记录在执行历史的输出中；写入的变量必须符合其声明
+		if changes := applyScriptVariables(nodeResult, execution.Variables); changes != nil {
+			nodeOutput["variables"] = changes
+			if err := checkDeclaredVariables(wd, execution.Variables, variableNames(changes)); err != nil {
+				s.logger.Error().Err(err).Str("nodeId", currentNodeId).Msg("Failed to apply script variables")
+				recordNode(err)
+				s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+				return nil, fmt.Errorf("failed to apply script variables: %w", err)
+			}
+		}
+
+		// 子实例结束后父实例从调用活动继续：失败时在调用活动上抛出 BPMN 错误，完成时按输出映射写回子实例的变量
+		if currentNodeId == triggeredNodeId && currentNode.Type == parser.NodeTypeCallActivity {
+			if called := calledResultFor(ctx, instance.Id, currentNodeId); called != nil {
+				if called.Failed {
+					nodeOutput["errorCode"] = called.ErrorCode
+					nodeOutput["calledError"] = called.ErrorMessage
+					boundaryEventId, err := s.throwError(wd, tokens, &currentNode, called.ErrorCode)
+					if err != nil {
+						s.logger.Error().Err(err).Str("nodeId", currentNodeId).Msg("Called instance failure was not handled")
+						recordNode(err)
+						s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+						return nil, err
+					}
+					nodeOutput["nextNodeIds"] = []string{boundaryEventId}
+					recordNode(nil)
+					tokens.queue = append(tokens.queue, boundaryEventId)
+					continue
+				}
+				changes, err := applyCalledResult(&currentNode, called, execution.Variables)
+				if err == nil {
+					err = checkDeclaredVariables(wd, execution.Variables, mappingTargets(currentNode.OutputMappings))
+				}
+				if err != nil {
+					s.logger.Error().Err(err).Str("nodeId", currentNodeId).Msg("Failed to apply output mappings of called instance")
+					recordNode(err)
+					s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+					return nil, err
+				}
+				nodeOutput["variables"] = changes
+			}
+		}
+
+		// 补偿抛出事件：按完成的逆序调用所在范围内已完成任务的补偿处理，全部完成后令牌继续推进
+		if currentNode.CompensateDefinition != nil {
+			compensated, err := s.compensate(ctx, wd, instance.Id, execution.Id, execution.Variables, compensationScope{
+				ActivityRef: currentNode.CompensateDefinition.ActivityRef,
+				ScopeId:     currentNode.ParentId,
+			})
+			nodeOutput["compensated"] = compensated
+			if err != nil {
+				s.logger.Error().Err(err).Str("nodeId", currentNodeId).Msg("Failed to compensate completed tasks")
+				recordNode(err)
+				s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+				return nil, err
+			}
+		}
+
+		// 信号抛出事件和信号结束事件：实例更新后广播信号，唤醒所有等待该信号的实例
+		if isSignalThrowEvent(currentNode) {
+			name := signalName(wd, &currentNode)
+			thrownSignals = append(thrownSignals, name)
+			nodeOutput["signal"] = name
 		}
 
-		// 6.2 检查是否应该自动推进到下一个节点
-		if !s.shouldAutoAdvance(currentNode.Type) {
-			// 对于 UserTask、IntermediateCatchEvent、EventBasedGateway，保持当前节点
-			nextNodeIds = []string{currentNodeId}
+		// 直接从 EndEvent 执行时，令牌在此结束（子流程内部的 EndEvent 会离开子流程）
+		if currentNode.Type == parser.NodeTypeEndEvent {
+			if flowIds, targets := followMessageFlows(wd, tokens, currentNodeId); len(flowIds) > 0 {
+				nodeOutput["messageFlows"] = flowIds
+				messageTargets = append(messageTargets, targets...)
+			}
+			successors, err := s.finishEndEvent(wd, tokens, &currentNode, nil)
+			if err != nil {
+				recordNode(err)
+				s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+				return nil, err
+			}
+			if len(successors) > 0 {
+				nodeOutput["nextNodeIds"] = successors
+			}
+			recordNode(nil)
+			if err := s.routeTokens(wd, tokens, currentNode.ParentId, successors); err != nil {
+				s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+				return nil, err
+			}
+			continue
+		}
+
+		// 6.3 检查是否应该自动推进到下一个节点（被触发的等待节点直接推进）
+		if currentNodeId == triggeredNodeId {
+			triggeredNodeId = ""
+		} else if !s.shouldAutoAdvance(currentNode.Type) || isExternalTask(currentNode) {
+			// 多实例子流程的循环状态只在本次执行中，实例内不能停下等待
+			if subProcessId := loopingSubProcess(wd, tokens, currentNodeId); subProcessId != "" {
+				err := fmt.Errorf("multi-instance SubProcess %s must complete within one execution, but node %s waits", subProcessId, currentNodeId)
+				recordNode(err)
+				s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+				return nil, err
+			}
+			// 对于 UserTask、IntermediateCatchEvent、EventBasedGateway 和外部任务，保持当前节点
+			tokens.parked = append(tokens.parked, currentNodeId)
 			s.logger.Info().
 				Str("nodeId", currentNodeId).
 				Uint32("nodeType", currentNode.Type).
 				Msg("Node type does not auto-advance, staying at current node")
-			break
+			nodeOutput["waiting"] = true
+			recordNode(nil)
+			continue
+		}
+
+		// 异步延续（asyncAfter）：节点执行完成后令牌停在节点上，由工作池推进到后续节点
+		if currentNode.AsyncAfter && resumedJobType != models.JobTypeAsyncAfter && asyncEnabled(currentNodeId) {
+			tokens.parked = append(tokens.parked, currentNodeId)
+			asyncJobs = append(asyncJobs, asyncJob{NodeId: currentNodeId, JobType: models.JobTypeAsyncAfter})
+			nodeOutput["async"] = models.JobTypeAsyncAfter
+			recordNode(nil)
+			continue
+		}
+
+		// 离开节点时沿消息流发送消息：启动目标泳池，或在实例更新后唤醒在目标事件上等待的令牌
+		if flowIds, targets := followMessageFlows(wd, tokens, currentNodeId); len(flowIds) > 0 {
+			nodeOutput["messageFlows"] = flowIds
+			messageTargets = append(messageTargets, targets...)
 		}
 
-		// 6.3 推进到下一个节点
-		nextNodeIds, err = s.advanceToNextNode(ctx, wd, currentNode, execution.Variables)
+		// 6.4 推进到下一个节点（并行网关会返回所有出边的目标节点，子流程会返回内部开始事件）
+		var nextNodeIds []string
+		if currentNode.Type == parser.NodeTypeSubProcess && currentNode.MultiInstance != nil {
+			nextNodeIds, err = s.startSubProcessLoop(wd, tokens, &currentNode, execution.Variables)
+		} else {
+			nextNodeIds, err = s.advanceToNextNode(ctx, wd, &currentNode, execution.Variables)
+		}
 		if err != nil {
 			s.logger.Error().Err(err).Str("nodeId", currentNodeId).Msg("Failed to advance to next node")
+			recordNode(err)
 			s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
 			return nil, fmt.Errorf("failed to advance to next node: %w", err)
 		}
 
-		// 6.4 检查是否有下一个节点
-		if len(nextNodeIds) == 0 {
-			s.logger.Info().Str("nodeId", currentNodeId).Msg("No next node, workflow may be completed")
-			break
-		}
+		// 选择的分支（网关条件求值结果）记录在输出中，便于审计
+		nodeOutput["nextNodeIds"] = nextNodeIds
+		recordNode(nil)
 
-		// 6.5 检查下一个节点是否是 EndEvent
-		nextNodeFromMap, exists := wd.Nodes[nextNodeIds[0]]
-		if !exists {
-			s.logger.Error().Str("nextNodeId", nextNodeIds[0]).Msg("Next node not found in workflow definition")
-			return nil, fmt.Errorf("next node %s not found in workflow definition", nextNodeIds[0])
+		// 6.5 检查是否有下一个节点
+		if len(nextNodeIds) == 0 {
+			s.logger.Info().Str("nodeId", currentNodeId).Msg("No next node, token consumed")
+			continue
 		}
 
-		if nextNodeFromMap.Type == parser.NodeTypeEndEvent {
-			s.logger.Info().
-				Str("currentNodeId", currentNodeId).
-				Str("nextNodeId", nextNodeIds[0]).
-				Msg("Next node is EndEvent, stopping execution loop")
-			break
+		// 6.6 将令牌路由到下一个节点（到达错误结束事件时抛出错误）
+		if err := s.routeTokens(wd, tokens, currentNodeId, nextNodeIds); err != nil {
+			s.updateExecutionStatus(ctx, execution, models.ExecutionStatusFailed, err.Error())
+			return nil, err
 		}
-
-		// 6.6 继续执行下一个节点
-		s.logger.Info().
-			Str("fromNodeId", currentNodeId).
-			Str("toNodeId", nextNodeIds[0]).
-			Msg("Auto-advancing to next node")
-
-		currentNode = &nextNodeFromMap
-		currentNodeId = nextNodeIds[0]
-		// 清空 businessParams，后续节点不需要外部参数
-		businessParams = nil
 	}
 
-	// 7. 检查是否到达 EndEvent 并更新执行状态
+	// 7. 合并令牌并检查流程是否结束
 	instanceStatus := instance.Status
 	executionStatus := models.ExecutionStatusRunning
+	nextNodeIds := tokens.parked
+	if nextNodeIds == nil {
+		nextNodeIds = []string{}
+	}
+	currentNodeIds := append(append([]string{}, tokens.remaining...), tokens.parked...)
 
-	// Check if current node is EndEvent (when executing from EndEvent directly)
-	if currentNode.Type == parser.NodeTypeEndEvent {
+	// 所有令牌都已到达 EndEvent 时流程完成
+	if tokens.reachedEndEvent && len(currentNodeIds) == 0 {
 		instanceStatus = models.InstanceStatusCompleted
 		executionStatus = models.ExecutionStatusCompleted
-		nextNodeIds = []string{} // 清空当前节点
-	} else if len(nextNodeIds) > 0 {
-		// Check if next node is EndEvent (when advancing to EndEvent)
-		nextNode := wd.Nodes[nextNodeIds[0]]
-		if nextNode.Type == parser.NodeTypeEndEvent {
-			instanceStatus = models.InstanceStatusCompleted
-			executionStatus = models.ExecutionStatusCompleted
-			nextNodeIds = []string{} // 清空当前节点
-		}
 	}
 
 	// 8. 更新执行状态为 Completed/Failed
@@ -449,25 +950,71 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 			Msg("Full mock mode: updating instance in memory")
 
 		instance.Status = instanceStatus
-		instance.CurrentNodeIds = nextNodeIds
+		instance.CurrentNodeIds = currentNodeIds
 		updatedInstance = instance
 	} else {
+		// 汇聚型并行网关上等待的令牌的入边在最终更新前写回，此时仍持有执行租约
+		if tokens.joinFlowsLoaded {
+			reconcileJoinFlows(wd, tokens)
+		}
+		if tokens.joinFlowsChanged {
+			if err := s.instanceSvc.SetJoinFlowIds(ctx, instance.Id, instance.InstanceVersion, tokens.joinFlows); err != nil {
+				s.logger.Warn().Err(err).Str("instanceId", instance.Id).Msg("Failed to store join flows")
+			}
+		}
+
 		// 正常模式：通过拦截器更新数据库
 		var err error
 		updatedInstance, err = interceptor.Intercept(ctx,
 			"UpdateInstance",
 			s.updateInstance,
 			UpdateInstanceParams{
-				InstanceID: instance.Id,
-				Status:     instanceStatus,
-				NextNodes:  nextNodeIds,
+				InstanceID:      instance.Id,
+				Status:          instanceStatus,
+				NextNodes:       currentNodeIds,
+				ExpectedVersion: instance.InstanceVersion,
+				Release:         true,
 			},
 		)
 
 		if err != nil {
 			s.logger.Error().Err(err).Str("instanceId", instance.Id).Msg("Failed to update instance")
+			if isInstanceVersionConflict(err) {
+				return nil, err
+			}
 			return nil, fmt.Errorf("failed to update instance: %w", err)
 		}
+		// 最终更新已经释放租约：子实例结束或信号、消息在本次调用中再次推进本实例时可以重新占用
+		if lease != nil {
+			lease.released = true
+		}
+		s.endExecutionLease(ctx, lease)
+		lease = nil
+
+		// 同步定时器、消息订阅、信号订阅、人工任务和外部任务：为新停留的令牌安排等待的事件，取消令牌已离开节点的事件
+		waiting := waitingNodeIds(tokens.parked, asyncJobs)
+		s.syncTimers(ctx, wd, workflow.Id, instance.Id, waiting, currentNodeIds, execution.Variables)
+		s.syncMessageSubscriptions(ctx, wd, workflow.Id, instance.Id, waiting, currentNodeIds, execution.Variables)
+		s.syncSignalSubscriptions(ctx, wd, workflow.Id, instance.Id, waiting, currentNodeIds, execution.Variables)
+		s.syncUserTasks(ctx, wd, workflow.Id, instance.Id, waiting, currentNodeIds, execution.Variables)
+		s.syncExternalTasks(ctx, wd, workflow.Id, instance.Id, waiting, currentNodeIds, execution.Variables)
+		// 停在异步延续上的令牌交给工作池，本次请求直接返回实例状态
+		s.syncJobs(ctx, wd, workflow.Id, instance.Id, asyncJobs, currentNodeIds, execution.Variables)
+
+		// 为停在调用活动上的令牌启动子实例；子实例在本次调用中就结束时，父实例会继续执行
+		resumed := s.syncCallActivities(ctx, wd, workflow, updatedInstance, waiting, currentNodeIds, execution.Variables)
+		// 广播本次执行抛出的信号，本实例也在等待该信号时同样被唤醒
+		if signalResumed := s.broadcastThrownSignals(ctx, instance.Id, thrownSignals); signalResumed != nil {
+			resumed = signalResumed
+		}
+		// 沿本次执行发送的消息流唤醒其他泳池中等待的令牌
+		if messageResumed := s.deliverMessageFlows(ctx, wd, workflow, instance.Id, messageTargets, execution.Variables); messageResumed != nil {
+			resumed = messageResumed
+		}
+		// 实例在本次调用中被继续推进时，返回实例最新的执行结果
+		if resumed != nil {
+			return resumed, nil
+		}
 	}
 
 	// 10. 构建响应
@@ -489,11 +1036,91 @@ func (s *WorkflowEngineService) ExecuteFromNode(
 }
 
 // executeServiceTask executes a ServiceTask node by calling business API
+// 配置了重试策略时，按策略对网络错误、超时和可重试状态码进行重试，每次尝试都会记录到执行历史；
+// 网络错误和超时的重试用尽时返回错误，可重试状态码的重试用尽时返回最后一次响应
 func (s *WorkflowEngineService) executeServiceTask(
 	ctx context.Context,
 	node *models.Node,
+	executionId string,
 	businessParams map[string]interface{},
 	variables map[string]interface{},
+) (*BusinessResponse, error) {
+	// 根据输入映射从流程变量中构建请求参数
+	requestParams, err := s.applyInputMappings(node, businessParams, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := node.RetryPolicy
+	if policy == nil {
+		return s.callServiceTask(ctx, node, requestParams, variables)
+	}
+
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	backoff := time.Duration(policy.BackoffMs) * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		// 每次尝试使用独立的超时时间
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.TimeoutMs > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, time.Duration(policy.TimeoutMs)*time.Millisecond)
+		}
+		startTime := time.Now()
+		response, callErr := s.callServiceTask(attemptCtx, node, requestParams, variables)
+		cancel()
+
+		attemptErr := callErr
+		if attemptErr == nil && isRetryableStatusCode(policy, response.StatusCode) {
+			attemptErr = fmt.Errorf("business API returned status %d", response.StatusCode)
+		}
+		s.recordServiceTaskAttempt(ctx, executionId, node, attempt, requestParams, variables, response, time.Since(startTime), attemptErr)
+
+		if attemptErr == nil {
+			return response, nil
+		}
+		if attempt >= maxAttempts {
+			// 可重试状态码的重试用尽时返回最后一次响应，与没有重试策略时一样按业务错误处理，可以被错误边界事件捕获
+			if callErr == nil {
+				s.logger.Warn().Str("nodeId", node.Id).Int("attempts", attempt).Int("statusCode", response.StatusCode).Msg("ServiceTask retries exhausted")
+				return response, nil
+			}
+			return nil, fmt.Errorf("ServiceTask %s failed after %d attempts: %w", node.Id, attempt, attemptErr)
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ServiceTask %s cancelled after %d attempts: %w", node.Id, attempt, attemptErr)
+		}
+
+		s.logger.Warn().
+			Err(attemptErr).
+			Str("nodeId", node.Id).
+			Int("attempt", attempt).
+			Int("maxAttempts", maxAttempts).
+			Dur("backoff", backoff).
+			Msg("ServiceTask attempt failed, retrying")
+
+		// 退避等待，流程上下文取消时立即停止重试
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, fmt.Errorf("ServiceTask %s cancelled after %d attempts: %w", node.Id, attempt, attemptErr)
+			case <-timer.C:
+			}
+			backoff = time.Duration(float64(backoff) * policy.BackoffMultiplier)
+		}
+	}
+}
+
+// callServiceTask performs a single ServiceTask call through the interceptor
+func (s *WorkflowEngineService) callServiceTask(
+	ctx context.Context,
+	node *models.Node,
+	requestParams map[string]interface{},
+	variables map[string]interface{},
 ) (*BusinessResponse, error) {
 	// Use new interceptor architecture with struct parameters
 	return interceptor.Intercept(ctx,
@@ -502,31 +1129,225 @@ func (s *WorkflowEngineService) executeServiceTask(
 		ExecuteServiceTaskParams{
 			NodeID:         node.Id,
 			BusinessApiUrl: node.BusinessApiUrl,
-			BusinessParams: businessParams,
+			BusinessParams: requestParams,
 			Variables:      variables,
 		},
 	)
 }
 
-// ExecuteNode executes a workflow node based on its type
-// This method encapsulates all node execution logic and can be intercepted for testing and debugging
-// It focuses purely on node execution without managing workflow execution state
-// Returns ExecuteResult to maintain consistency with ExecuteFromNode
-func (s *WorkflowEngineService) ExecuteNode(
+// isRetryableStatusCode checks whether the status code should be retried under the policy
+func isRetryableStatusCode(policy *models.RetryPolicy, statusCode int) bool {
+	codes := policy.RetryableStatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryableStatusCodes
+	}
+	for _, code := range codes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// recordServiceTaskAttempt writes one ServiceTask attempt into the execution history
+// 记录失败只输出日志，不影响流程执行
+func (s *WorkflowEngineService) recordServiceTaskAttempt(
 	ctx context.Context,
-	params ExecuteNodeParams,
-) (*ExecuteResult, error) {
-	nodeId := params.Node.Id
+	executionId string,
+	node *models.Node,
+	attempt int,
+	requestParams map[string]interface{},
+	variables map[string]interface{},
+	response *BusinessResponse,
+	duration time.Duration,
+	attemptErr error,
+) {
+	if executionId == "" {
+		return
+	}
 
-	// Execute node based on type
-	switch params.Node.Type {
-	case parser.NodeTypeTask:
-		// 普通 Task 直接执行，不调用外部服务
-		s.logger.Info().Str("nodeId", nodeId).Msg("Task executed (no operation)")
-		return &ExecuteResult{}, nil
+	outputData := map[string]interface{}{}
+	if response != nil {
+		outputData["statusCode"] = response.StatusCode
+		outputData["body"] = response.Body
+	}
+	errorMessage := ""
+	if attemptErr != nil {
+		errorMessage = attemptErr.Error()
+	}
+
+	_, err := interceptor.Intercept(ctx,
+		"CreateExecutionHistory",
+		s.createExecutionHistory,
+		CreateExecutionHistoryParams{
+			ExecutionID: executionId,
+			NodeID:      node.Id,
+			NodeName:    node.Name,
+			NodeType:    int(node.Type),
+			InputData: map[string]interface{}{
+				"attempt":       attempt,
+				"requestParams": requestParams,
+			},
+			OutputData:      outputData,
+			VariablesBefore: variables,
+			VariablesAfter:  variables,
+			ExecutionTimeMs: int(duration.Milliseconds()),
+			ErrorMessage:    errorMessage,
+		},
+	)
+	if err != nil {
+		s.logger.Warn().
+			Err(err).
+			Str("executionId", executionId).
+			Str("nodeId", node.Id).
+			Int("attempt", attempt).
+			Msg("Failed to record ServiceTask attempt")
+	}
+}
+
+// recordNodeExecution writes one executed node into the execution history
+// 记录失败只输出日志，不影响流程执行
+func (s *WorkflowEngineService) recordNodeExecution(
+	ctx context.Context,
+	executionId string,
+	node *models.Node,
+	inputData map[string]interface{},
+	outputData map[string]interface{},
+	variablesBefore map[string]interface{},
+	variablesAfter map[string]interface{},
+	duration time.Duration,
+	nodeErr error,
+) {
+	if executionId == "" {
+		return
+	}
+
+	errorMessage := ""
+	if nodeErr != nil {
+		errorMessage = nodeErr.Error()
+	}
+
+	_, err := interceptor.Intercept(ctx,
+		"CreateExecutionHistory",
+		s.createExecutionHistory,
+		CreateExecutionHistoryParams{
+			ExecutionID:     executionId,
+			NodeID:          node.Id,
+			NodeName:        node.Name,
+			NodeType:        int(node.Type),
+			InputData:       inputData,
+			OutputData:      outputData,
+			VariablesBefore: variablesBefore,
+			VariablesAfter:  cloneVariables(variablesAfter),
+			ExecutionTimeMs: int(duration.Milliseconds()),
+			ErrorMessage:    errorMessage,
+		},
+	)
+	if err != nil {
+		s.logger.Warn().
+			Err(err).
+			Str("executionId", executionId).
+			Str("nodeId", node.Id).
+			Msg("Failed to record node execution history")
+	}
+}
+
+// cloneVariables returns a shallow copy of the variables so later changes do not alter recorded snapshots
+func cloneVariables(variables map[string]interface{}) map[string]interface{} {
+	cloned := make(map[string]interface{}, len(variables))
+	for key, value := range variables {
+		cloned[key] = value
+	}
+	return cloned
+}
+
+// applyInputMappings builds the ServiceTask request params from businessParams and the node's input mappings
+// 输入映射的 source 基于流程变量求值，结果写入请求参数的 target 字段
+func (s *WorkflowEngineService) applyInputMappings(
+	node *models.Node,
+	businessParams map[string]interface{},
+	variables map[string]interface{},
+) (map[string]interface{}, error) {
+	if len(node.InputMappings) == 0 {
+		return businessParams, nil
+	}
+
+	requestParams := make(map[string]interface{}, len(businessParams)+len(node.InputMappings))
+	for key, value := range businessParams {
+		requestParams[key] = value
+	}
+
+	for _, mapping := range node.InputMappings {
+		value, err := evaluateMappingSource(mapping.Source, variables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate input mapping %s of node %s: %w", mapping.Target, node.Id, err)
+		}
+		requestParams[mapping.Target] = value
+	}
+
+	return requestParams, nil
+}
+
+// applyOutputMappings writes the ServiceTask response into execution variables according to the node's output mappings
+// 输出映射的 source 基于响应求值，可访问 statusCode、body、headers
+func (s *WorkflowEngineService) applyOutputMappings(
+	node *models.Node,
+	response *BusinessResponse,
+	variables map[string]interface{},
+) error {
+	if len(node.OutputMappings) == 0 {
+		return nil
+	}
+
+	env := map[string]interface{}{
+		"statusCode": response.StatusCode,
+		"body":       response.Body,
+		"headers":    response.Headers,
+	}
+
+	for _, mapping := range node.OutputMappings {
+		value, err := evaluateMappingSource(mapping.Source, env)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate output mapping %s of node %s: %w", mapping.Target, node.Id, err)
+		}
+		variables[mapping.Target] = value
+	}
+
+	return nil
+}
+
+// evaluateMappingSource evaluates a mapping source expression against the given environment
+func evaluateMappingSource(source string, env map[string]interface{}) (interface{}, error) {
+	if source == "" {
+		return nil, fmt.Errorf("mapping source is empty")
+	}
+	return expr.Eval(source, env)
+}
+
+// ExecuteNode executes a workflow node based on its type
+// This method encapsulates all node execution logic and can be intercepted for testing and debugging
+// It focuses purely on node execution without managing workflow execution state
+// Returns ExecuteResult to maintain consistency with ExecuteFromNode
+func (s *WorkflowEngineService) ExecuteNode(
+	ctx context.Context,
+	params ExecuteNodeParams,
+) (*ExecuteResult, error) {
+	nodeId := params.Node.Id
+
+	// Execute node based on type
+	switch params.Node.Type {
+	case parser.NodeTypeTask:
+		// 普通 Task 直接执行，不调用外部服务
+		s.logger.Info().Str("nodeId", nodeId).Msg("Task executed (no operation)")
+		return &ExecuteResult{}, nil
 
 	case parser.NodeTypeServiceTask:
-		businessResponse, err := s.executeServiceTask(ctx, params.Node, params.BusinessParams, params.Variables)
+		// 外部任务不调用业务接口，由工作者拉取执行，完成后从该节点继续
+		if isExternalTask(*params.Node) {
+			s.logger.Info().Str("nodeId", nodeId).Str("topic", params.Node.ExternalTopic).Msg("ServiceTask is executed by external workers")
+			return &ExecuteResult{}, nil
+		}
+		businessResponse, err := s.executeServiceTask(ctx, params.Node, params.ExecutionID, params.BusinessParams, params.Variables)
 		if err != nil {
 			s.logger.Error().Err(err).Str("nodeId", nodeId).Msg("Failed to execute ServiceTask")
 			return nil, fmt.Errorf("failed to execute ServiceTask: %w", err)
@@ -535,6 +1356,17 @@ func (s *WorkflowEngineService) ExecuteNode(
 			BusinessResponse: businessResponse,
 		}, nil
 
+	case parser.NodeTypeScriptTask:
+		// ScriptTask 在引擎内执行脚本，计算出的变量通过 EngineResponse 返回
+		variables, err := s.executeScriptTask(ctx, params.Node, params.Variables)
+		if err != nil {
+			s.logger.Error().Err(err).Str("nodeId", nodeId).Msg("Failed to execute ScriptTask")
+			return nil, fmt.Errorf("failed to execute ScriptTask: %w", err)
+		}
+		return &ExecuteResult{
+			EngineResponse: &EngineResponse{Variables: variables},
+		}, nil
+
 	case parser.NodeTypeUserTask:
 		// UserTask returns pending status, no actual operation
 		s.logger.Info().Str("nodeId", nodeId).Msg("UserTask encountered, returning pending status")
@@ -545,6 +1377,11 @@ func (s *WorkflowEngineService) ExecuteNode(
 		s.logger.Info().Str("nodeId", nodeId).Msg("IntermediateCatchEvent encountered, waiting for external event")
 		return &ExecuteResult{}, nil
 
+	case parser.NodeTypeCallActivity:
+		// CallActivity waits for the child instance, which is started after the instance is updated
+		s.logger.Info().Str("nodeId", nodeId).Msg("CallActivity encountered, waiting for called instance")
+		return &ExecuteResult{}, nil
+
 	case parser.NodeTypeEventBasedGateway:
 		// EventBasedGateway waits for event branch, no actual operation
 		s.logger.Info().Str("nodeId", nodeId).Msg("EventBasedGateway encountered, waiting for event branch")
@@ -555,6 +1392,11 @@ func (s *WorkflowEngineService) ExecuteNode(
 		s.logger.Info().Str("nodeId", nodeId).Msg("ExclusiveGateway encountered, evaluating conditions")
 		return &ExecuteResult{}, nil
 
+	case parser.NodeTypeInclusiveGateway:
+		// Gateway logic is handled in advance logic
+		s.logger.Info().Str("nodeId", nodeId).Msg("InclusiveGateway encountered, evaluating conditions")
+		return &ExecuteResult{}, nil
+
 	case parser.NodeTypeEndEvent:
 		// EndEvent marks workflow completion
 		s.logger.Info().Str("nodeId", nodeId).Msg("EndEvent encountered, workflow completed")
@@ -573,6 +1415,11 @@ func (s *WorkflowEngineService) advanceToNextNode(
 	currentNode *models.Node,
 	variables map[string]interface{},
 ) ([]string, error) {
+	// 子流程：令牌进入子流程内部的开始事件
+	if currentNode.Type == parser.NodeTypeSubProcess {
+		return s.enterSubProcess(wd, currentNode), nil
+	}
+
 	if len(currentNode.OutgoingSequenceFlowIds) == 0 {
 		// 没有出边，可能是 EndEvent
 		return []string{}, nil
@@ -582,17 +1429,16 @@ func (s *WorkflowEngineService) advanceToNextNode(
 
 	switch currentNode.Type {
 	case parser.NodeTypeExclusiveGateway:
-		// 对于排他网关，需要评估条件表达式
-		for _, flowId := range currentNode.OutgoingSequenceFlowIds {
-			flow, exists := wd.SequenceFlows[flowId]
-			if !exists {
+		// 对于排他网关，按优先级依次评估所有带条件的出边，第一个满足的胜出
+		// 都不满足时使用网关声明的默认流，最后才使用没有条件的出边
+		var unconditioned []models.SequenceFlow
+		for _, flow := range sortedOutgoingFlows(wd, currentNode) {
+			if flow.Id == currentNode.DefaultFlowId {
 				continue
 			}
-
-			// 如果没有条件表达式，作为默认流
 			if flow.ConditionExpression == "" {
-				nextNodeIds = append(nextNodeIds, flow.TargetNodeId)
-				break
+				unconditioned = append(unconditioned, flow)
+				continue
 			}
 
 			// 评估条件表达式
@@ -607,10 +1453,56 @@ func (s *WorkflowEngineService) advanceToNextNode(
 			}
 		}
 
+		if len(nextNodeIds) == 0 && currentNode.DefaultFlowId != "" {
+			if flow, exists := wd.SequenceFlows[currentNode.DefaultFlowId]; exists {
+				nextNodeIds = append(nextNodeIds, flow.TargetNodeId)
+			}
+		}
+		if len(nextNodeIds) == 0 && len(unconditioned) > 0 {
+			nextNodeIds = append(nextNodeIds, unconditioned[0].TargetNodeId)
+		}
+
 		if len(nextNodeIds) == 0 {
 			return nil, fmt.Errorf("no matching sequence flow found for ExclusiveGateway %s", currentNode.Id)
 		}
 
+	case parser.NodeTypeInclusiveGateway:
+		// 对于包容网关，激活所有条件为真的出边（没有条件的出边总是激活），每条出边产生一个新的令牌
+		// 所有条件都不满足时走默认流
+		for _, flow := range sortedOutgoingFlows(wd, currentNode) {
+			if flow.Id == currentNode.DefaultFlowId {
+				continue
+			}
+
+			matched, err := s.evaluateCondition(flow.ConditionExpression, variables)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate condition: %w", err)
+			}
+			if matched {
+				nextNodeIds = append(nextNodeIds, flow.TargetNodeId)
+			}
+		}
+
+		if len(nextNodeIds) == 0 && currentNode.DefaultFlowId != "" {
+			if flow, exists := wd.SequenceFlows[currentNode.DefaultFlowId]; exists {
+				nextNodeIds = append(nextNodeIds, flow.TargetNodeId)
+			}
+		}
+
+		if len(nextNodeIds) == 0 {
+			return nil, fmt.Errorf("no matching sequence flow found for InclusiveGateway %s", currentNode.Id)
+		}
+
+	case parser.NodeTypeParallelGateway:
+		// 对于并行网关，激活所有出边，每条出边产生一个新的令牌
+		for _, flowId := range currentNode.OutgoingSequenceFlowIds {
+			flow, exists := wd.SequenceFlows[flowId]
+			if !exists {
+				continue
+			}
+			nextNodeIds = append(nextNodeIds, flow.TargetNodeId)
+		}
+
 	default:
 		// 对于其他节点类型，直接选择第一个出边
 		if len(currentNode.OutgoingSequenceFlowIds) > 0 {
@@ -625,6 +1517,26 @@ func (s *WorkflowEngineService) advanceToNextNode(
 	return nextNodeIds, nil
 }
 
+// sortedOutgoingFlows returns the node's outgoing sequence flows in gateway evaluation order
+// 设置了优先级的出边按数值从小到大排在前面，其余保持声明顺序
+func sortedOutgoingFlows(wd *models.WorkflowDefinition, node *models.Node) []models.SequenceFlow {
+	flows := make([]models.SequenceFlow, 0, len(node.OutgoingSequenceFlowIds))
+	for _, flowId := range node.OutgoingSequenceFlowIds {
+		if flow, exists := wd.SequenceFlows[flowId]; exists {
+			flows = append(flows, flow)
+		}
+	}
+
+	sort.SliceStable(flows, func(i, j int) bool {
+		pi, pj := flows[i].Priority, flows[j].Priority
+		if pi == 0 || pj == 0 {
+			return pi != 0 && pj == 0
+		}
+		return pi < pj
+	})
+	return flows
+}
+
 // evaluateCondition evaluates a condition expression using workflow variables
 func (s *WorkflowEngineService) evaluateCondition(
 	conditionExpr string,
@@ -675,20 +1587,771 @@ func (s *WorkflowEngineService) updateExecutionStatus(
 	}
 }
 
+// syncTimers schedules timers for newly parked tokens and cancels timers whose token has left
+// 定时器记录失败只输出日志，不影响流程执行
+func (s *WorkflowEngineService) syncTimers(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	workflowId string,
+	instanceId string,
+	parkedNodeIds []string,
+	currentNodeIds []string,
+	variables map[string]interface{},
+) {
+	if !hasWaitingEvents(wd, isTimerEvent) {
+		return
+	}
+
+	if _, err := s.timerSvc.CancelStaleTimers(ctx, instanceId, currentNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale timers")
+	}
+
+	now := time.Now()
+	for _, scopeNodeId := range parkedNodeIds {
+		for _, timerNode := range timerEventsForNode(wd, scopeNodeId) {
+			dueAt, err := parser.TimerDueDate(timerNode.TimerDefinition, now)
+			if err != nil {
+				s.logger.Warn().Err(err).Str("nodeId", timerNode.Id).Msg("Failed to compute timer due date")
+				continue
+			}
+			err = s.timerSvc.ScheduleTimer(ctx, &models.WorkflowTimer{
+				InstanceId:  instanceId,
+				WorkflowId:  workflowId,
+				NodeId:      timerNode.Id,
+				ScopeNodeId: scopeNodeId,
+				DueAt:       dueAt,
+				Variables:   variables,
+			})
+			if err != nil {
+				s.logger.Warn().Err(err).Str("instanceId", instanceId).Str("nodeId", timerNode.Id).Msg("Failed to schedule timer")
+			}
+		}
+	}
+}
+
+// syncMessageSubscriptions subscribes newly parked tokens to their message events and cancels stale subscriptions
+// 业务键取自流程变量 businessKey；订阅记录失败只输出日志，不影响流程执行
+func (s *WorkflowEngineService) syncMessageSubscriptions(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	workflowId string,
+	instanceId string,
+	parkedNodeIds []string,
+	currentNodeIds []string,
+	variables map[string]interface{},
+) {
+	if !hasWaitingEvents(wd, isMessageEvent) {
+		return
+	}
+
+	if _, err := s.messageSvc.CancelStaleSubscriptions(ctx, instanceId, currentNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale message subscriptions")
+	}
+
+	businessKey, _ := variables[models.BusinessKeyVariable].(string)
+	for _, scopeNodeId := range parkedNodeIds {
+		for _, messageNode := range messageEventsForNode(wd, scopeNodeId) {
+			err := s.messageSvc.Subscribe(ctx, &models.MessageSubscription{
+				InstanceId:  instanceId,
+				WorkflowId:  workflowId,
+				NodeId:      messageNode.Id,
+				ScopeNodeId: scopeNodeId,
+				MessageName: messageName(wd, &messageNode),
+				BusinessKey: businessKey,
+				Variables:   variables,
+			})
+			if err != nil {
+				s.logger.Warn().Err(err).Str("instanceId", instanceId).Str("nodeId", messageNode.Id).Msg("Failed to subscribe to message")
+			}
+		}
+	}
+}
+
+// messageName resolves the message name referenced by a message event (falls back to the message ID)
+func messageName(wd *models.WorkflowDefinition, node *models.Node) string {
+	if message, exists := wd.Messages[node.MessageRef]; exists && message.Name != "" {
+		return message.Name
+	}
+	return node.MessageRef
+}
+
+// isTimerEvent checks whether the node is a timer event
+func isTimerEvent(node models.Node) bool {
+	return node.TimerDefinition != nil
+}
+
+// isMessageEvent checks whether the node is a message event
+func isMessageEvent(node models.Node) bool {
+	return node.MessageRef != ""
+}
+
+// hasWaitingEvents checks whether the workflow contains any event matching the predicate
+func hasWaitingEvents(wd *models.WorkflowDefinition, match func(models.Node) bool) bool {
+	for _, node := range wd.Nodes {
+		if match(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// timerEventsForNode returns the timer events that start counting when a token waits at the node
+func timerEventsForNode(wd *models.WorkflowDefinition, nodeId string) []models.Node {
+	return waitingEventsForNode(wd, nodeId, isTimerEvent)
+}
+
+// messageEventsForNode returns the message events that a token waiting at the node subscribes to
+func messageEventsForNode(wd *models.WorkflowDefinition, nodeId string) []models.Node {
+	return waitingEventsForNode(wd, nodeId, isMessageEvent)
+}
+
+// waitingEventsForNode returns the events matching the predicate that a token waiting at the node listens to
+// 包括：中间捕获事件本身、事件网关后的中间捕获事件、依附在节点上的边界事件
+func waitingEventsForNode(wd *models.WorkflowDefinition, nodeId string, match func(models.Node) bool) []models.Node {
+	node, exists := wd.Nodes[nodeId]
+	if !exists {
+		return nil
+	}
+
+	var events []models.Node
+	if node.Type == parser.NodeTypeIntermediateCatchEvent && match(node) {
+		events = append(events, node)
+	}
+
+	if node.Type == parser.NodeTypeEventBasedGateway {
+		for _, succId := range wd.AdjacencyList[nodeId] {
+			succ, exists := wd.Nodes[succId]
+			if exists && succ.Type == parser.NodeTypeIntermediateCatchEvent && match(succ) {
+				events = append(events, succ)
+			}
+		}
+	}
+
+	var boundaryIds []string
+	for id, candidate := range wd.Nodes {
+		if candidate.Type == parser.NodeTypeBoundaryEvent && candidate.AttachedNodeId == nodeId && match(candidate) {
+			boundaryIds = append(boundaryIds, id)
+		}
+	}
+	sort.Strings(boundaryIds)
+	for _, id := range boundaryIds {
+		events = append(events, wd.Nodes[id])
+	}
+
+	return events
+}
+
 // shouldAutoAdvance checks if the node type should automatically advance to the next node
-// UserTask, IntermediateCatchEvent, EventBasedGateway should NOT auto-advance
+// UserTask, IntermediateCatchEvent, EventBasedGateway, CallActivity should NOT auto-advance
 // They need to wait for external events or user actions
 func (s *WorkflowEngineService) shouldAutoAdvance(nodeType uint32) bool {
 	switch nodeType {
 	case parser.NodeTypeUserTask,
 		parser.NodeTypeIntermediateCatchEvent,
-		parser.NodeTypeEventBasedGateway:
+		parser.NodeTypeEventBasedGateway,
+		parser.NodeTypeCallActivity:
 		return false
 	default:
 		return true
 	}
 }
 
+// tokenState tracks the tokens of a single ExecuteFromNode run
+type tokenState struct {
+	queue           []string // 待执行的令牌
+	remaining       []string // 本次未推进的其他分支令牌（来自 current_node_ids）
+	parked          []string // 本次执行中停在等待节点上的令牌
+	reachedEndEvent bool     // 是否有令牌到达顶层 EndEvent
+	// loops 本次执行中正在逐个执行实例的多实例子流程
+	loops map[string]*subProcessLoop
+	// inbound 队列中前往汇聚型并行网关和包容网关的令牌经过的入边，按入队顺序排列
+	inbound map[string][]string
+	// joinFlows 停在汇聚型并行网关和包容网关上的令牌到达时经过的入边，保存在实例的 join_flow_ids 中；
+	// 第一次到达汇聚型网关时读取，有变化时在最终更新前写回
+	joinFlows        []string
+	joinFlowsLoaded  bool
+	joinFlowsChanged bool
+}
+
+// routeTokens moves tokens from a node to its next nodes
+// 普通 EndEvent 不入队：顶层 EndEvent 消耗令牌，子流程内部的 EndEvent 在子流程没有其他令牌时离开子流程
+func (s *WorkflowEngineService) routeTokens(
+	wd *models.WorkflowDefinition,
+	tokens *tokenState,
+	fromNodeId string,
+	nextNodeIds []string,
+) error {
+	var endEvents []models.Node
+	routed := make(map[string]int)
+	for _, nextNodeId := range nextNodeIds {
+		nextNode, exists := wd.Nodes[nextNodeId]
+		if !exists {
+			s.logger.Error().Str("nextNodeId", nextNodeId).Msg("Next node not found in workflow definition")
+			return fmt.Errorf("next node %s not found in workflow definition", nextNodeId)
+		}
+
+		// 补偿结束事件需要在循环中执行补偿、发送消息流的结束事件需要在循环中发送消息，和其他节点一样入队
+		if nextNode.Type == parser.NodeTypeEndEvent && nextNode.CompensateDefinition == nil && len(parser.MessageFlowsFrom(wd, nextNodeId)) == 0 {
+			endEvents = append(endEvents, nextNode)
+			continue
+		}
+
+		s.logger.Info().
+			Str("fromNodeId", fromNodeId).
+			Str("toNodeId", nextNodeId).
+			Msg("Auto-advancing to next node")
+		tokens.queue = append(tokens.queue, nextNodeId)
+		// 汇聚型网关按入边合并令牌，记录令牌经过的入边
+		if s.isConvergingParallelGateway(wd, &nextNode) || s.isConvergingInclusiveGateway(wd, &nextNode) {
+			if tokens.inbound == nil {
+				tokens.inbound = make(map[string][]string)
+			}
+			tokens.inbound[nextNodeId] = append(tokens.inbound[nextNodeId], flowBetween(wd, fromNodeId, nextNodeId, routed[nextNodeId]))
+			routed[nextNodeId]++
+		}
+	}
+
+	for i := range endEvents {
+		// 同一批到达的其他 EndEvent 令牌仍在子流程内
+		var pending []string
+		for _, other := range endEvents[i+1:] {
+			pending = append(pending, other.Id)
+		}
+
+		successors, err := s.finishEndEvent(wd, tokens, &endEvents[i], pending)
+		if err != nil {
+			return err
+		}
+		if err := s.routeTokens(wd, tokens, endEvents[i].ParentId, successors); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// finishEndEvent consumes a token at an EndEvent
+// Returns the successors of the enclosing SubProcess when the last token inside it completes
+// (or its start events again when a multi-instance SubProcess has instances left)
+// 错误结束事件抛出错误，返回捕获它的错误边界事件
+func (s *WorkflowEngineService) finishEndEvent(
+	wd *models.WorkflowDefinition,
+	tokens *tokenState,
+	endEvent *models.Node,
+	pending []string,
+) ([]string, error) {
+	if endEvent.ErrorDefinition != nil {
+		boundaryEventId, err := s.throwError(wd, tokens, endEvent, endEvent.ErrorDefinition.ErrorCode)
+		if err != nil {
+			return nil, err
+		}
+		return []string{boundaryEventId}, nil
+	}
+
+	if endEvent.ParentId == "" {
+		s.logger.Info().Str("nodeId", endEvent.Id).Msg("EndEvent reached, token consumed")
+		tokens.reachedEndEvent = true
+		return nil, nil
+	}
+
+	if s.hasTokensInScope(wd, endEvent.ParentId, tokens, pending) {
+		s.logger.Info().
+			Str("nodeId", endEvent.Id).
+			Str("subProcessId", endEvent.ParentId).
+			Msg("SubProcess EndEvent reached, waiting for other tokens in SubProcess")
+		return nil, nil
+	}
+
+	subProcess := wd.Nodes[endEvent.ParentId]
+	s.logger.Info().
+		Str("nodeId", endEvent.Id).
+		Str("subProcessId", subProcess.Id).
+		Msg("SubProcess completed, leaving SubProcess")
+	return s.completeSubProcessInstance(wd, tokens, &subProcess)
+}
+
+// matchBusinessError maps a ServiceTask response to a business error code
+// 按声明顺序匹配 xflow:error 映射；没有映射匹配时，4xx/5xx 状态码本身作为错误码，其余情况返回空字符串
+func (s *WorkflowEngineService) matchBusinessError(node *models.Node, response *BusinessResponse) (string, error) {
+	if node.Type != parser.NodeTypeServiceTask {
+		return "", nil
+	}
+
+	env := map[string]interface{}{
+		"statusCode": response.StatusCode,
+		"body":       response.Body,
+		"headers":    response.Headers,
+	}
+	for _, mapping := range node.ErrorMappings {
+		value, err := expr.Eval(mapping.When, env)
+		if err != nil {
+			return "", fmt.Errorf("failed to evaluate error mapping %s of node %s: %w", mapping.Code, node.Id, err)
+		}
+		if matched, ok := value.(bool); ok && matched {
+			return mapping.Code, nil
+		}
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return strconv.Itoa(response.StatusCode), nil
+	}
+	return "", nil
+}
+
+// throwError propagates a BPMN error from the source node to the closest error boundary event that catches it
+// 先查找节点自身的错误边界事件，再逐层查找外层子流程的；捕获后取消被中断子流程内的其他令牌
+// 没有任何边界事件捕获时返回错误，本次执行失败
+func (s *WorkflowEngineService) throwError(
+	wd *models.WorkflowDefinition,
+	tokens *tokenState,
+	source *models.Node,
+	errorCode string,
+) (string, error) {
+	scopeId := source.Id
+	if source.Type == parser.NodeTypeEndEvent {
+		// 错误结束事件没有边界事件，从所在的子流程开始查找
+		scopeId = source.ParentId
+	}
+
+	for scopeId != "" {
+		scope := wd.Nodes[scopeId]
+		if boundaryEvent := findErrorBoundaryEvent(wd, scopeId, errorCode); boundaryEvent != nil {
+			if scope.Type == parser.NodeTypeSubProcess {
+				tokens.queue = removeNodesInScope(wd, tokens.queue, scopeId)
+				tokens.remaining = removeNodesInScope(wd, tokens.remaining, scopeId)
+				tokens.parked = removeNodesInScope(wd, tokens.parked, scopeId)
+				for nodeId := range tokens.inbound {
+					if isNodeInScope(wd, nodeId, scopeId) {
+						delete(tokens.inbound, nodeId)
+					}
+				}
+				s.abandonSubProcessLoops(wd, tokens, scopeId)
+			}
+			s.logger.Info().
+				Str("nodeId", source.Id).
+				Str("errorCode", errorCode).
+				Str("boundaryEventId", boundaryEvent.Id).
+				Msg("BPMN error caught by error boundary event")
+			return boundaryEvent.Id, nil
+		}
+		scopeId = scope.ParentId
+	}
+
+	return "", &unhandledBpmnError{ErrorCode: errorCode, NodeId: source.Id}
+}
+
+// findErrorBoundaryEvent returns the error boundary event attached to the node that catches the error code
+// 指定了错误码的边界事件优先于捕获所有错误的边界事件
+func findErrorBoundaryEvent(wd *models.WorkflowDefinition, attachedNodeId string, errorCode string) *models.Node {
+	var catchAll *models.Node
+	for _, nodeId := range wd.AdjacencyList[attachedNodeId] {
+		node, exists := wd.Nodes[nodeId]
+		if !exists || node.Type != parser.NodeTypeBoundaryEvent || node.AttachedNodeId != attachedNodeId || node.ErrorDefinition == nil {
+			continue
+		}
+		if node.ErrorDefinition.ErrorRef == "" {
+			if catchAll == nil {
+				catchAll = &node
+			}
+			continue
+		}
+		if node.ErrorDefinition.ErrorCode == errorCode {
+			return &node
+		}
+	}
+	return catchAll
+}
+
+// removeNodesInScope returns the node IDs that are not nested inside the given SubProcess
+func removeNodesInScope(wd *models.WorkflowDefinition, nodeIds []string, scopeId string) []string {
+	result := make([]string, 0, len(nodeIds))
+	for _, nodeId := range nodeIds {
+		if !isNodeInScope(wd, nodeId, scopeId) {
+			result = append(result, nodeId)
+		}
+	}
+	return result
+}
+
+// enterSubProcess returns the internal start events of a SubProcess
+// 空的子流程直接离开
+func (s *WorkflowEngineService) enterSubProcess(wd *models.WorkflowDefinition, subProcess *models.Node) []string {
+	var startEventIds []string
+	for _, nodeId := range wd.AdjacencyList[subProcess.Id] {
+		node, exists := wd.Nodes[nodeId]
+		if exists && node.ParentId == subProcess.Id && node.Type == parser.NodeTypeStartEvent {
+			startEventIds = append(startEventIds, nodeId)
+		}
+	}
+
+	if len(startEventIds) == 0 {
+		return s.leaveSubProcess(wd, subProcess)
+	}
+	return startEventIds
+}
+
+// leaveSubProcess returns the successor of a completed SubProcess
+func (s *WorkflowEngineService) leaveSubProcess(wd *models.WorkflowDefinition, subProcess *models.Node) []string {
+	for _, flowId := range subProcess.OutgoingSequenceFlowIds {
+		if flow, exists := wd.SequenceFlows[flowId]; exists {
+			return []string{flow.TargetNodeId}
+		}
+	}
+	return nil
+}
+
+// hasTokensInScope checks if any token (other than the one being finished) is located inside the SubProcess
+func (s *WorkflowEngineService) hasTokensInScope(
+	wd *models.WorkflowDefinition,
+	scopeId string,
+	tokens *tokenState,
+	pending []string,
+) bool {
+	for _, nodeIds := range [][]string{tokens.queue, tokens.remaining, tokens.parked, pending} {
+		for _, nodeId := range nodeIds {
+			if isNodeInScope(wd, nodeId, scopeId) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isNodeInScope checks if the node is nested (directly or indirectly) inside the given SubProcess
+func isNodeInScope(wd *models.WorkflowDefinition, nodeId string, scopeId string) bool {
+	node, exists := wd.Nodes[nodeId]
+	for exists && node.ParentId != "" {
+		if node.ParentId == scopeId {
+			return true
+		}
+		node, exists = wd.Nodes[node.ParentId]
+	}
+	return false
+}
+
+// isConvergingParallelGateway checks if the node is a ParallelGateway that joins multiple incoming branches
+func (s *WorkflowEngineService) isConvergingParallelGateway(wd *models.WorkflowDefinition, node *models.Node) bool {
+	return node.Type == parser.NodeTypeParallelGateway && incomingFlowCount(wd, node.Id) > 1
+}
+
+// joinParallelGateway records the arrival of a token at a converging ParallelGateway
+// 每个到达的令牌都停在网关上（记录在 current_node_ids 中），并记录它经过的入边；
+// 每条入边都有令牌到达时，每条入边消耗一个令牌合并为一个令牌并返回 true，同一入边上多余的令牌继续等待。
+// 入边未知的令牌（升级前停在网关上的令牌，或从网关本身继续执行的令牌）可以补足任意一条入边
+func (s *WorkflowEngineService) joinParallelGateway(
+	wd *models.WorkflowDefinition,
+	gateway *models.Node,
+	tokens *tokenState,
+	flowId string,
+) bool {
+	reconcileJoinFlows(wd, tokens)
+	waiting := countNodeId(tokens.remaining, gateway.Id) + countNodeId(tokens.parked, gateway.Id)
+	arrived := joinFlowsOf(wd, tokens.joinFlows, gateway.Id)
+	unknown := waiting - len(arrived)
+	if flowId == "" {
+		unknown++
+	}
+
+	missing := 0
+	for _, incoming := range incomingFlowIds(wd, gateway.Id) {
+		if incoming != flowId && countNodeId(arrived, incoming) == 0 {
+			missing++
+		}
+	}
+	if missing > unknown {
+		tokens.parked = append(tokens.parked, gateway.Id)
+		if flowId != "" {
+			tokens.joinFlows = append(tokens.joinFlows, flowId)
+			tokens.joinFlowsChanged = true
+		}
+		return false
+	}
+
+	// 每条入边都有令牌：每条其他入边消耗一个等待中的令牌，由当前令牌继续推进
+	for _, incoming := range incomingFlowIds(wd, gateway.Id) {
+		switch {
+		case incoming == flowId:
+			continue
+		case countNodeId(arrived, incoming) > 0:
+			tokens.joinFlows = removeNodeId(tokens.joinFlows, incoming, 1)
+		case flowId == "":
+			// 当前令牌的入边未知，由它补足第一条缺少令牌的入边
+			flowId = incoming
+			continue
+		}
+		if countNodeId(tokens.parked, gateway.Id) > 0 {
+			tokens.parked = removeNodeId(tokens.parked, gateway.Id, 1)
+		} else {
+			tokens.remaining = removeNodeId(tokens.remaining, gateway.Id, 1)
+		}
+	}
+	tokens.joinFlowsChanged = true
+	return true
+}
+
+// takeInbound returns the incoming flow of the next queued token at the node, or "" when it is unknown
+func (t *tokenState) takeInbound(nodeId string) string {
+	flows := t.inbound[nodeId]
+	if len(flows) == 0 {
+		return ""
+	}
+	t.inbound[nodeId] = flows[1:]
+	return flows[0]
+}
+
+// loadJoinFlows reads the incoming flows of the tokens waiting at converging gateways once per execution
+// 全程 Mock 模式不读取数据库，之前停在网关上的令牌的入边视为未知
+func (s *WorkflowEngineService) loadJoinFlows(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	instanceId string,
+	tokens *tokenState,
+	isFullMockMode bool,
+) {
+	if tokens.joinFlowsLoaded {
+		return
+	}
+	tokens.joinFlowsLoaded = true
+	if isFullMockMode {
+		return
+	}
+
+	flowIds, err := s.instanceSvc.GetJoinFlowIds(ctx, instanceId)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceId).Msg("Failed to load join flows, treating waiting tokens as unknown")
+		return
+	}
+	tokens.joinFlows = flowIds
+	reconcileJoinFlows(wd, tokens)
+}
+
+// reconcileJoinFlows drops recorded join flows that no longer match a token waiting at their gateway
+// 令牌被其他操作（错误边界事件中断子流程、实例迁移、回滚等）移走后，多余的记录视为过期
+func reconcileJoinFlows(wd *models.WorkflowDefinition, tokens *tokenState) {
+	kept := make([]string, 0, len(tokens.joinFlows))
+	perGateway := make(map[string]int)
+	for _, flowId := range tokens.joinFlows {
+		flow, exists := wd.SequenceFlows[flowId]
+		if exists {
+			gatewayId := flow.TargetNodeId
+			if perGateway[gatewayId] < countNodeId(tokens.remaining, gatewayId)+countNodeId(tokens.parked, gatewayId) {
+				perGateway[gatewayId]++
+				kept = append(kept, flowId)
+				continue
+			}
+		}
+		tokens.joinFlowsChanged = true
+	}
+	tokens.joinFlows = kept
+}
+
+// joinFlowsOf returns the recorded incoming flows of the tokens waiting at the gateway
+func joinFlowsOf(wd *models.WorkflowDefinition, joinFlows []string, gatewayId string) []string {
+	var flowIds []string
+	for _, flowId := range joinFlows {
+		if wd.SequenceFlows[flowId].TargetNodeId == gatewayId {
+			flowIds = append(flowIds, flowId)
+		}
+	}
+	return flowIds
+}
+
+// incomingFlowIds returns the IDs of the sequence flows targeting the node in a stable order
+func incomingFlowIds(wd *models.WorkflowDefinition, nodeId string) []string {
+	var flowIds []string
+	for flowId, flow := range wd.SequenceFlows {
+		if flow.TargetNodeId == nodeId {
+			flowIds = append(flowIds, flowId)
+		}
+	}
+	sort.Strings(flowIds)
+	return flowIds
+}
+
+// flowBetween returns the nth sequence flow from the source to the target, or "" when there is none
+// 离开子流程时 source 为子流程节点
+func flowBetween(wd *models.WorkflowDefinition, sourceId string, targetId string, nth int) string {
+	var flowIds []string
+	for flowId, flow := range wd.SequenceFlows {
+		if flow.SourceNodeId == sourceId && flow.TargetNodeId == targetId {
+			flowIds = append(flowIds, flowId)
+		}
+	}
+	if nth >= len(flowIds) {
+		return ""
+	}
+	sort.Strings(flowIds)
+	return flowIds[nth]
+}
+
+// isConvergingInclusiveGateway checks if the node is an InclusiveGateway that joins multiple incoming branches
+func (s *WorkflowEngineService) isConvergingInclusiveGateway(wd *models.WorkflowDefinition, node *models.Node) bool {
+	return node.Type == parser.NodeTypeInclusiveGateway && incomingFlowCount(wd, node.Id) > 1
+}
+
+// joinInclusiveGateway records the arrival of a token at a converging InclusiveGateway
+// 与并行网关不同，包容网关只等待实际激活的分支：只要还有其他令牌能到达没有令牌的入边，
+// 当前令牌就停在网关上；没有时合并所有停在网关上的令牌并返回 true。
+// 按 BPMN 规范，经过网关本身、或经过能到达已有令牌的入边的节点的路径不算：
+// 网关在循环中时，网关之后的令牌只能绕回网关，不应阻塞本轮合并
+func (s *WorkflowEngineService) joinInclusiveGateway(
+	wd *models.WorkflowDefinition,
+	gateway *models.Node,
+	tokens *tokenState,
+	flowId string,
+) bool {
+	reconcileJoinFlows(wd, tokens)
+	filled := joinFlowsOf(wd, tokens.joinFlows, gateway.Id)
+	if flowId != "" {
+		filled = append(filled, flowId)
+	}
+	feeding := nodesFeedingFlows(wd, gateway.Id, filled)
+
+	blocked := false
+	// 队列中同样到达网关的令牌还未处理，由最后一个令牌负责合并
+	for _, nodeId := range tokens.queue {
+		if nodeId == gateway.Id || reachesJoinGateway(wd, gateway.Id, nodeId, feeding) {
+			blocked = true
+			break
+		}
+	}
+	for _, nodeIds := range [][]string{tokens.remaining, tokens.parked} {
+		for _, nodeId := range nodeIds {
+			if !blocked && nodeId != gateway.Id && reachesJoinGateway(wd, gateway.Id, nodeId, feeding) {
+				blocked = true
+			}
+		}
+	}
+	if blocked {
+		tokens.parked = append(tokens.parked, gateway.Id)
+		if flowId != "" {
+			tokens.joinFlows = append(tokens.joinFlows, flowId)
+			tokens.joinFlowsChanged = true
+		}
+		return false
+	}
+
+	// 没有其他激活的分支：移除等待中的令牌，由当前令牌继续推进
+	tokens.remaining = removeNodeId(tokens.remaining, gateway.Id, -1)
+	tokens.parked = removeNodeId(tokens.parked, gateway.Id, -1)
+	for _, arrived := range joinFlowsOf(wd, tokens.joinFlows, gateway.Id) {
+		tokens.joinFlows = removeNodeId(tokens.joinFlows, arrived, 1)
+		tokens.joinFlowsChanged = true
+	}
+	return true
+}
+
+// nodesFeedingFlows returns the nodes that can reach the source of one of the flows without passing through the gateway
+func nodesFeedingFlows(wd *models.WorkflowDefinition, gatewayId string, flowIds []string) map[string]bool {
+	feeding := make(map[string]bool)
+	queue := make([]string, 0, len(flowIds))
+	for _, flowId := range flowIds {
+		sourceId := wd.SequenceFlows[flowId].SourceNodeId
+		if sourceId != gatewayId && !feeding[sourceId] {
+			feeding[sourceId] = true
+			queue = append(queue, sourceId)
+		}
+	}
+	for len(queue) > 0 {
+		nodeId := queue[0]
+		queue = queue[1:]
+		for _, predId := range wd.ReverseAdjacencyList[nodeId] {
+			if predId != gatewayId && !feeding[predId] {
+				feeding[predId] = true
+				queue = append(queue, predId)
+			}
+		}
+	}
+	return feeding
+}
+
+// reachesJoinGateway checks if a token at the node can still arrive at the gateway on a flow without a token
+// 不经过网关本身，也不经过 feeding 中的节点（这些节点的令牌会到达已有令牌的入边）
+func reachesJoinGateway(wd *models.WorkflowDefinition, gatewayId string, nodeId string, feeding map[string]bool) bool {
+	if feeding[nodeId] {
+		return false
+	}
+	visited := map[string]bool{nodeId: true}
+	queue := []string{nodeId}
+	for len(queue) > 0 {
+		currentId := queue[0]
+		queue = queue[1:]
+		for _, succId := range wd.AdjacencyList[currentId] {
+			if succId == gatewayId {
+				return true
+			}
+			if !visited[succId] && !feeding[succId] {
+				visited[succId] = true
+				queue = append(queue, succId)
+			}
+		}
+	}
+	return false
+}
+
+// incomingFlowCount counts the sequence flows targeting the node
+// 不使用反向邻接表，因为其中包含子流程穿越边
+func incomingFlowCount(wd *models.WorkflowDefinition, nodeId string) int {
+	count := 0
+	for _, flow := range wd.SequenceFlows {
+		if flow.TargetNodeId == nodeId {
+			count++
+		}
+	}
+	return count
+}
+
+// consumeToken removes the token that is being advanced by this execution from currentNodeIds
+// 令牌通常停在 fromNode 本身；边界事件的令牌停在依附节点上；
+// 事件网关后的中间捕获事件的令牌停在事件网关上
+func (s *WorkflowEngineService) consumeToken(
+	wd *models.WorkflowDefinition,
+	fromNode *models.Node,
+	currentNodeIds []string,
+) []string {
+	if countNodeId(currentNodeIds, fromNode.Id) > 0 {
+		return removeNodeId(currentNodeIds, fromNode.Id, 1)
+	}
+
+	// 非中断边界事件保留依附节点上的令牌，另起一个令牌
+	if fromNode.Type == parser.NodeTypeBoundaryEvent && fromNode.CancelActivity && countNodeId(currentNodeIds, fromNode.AttachedNodeId) > 0 {
+		return removeNodeId(currentNodeIds, fromNode.AttachedNodeId, 1)
+	}
+
+	for _, predId := range wd.ReverseAdjacencyList[fromNode.Id] {
+		predNode, exists := wd.Nodes[predId]
+		if exists && predNode.Type == parser.NodeTypeEventBasedGateway && countNodeId(currentNodeIds, predId) > 0 {
+			return removeNodeId(currentNodeIds, predId, 1)
+		}
+	}
+
+	return append([]string{}, currentNodeIds...)
+}
+
+// countNodeId counts how many tokens are located at the given node
+func countNodeId(nodeIds []string, nodeId string) int {
+	count := 0
+	for _, id := range nodeIds {
+		if id == nodeId {
+			count++
+		}
+	}
+	return count
+}
+
+// removeNodeId returns a copy of nodeIds with at most n occurrences of nodeId removed (n < 0 removes all)
+func removeNodeId(nodeIds []string, nodeId string, n int) []string {
+	result := make([]string, 0, len(nodeIds))
+	for _, id := range nodeIds {
+		if id == nodeId && n != 0 {
+			n--
+			continue
+		}
+		result = append(result, id)
+	}
+	return result
+}
+
 // RollbackAction represents the action to take after rollback check
 type RollbackAction struct {
 	NeedsRollback bool     // 是否需要回滚
@@ -886,12 +2549,43 @@ func (s *WorkflowEngineService) isNodeAfterCurrentNodes(
 // updateInstance updates a workflow instance in database
 // This method uses struct parameters for the new interceptor architecture
 func (s *WorkflowEngineService) updateInstance(ctx context.Context, params UpdateInstanceParams) (*models.WorkflowInstance, error) {
-	return s.instanceSvc.UpdateWorkflowInstance(
-		ctx,
-		params.InstanceID,
-		params.Status,
-		params.NextNodes,
-	)
+	switch {
+	case params.Claim:
+		instance, err := s.instanceSvc.ClaimWorkflowInstance(ctx, params.InstanceID, params.Status, params.NextNodes, params.ExpectedVersion)
+		if isInstanceVersionConflict(err) {
+			return nil, &claimConflictError{err: err}
+		}
+		return instance, err
+	case params.Release:
+		return s.instanceSvc.ReleaseWorkflowInstance(ctx, params.InstanceID, params.Status, params.NextNodes, params.ExpectedVersion)
+	default:
+		return s.instanceSvc.UpdateWorkflowInstance(ctx, params.InstanceID, params.Status, params.NextNodes, params.ExpectedVersion)
+	}
+}
+
+// isInstanceVersionConflict reports whether err is an optimistic concurrency conflict on an instance
+func isInstanceVersionConflict(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), models.ErrInstanceVersionConflict)
+}
+
+// claimConflictError is a version conflict raised while claiming the instance, before any node ran
+type claimConflictError struct {
+	err error
+}
+
+func (e *claimConflictError) Error() string {
+	return e.err.Error()
+}
+
+func (e *claimConflictError) Unwrap() error {
+	return e.err
+}
+
+// IsClaimConflict reports whether err is a conflict raised by the claim of an execution
+// 占用失败时还没有执行任何节点，重新读取实例后重试是安全的；最终更新的冲突发生在业务副作用之后，不能重试
+func IsClaimConflict(err error) bool {
+	var conflict *claimConflictError
+	return errors.As(err, &conflict)
 }
 
 // createExecution creates a workflow execution in database
@@ -912,6 +2606,24 @@ func (s *WorkflowEngineService) updateExecution(ctx context.Context, params Upda
 	)
 }
 
+// createExecutionHistory creates an execution history record in database
+// This method uses struct parameters for the new interceptor architecture
+func (s *WorkflowEngineService) createExecutionHistory(ctx context.Context, params CreateExecutionHistoryParams) (*models.ExecutionHistory, error) {
+	return s.historySvc.CreateExecutionHistory(
+		ctx,
+		params.ExecutionID,
+		params.NodeID,
+		params.NodeName,
+		params.NodeType,
+		params.InputData,
+		params.OutputData,
+		params.VariablesBefore,
+		params.VariablesAfter,
+		params.ExecutionTimeMs,
+		params.ErrorMessage,
+	)
+}
+
 // executeServiceTaskWithParams executes a ServiceTask with struct parameters
 // This method uses struct parameters for the new interceptor architecture
 func (s *WorkflowEngineService) executeServiceTaskWithParams(ctx context.Context, params ExecuteServiceTaskParams) (*BusinessResponse, error) {
@@ -4,12 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/interceptor"
 	"github.com/bpmn-explorer/server/internal/models"
 	"github.com/bpmn-explorer/server/internal/parser"
 	"github.com/bpmn-explorer/server/pkg/database"
@@ -127,6 +130,13 @@ func TestWorkflowEngineService_ExecuteFromNode_ServiceTask_Success(t *testing.T)
 		UpdatedAt:      now,
 	}
 
+	// Mock: Claim instance version before executing nodes (optimistic lock)
+	// Args: updated_at, status, current_node_ids, instance_id, expected instance_version
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceId, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"ServiceTask_1"}), 2, 0, now, now))
+
 	// Mock: Get instance version (for CreateWorkflowExecution)
 	mock.ExpectQuery(`SELECT instance_version FROM workflow_instances WHERE id`).
 		WithArgs(instanceId).
@@ -144,6 +154,16 @@ func TestWorkflowEngineService_ExecuteFromNode_ServiceTask_Success(t *testing.T)
 		WillReturnRows(sqlmock.NewRows([]string{"id", "instance_id", "workflow_id", "status", "variables", "execution_version", "started_at", "completed_at", "error_message"}).
 			AddRow("exec-1", instanceId, workflowId, models.ExecutionStatusRunning, []byte("{}"), 1, now, sql.NullTime{}, sql.NullString{}))
 
+	// Mock: Execution history for ServiceTask_1 (input, response and chosen branch)
+	historyColumns := []string{"id", "execution_id", "node_id", "node_name", "node_type", "input_data", "output_data", "variables_before", "variables_after", "execution_time_ms", "error_message", "executed_at"}
+	mock.ExpectQuery(`INSERT INTO execution_histories`).
+		WithArgs(sqlmock.AnyArg(), "exec-1", "ServiceTask_1", "Service Task", int(parser.NodeTypeServiceTask),
+			`{"businessParams":{"param":"value"}}`,
+			`{"body":{"data":"test data","result":"success"},"nextNodeIds":["EndEvent_1"],"statusCode":200}`,
+			"{}", "{}", sqlmock.AnyArg(), "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(historyColumns).
+			AddRow("history-1", "exec-1", "ServiceTask_1", "Service Task", int(parser.NodeTypeServiceTask), []byte("{}"), []byte("{}"), []byte("{}"), []byte("{}"), 1, "", now))
+
 	// Mock: Update execution to Completed
 	mock.ExpectQuery(`UPDATE workflow_executions`).
 		WithArgs(sqlmock.AnyArg(), models.ExecutionStatusCompleted, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
@@ -153,9 +173,9 @@ func TestWorkflowEngineService_ExecuteFromNode_ServiceTask_Success(t *testing.T)
 	// Mock: Update instance to Completed (workflow reaches EndEvent)
 	// Args: updated_at, status, current_node_ids (empty when completed), instance_id
 	mock.ExpectQuery(`UPDATE workflow_instances`).
-		WithArgs(sqlmock.AnyArg(), models.InstanceStatusCompleted, sqlmock.AnyArg(), instanceId).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "created_at", "updated_at"}).
-			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusCompleted, pq.Array([]string{}), 2, now, now))
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusCompleted, sqlmock.AnyArg(), instanceId, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusCompleted, pq.Array([]string{}), 3, 0, now, now))
 
 	// Execute
 	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, fromNodeId, map[string]interface{}{"param": "value"})
@@ -206,9 +226,9 @@ func TestWorkflowEngineService_ExecuteFromNode_InvalidNodeId(t *testing.T) {
 	// Mock: Update instance to initialize current_node_ids (auto-initialization will happen before node validation)
 	// Args: updated_at, status, current_node_ids, instance_id
 	mock.ExpectQuery(`UPDATE workflow_instances`).
-		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceId).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "created_at", "updated_at"}).
-			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"StartEvent_1"}), 2, now, now))
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceId, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"StartEvent_1"}), 2, 0, now, now))
 
 	// Execute
 	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, fromNodeId, nil)
@@ -264,6 +284,13 @@ func TestWorkflowEngineService_ExecuteFromNode_EndEvent(t *testing.T) {
 		UpdatedAt:      now,
 	}
 
+	// Mock: Claim instance version before executing nodes (optimistic lock)
+	// Args: updated_at, status, current_node_ids, instance_id, expected instance_version
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceId, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"EndEvent_1"}), 2, 0, now, now))
+
 	// Mock: Get instance version (for CreateWorkflowExecution)
 	mock.ExpectQuery(`SELECT instance_version FROM workflow_instances WHERE id`).
 		WithArgs(instanceId).
@@ -289,9 +316,9 @@ func TestWorkflowEngineService_ExecuteFromNode_EndEvent(t *testing.T) {
 
 	// Mock: Update instance (4 params: updated_at, status, current_node_ids, instance_id)
 	mock.ExpectQuery(`UPDATE workflow_instances`).
-		WithArgs(sqlmock.AnyArg(), models.InstanceStatusCompleted, sqlmock.AnyArg(), instanceId).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "created_at", "updated_at"}).
-			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusCompleted, pq.Array([]string{}), 2, now, now))
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusCompleted, sqlmock.AnyArg(), instanceId, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusCompleted, pq.Array([]string{}), 3, 0, now, now))
 
 	// Execute
 	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, fromNodeId, nil)
@@ -414,6 +441,88 @@ func TestWorkflowEngineService_AdvanceToNextNode_ExclusiveGateway(t *testing.T)
 	assert.Equal(t, "Task_1", nextNodeIds[0])
 }
 
+// createPriorityGatewayTestBPMN 排他网关：无条件出边声明在最前，两条条件出边按 priority 排序，带默认流
+func createPriorityGatewayTestBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1">
+    <bpmn:exclusiveGateway id="Gateway_1" default="Flow_Default">
+      <bpmn:outgoing>Flow_Default</bpmn:outgoing>
+      <bpmn:outgoing>Flow_Silver</bpmn:outgoing>
+      <bpmn:outgoing>Flow_Gold</bpmn:outgoing>
+    </bpmn:exclusiveGateway>
+    <bpmn:userTask id="Task_Standard"><bpmn:incoming>Flow_Default</bpmn:incoming></bpmn:userTask>
+    <bpmn:userTask id="Task_Silver"><bpmn:incoming>Flow_Silver</bpmn:incoming></bpmn:userTask>
+    <bpmn:userTask id="Task_Gold"><bpmn:incoming>Flow_Gold</bpmn:incoming></bpmn:userTask>
+    <bpmn:sequenceFlow id="Flow_Default" sourceRef="Gateway_1" targetRef="Task_Standard"/>
+    <bpmn:sequenceFlow id="Flow_Silver" sourceRef="Gateway_1" targetRef="Task_Silver" priority="2">
+      <bpmn:conditionExpression>amount > 100</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_Gold" sourceRef="Gateway_1" targetRef="Task_Gold" priority="1">
+      <bpmn:conditionExpression>amount > 1000</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_AdvanceToNextNode_ExclusiveGatewayPriorityAndDefault(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	wd, err := parser.ParseBPMN(createPriorityGatewayTestBPMN())
+	require.NoError(t, err)
+	gateway := wd.Nodes["Gateway_1"]
+
+	tests := []struct {
+		name     string
+		amount   int
+		expected string
+	}{
+		// 两个条件都满足时，priority 小的胜出
+		{name: "both conditions match", amount: 5000, expected: "Task_Gold"},
+		{name: "lower priority condition matches", amount: 500, expected: "Task_Silver"},
+		// 默认流声明在最前，但只有条件都不满足时才使用
+		{name: "no condition matches", amount: 50, expected: "Task_Standard"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextNodeIds, err := engineSvc.advanceToNextNode(context.Background(), wd, &gateway, map[string]interface{}{"amount": tt.amount})
+			require.NoError(t, err)
+			assert.Equal(t, []string{tt.expected}, nextNodeIds)
+		})
+	}
+}
+
+func TestWorkflowEngineService_AdvanceToNextNode_ExclusiveGatewayUnconditionedFlowLast(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	// 没有声明 default 时，无条件出边即使排在前面也要等条件出边都评估完
+	wd := &models.WorkflowDefinition{
+		Nodes: map[string]models.Node{
+			"Gateway_1": {
+				Id:                      "Gateway_1",
+				Type:                    parser.NodeTypeExclusiveGateway,
+				OutgoingSequenceFlowIds: []string{"Flow_Fallback", "Flow_Match"},
+			},
+		},
+		SequenceFlows: map[string]models.SequenceFlow{
+			"Flow_Fallback": {Id: "Flow_Fallback", SourceNodeId: "Gateway_1", TargetNodeId: "Task_Fallback"},
+			"Flow_Match":    {Id: "Flow_Match", SourceNodeId: "Gateway_1", TargetNodeId: "Task_Match", ConditionExpression: "x > 5"},
+		},
+	}
+	gateway := wd.Nodes["Gateway_1"]
+
+	nextNodeIds, err := engineSvc.advanceToNextNode(context.Background(), wd, &gateway, map[string]interface{}{"x": 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Task_Match"}, nextNodeIds)
+
+	nextNodeIds, err = engineSvc.advanceToNextNode(context.Background(), wd, &gateway, map[string]interface{}{"x": 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Task_Fallback"}, nextNodeIds)
+}
+
 func TestWorkflowEngineService_CheckAndHandleRollback_OtherNode_NoRollback(t *testing.T) {
 	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
 	defer cleanup()
@@ -837,9 +946,9 @@ func TestExecuteFromNode_AutoInitializeCurrentNodeIds(t *testing.T) {
 	// Mock: Update instance to initialize current_node_ids
 	// Args: updated_at, status, current_node_ids, instance_id
 	mock.ExpectQuery(`UPDATE workflow_instances`).
-		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceId).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "created_at", "updated_at"}).
-			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"StartEvent_1"}), 2, now, now))
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceId, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"StartEvent_1"}), 2, 0, now, now))
 
 	// Mock: Get instance version (for CreateWorkflowExecution)
 	mock.ExpectQuery(`SELECT instance_version FROM workflow_instances WHERE id`).
@@ -869,9 +978,9 @@ func TestExecuteFromNode_AutoInitializeCurrentNodeIds(t *testing.T) {
 	// Mock: Update instance to Completed
 	// Args: updated_at, status, current_node_ids (empty for completed), instance_id
 	mock.ExpectQuery(`UPDATE workflow_instances`).
-		WithArgs(sqlmock.AnyArg(), models.InstanceStatusCompleted, sqlmock.AnyArg(), instanceId).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "created_at", "updated_at"}).
-			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusCompleted, pq.Array([]string{}), 3, now, now))
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusCompleted, sqlmock.AnyArg(), instanceId, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusCompleted, pq.Array([]string{}), 3, 0, now, now))
 
 	// Execute
 	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, fromNodeId, nil)
@@ -1015,6 +1124,13 @@ func TestWorkflowEngineService_ExecuteFromNode_EmptyFromNodeId_UsesCurrentNodeId
 		UpdatedAt:      now,
 	}
 
+	// Mock: Claim instance version before executing nodes (optimistic lock)
+	// Args: updated_at, status, current_node_ids, instance_id, expected instance_version
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceId, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"ServiceTask_1"}), 2, 0, now, now))
+
 	// Mock: Get instance version (for CreateWorkflowExecution)
 	mock.ExpectQuery(`SELECT instance_version FROM workflow_instances WHERE id`).
 		WithArgs(instanceId).
@@ -1040,9 +1156,9 @@ func TestWorkflowEngineService_ExecuteFromNode_EmptyFromNodeId_UsesCurrentNodeId
 
 	// Mock: Update instance to Completed (workflow reaches EndEvent)
 	mock.ExpectQuery(`UPDATE workflow_instances`).
-		WithArgs(sqlmock.AnyArg(), models.InstanceStatusCompleted, sqlmock.AnyArg(), instanceId).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "created_at", "updated_at"}).
-			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusCompleted, pq.Array([]string{}), 2, now, now))
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusCompleted, sqlmock.AnyArg(), instanceId, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceId, workflowId, "Test Instance", models.InstanceStatusCompleted, pq.Array([]string{}), 3, 0, now, now))
 
 	// Execute with empty fromNodeId - should use ServiceTask_1 from current_node_ids
 	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, fromNodeId, map[string]interface{}{"param": "value"})
@@ -1282,3 +1398,1307 @@ func TestExecuteNode_EndEvent(t *testing.T) {
 	assert.NotNil(t, result)
 	assert.Nil(t, result.BusinessResponse)
 }
+
+// newFullMockContext creates a context in full mock mode, so instance and execution updates stay in memory
+func newFullMockContext() context.Context {
+	config := interceptor.NewInterceptConfig(map[string]string{"*": string(interceptor.InterceptModeEnabled)})
+	return interceptor.WithInterceptConfig(context.Background(), config)
+}
+
+// createParallelTestBPMN creates a BPMN with a parallel fork/join around a Task and a UserTask
+func createParallelTestBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1" name="Parallel Review">
+    <bpmn:startEvent id="StartEvent_1" name="Start">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:parallelGateway id="Fork_1" name="Fork">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:outgoing>Flow_3</bpmn:outgoing>
+    </bpmn:parallelGateway>
+    <bpmn:task id="Task_Legal" name="Legal Review">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+      <bpmn:outgoing>Flow_4</bpmn:outgoing>
+    </bpmn:task>
+    <bpmn:userTask id="UserTask_Finance" name="Finance Review">
+      <bpmn:incoming>Flow_3</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:boundaryEvent id="Boundary_Finance" name="Finance Approved" attachedToRef="UserTask_Finance">
+      <bpmn:outgoing>Flow_5</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:parallelGateway id="Join_1" name="Join">
+      <bpmn:incoming>Flow_4</bpmn:incoming>
+      <bpmn:incoming>Flow_5</bpmn:incoming>
+      <bpmn:outgoing>Flow_6</bpmn:outgoing>
+    </bpmn:parallelGateway>
+    <bpmn:endEvent id="EndEvent_1" name="End">
+      <bpmn:incoming>Flow_6</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Fork_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Fork_1" targetRef="Task_Legal"/>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="Fork_1" targetRef="UserTask_Finance"/>
+    <bpmn:sequenceFlow id="Flow_4" sourceRef="Task_Legal" targetRef="Join_1"/>
+    <bpmn:sequenceFlow id="Flow_5" sourceRef="Boundary_Finance" targetRef="Join_1"/>
+    <bpmn:sequenceFlow id="Flow_6" sourceRef="Join_1" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_AdvanceToNextNode_ParallelGatewayFork(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	wd, err := parser.ParseBPMN(createParallelTestBPMN())
+	require.NoError(t, err)
+
+	fork := wd.Nodes["Fork_1"]
+	nextNodeIds, err := engineSvc.advanceToNextNode(context.Background(), wd, &fork, map[string]interface{}{})
+
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Task_Legal", "UserTask_Finance"}, nextNodeIds)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_ParallelForkAndJoin(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	ctx := newFullMockContext()
+	workflow := &models.Workflow{
+		Id:      "test-workflow-id",
+		Name:    "Parallel Review",
+		BpmnXml: createParallelTestBPMN(),
+		Status:  models.StatusDraft,
+	}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+
+	// Fork: legal branch runs through to the join, finance branch waits at the UserTask
+	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, "StartEvent_1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+	assert.ElementsMatch(t, []string{"UserTask_Finance", "Join_1"}, result.EngineResponse.CurrentNodeIds)
+
+	// Join: the finance branch arrives, the join fires and the instance completes
+	result, err = engineSvc.ExecuteFromNode(ctx, workflow, instance, "Boundary_Finance", nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusCompleted, result.EngineResponse.Status)
+	assert.Empty(t, result.EngineResponse.CurrentNodeIds)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_ParallelJoinWaitsForAllBranches(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	ctx := newFullMockContext()
+	workflow := &models.Workflow{
+		Id:      "test-workflow-id",
+		Name:    "Parallel Review",
+		BpmnXml: createParallelTestBPMN(),
+		Status:  models.StatusDraft,
+	}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"Task_Legal", "UserTask_Finance"},
+	}
+
+	// Only the legal branch arrives: the join must not fire yet
+	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, "Task_Legal", nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+	assert.ElementsMatch(t, []string{"UserTask_Finance", "Join_1"}, result.EngineResponse.CurrentNodeIds)
+	assert.Equal(t, []string{"Join_1"}, result.EngineResponse.NextNodeIds)
+}
+
+// createMergedBranchesJoinBPMN 两个分支经排他网关合并到并行汇聚网关的同一条入边上，另一条入边来自人工任务
+func createMergedBranchesJoinBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1" name="Merged Branches">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:parallelGateway id="Fork_1">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_A1</bpmn:outgoing>
+      <bpmn:outgoing>Flow_A2</bpmn:outgoing>
+      <bpmn:outgoing>Flow_B1</bpmn:outgoing>
+    </bpmn:parallelGateway>
+    <bpmn:task id="Task_A1">
+      <bpmn:incoming>Flow_A1</bpmn:incoming>
+      <bpmn:outgoing>Flow_A3</bpmn:outgoing>
+    </bpmn:task>
+    <bpmn:task id="Task_A2">
+      <bpmn:incoming>Flow_A2</bpmn:incoming>
+      <bpmn:outgoing>Flow_A4</bpmn:outgoing>
+    </bpmn:task>
+    <bpmn:exclusiveGateway id="Merge_1">
+      <bpmn:incoming>Flow_A3</bpmn:incoming>
+      <bpmn:incoming>Flow_A4</bpmn:incoming>
+      <bpmn:outgoing>Flow_A</bpmn:outgoing>
+    </bpmn:exclusiveGateway>
+    <bpmn:userTask id="UserTask_B">
+      <bpmn:incoming>Flow_B1</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:boundaryEvent id="Boundary_B" attachedToRef="UserTask_B">
+      <bpmn:outgoing>Flow_B</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:parallelGateway id="Join_1">
+      <bpmn:incoming>Flow_A</bpmn:incoming>
+      <bpmn:incoming>Flow_B</bpmn:incoming>
+      <bpmn:outgoing>Flow_End</bpmn:outgoing>
+    </bpmn:parallelGateway>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_End</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Fork_1"/>
+    <bpmn:sequenceFlow id="Flow_A1" sourceRef="Fork_1" targetRef="Task_A1"/>
+    <bpmn:sequenceFlow id="Flow_A2" sourceRef="Fork_1" targetRef="Task_A2"/>
+    <bpmn:sequenceFlow id="Flow_B1" sourceRef="Fork_1" targetRef="UserTask_B"/>
+    <bpmn:sequenceFlow id="Flow_A3" sourceRef="Task_A1" targetRef="Merge_1"/>
+    <bpmn:sequenceFlow id="Flow_A4" sourceRef="Task_A2" targetRef="Merge_1"/>
+    <bpmn:sequenceFlow id="Flow_A" sourceRef="Merge_1" targetRef="Join_1"/>
+    <bpmn:sequenceFlow id="Flow_B" sourceRef="Boundary_B" targetRef="Join_1"/>
+    <bpmn:sequenceFlow id="Flow_End" sourceRef="Join_1" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_ParallelJoinNeedsEveryIncomingFlow(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	ctx := newFullMockContext()
+	workflow := &models.Workflow{Id: "test-workflow-id", Name: "Merged Branches", BpmnXml: createMergedBranchesJoinBPMN(), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{Id: "test-instance-id", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_1"}}
+
+	// 两个令牌都经过 Flow_A 到达：Flow_B 还没有令牌，网关不合并
+	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, "StartEvent_1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+	assert.ElementsMatch(t, []string{"UserTask_B", "Join_1", "Join_1"}, result.EngineResponse.CurrentNodeIds)
+
+	// Flow_B 的令牌到达：每条入边消耗一个令牌，Flow_A 上多余的令牌继续等待
+	result, err = engineSvc.ExecuteFromNode(ctx, workflow, instance, "Boundary_B", nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+	assert.Equal(t, []string{"Join_1"}, result.EngineResponse.CurrentNodeIds)
+}
+
+func TestWorkflowEngineService_JoinParallelGateway_RecordedFlows(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	wd, err := parser.ParseBPMN(createMergedBranchesJoinBPMN())
+	require.NoError(t, err)
+	join := wd.Nodes["Join_1"]
+
+	// 之前的执行中两个令牌经过 Flow_A 到达
+	tokens := &tokenState{remaining: []string{"Join_1", "Join_1"}, joinFlows: []string{"Flow_A", "Flow_A"}, joinFlowsLoaded: true}
+
+	// 又一个令牌经过 Flow_A 到达：仍然缺少 Flow_B
+	assert.False(t, engineSvc.joinParallelGateway(wd, &join, tokens, "Flow_A"))
+	assert.Equal(t, []string{"Join_1"}, tokens.parked)
+	assert.Equal(t, []string{"Flow_A", "Flow_A", "Flow_A"}, tokens.joinFlows)
+
+	// Flow_B 的令牌到达：只消耗一个 Flow_A 的令牌
+	assert.True(t, engineSvc.joinParallelGateway(wd, &join, tokens, "Flow_B"))
+	assert.Equal(t, 2, countNodeId(tokens.remaining, "Join_1")+countNodeId(tokens.parked, "Join_1"))
+	assert.Equal(t, []string{"Flow_A", "Flow_A"}, tokens.joinFlows)
+	assert.True(t, tokens.joinFlowsChanged)
+
+	// 入边未知的令牌（升级前停在网关上）可以补足缺少的入边
+	tokens = &tokenState{remaining: []string{"Join_1"}, joinFlowsLoaded: true}
+	assert.True(t, engineSvc.joinParallelGateway(wd, &join, tokens, "Flow_B"))
+	assert.Empty(t, tokens.remaining)
+}
+
+// createInclusiveTestBPMN 通知流程：按用户的订阅选择发送邮件和/或短信，都未订阅时记录日志
+func createInclusiveTestBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1" name="Notify Customer">
+    <bpmn:startEvent id="StartEvent_1" name="Start">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:inclusiveGateway id="Split_1" name="Opt-ins" default="Flow_Default">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_Email</bpmn:outgoing>
+      <bpmn:outgoing>Flow_SMS</bpmn:outgoing>
+      <bpmn:outgoing>Flow_Default</bpmn:outgoing>
+    </bpmn:inclusiveGateway>
+    <bpmn:task id="Task_Email" name="Send Email">
+      <bpmn:incoming>Flow_Email</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+    </bpmn:task>
+    <bpmn:userTask id="UserTask_SMS" name="Confirm SMS">
+      <bpmn:incoming>Flow_SMS</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:boundaryEvent id="Boundary_SMS" name="SMS Sent" attachedToRef="UserTask_SMS">
+      <bpmn:outgoing>Flow_3</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:task id="Task_Log" name="Log No Opt-in">
+      <bpmn:incoming>Flow_Default</bpmn:incoming>
+      <bpmn:outgoing>Flow_4</bpmn:outgoing>
+    </bpmn:task>
+    <bpmn:inclusiveGateway id="Join_1" name="Join">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+      <bpmn:incoming>Flow_3</bpmn:incoming>
+      <bpmn:incoming>Flow_4</bpmn:incoming>
+      <bpmn:outgoing>Flow_5</bpmn:outgoing>
+    </bpmn:inclusiveGateway>
+    <bpmn:endEvent id="EndEvent_1" name="End">
+      <bpmn:incoming>Flow_5</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Split_1"/>
+    <bpmn:sequenceFlow id="Flow_Email" sourceRef="Split_1" targetRef="Task_Email">
+      <bpmn:conditionExpression>emailOptIn == true</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_SMS" sourceRef="Split_1" targetRef="UserTask_SMS">
+      <bpmn:conditionExpression>smsOptIn == true</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_Default" sourceRef="Split_1" targetRef="Task_Log"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Task_Email" targetRef="Join_1"/>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="Boundary_SMS" targetRef="Join_1"/>
+    <bpmn:sequenceFlow id="Flow_4" sourceRef="Task_Log" targetRef="Join_1"/>
+    <bpmn:sequenceFlow id="Flow_5" sourceRef="Join_1" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_AdvanceToNextNode_InclusiveGatewaySplit(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	wd, err := parser.ParseBPMN(createInclusiveTestBPMN())
+	require.NoError(t, err)
+	split := wd.Nodes["Split_1"]
+
+	tests := []struct {
+		name      string
+		variables map[string]interface{}
+		expected  []string
+	}{
+		{"both opt-ins", map[string]interface{}{"emailOptIn": true, "smsOptIn": true}, []string{"Task_Email", "UserTask_SMS"}},
+		{"email only", map[string]interface{}{"emailOptIn": true, "smsOptIn": false}, []string{"Task_Email"}},
+		{"no opt-in falls back to default flow", map[string]interface{}{"emailOptIn": false, "smsOptIn": false}, []string{"Task_Log"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextNodeIds, err := engineSvc.advanceToNextNode(context.Background(), wd, &split, tt.variables)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.expected, nextNodeIds)
+		})
+	}
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_InclusiveJoinSkipsInactiveBranches(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createInclusiveTestBPMN(), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+
+	// 只有邮件分支被激活：汇聚网关不等待短信分支，流程直接完成
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1",
+		map[string]interface{}{"emailOptIn": true, "smsOptIn": false})
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusCompleted, result.EngineResponse.Status)
+	assert.Empty(t, result.EngineResponse.CurrentNodeIds)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_InclusiveJoinWaitsForActiveBranches(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	ctx := newFullMockContext()
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createInclusiveTestBPMN(), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+
+	// 两个分支都被激活：邮件分支到达汇聚网关后等待仍在进行中的短信分支
+	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, "StartEvent_1",
+		map[string]interface{}{"emailOptIn": true, "smsOptIn": true})
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+	assert.ElementsMatch(t, []string{"UserTask_SMS", "Join_1"}, result.EngineResponse.CurrentNodeIds)
+
+	// 短信分支到达后汇聚网关触发，流程完成
+	result, err = engineSvc.ExecuteFromNode(ctx, workflow, instance, "Boundary_SMS", nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusCompleted, result.EngineResponse.Status)
+	assert.Empty(t, result.EngineResponse.CurrentNodeIds)
+}
+
+// createInclusiveLoopBPMN 汇聚型包容网关在循环中：审核时可以不中断审核直接要求返工，返工重新经过拆分网关
+func createInclusiveLoopBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1" name="Prepare And Review">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:inclusiveGateway id="Split_1">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:incoming>Flow_Rework</bpmn:incoming>
+      <bpmn:outgoing>Flow_A</bpmn:outgoing>
+      <bpmn:outgoing>Flow_B</bpmn:outgoing>
+    </bpmn:inclusiveGateway>
+    <bpmn:task id="Task_A">
+      <bpmn:incoming>Flow_A</bpmn:incoming>
+      <bpmn:outgoing>Flow_A_Join</bpmn:outgoing>
+    </bpmn:task>
+    <bpmn:userTask id="UserTask_B">
+      <bpmn:incoming>Flow_B</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:boundaryEvent id="Boundary_B" attachedToRef="UserTask_B">
+      <bpmn:outgoing>Flow_B_Join</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:inclusiveGateway id="Join_1">
+      <bpmn:incoming>Flow_A_Join</bpmn:incoming>
+      <bpmn:incoming>Flow_B_Join</bpmn:incoming>
+      <bpmn:outgoing>Flow_Review</bpmn:outgoing>
+    </bpmn:inclusiveGateway>
+    <bpmn:userTask id="UserTask_Review">
+      <bpmn:incoming>Flow_Review</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:boundaryEvent id="Boundary_Rework" attachedToRef="UserTask_Review" cancelActivity="false">
+      <bpmn:outgoing>Flow_Rework</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:boundaryEvent id="Boundary_Approve" attachedToRef="UserTask_Review">
+      <bpmn:outgoing>Flow_End</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_End</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Split_1"/>
+    <bpmn:sequenceFlow id="Flow_A" sourceRef="Split_1" targetRef="Task_A">
+      <bpmn:conditionExpression>needA == true</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_B" sourceRef="Split_1" targetRef="UserTask_B">
+      <bpmn:conditionExpression>needB == true</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_A_Join" sourceRef="Task_A" targetRef="Join_1"/>
+    <bpmn:sequenceFlow id="Flow_B_Join" sourceRef="Boundary_B" targetRef="Join_1"/>
+    <bpmn:sequenceFlow id="Flow_Review" sourceRef="Join_1" targetRef="UserTask_Review"/>
+    <bpmn:sequenceFlow id="Flow_Rework" sourceRef="Boundary_Rework" targetRef="Split_1"/>
+    <bpmn:sequenceFlow id="Flow_End" sourceRef="Boundary_Approve" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_InclusiveJoinInLoop(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	ctx := newFullMockContext()
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createInclusiveLoopBPMN(), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+
+	// 第一轮两个分支都被激活：Task_A 的令牌等待 UserTask_B
+	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, "StartEvent_1",
+		map[string]interface{}{"needA": true, "needB": true})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"UserTask_B", "Join_1"}, result.EngineResponse.CurrentNodeIds)
+
+	result, err = engineSvc.ExecuteFromNode(ctx, workflow, instance, "Boundary_B", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Review"}, result.EngineResponse.CurrentNodeIds)
+
+	// 审核中要求返工，只激活 Task_A：审核任务只能绕回拆分网关，不阻塞本轮合并
+	result, err = engineSvc.ExecuteFromNode(ctx, workflow, instance, "Boundary_Rework",
+		map[string]interface{}{"needA": true, "needB": false})
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+	assert.ElementsMatch(t, []string{"UserTask_Review", "UserTask_Review"}, result.EngineResponse.CurrentNodeIds)
+}
+
+func TestWorkflowEngineService_JoinInclusiveGateway_Loop(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	wd, err := parser.ParseBPMN(createInclusiveLoopBPMN())
+	require.NoError(t, err)
+	join := wd.Nodes["Join_1"]
+
+	// 仍在进行中的分支任务可以经过没有令牌的入边到达网关，需要等待
+	tokens := &tokenState{remaining: []string{"UserTask_B"}, joinFlowsLoaded: true}
+	assert.False(t, engineSvc.joinInclusiveGateway(wd, &join, tokens, "Flow_A_Join"))
+	assert.Equal(t, []string{"Join_1"}, tokens.parked)
+	assert.Equal(t, []string{"Flow_A_Join"}, tokens.joinFlows)
+
+	// UserTask_B 完成后合并，停在网关上的令牌和记录的入边一起移除
+	tokens.remaining = nil
+	assert.True(t, engineSvc.joinInclusiveGateway(wd, &join, tokens, "Flow_B_Join"))
+	assert.Empty(t, tokens.parked)
+	assert.Empty(t, tokens.joinFlows)
+
+	// 网关之后的审核任务只能经过拆分网关绕回，拆分网关能到达已有令牌的入边，不需要等待
+	tokens = &tokenState{remaining: []string{"UserTask_Review"}, joinFlowsLoaded: true}
+	assert.True(t, engineSvc.joinInclusiveGateway(wd, &join, tokens, "Flow_A_Join"))
+	assert.Equal(t, []string{"UserTask_Review"}, tokens.remaining)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_SubProcess(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1" name="SubProcess Test">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:subProcess id="SubProcess_1" name="Review">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:startEvent id="SubStart_1">
+        <bpmn:outgoing>SubFlow_1</bpmn:outgoing>
+      </bpmn:startEvent>
+      <bpmn:userTask id="SubUserTask_1" name="Approve">
+        <bpmn:incoming>SubFlow_1</bpmn:incoming>
+      </bpmn:userTask>
+      <bpmn:boundaryEvent id="SubBoundary_1" attachedToRef="SubUserTask_1">
+        <bpmn:outgoing>SubFlow_2</bpmn:outgoing>
+      </bpmn:boundaryEvent>
+      <bpmn:endEvent id="SubEnd_1">
+        <bpmn:incoming>SubFlow_2</bpmn:incoming>
+      </bpmn:endEvent>
+      <bpmn:sequenceFlow id="SubFlow_1" sourceRef="SubStart_1" targetRef="SubUserTask_1"/>
+      <bpmn:sequenceFlow id="SubFlow_2" sourceRef="SubBoundary_1" targetRef="SubEnd_1"/>
+    </bpmn:subProcess>
+    <bpmn:userTask id="UserTask_After" name="After SubProcess">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="SubProcess_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="SubProcess_1" targetRef="UserTask_After"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	ctx := newFullMockContext()
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: bpmnXML, Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+
+	// Entering the SubProcess runs its internal start event and parks at the inner UserTask
+	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, "StartEvent_1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"SubUserTask_1"}, result.EngineResponse.CurrentNodeIds)
+
+	// Reaching the inner EndEvent leaves the SubProcess towards its successor
+	result, err = engineSvc.ExecuteFromNode(ctx, workflow, instance, "SubBoundary_1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_After"}, result.EngineResponse.CurrentNodeIds)
+	assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_ServiceTaskMappings(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	var receivedParams map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&receivedParams)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"score": 85})
+	}))
+	defer server.Close()
+
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1" name="Risk Check">
+    <bpmn:serviceTask id="ServiceTask_Score" name="Score">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+      <bpmn:extensionElements>
+        <xflow:url value="` + server.URL + `"/>
+        <xflow:input source="customer.id" target="customerId"/>
+        <xflow:output source="body.score" target="riskScore"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:exclusiveGateway id="Gateway_1">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_High</bpmn:outgoing>
+      <bpmn:outgoing>Flow_Low</bpmn:outgoing>
+    </bpmn:exclusiveGateway>
+    <bpmn:userTask id="UserTask_Manual" name="Manual Review"/>
+    <bpmn:userTask id="UserTask_Auto" name="Auto Approve"/>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="ServiceTask_Score" targetRef="Gateway_1"/>
+    <bpmn:sequenceFlow id="Flow_High" sourceRef="Gateway_1" targetRef="UserTask_Manual">
+      <bpmn:conditionExpression>riskScore > 80</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_Low" sourceRef="Gateway_1" targetRef="UserTask_Auto">
+      <bpmn:conditionExpression>riskScore &lt;= 80</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: bpmnXML, Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"ServiceTask_Score"},
+	}
+
+	businessParams := map[string]interface{}{
+		"customer": map[string]interface{}{"id": "C-1"},
+	}
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "ServiceTask_Score", businessParams)
+
+	require.NoError(t, err)
+	assert.Equal(t, "C-1", receivedParams["customerId"])
+	assert.EqualValues(t, 85, result.EngineResponse.Variables["riskScore"])
+	assert.Equal(t, []string{"UserTask_Manual"}, result.EngineResponse.CurrentNodeIds)
+}
+
+// expectExecutionHistoryInsert mocks one execution history insert
+func expectExecutionHistoryInsert(mock sqlmock.Sqlmock, executionId string, nodeId string, errorMessage string) {
+	mock.ExpectQuery(`INSERT INTO execution_histories`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "execution_id", "node_id", "node_name", "node_type", "input_data", "output_data", "variables_before", "variables_after", "execution_time_ms", "error_message", "executed_at"}).
+			AddRow("history-id", executionId, nodeId, "", parser.NodeTypeServiceTask, []byte("{}"), []byte("{}"), []byte("{}"), []byte("{}"), 0, errorMessage, time.Now()))
+}
+
+func TestExecuteNode_ServiceTask_RetriesUntilSuccess(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success"})
+	}))
+	defer server.Close()
+
+	node := &models.Node{
+		Id:             "ServiceTask_1",
+		Type:           parser.NodeTypeServiceTask,
+		BusinessApiUrl: server.URL,
+		RetryPolicy: &models.RetryPolicy{
+			MaxAttempts:       3,
+			BackoffMs:         1,
+			BackoffMultiplier: 2,
+		},
+	}
+
+	// 每次尝试都会写入一条执行历史
+	expectExecutionHistoryInsert(mock, "exec-1", node.Id, "business API returned status 503")
+	expectExecutionHistoryInsert(mock, "exec-1", node.Id, "business API returned status 503")
+	expectExecutionHistoryInsert(mock, "exec-1", node.Id, "")
+
+	result, err := engineSvc.ExecuteNode(context.Background(), ExecuteNodeParams{
+		Node:        node,
+		ExecutionID: "exec-1",
+		Variables:   make(map[string]interface{}),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, http.StatusOK, result.BusinessResponse.StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecuteNode_ServiceTask_RetriesExhausted(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	node := &models.Node{
+		Id:             "ServiceTask_1",
+		Type:           parser.NodeTypeServiceTask,
+		BusinessApiUrl: server.URL,
+		RetryPolicy: &models.RetryPolicy{
+			MaxAttempts:          2,
+			BackoffMultiplier:    1,
+			RetryableStatusCodes: []int{http.StatusBadGateway},
+		},
+	}
+
+	result, err := engineSvc.ExecuteNode(context.Background(), ExecuteNodeParams{
+		Node:      node,
+		Variables: make(map[string]interface{}),
+	})
+
+	// 重试用尽时返回最后一次响应，由流程按业务错误处理
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusBadGateway, result.BusinessResponse.StatusCode)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_RetriesExhaustedErrorBoundary(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="ServiceTask_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+      <bpmn:extensionElements>
+        <xflow:url value="` + server.URL + `"/>
+        <xflow:retry maxAttempts="3" backoff="1ms"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:boundaryEvent id="Boundary_Unavailable" attachedToRef="ServiceTask_1">
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:errorEventDefinition/>
+    </bpmn:boundaryEvent>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:userTask id="UserTask_Manual">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="ServiceTask_1" targetRef="EndEvent_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Boundary_Unavailable" targetRef="UserTask_Manual"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: bpmnXML, Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"ServiceTask_1"},
+	}
+
+	// 重试用尽的 503 与没有重试策略时一样被错误边界事件捕获
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "ServiceTask_1", nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []string{"UserTask_Manual"}, result.EngineResponse.CurrentNodeIds)
+	assert.Equal(t, http.StatusServiceUnavailable, result.BusinessResponse.StatusCode)
+}
+
+func TestExecuteNode_ServiceTask_AttemptTimeout(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "success"})
+	}))
+	defer server.Close()
+
+	node := &models.Node{
+		Id:             "ServiceTask_1",
+		Type:           parser.NodeTypeServiceTask,
+		BusinessApiUrl: server.URL,
+		RetryPolicy: &models.RetryPolicy{
+			MaxAttempts:       2,
+			TimeoutMs:         50,
+			BackoffMultiplier: 1,
+		},
+	}
+
+	result, err := engineSvc.ExecuteNode(context.Background(), ExecuteNodeParams{
+		Node:      node,
+		Variables: make(map[string]interface{}),
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, http.StatusOK, result.BusinessResponse.StatusCode)
+}
+
+// createTimerTestBPMN creates a BPMN that waits on a timer catch event and has a timer boundary on a UserTask
+// UserTask 只能通过边界事件离开：Boundary_Replied 表示收到回复，Timer_Expire 表示超时
+func createTimerTestBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1" name="Reminder Journey">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:intermediateCatchEvent id="Timer_Wait" name="Wait 3 days">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:timerEventDefinition>
+        <bpmn:timeDuration>P3D</bpmn:timeDuration>
+      </bpmn:timerEventDefinition>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:userTask id="UserTask_Reply" name="Wait for Reply">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:boundaryEvent id="Boundary_Replied" attachedToRef="UserTask_Reply">
+      <bpmn:outgoing>Flow_3</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:boundaryEvent id="Timer_Expire" attachedToRef="UserTask_Reply">
+      <bpmn:outgoing>Flow_4</bpmn:outgoing>
+      <bpmn:timerEventDefinition>
+        <bpmn:timeDuration>P7D</bpmn:timeDuration>
+      </bpmn:timerEventDefinition>
+    </bpmn:boundaryEvent>
+    <bpmn:endEvent id="EndEvent_Replied">
+      <bpmn:incoming>Flow_3</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:endEvent id="EndEvent_Expired">
+      <bpmn:incoming>Flow_4</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Timer_Wait"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Timer_Wait" targetRef="UserTask_Reply"/>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="Boundary_Replied" targetRef="EndEvent_Replied"/>
+    <bpmn:sequenceFlow id="Flow_4" sourceRef="Timer_Expire" targetRef="EndEvent_Expired"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_TriggerNode_TimerCatchEvent(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createTimerTestBPMN(), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+
+	// 执行到定时器中间捕获事件后停留
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Timer_Wait"}, result.EngineResponse.CurrentNodeIds)
+
+	// 定时器触发后推进到 UserTask
+	result, err = engineSvc.TriggerNode(newFullMockContext(), workflow, instance, "Timer_Wait", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Reply"}, result.EngineResponse.CurrentNodeIds)
+
+	// 中断型定时器边界事件触发后，UserTask 的令牌被取消
+	result, err = engineSvc.TriggerNode(newFullMockContext(), workflow, instance, "Timer_Expire", nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.EngineResponse.CurrentNodeIds)
+	assert.Equal(t, models.InstanceStatusCompleted, result.EngineResponse.Status)
+}
+
+func TestTimerEventsForNode(t *testing.T) {
+	wd, err := parser.ParseBPMN(createTimerTestBPMN())
+	require.NoError(t, err)
+
+	catchTimers := timerEventsForNode(wd, "Timer_Wait")
+	require.Len(t, catchTimers, 1)
+	assert.Equal(t, "Timer_Wait", catchTimers[0].Id)
+
+	boundaryTimers := timerEventsForNode(wd, "UserTask_Reply")
+	require.Len(t, boundaryTimers, 1)
+	assert.Equal(t, "Timer_Expire", boundaryTimers[0].Id)
+
+	assert.Empty(t, timerEventsForNode(wd, "EndEvent_Replied"))
+}
+
+// createEventGatewayTestBPMN creates a BPMN where an EventBasedGateway waits for a message or a timeout
+func createEventGatewayTestBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:message id="Message_Paid" name="PaymentReceived"/>
+  <bpmn:process id="Process_1" name="Await Payment">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:eventBasedGateway id="Gateway_1">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_Paid</bpmn:outgoing>
+      <bpmn:outgoing>Flow_Timeout</bpmn:outgoing>
+    </bpmn:eventBasedGateway>
+    <bpmn:intermediateCatchEvent id="Catch_Paid">
+      <bpmn:incoming>Flow_Paid</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:messageEventDefinition messageRef="Message_Paid"/>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:intermediateCatchEvent id="Catch_Timeout">
+      <bpmn:incoming>Flow_Timeout</bpmn:incoming>
+      <bpmn:outgoing>Flow_3</bpmn:outgoing>
+      <bpmn:timerEventDefinition>
+        <bpmn:timeDuration>P1D</bpmn:timeDuration>
+      </bpmn:timerEventDefinition>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:endEvent id="EndEvent_Paid">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:endEvent id="EndEvent_Timeout">
+      <bpmn:incoming>Flow_3</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Gateway_1"/>
+    <bpmn:sequenceFlow id="Flow_Paid" sourceRef="Gateway_1" targetRef="Catch_Paid"/>
+    <bpmn:sequenceFlow id="Flow_Timeout" sourceRef="Gateway_1" targetRef="Catch_Timeout"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Catch_Paid" targetRef="EndEvent_Paid"/>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="Catch_Timeout" targetRef="EndEvent_Timeout"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestMessageEventsForNode_EventBasedGateway(t *testing.T) {
+	wd, err := parser.ParseBPMN(createEventGatewayTestBPMN())
+	require.NoError(t, err)
+
+	messages := messageEventsForNode(wd, "Gateway_1")
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Catch_Paid", messages[0].Id)
+	assert.Equal(t, "PaymentReceived", messageName(wd, &messages[0]))
+
+	timers := timerEventsForNode(wd, "Gateway_1")
+	require.Len(t, timers, 1)
+	assert.Equal(t, "Catch_Timeout", timers[0].Id)
+}
+
+func TestWorkflowEngineService_TriggerNode_EventBasedGatewayMessageWins(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createEventGatewayTestBPMN(), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Gateway_1"}, result.EngineResponse.CurrentNodeIds)
+
+	// 消息分支先到达：事件网关的令牌被消耗，超时分支不再等待
+	result, err = engineSvc.TriggerNode(newFullMockContext(), workflow, instance, "Catch_Paid", map[string]interface{}{"amount": 100})
+	require.NoError(t, err)
+	assert.Empty(t, result.EngineResponse.CurrentNodeIds)
+	assert.Equal(t, models.InstanceStatusCompleted, result.EngineResponse.Status)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_SuspendedInstance(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createTestBPMN(), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusSuspended,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+
+	_, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInstanceSuspended)
+
+	_, err = engineSvc.TriggerNode(newFullMockContext(), workflow, instance, "StartEvent_1", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInstanceSuspended)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_FinishedInstance(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createTestBPMN(), Status: models.StatusDraft}
+
+	// 取消后再执行：不占用实例、不调用业务接口，实例保持原状态
+	for _, status := range []string{models.InstanceStatusCancelled, models.InstanceStatusCompleted, models.InstanceStatusFailed} {
+		t.Run(status, func(t *testing.T) {
+			instance := &models.WorkflowInstance{
+				Id:              "test-instance-id",
+				WorkflowId:      workflow.Id,
+				Status:          status,
+				CurrentNodeIds:  []string{"StartEvent_1"},
+				InstanceVersion: 3,
+			}
+
+			result, err := engineSvc.ExecuteFromNode(context.Background(), workflow, instance, "StartEvent_1", nil)
+			require.Error(t, err)
+			assert.Nil(t, result)
+			assert.Contains(t, err.Error(), models.ErrInvalidInstanceState)
+			assert.Equal(t, status, instance.Status)
+		})
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_VersionConflict(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createTestBPMN(), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:              "test-instance-id",
+		WorkflowId:      workflow.Id,
+		Status:          models.InstanceStatusRunning,
+		CurrentNodeIds:  []string{"StartEvent_1"},
+		InstanceVersion: 1,
+	}
+
+	// 另一个请求已经推进了实例：占用版本失败，不创建执行记录也不执行任何节点
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instance.Id, 1).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids`).
+		WithArgs(instance.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instance.Id, workflow.Id, "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"EndEvent_1"}), 2, 0, now, now))
+
+	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, "StartEvent_1", nil)
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), models.ErrInstanceVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_InstanceClaimedByAnotherExecution(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createTestBPMN(), Status: models.StatusDraft}
+	// 第一个执行已经占用实例（版本 1 -> 2）但还没有完成最终更新，第二个执行读到的是占用后的版本
+	instance := &models.WorkflowInstance{
+		Id:              "test-instance-id",
+		WorkflowId:      workflow.Id,
+		Status:          models.InstanceStatusRunning,
+		CurrentNodeIds:  []string{"StartEvent_1"},
+		InstanceVersion: 2,
+	}
+
+	// 版本相同但执行租约仍然有效：占用被拒绝，不创建执行记录也不执行任何节点
+	mock.ExpectQuery(`UPDATE workflow_instances .* AND instance_version = \$5 AND \(execution_lease_until IS NULL OR execution_lease_until < \$1\)`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instance.Id, 2).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids`).
+		WithArgs(instance.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instance.Id, workflow.Id, "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"StartEvent_1"}), 2, 0, now, now))
+
+	result, err := engineSvc.ExecuteFromNode(ctx, workflow, instance, "StartEvent_1", nil)
+	require.Error(t, err)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), "is being executed by another request")
+	assert.True(t, strings.HasPrefix(err.Error(), models.ErrInstanceVersionConflict))
+	// 占用时的冲突可以重试，最终更新的冲突不能
+	assert.True(t, IsClaimConflict(err))
+	assert.False(t, IsClaimConflict(fmt.Errorf("%s: workflow instance was modified concurrently", models.ErrInstanceVersionConflict)))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_StartInstance(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", Name: "Parallel Review", BpmnXml: createParallelTestBPMN(), Status: models.StatusDraft}
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT version FROM workflow_versions WHERE workflow_id = \$1 AND is_active`).
+		WithArgs(workflow.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery(`INSERT INTO workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), workflow.Id, "Parallel Review", models.InstanceStatusPending, pq.Array([]string{}), 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow("test-instance-id", workflow.Id, "Parallel Review", models.InstanceStatusPending, pq.Array([]string{}), 1, 0, now, now))
+
+	instance, result, err := engineSvc.StartInstance(newFullMockContext(), workflow, "", "", map[string]interface{}{"amount": 100})
+
+	require.NoError(t, err)
+	assert.Equal(t, "test-instance-id", instance.Id)
+	assert.Equal(t, models.InstanceStatusRunning, instance.Status)
+	assert.Equal(t, result.EngineResponse.CurrentNodeIds, instance.CurrentNodeIds)
+	assert.Equal(t, 100, result.EngineResponse.Variables["amount"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_StartInstance_InvalidStartNode(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createTestBPMN(), Status: models.StatusDraft}
+
+	mock.ExpectQuery(`SELECT version FROM workflow_versions WHERE workflow_id = \$1 AND is_active`).
+		WithArgs(workflow.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+
+	_, _, err := engineSvc.StartInstance(newFullMockContext(), workflow, "", "ServiceTask_1", nil)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInvalidNodeId)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// createPaymentErrorTestBPMN 子流程内的 ServiceTask 带业务错误映射，任务上的错误边界事件捕获拒付，
+// 子流程上的错误边界事件捕获其他所有错误
+func createPaymentErrorTestBPMN(serviceURL string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:error id="Error_Declined" name="Payment Declined" errorCode="PAYMENT_DECLINED"/>
+  <bpmn:process id="Process_1" name="Checkout">
+    <bpmn:subProcess id="SubProcess_Payment" name="Payment">
+      <bpmn:outgoing>Flow_Done</bpmn:outgoing>
+      <bpmn:startEvent id="StartEvent_Sub">
+        <bpmn:outgoing>Flow_1</bpmn:outgoing>
+      </bpmn:startEvent>
+      <bpmn:serviceTask id="ServiceTask_Charge" name="Charge">
+        <bpmn:incoming>Flow_1</bpmn:incoming>
+        <bpmn:outgoing>Flow_2</bpmn:outgoing>
+        <bpmn:extensionElements>
+          <xflow:url value="` + serviceURL + `"/>
+          <xflow:error code="PAYMENT_DECLINED" when="statusCode == 402"/>
+          <xflow:error code="PAYMENT_DECLINED" when="body.status == 'DECLINED'"/>
+        </bpmn:extensionElements>
+      </bpmn:serviceTask>
+      <bpmn:boundaryEvent id="Boundary_Declined" attachedToRef="ServiceTask_Charge">
+        <bpmn:outgoing>Flow_3</bpmn:outgoing>
+        <bpmn:errorEventDefinition errorRef="Error_Declined"/>
+      </bpmn:boundaryEvent>
+      <bpmn:userTask id="UserTask_UpdateCard" name="Update Card">
+        <bpmn:incoming>Flow_3</bpmn:incoming>
+      </bpmn:userTask>
+      <bpmn:endEvent id="EndEvent_Sub">
+        <bpmn:incoming>Flow_2</bpmn:incoming>
+      </bpmn:endEvent>
+      <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_Sub" targetRef="ServiceTask_Charge"/>
+      <bpmn:sequenceFlow id="Flow_2" sourceRef="ServiceTask_Charge" targetRef="EndEvent_Sub"/>
+      <bpmn:sequenceFlow id="Flow_3" sourceRef="Boundary_Declined" targetRef="UserTask_UpdateCard"/>
+    </bpmn:subProcess>
+    <bpmn:boundaryEvent id="Boundary_PaymentFailed" attachedToRef="SubProcess_Payment">
+      <bpmn:outgoing>Flow_Failed</bpmn:outgoing>
+      <bpmn:errorEventDefinition/>
+    </bpmn:boundaryEvent>
+    <bpmn:userTask id="UserTask_Ship" name="Ship">
+      <bpmn:incoming>Flow_Done</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:userTask id="UserTask_Manual" name="Manual Payment">
+      <bpmn:incoming>Flow_Failed</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:sequenceFlow id="Flow_Done" sourceRef="SubProcess_Payment" targetRef="UserTask_Ship"/>
+    <bpmn:sequenceFlow id="Flow_Failed" sourceRef="Boundary_PaymentFailed" targetRef="UserTask_Manual"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_ServiceTaskErrorBoundary(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       map[string]interface{}
+		expected   []string
+	}{
+		{name: "success leaves subprocess", statusCode: http.StatusOK, body: map[string]interface{}{"status": "CHARGED"}, expected: []string{"UserTask_Ship"}},
+		{name: "status mapped to error code", statusCode: http.StatusPaymentRequired, body: map[string]interface{}{}, expected: []string{"UserTask_UpdateCard"}},
+		{name: "body mapped to error code", statusCode: http.StatusOK, body: map[string]interface{}{"status": "DECLINED"}, expected: []string{"UserTask_UpdateCard"}},
+		// 未映射的 5xx 以状态码作为错误码，由子流程上捕获所有错误的边界事件处理
+		{name: "unmapped status caught by subprocess", statusCode: http.StatusInternalServerError, body: map[string]interface{}{}, expected: []string{"UserTask_Manual"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+			defer cleanup()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.statusCode)
+				json.NewEncoder(w).Encode(tt.body)
+			}))
+			defer server.Close()
+
+			workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createPaymentErrorTestBPMN(server.URL), Status: models.StatusDraft}
+			instance := &models.WorkflowInstance{
+				Id:             "test-instance-id",
+				WorkflowId:     workflow.Id,
+				Status:         models.InstanceStatusRunning,
+				CurrentNodeIds: []string{"ServiceTask_Charge"},
+			}
+
+			result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "ServiceTask_Charge", nil)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.EngineResponse.CurrentNodeIds)
+			assert.Equal(t, tt.statusCode, result.BusinessResponse.StatusCode)
+		})
+	}
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_UncaughtServiceTaskError(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:serviceTask id="ServiceTask_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+      <bpmn:extensionElements>
+        <xflow:url value="` + server.URL + `"/>
+      </bpmn:extensionElements>
+    </bpmn:serviceTask>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="ServiceTask_1" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: bpmnXML, Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"ServiceTask_1"},
+	}
+
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "ServiceTask_1", nil)
+
+	require.Error(t, err)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), models.ErrUnhandledBpmnError)
+	assert.Contains(t, err.Error(), "error 503")
+}
+
+// createErrorEndEventTestBPMN 子流程内并行分支中的错误结束事件抛出错误，由子流程上的错误边界事件捕获
+func createErrorEndEventTestBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:error id="Error_Invalid" errorCode="INVALID_ORDER"/>
+  <bpmn:process id="Process_1" name="Order Check">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:subProcess id="SubProcess_Check">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_Done</bpmn:outgoing>
+      <bpmn:startEvent id="StartEvent_Sub">
+        <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      </bpmn:startEvent>
+      <bpmn:parallelGateway id="Fork_1">
+        <bpmn:incoming>Flow_2</bpmn:incoming>
+        <bpmn:outgoing>Flow_3</bpmn:outgoing>
+        <bpmn:outgoing>Flow_4</bpmn:outgoing>
+      </bpmn:parallelGateway>
+      <bpmn:userTask id="UserTask_Review">
+        <bpmn:incoming>Flow_3</bpmn:incoming>
+      </bpmn:userTask>
+      <bpmn:exclusiveGateway id="Gateway_Valid" default="Flow_Valid">
+        <bpmn:incoming>Flow_4</bpmn:incoming>
+        <bpmn:outgoing>Flow_Valid</bpmn:outgoing>
+        <bpmn:outgoing>Flow_Invalid</bpmn:outgoing>
+      </bpmn:exclusiveGateway>
+      <bpmn:endEvent id="EndEvent_Sub">
+        <bpmn:incoming>Flow_Valid</bpmn:incoming>
+      </bpmn:endEvent>
+      <bpmn:endEvent id="ErrorEnd_Invalid">
+        <bpmn:incoming>Flow_Invalid</bpmn:incoming>
+        <bpmn:errorEventDefinition errorRef="Error_Invalid"/>
+      </bpmn:endEvent>
+      <bpmn:sequenceFlow id="Flow_2" sourceRef="StartEvent_Sub" targetRef="Fork_1"/>
+      <bpmn:sequenceFlow id="Flow_3" sourceRef="Fork_1" targetRef="UserTask_Review"/>
+      <bpmn:sequenceFlow id="Flow_4" sourceRef="Fork_1" targetRef="Gateway_Valid"/>
+      <bpmn:sequenceFlow id="Flow_Valid" sourceRef="Gateway_Valid" targetRef="EndEvent_Sub"/>
+      <bpmn:sequenceFlow id="Flow_Invalid" sourceRef="Gateway_Valid" targetRef="ErrorEnd_Invalid">
+        <bpmn:conditionExpression>valid == false</bpmn:conditionExpression>
+      </bpmn:sequenceFlow>
+    </bpmn:subProcess>
+    <bpmn:boundaryEvent id="Boundary_Any" attachedToRef="SubProcess_Check">
+      <bpmn:outgoing>Flow_Any</bpmn:outgoing>
+      <bpmn:errorEventDefinition/>
+    </bpmn:boundaryEvent>
+    <bpmn:boundaryEvent id="Boundary_Invalid" attachedToRef="SubProcess_Check">
+      <bpmn:outgoing>Flow_Fix</bpmn:outgoing>
+      <bpmn:errorEventDefinition errorRef="Error_Invalid"/>
+    </bpmn:boundaryEvent>
+    <bpmn:userTask id="UserTask_Fix">
+      <bpmn:incoming>Flow_Fix</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:userTask id="UserTask_Manual">
+      <bpmn:incoming>Flow_Any</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:userTask id="UserTask_Done">
+      <bpmn:incoming>Flow_Done</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="SubProcess_Check"/>
+    <bpmn:sequenceFlow id="Flow_Done" sourceRef="SubProcess_Check" targetRef="UserTask_Done"/>
+    <bpmn:sequenceFlow id="Flow_Fix" sourceRef="Boundary_Invalid" targetRef="UserTask_Fix"/>
+    <bpmn:sequenceFlow id="Flow_Any" sourceRef="Boundary_Any" targetRef="UserTask_Manual"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_ErrorEndEvent(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createErrorEndEventTestBPMN(), Status: models.StatusDraft}
+
+	// 错误码匹配的边界事件优先于捕获所有错误的边界事件，子流程内仍在等待的令牌被取消
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", map[string]interface{}{"valid": false})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Fix"}, result.EngineResponse.CurrentNodeIds)
+
+	// 没有抛出错误时，子流程等待其余分支完成
+	instance = &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"StartEvent_1"},
+	}
+	result, err = engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", map[string]interface{}{"valid": true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Review"}, result.EngineResponse.CurrentNodeIds)
+}
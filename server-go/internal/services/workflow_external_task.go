@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+)
+
+// isExternalTask checks whether the node is a service task executed by external workers
+func isExternalTask(node models.Node) bool {
+	return node.Type == parser.NodeTypeServiceTask && node.ExternalTopic != ""
+}
+
+// syncExternalTasks creates external tasks for tokens newly parked at external service tasks and cancels tasks whose token has left
+// 任务记录失败只输出日志，不影响流程执行
+func (s *WorkflowEngineService) syncExternalTasks(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	workflowId string,
+	instanceId string,
+	parkedNodeIds []string,
+	currentNodeIds []string,
+	variables map[string]interface{},
+) {
+	if !hasWaitingEvents(wd, isExternalTask) {
+		return
+	}
+
+	if _, err := s.externalTaskSvc.CancelStaleExternalTasks(ctx, instanceId, currentNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale external tasks")
+	}
+
+	for _, nodeId := range parkedNodeIds {
+		node := wd.Nodes[nodeId]
+		if !isExternalTask(node) {
+			continue
+		}
+		err := s.externalTaskSvc.CreateExternalTask(ctx, &models.ExternalTask{
+			InstanceId: instanceId,
+			WorkflowId: workflowId,
+			NodeId:     nodeId,
+			Topic:      node.ExternalTopic,
+			Variables:  variables,
+		})
+		if err != nil {
+			s.logger.Warn().Err(err).Str("instanceId", instanceId).Str("nodeId", nodeId).Msg("Failed to create external task")
+		}
+	}
+}
+
+// externalTaskNodeIds returns the node IDs that are external service tasks in the definition
+func externalTaskNodeIds(wd *models.WorkflowDefinition, nodeIds []string) []string {
+	external := []string{}
+	for _, nodeId := range nodeIds {
+		if isExternalTask(wd.Nodes[nodeId]) {
+			external = append(external, nodeId)
+		}
+	}
+	return external
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createExternalTaskBPMN 信用评分由防火墙后的工作者拉取执行
+func createExternalTaskBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1" name="Credit Check">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:serviceTask id="ServiceTask_Score" name="Score Applicant" type="external" topic="credit-scoring">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+    </bpmn:serviceTask>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="ServiceTask_Score"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="ServiceTask_Score" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+// setupExternalTaskCompletionTest creates a completion service sharing the engine's mocked database
+func setupExternalTaskCompletionTest(t *testing.T) (*ExternalTaskCompletionService, sqlmock.Sqlmock, func()) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Credit Check", BpmnXml: createExternalTaskBPMN(), Status: models.StatusDraft}
+	engineSvc.workflowSvc.SetWorkflowInMemory(workflow)
+
+	service := NewExternalTaskCompletionService(engineSvc.db, engineSvc.logger, engineSvc.workflowSvc, engineSvc.instanceSvc, engineSvc)
+	return service, mock, cleanup
+}
+
+// expectExternalTaskInstance mocks loading instance-1 waiting at the scoring task
+func expectExternalTaskInstance(mock sqlmock.Sqlmock, status string) {
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow("instance-1", "workflow-1", "Credit Check", status, pq.Array([]string{"ServiceTask_Score"}), 3, 0, now, now))
+}
+
+func TestWorkflowEngineService_ExternalTaskParksToken(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	instanceId := "instance-1"
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Credit Check", BpmnXml: createExternalTaskBPMN(), Status: models.StatusActive}
+
+	expectAsyncExecution(mock, instanceId, workflow.Id, `{"applicant":"a-1"}`, []string{"StartEvent_1"},
+		[]string{"StartEvent_1", "ServiceTask_Score"}, models.InstanceStatusRunning, []string{"ServiceTask_Score"})
+	mock.ExpectExec(`UPDATE external_tasks`).
+		WithArgs(models.ExternalTaskStatusCancelled, sqlmock.AnyArg(), instanceId,
+			models.ExternalTaskStatusPending, models.ExternalTaskStatusFailed, pq.Array([]string{"ServiceTask_Score"})).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO external_tasks`).
+		WithArgs(sqlmock.AnyArg(), instanceId, workflow.Id, "ServiceTask_Score", "credit-scoring", `{"applicant":"a-1"}`,
+			models.ExternalTaskStatusPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	instance := &models.WorkflowInstance{Id: instanceId, WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_1"}, InstanceVersion: 1}
+	result, err := engineSvc.ExecuteFromNode(context.Background(), workflow, instance, "StartEvent_1", map[string]interface{}{"applicant": "a-1"})
+
+	// 外部任务不调用业务接口，令牌停在节点上等待工作者完成
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusRunning, result.EngineResponse.Status)
+	assert.Equal(t, []string{"ServiceTask_Score"}, result.EngineResponse.CurrentNodeIds)
+	assert.Nil(t, result.BusinessResponse)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExternalTaskCompletionService_CompleteTask(t *testing.T) {
+	service, mock, cleanup := setupExternalTaskCompletionTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT (.+) FROM external_tasks WHERE id = \$1`).
+		WithArgs("task-1").
+		WillReturnRows(externalTaskRow(models.ExternalTaskStatusPending, "scorer-1"))
+	expectExternalTaskInstance(mock, models.InstanceStatusRunning)
+	mock.ExpectQuery(`UPDATE external_tasks SET status = \$4`).
+		WithArgs("task-1", "scorer-1", sqlmock.AnyArg(), models.ExternalTaskStatusCompleted, models.ExternalTaskStatusPending).
+		WillReturnRows(externalTaskRow(models.ExternalTaskStatusCompleted, "scorer-1"))
+
+	completion, err := service.CompleteTask(newFullMockContext(), "task-1", CompleteExternalTaskRequest{
+		WorkerId:  "scorer-1",
+		Variables: map[string]interface{}{"score": 720},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, models.ExternalTaskStatusCompleted, completion.Task.Status)
+	assert.Equal(t, models.InstanceStatusCompleted, completion.EngineResponse.Status)
+	// 创建任务时的变量与工作者返回的变量合并
+	assert.Equal(t, "a-1", completion.EngineResponse.Variables["applicant"])
+	assert.Equal(t, 720, completion.EngineResponse.Variables["score"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExternalTaskCompletionService_CompleteTask_ReopensWhenInstanceRejects(t *testing.T) {
+	service, mock, cleanup := setupExternalTaskCompletionTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT (.+) FROM external_tasks WHERE id = \$1`).
+		WithArgs("task-1").
+		WillReturnRows(externalTaskRow(models.ExternalTaskStatusPending, "scorer-1"))
+	expectExternalTaskInstance(mock, models.InstanceStatusSuspended)
+	mock.ExpectQuery(`UPDATE external_tasks SET status = \$4`).
+		WillReturnRows(externalTaskRow(models.ExternalTaskStatusCompleted, "scorer-1"))
+	// 挂起的实例拒绝推进，任务恢复为未锁定的待处理状态
+	mock.ExpectExec(`UPDATE external_tasks SET status = \$1, worker_id = NULL`).
+		WithArgs(models.ExternalTaskStatusPending, sqlmock.AnyArg(), "task-1", models.ExternalTaskStatusCompleted).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	completion, err := service.CompleteTask(newFullMockContext(), "task-1", CompleteExternalTaskRequest{WorkerId: "scorer-1"})
+
+	require.Error(t, err)
+	assert.Nil(t, completion)
+	assert.Contains(t, err.Error(), models.ErrInstanceSuspended)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -28,6 +28,7 @@ func NewWorkflowInstanceService(db *database.Database, logger *zerolog.Logger) *
 }
 
 // CreateWorkflowInstance creates a new workflow instance
+// 实例固定在流程当前的激活版本上，流程未部署时 workflow_version 为空
 func (s *WorkflowInstanceService) CreateWorkflowInstance(ctx context.Context, workflowId, name string) (*models.WorkflowInstance, error) {
 	if s.db.DB == nil {
 		return nil, fmt.Errorf("database not available")
@@ -38,9 +39,10 @@ func (s *WorkflowInstanceService) CreateWorkflowInstance(ctx context.Context, wo
 
 	// Insert into database
 	query := `
-		INSERT INTO workflow_instances (id, workflow_id, name, status, current_node_ids, instance_version, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, workflow_id, name, status, current_node_ids, instance_version, created_at, updated_at
+		INSERT INTO workflow_instances (id, workflow_id, name, status, current_node_ids, instance_version, workflow_version, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6,
+		        (SELECT version FROM workflow_versions WHERE workflow_id = $2 AND is_active), $7, $8)
+		RETURNING id, workflow_id, name, status, current_node_ids, instance_version, COALESCE(workflow_version, 0), created_at, updated_at
 	`
 
 	now := time.Now()
@@ -55,6 +57,7 @@ func (s *WorkflowInstanceService) CreateWorkflowInstance(ctx context.Context, wo
 		&instance.Status,
 		pq.Array(&instance.CurrentNodeIds),
 		&instance.InstanceVersion,
+		&instance.WorkflowVersion,
 		&instance.CreatedAt,
 		&instance.UpdatedAt,
 	)
@@ -82,7 +85,7 @@ func (s *WorkflowInstanceService) GetWorkflowInstanceByID(ctx context.Context, i
 	}
 
 	query := `
-		SELECT id, workflow_id, name, status, current_node_ids, instance_version, created_at, updated_at
+		SELECT id, workflow_id, name, status, current_node_ids, instance_version, COALESCE(workflow_version, 0), created_at, updated_at
 		FROM workflow_instances
 		WHERE id = $1
 	`
@@ -96,6 +99,7 @@ func (s *WorkflowInstanceService) GetWorkflowInstanceByID(ctx context.Context, i
 		&instance.Status,
 		pq.Array(&instance.CurrentNodeIds),
 		&instance.InstanceVersion,
+		&instance.WorkflowVersion,
 		&instance.CreatedAt,
 		&instance.UpdatedAt,
 	)
@@ -112,8 +116,132 @@ func (s *WorkflowInstanceService) GetWorkflowInstanceByID(ctx context.Context, i
 	return &instance, nil
 }
 
+// instanceLease describes what an instance update does with the execution lease
+type instanceLease int
+
+const (
+	leaseKeep    instanceLease = iota // 不改变租约
+	leaseClaim                        // 租约有效时拒绝更新，否则为本次执行设置新的租约
+	leaseRelease                      // 更新的同时释放租约
+)
+
+// instanceLeaseDuration 执行租约的有效期，执行期间持有方定期续约，执行方崩溃时租约到期后实例可以被重新占用
+const instanceLeaseDuration = 2 * time.Minute
+
 // UpdateWorkflowInstance updates a workflow instance
-func (s *WorkflowInstanceService) UpdateWorkflowInstance(ctx context.Context, instanceID string, status string, currentNodeIds []string) (*models.WorkflowInstance, error) {
+// expectedVersion 大于 0 时仅在 instance_version 与之相同时更新，否则返回版本冲突错误
+func (s *WorkflowInstanceService) UpdateWorkflowInstance(ctx context.Context, instanceID string, status string, currentNodeIds []string, expectedVersion int) (*models.WorkflowInstance, error) {
+	return s.updateWorkflowInstance(ctx, instanceID, status, currentNodeIds, expectedVersion, leaseKeep)
+}
+
+// ClaimWorkflowInstance updates the instance at expectedVersion and takes the execution lease for the caller
+// 其他执行持有有效租约时同样返回版本冲突错误，占用成功后其他执行在租约释放或到期前无法占用实例
+func (s *WorkflowInstanceService) ClaimWorkflowInstance(ctx context.Context, instanceID string, status string, currentNodeIds []string, expectedVersion int) (*models.WorkflowInstance, error) {
+	return s.updateWorkflowInstance(ctx, instanceID, status, currentNodeIds, expectedVersion, leaseClaim)
+}
+
+// ReleaseWorkflowInstance updates the instance at the end of an execution and releases the execution lease
+func (s *WorkflowInstanceService) ReleaseWorkflowInstance(ctx context.Context, instanceID string, status string, currentNodeIds []string, expectedVersion int) (*models.WorkflowInstance, error) {
+	return s.updateWorkflowInstance(ctx, instanceID, status, currentNodeIds, expectedVersion, leaseRelease)
+}
+
+// RenewInstanceLease extends the execution lease held at the claimed version
+// 实例已被其他请求修改或租约已释放时返回版本冲突错误
+func (s *WorkflowInstanceService) RenewInstanceLease(ctx context.Context, instanceID string, version int) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE workflow_instances
+		SET execution_lease_until = $1
+		WHERE id = $2 AND instance_version = $3 AND execution_lease_until IS NOT NULL
+	`
+
+	result, err := s.db.ExecContext(ctx, query, time.Now().Add(instanceLeaseDuration), instanceID, version)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceID).Msg("Failed to renew execution lease")
+		return fmt.Errorf("failed to renew execution lease: %w", err)
+	}
+	if renewed, _ := result.RowsAffected(); renewed == 0 {
+		return fmt.Errorf("%s: execution lease of workflow instance %s at version %d is no longer held", models.ErrInstanceVersionConflict, instanceID, version)
+	}
+	return nil
+}
+
+// DropInstanceLease releases the execution lease held at the claimed version without changing the instance
+// 执行在最终更新前中止时使用，实例已被其他请求修改时不做任何事
+func (s *WorkflowInstanceService) DropInstanceLease(ctx context.Context, instanceID string, version int) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE workflow_instances
+		SET execution_lease_until = NULL
+		WHERE id = $1 AND instance_version = $2
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, instanceID, version); err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceID).Msg("Failed to drop execution lease")
+		return fmt.Errorf("failed to drop execution lease: %w", err)
+	}
+	return nil
+}
+
+// GetJoinFlowIds returns the incoming flows of the tokens waiting at converging parallel gateways of the instance
+func (s *WorkflowInstanceService) GetJoinFlowIds(ctx context.Context, instanceID string) ([]string, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	var flowIds pq.StringArray
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(join_flow_ids, '{}') FROM workflow_instances WHERE id = $1`, instanceID,
+	).Scan(&flowIds)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s: %s", models.ErrWorkflowInstanceNotFound, "workflow instance not found")
+		}
+		s.logger.Error().Err(err).Str("instanceId", instanceID).Msg("Failed to get join flows")
+		return nil, fmt.Errorf("failed to get join flows: %w", err)
+	}
+	return flowIds, nil
+}
+
+// SetJoinFlowIds stores the incoming flows of the tokens waiting at converging parallel gateways
+// 只在占用的版本上写入：执行在持有执行租约期间、最终更新之前调用，实例已被其他请求修改时返回版本冲突错误
+func (s *WorkflowInstanceService) SetJoinFlowIds(ctx context.Context, instanceID string, version int, flowIds []string) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE workflow_instances
+		SET join_flow_ids = $1
+		WHERE id = $2 AND instance_version = $3
+	`
+
+	result, err := s.db.ExecContext(ctx, query, pq.Array(flowIds), instanceID, version)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceID).Msg("Failed to set join flows")
+		return fmt.Errorf("failed to set join flows: %w", err)
+	}
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return fmt.Errorf("%s: workflow instance %s was modified (expected version %d)", models.ErrInstanceVersionConflict, instanceID, version)
+	}
+	return nil
+}
+
+// updateWorkflowInstance updates a workflow instance and handles the execution lease
+func (s *WorkflowInstanceService) updateWorkflowInstance(
+	ctx context.Context,
+	instanceID string,
+	status string,
+	currentNodeIds []string,
+	expectedVersion int,
+	lease instanceLease,
+) (*models.WorkflowInstance, error) {
 	if s.db.DB == nil {
 		return nil, fmt.Errorf("database not available")
 	}
@@ -138,11 +266,29 @@ func (s *WorkflowInstanceService) UpdateWorkflowInstance(ctx context.Context, in
 		argIndex++
 	}
 
+	switch lease {
+	case leaseClaim:
+		query += fmt.Sprintf(", execution_lease_until = $1::timestamptz + interval '%d seconds'", int(instanceLeaseDuration.Seconds()))
+	case leaseRelease:
+		query += ", execution_lease_until = NULL"
+	}
+
 	query += fmt.Sprintf(`
-		WHERE id = $%d
-		RETURNING id, workflow_id, name, status, current_node_ids, instance_version, created_at, updated_at
-	`, argIndex)
+		WHERE id = $%d`, argIndex)
 	args = append(args, instanceID)
+	argIndex++
+
+	if expectedVersion > 0 {
+		query += fmt.Sprintf(" AND instance_version = $%d", argIndex)
+		args = append(args, expectedVersion)
+	}
+	if lease == leaseClaim {
+		query += " AND (execution_lease_until IS NULL OR execution_lease_until < $1)"
+	}
+
+	query += `
+		RETURNING id, workflow_id, name, status, current_node_ids, instance_version, COALESCE(workflow_version, 0), created_at, updated_at
+	`
 
 	var instance models.WorkflowInstance
 
@@ -153,12 +299,35 @@ func (s *WorkflowInstanceService) UpdateWorkflowInstance(ctx context.Context, in
 		&instance.Status,
 		pq.Array(&instance.CurrentNodeIds),
 		&instance.InstanceVersion,
+		&instance.WorkflowVersion,
 		&instance.CreatedAt,
 		&instance.UpdatedAt,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
+			if expectedVersion > 0 {
+				// 没有更新任何行：区分实例不存在与版本已被其他请求修改
+				current, getErr := s.GetWorkflowInstanceByID(ctx, instanceID)
+				if getErr != nil {
+					return nil, getErr
+				}
+				if lease == leaseClaim && current.InstanceVersion == expectedVersion {
+					s.logger.Warn().
+						Str("instanceId", instanceID).
+						Int("version", expectedVersion).
+						Msg("Workflow instance is being executed by another request")
+					return nil, fmt.Errorf("%s: workflow instance %s is being executed by another request (version %d)",
+						models.ErrInstanceVersionConflict, instanceID, expectedVersion)
+				}
+				s.logger.Warn().
+					Str("instanceId", instanceID).
+					Int("expectedVersion", expectedVersion).
+					Int("currentVersion", current.InstanceVersion).
+					Msg("Workflow instance version conflict")
+				return nil, fmt.Errorf("%s: workflow instance %s was modified concurrently (expected version %d, current version %d)",
+					models.ErrInstanceVersionConflict, instanceID, expectedVersion, current.InstanceVersion)
+			}
 			s.logger.Warn().Str("instanceId", instanceID).Msg("Workflow instance not found")
 			return nil, fmt.Errorf("%s: %s", models.ErrWorkflowInstanceNotFound, "workflow instance not found")
 		}
@@ -170,3 +339,313 @@ func (s *WorkflowInstanceService) UpdateWorkflowInstance(ctx context.Context, in
 	return &instance, nil
 }
 
+// WorkflowInstanceFilter holds the optional filters for listing workflow instances
+type WorkflowInstanceFilter struct {
+	WorkflowId    string
+	Status        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// ListWorkflowInstances lists workflow instances matching the filter with pagination
+func (s *WorkflowInstanceService) ListWorkflowInstances(
+	ctx context.Context,
+	filter WorkflowInstanceFilter,
+	page, pageSize int,
+) ([]models.WorkflowInstance, *models.Metadata, error) {
+	if s.db.DB == nil {
+		return nil, nil, fmt.Errorf("database not available")
+	}
+
+	// Default pagination
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	// 按提供的条件拼接 WHERE 子句
+	where := " WHERE 1=1"
+	var args []interface{}
+	if filter.WorkflowId != "" {
+		args = append(args, filter.WorkflowId)
+		where += fmt.Sprintf(" AND workflow_id = $%d", len(args))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		where += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if filter.CreatedBefore != nil {
+		args = append(args, *filter.CreatedBefore)
+		where += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_instances`+where, args...).Scan(&total); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to count workflow instances")
+		return nil, nil, fmt.Errorf("failed to count workflow instances: %w", err)
+	}
+
+	query := `
+		SELECT id, workflow_id, name, status, current_node_ids, instance_version, COALESCE(workflow_version, 0), created_at, updated_at
+		FROM workflow_instances` + where + fmt.Sprintf(`
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, len(args)+1, len(args)+2)
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list workflow instances")
+		return nil, nil, fmt.Errorf("failed to list workflow instances: %w", err)
+	}
+	defer rows.Close()
+
+	instances := []models.WorkflowInstance{}
+	for rows.Next() {
+		var instance models.WorkflowInstance
+		if err := rows.Scan(
+			&instance.Id,
+			&instance.WorkflowId,
+			&instance.Name,
+			&instance.Status,
+			pq.Array(&instance.CurrentNodeIds),
+			&instance.InstanceVersion,
+			&instance.WorkflowVersion,
+			&instance.CreatedAt,
+			&instance.UpdatedAt,
+		); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to scan workflow instance")
+			return nil, nil, fmt.Errorf("failed to scan workflow instance: %w", err)
+		}
+		instances = append(instances, instance)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to iterate workflow instances: %w", err)
+	}
+
+	metadata := &models.Metadata{
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		HasMore:  page*pageSize < total,
+	}
+
+	return instances, metadata, nil
+}
+
+// CancelWorkflowInstance cancels an active or suspended instance, its pending timers, message and signal subscriptions, user tasks, jobs and external tasks, and its child instances
+func (s *WorkflowInstanceService) CancelWorkflowInstance(ctx context.Context, instanceID string) (*models.WorkflowInstance, error) {
+	instance, err := s.transitionStatus(ctx, instanceID, models.InstanceStatusCancelled,
+		models.InstanceStatusPending, models.InstanceStatusRunning, models.InstanceStatusSuspended)
+	if err != nil {
+		return nil, err
+	}
+
+	// 令牌不再等待任何节点，清理所有待触发的定时器和待关联的消息订阅
+	if _, err := NewWorkflowTimerService(s.db, s.logger).CancelStaleTimers(ctx, instanceID, nil); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceID).Msg("Failed to cancel timers of cancelled instance")
+	}
+	if _, err := NewMessageSubscriptionService(s.db, s.logger).CancelStaleSubscriptions(ctx, instanceID, nil); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceID).Msg("Failed to cancel message subscriptions of cancelled instance")
+	}
+	if _, err := NewSignalSubscriptionService(s.db, s.logger).CancelStaleSubscriptions(ctx, instanceID, nil); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceID).Msg("Failed to cancel signal subscriptions of cancelled instance")
+	}
+	// 调用活动启动的子实例随父实例一起取消
+	children, err := NewCallActivityService(s.db, s.logger).CancelStaleCallActivities(ctx, instanceID, nil)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceID).Msg("Failed to cancel call activities of cancelled instance")
+	}
+	for _, childInstanceId := range children {
+		if _, err := s.CancelWorkflowInstance(ctx, childInstanceId); err != nil {
+			s.logger.Warn().Err(err).Str("childInstanceId", childInstanceId).Msg("Failed to cancel child instance")
+		}
+	}
+	if _, err := NewUserTaskService(s.db, s.logger).CancelStaleUserTasks(ctx, instanceID, nil); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceID).Msg("Failed to cancel user tasks of cancelled instance")
+	}
+	if _, err := NewWorkflowJobService(s.db, s.logger).CancelStaleJobs(ctx, instanceID, nil); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceID).Msg("Failed to cancel jobs of cancelled instance")
+	}
+	if _, err := NewExternalTaskService(s.db, s.logger).CancelStaleExternalTasks(ctx, instanceID, nil); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceID).Msg("Failed to cancel external tasks of cancelled instance")
+	}
+
+	return instance, nil
+}
+
+// SuspendWorkflowInstance suspends an active instance
+// 挂起期间实例拒绝执行，到期的定时器和到达的消息保留到恢复后再处理
+func (s *WorkflowInstanceService) SuspendWorkflowInstance(ctx context.Context, instanceID string) (*models.WorkflowInstance, error) {
+	return s.transitionStatus(ctx, instanceID, models.InstanceStatusSuspended,
+		models.InstanceStatusPending, models.InstanceStatusRunning)
+}
+
+// ResumeWorkflowInstance resumes a suspended instance
+func (s *WorkflowInstanceService) ResumeWorkflowInstance(ctx context.Context, instanceID string) (*models.WorkflowInstance, error) {
+	return s.transitionStatus(ctx, instanceID, models.InstanceStatusRunning, models.InstanceStatusSuspended)
+}
+
+// transitionStatus changes the instance status only if it is currently one of fromStatuses
+func (s *WorkflowInstanceService) transitionStatus(
+	ctx context.Context,
+	instanceID string,
+	toStatus string,
+	fromStatuses ...string,
+) (*models.WorkflowInstance, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	// 条件更新：状态检查与修改在同一条语句中完成，避免并发请求之间的竞争
+	query := `
+		UPDATE workflow_instances
+		SET status = $1, instance_version = instance_version + 1, updated_at = $2
+		WHERE id = $3 AND status = ANY($4)
+		RETURNING id, workflow_id, name, status, current_node_ids, instance_version, COALESCE(workflow_version, 0), created_at, updated_at
+	`
+
+	var instance models.WorkflowInstance
+	err := s.db.QueryRowContext(ctx, query, toStatus, time.Now(), instanceID, pq.Array(fromStatuses)).Scan(
+		&instance.Id,
+		&instance.WorkflowId,
+		&instance.Name,
+		&instance.Status,
+		pq.Array(&instance.CurrentNodeIds),
+		&instance.InstanceVersion,
+		&instance.WorkflowVersion,
+		&instance.CreatedAt,
+		&instance.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// 区分实例不存在与当前状态不允许该操作
+			current, getErr := s.GetWorkflowInstanceByID(ctx, instanceID)
+			if getErr != nil {
+				return nil, getErr
+			}
+			return nil, fmt.Errorf("%s: cannot change workflow instance from %s to %s", models.ErrInvalidInstanceState, current.Status, toStatus)
+		}
+		s.logger.Error().Err(err).Str("instanceId", instanceID).Str("status", toStatus).Msg("Failed to change workflow instance status")
+		return nil, fmt.Errorf("failed to change workflow instance status: %w", err)
+	}
+
+	s.logger.Info().Str("instanceId", instanceID).Str("status", toStatus).Msg("Workflow instance status changed")
+	return &instance, nil
+}
+
+// ListActiveInstancesByVersion lists pending, running and suspended instances pinned to a workflow version
+// 按 id 游标分批读取，version 为 0 表示部署前创建的实例
+func (s *WorkflowInstanceService) ListActiveInstancesByVersion(
+	ctx context.Context,
+	workflowId string,
+	version int,
+	afterId string,
+	limit int,
+) ([]models.WorkflowInstance, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		SELECT id, workflow_id, name, status, current_node_ids, instance_version, COALESCE(workflow_version, 0), created_at, updated_at
+		FROM workflow_instances
+		WHERE workflow_id = $1 AND COALESCE(workflow_version, 0) = $2 AND status = ANY($3) AND id::text > $4
+		ORDER BY id::text
+		LIMIT $5
+	`
+
+	activeStatuses := []string{models.InstanceStatusPending, models.InstanceStatusRunning, models.InstanceStatusSuspended}
+	rows, err := s.db.QueryContext(ctx, query, workflowId, version, pq.Array(activeStatuses), afterId, limit)
+	if err != nil {
+		s.logger.Error().Err(err).Str("workflowId", workflowId).Int("version", version).Msg("Failed to list workflow instances by version")
+		return nil, fmt.Errorf("failed to list workflow instances by version: %w", err)
+	}
+	defer rows.Close()
+
+	instances := []models.WorkflowInstance{}
+	for rows.Next() {
+		var instance models.WorkflowInstance
+		if err := rows.Scan(
+			&instance.Id,
+			&instance.WorkflowId,
+			&instance.Name,
+			&instance.Status,
+			pq.Array(&instance.CurrentNodeIds),
+			&instance.InstanceVersion,
+			&instance.WorkflowVersion,
+			&instance.CreatedAt,
+			&instance.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan workflow instance: %w", err)
+		}
+		instances = append(instances, instance)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate workflow instances: %w", err)
+	}
+
+	return instances, nil
+}
+
+// MigrateWorkflowInstance re-pins an instance to another workflow version with mapped current nodes
+// 仅当实例仍处于读取时的版本和 instance_version 时才更新，避免覆盖并发执行的结果
+func (s *WorkflowInstanceService) MigrateWorkflowInstance(
+	ctx context.Context,
+	instance *models.WorkflowInstance,
+	targetVersion int,
+	currentNodeIds []string,
+) (*models.WorkflowInstance, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE workflow_instances
+		SET workflow_version = $1, current_node_ids = $2, instance_version = instance_version + 1, updated_at = $3
+		WHERE id = $4 AND COALESCE(workflow_version, 0) = $5 AND instance_version = $6
+		RETURNING id, workflow_id, name, status, current_node_ids, instance_version, COALESCE(workflow_version, 0), created_at, updated_at
+	`
+
+	var migrated models.WorkflowInstance
+	err := s.db.QueryRowContext(ctx, query,
+		targetVersion, pq.Array(currentNodeIds), time.Now(), instance.Id, instance.WorkflowVersion, instance.InstanceVersion,
+	).Scan(
+		&migrated.Id,
+		&migrated.WorkflowId,
+		&migrated.Name,
+		&migrated.Status,
+		pq.Array(&migrated.CurrentNodeIds),
+		&migrated.InstanceVersion,
+		&migrated.WorkflowVersion,
+		&migrated.CreatedAt,
+		&migrated.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s: workflow instance %s changed during migration", models.ErrInvalidInstanceState, instance.Id)
+		}
+		s.logger.Error().Err(err).Str("instanceId", instance.Id).Msg("Failed to migrate workflow instance")
+		return nil, fmt.Errorf("failed to migrate workflow instance: %w", err)
+	}
+
+	s.logger.Info().
+		Str("instanceId", instance.Id).
+		Int("fromVersion", instance.WorkflowVersion).
+		Int("toVersion", targetVersion).
+		Msg("Workflow instance migrated")
+	return &migrated, nil
+}
@@ -43,8 +43,8 @@ func TestWorkflowInstanceService_CreateWorkflowInstance_Success(t *testing.T) {
 
 	mock.ExpectQuery(`INSERT INTO workflow_instances`).
 		WithArgs(sqlmock.AnyArg(), workflowId, name, models.InstanceStatusPending, pq.Array([]string{}), 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "created_at", "updated_at"}).
-		AddRow("test-instance-id", workflowId, name, models.InstanceStatusPending, pq.Array([]string{}), 1, now, now))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+		AddRow("test-instance-id", workflowId, name, models.InstanceStatusPending, pq.Array([]string{}), 1, 0, now, now))
 
 	instance, err := service.CreateWorkflowInstance(ctx, workflowId, name)
 
@@ -70,10 +70,10 @@ func TestWorkflowInstanceService_GetWorkflowInstanceByID_Success(t *testing.T) {
 	name := "Test Instance"
 	now := time.Now()
 
-	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids, instance_version, created_at, updated_at`).
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids, instance_version, COALESCE\(workflow_version, 0\), created_at, updated_at`).
 		WithArgs(instanceID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "created_at", "updated_at"}).
-			AddRow(instanceID, workflowId, name, models.InstanceStatusRunning, pq.Array([]string{"node1", "node2"}), 2, now, now))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceID, workflowId, name, models.InstanceStatusRunning, pq.Array([]string{"node1", "node2"}), 2, 0, now, now))
 
 	instance, err := service.GetWorkflowInstanceByID(ctx, instanceID)
 
@@ -94,7 +94,7 @@ func TestWorkflowInstanceService_GetWorkflowInstanceByID_NotFound(t *testing.T)
 	ctx := context.Background()
 	instanceID := "nonexistent-id"
 
-	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids, instance_version, created_at, updated_at`).
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids, instance_version, COALESCE\(workflow_version, 0\), created_at, updated_at`).
 		WithArgs(instanceID).
 		WillReturnError(sql.ErrNoRows)
 
@@ -120,10 +120,10 @@ func TestWorkflowInstanceService_UpdateWorkflowInstance_Success(t *testing.T) {
 
 	mock.ExpectQuery(`UPDATE workflow_instances`).
 		WithArgs(sqlmock.AnyArg(), newStatus, pq.Array(newNodeIds), instanceID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "created_at", "updated_at"}).
-			AddRow(instanceID, "workflow-id", "Test", newStatus, pq.Array(newNodeIds), 2, now, now))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceID, "workflow-id", "Test", newStatus, pq.Array(newNodeIds), 2, 0, now, now))
 
-	instance, err := service.UpdateWorkflowInstance(ctx, instanceID, newStatus, newNodeIds)
+	instance, err := service.UpdateWorkflowInstance(ctx, instanceID, newStatus, newNodeIds, 0)
 
 	require.NoError(t, err)
 	assert.NotNil(t, instance)
@@ -135,3 +135,241 @@ func TestWorkflowInstanceService_UpdateWorkflowInstance_Success(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+
+func TestWorkflowInstanceService_UpdateWorkflowInstance_ExpectedVersion(t *testing.T) {
+	service, mock, cleanup := setupWorkflowInstanceServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	instanceID := "test-instance-id"
+	newNodeIds := []string{"node2"}
+	now := time.Now()
+
+	mock.ExpectQuery(`UPDATE workflow_instances .* WHERE id = \$4 AND instance_version = \$5`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, pq.Array(newNodeIds), instanceID, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceID, "workflow-id", "Test", models.InstanceStatusRunning, pq.Array(newNodeIds), 4, 0, now, now))
+
+	instance, err := service.UpdateWorkflowInstance(ctx, instanceID, models.InstanceStatusRunning, newNodeIds, 3)
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, instance.InstanceVersion)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowInstanceService_UpdateWorkflowInstance_VersionConflict(t *testing.T) {
+	service, mock, cleanup := setupWorkflowInstanceServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	instanceID := "test-instance-id"
+	now := time.Now()
+
+	// 另一个请求已经把版本推进到 4，条件更新不命中任何行
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceID, 3).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids, instance_version, COALESCE\(workflow_version, 0\), created_at, updated_at`).
+		WithArgs(instanceID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow(instanceID, "workflow-id", "Test", models.InstanceStatusRunning, pq.Array([]string{"node3"}), 4, 0, now, now))
+
+	instance, err := service.UpdateWorkflowInstance(ctx, instanceID, models.InstanceStatusRunning, []string{"node2"}, 3)
+
+	assert.Error(t, err)
+	assert.Nil(t, instance)
+	assert.Contains(t, err.Error(), models.ErrInstanceVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowInstanceService_ClaimWorkflowInstance_Lease(t *testing.T) {
+	service, mock, cleanup := setupWorkflowInstanceServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	instanceID := "test-instance-id"
+	now := time.Now()
+	columns := []string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}
+
+	// 占用设置执行租约，并要求实例没有被其他执行占用
+	mock.ExpectQuery(`UPDATE workflow_instances .* execution_lease_until = \$1::timestamptz \+ interval '120 seconds'.* AND \(execution_lease_until IS NULL OR execution_lease_until < \$1\)`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceID, 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(instanceID, "workflow-id", "Test", models.InstanceStatusRunning, pq.Array([]string{"node1"}), 4, 0, now, now))
+	// 同一版本上的第二次占用：租约仍然有效
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceID, 4).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids`).
+		WithArgs(instanceID).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(instanceID, "workflow-id", "Test", models.InstanceStatusRunning, pq.Array([]string{"node1"}), 4, 0, now, now))
+	// 最终更新释放租约
+	mock.ExpectQuery(`UPDATE workflow_instances .* execution_lease_until = NULL\s+WHERE id = \$4 AND instance_version = \$5\s+RETURNING`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusCompleted, sqlmock.AnyArg(), instanceID, 4).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(instanceID, "workflow-id", "Test", models.InstanceStatusCompleted, pq.Array([]string{}), 5, 0, now, now))
+
+	instance, err := service.ClaimWorkflowInstance(ctx, instanceID, models.InstanceStatusRunning, []string{"node1"}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 4, instance.InstanceVersion)
+
+	_, err = service.ClaimWorkflowInstance(ctx, instanceID, models.InstanceStatusRunning, []string{"node1"}, 4)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInstanceVersionConflict)
+	assert.Contains(t, err.Error(), "is being executed by another request")
+
+	instance, err = service.ReleaseWorkflowInstance(ctx, instanceID, models.InstanceStatusCompleted, []string{}, 4)
+	require.NoError(t, err)
+	assert.Equal(t, 5, instance.InstanceVersion)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowInstanceService_UpdateWorkflowInstance_ExpectedVersionNotFound(t *testing.T) {
+	service, mock, cleanup := setupWorkflowInstanceServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	instanceID := "missing-instance-id"
+
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), instanceID, 3).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids`).
+		WithArgs(instanceID).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err := service.UpdateWorkflowInstance(ctx, instanceID, models.InstanceStatusRunning, []string{"node2"}, 3)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrWorkflowInstanceNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowInstanceService_ListWorkflowInstances_WithFilter(t *testing.T) {
+	service, mock, cleanup := setupWorkflowInstanceServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+	createdAfter := now.Add(-24 * time.Hour)
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM workflow_instances WHERE 1=1 AND workflow_id = \$1 AND status = \$2 AND created_at >= \$3`).
+		WithArgs("test-workflow-id", models.InstanceStatusRunning, createdAfter).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids, instance_version, COALESCE\(workflow_version, 0\), created_at, updated_at`).
+		WithArgs("test-workflow-id", models.InstanceStatusRunning, createdAfter, 2, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow("instance-1", "test-workflow-id", "Instance 1", models.InstanceStatusRunning, pq.Array([]string{"UserTask_1"}), 2, 0, now, now).
+			AddRow("instance-2", "test-workflow-id", "Instance 2", models.InstanceStatusRunning, pq.Array([]string{"UserTask_1"}), 2, 0, now, now))
+
+	instances, metadata, err := service.ListWorkflowInstances(ctx, WorkflowInstanceFilter{
+		WorkflowId:   "test-workflow-id",
+		Status:       models.InstanceStatusRunning,
+		CreatedAfter: &createdAfter,
+	}, 1, 2)
+
+	require.NoError(t, err)
+	assert.Len(t, instances, 2)
+	assert.Equal(t, 3, metadata.Total)
+	assert.True(t, metadata.HasMore)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowInstanceService_SuspendWorkflowInstance_Success(t *testing.T) {
+	service, mock, cleanup := setupWorkflowInstanceServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(models.InstanceStatusSuspended, sqlmock.AnyArg(), "test-instance-id",
+			pq.Array([]string{models.InstanceStatusPending, models.InstanceStatusRunning})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow("test-instance-id", "test-workflow-id", "Test Instance", models.InstanceStatusSuspended, pq.Array([]string{"UserTask_1"}), 3, 0, now, now))
+
+	instance, err := service.SuspendWorkflowInstance(ctx, "test-instance-id")
+
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusSuspended, instance.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowInstanceService_ResumeWorkflowInstance_InvalidState(t *testing.T) {
+	service, mock, cleanup := setupWorkflowInstanceServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(models.InstanceStatusRunning, sqlmock.AnyArg(), "test-instance-id", pq.Array([]string{models.InstanceStatusSuspended})).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT id, workflow_id, name, status, current_node_ids, instance_version, COALESCE\(workflow_version, 0\), created_at, updated_at`).
+		WithArgs("test-instance-id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow("test-instance-id", "test-workflow-id", "Test Instance", models.InstanceStatusCompleted, pq.Array([]string{}), 4, 0, now, now))
+
+	_, err := service.ResumeWorkflowInstance(ctx, "test-instance-id")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInvalidInstanceState)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowInstanceService_CancelWorkflowInstance_CancelsWaitingEvents(t *testing.T) {
+	service, mock, cleanup := setupWorkflowInstanceServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(models.InstanceStatusCancelled, sqlmock.AnyArg(), "test-instance-id",
+			pq.Array([]string{models.InstanceStatusPending, models.InstanceStatusRunning, models.InstanceStatusSuspended})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow("test-instance-id", "test-workflow-id", "Test Instance", models.InstanceStatusCancelled, pq.Array([]string{"Catch_Timer"}), 3, 0, now, now))
+	mock.ExpectExec(`UPDATE workflow_timers`).
+		WithArgs(models.TimerStatusCancelled, sqlmock.AnyArg(), "test-instance-id", models.TimerStatusPending, pq.Array([]string{})).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE message_subscriptions`).
+		WithArgs(models.SubscriptionStatusCancelled, sqlmock.AnyArg(), "test-instance-id", models.SubscriptionStatusPending, pq.Array([]string{})).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	instance, err := service.CancelWorkflowInstance(ctx, "test-instance-id")
+
+	require.NoError(t, err)
+	assert.Equal(t, models.InstanceStatusCancelled, instance.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowInstanceService_JoinFlowIds(t *testing.T) {
+	service, mock, cleanup := setupWorkflowInstanceServiceTest(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	instanceID := "test-instance-id"
+
+	mock.ExpectQuery(`SELECT COALESCE\(join_flow_ids, '\{\}'\) FROM workflow_instances WHERE id = \$1`).
+		WithArgs(instanceID).
+		WillReturnRows(sqlmock.NewRows([]string{"join_flow_ids"}).AddRow(pq.Array([]string{"Flow_A", "Flow_A"})))
+	// 只在占用的版本上写入
+	mock.ExpectExec(`UPDATE workflow_instances SET join_flow_ids = \$1 WHERE id = \$2 AND instance_version = \$3`).
+		WithArgs(pq.Array([]string{"Flow_A"}), instanceID, 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE workflow_instances SET join_flow_ids`).
+		WithArgs(pq.Array([]string{}), instanceID, 4).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	flowIds, err := service.GetJoinFlowIds(ctx, instanceID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Flow_A", "Flow_A"}, flowIds)
+
+	require.NoError(t, service.SetJoinFlowIds(ctx, instanceID, 4, []string{"Flow_A"}))
+
+	err = service.SetJoinFlowIds(ctx, instanceID, 4, []string{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInstanceVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// workflowJobColumns 查询作业时返回的列，与 scanWorkflowJob 的顺序一致
+const workflowJobColumns = `id, instance_id, workflow_id, node_id, job_type, variables, status, attempts, max_attempts,
+		       due_at, COALESCE(lock_owner, ''), lock_expires_at, COALESCE(last_error, ''), created_at, updated_at`
+
+// WorkflowJobService handles persistence of asynchronous continuation jobs
+type WorkflowJobService struct {
+	db     *database.Database
+	logger *zerolog.Logger
+}
+
+// NewWorkflowJobService creates a new WorkflowJobService
+func NewWorkflowJobService(db *database.Database, logger *zerolog.Logger) *WorkflowJobService {
+	return &WorkflowJobService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateJob stores a pending job that is due immediately
+// 同一实例的同一节点已存在同类型的待执行作业时不会重复创建
+func (s *WorkflowJobService) CreateJob(ctx context.Context, job *models.WorkflowJob) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	variables := job.Variables
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job variables: %w", err)
+	}
+
+	maxAttempts := job.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = models.DefaultJobMaxAttempts
+	}
+
+	query := `
+		INSERT INTO workflow_jobs (
+			id, instance_id, workflow_id, node_id, job_type, variables,
+			status, attempts, max_attempts, due_at, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6::jsonb, $7, 0, $8, $9, $9, $9)
+		ON CONFLICT (instance_id, node_id, job_type) WHERE status = 'pending' DO NOTHING
+	`
+
+	_, err = s.db.ExecContext(ctx, query,
+		uuid.New().String(), job.InstanceId, job.WorkflowId, job.NodeId, job.JobType, string(variablesJSON),
+		models.JobStatusPending, maxAttempts, time.Now(),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", job.InstanceId).Str("nodeId", job.NodeId).Msg("Failed to create job")
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+
+	s.logger.Info().
+		Str("instanceId", job.InstanceId).
+		Str("nodeId", job.NodeId).
+		Str("jobType", job.JobType).
+		Msg("Job created")
+	return nil
+}
+
+// CancelStaleJobs cancels pending jobs whose token is no longer waiting at the node
+// 执行中的作业由工作池在执行完成后自行结束
+func (s *WorkflowJobService) CancelStaleJobs(ctx context.Context, instanceId string, activeNodeIds []string) (int64, error) {
+	if s.db.DB == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+
+	if activeNodeIds == nil {
+		activeNodeIds = []string{}
+	}
+
+	query := `
+		UPDATE workflow_jobs
+		SET status = $1, updated_at = $2
+		WHERE instance_id = $3 AND status = $4 AND NOT (node_id = ANY($5))
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		models.JobStatusCancelled, time.Now(), instanceId, models.JobStatusPending, pq.Array(activeNodeIds),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale jobs")
+		return 0, fmt.Errorf("failed to cancel stale jobs: %w", err)
+	}
+
+	cancelled, _ := result.RowsAffected()
+	if cancelled > 0 {
+		s.logger.Info().Str("instanceId", instanceId).Int64("cancelled", cancelled).Msg("Stale jobs cancelled")
+	}
+	return cancelled, nil
+}
+
+// AcquireJobs locks up to limit due jobs for the owner and returns them
+// 使用 FOR UPDATE SKIP LOCKED，多个工作线程和服务实例同时认领时不会重复执行同一个作业；
+// 锁已过期的执行中作业视为工作线程崩溃，可以被重新认领；挂起实例的作业在恢复后才会被认领
+func (s *WorkflowJobService) AcquireJobs(ctx context.Context, owner string, limit int, lockDuration time.Duration) ([]models.WorkflowJob, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	now := time.Now()
+	query := `
+		UPDATE workflow_jobs
+		SET status = $1, lock_owner = $2, lock_expires_at = $3, updated_at = $4
+		WHERE id IN (
+			SELECT id FROM workflow_jobs
+			WHERE ((status = $5 AND due_at <= $4)
+			   OR (status = $1 AND lock_expires_at < $4))
+			  AND NOT EXISTS (
+			      SELECT 1 FROM workflow_instances i
+			      WHERE i.id = workflow_jobs.instance_id AND i.status = 'suspended'
+			  )
+			ORDER BY due_at
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + workflowJobColumns
+
+	rows, err := s.db.QueryContext(ctx, query,
+		models.JobStatusRunning, owner, now.Add(lockDuration), now, models.JobStatusPending, limit,
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("owner", owner).Msg("Failed to acquire jobs")
+		return nil, fmt.Errorf("failed to acquire jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.WorkflowJob
+	for rows.Next() {
+		job, err := scanWorkflowJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// ExtendJobLock extends the lock of a job still locked by the owner
+// 锁已过期并被其他工作线程重新认领时返回 INVALID_JOB_STATE 错误，作业不能再由该持有者执行
+func (s *WorkflowJobService) ExtendJobLock(ctx context.Context, jobId string, owner string, lockDuration time.Duration) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	now := time.Now()
+	query := `
+		UPDATE workflow_jobs
+		SET lock_expires_at = $1, updated_at = $2
+		WHERE id = $3 AND status = $4 AND lock_owner = $5
+	`
+
+	result, err := s.db.ExecContext(ctx, query, now.Add(lockDuration), now, jobId, models.JobStatusRunning, owner)
+	if err != nil {
+		s.logger.Error().Err(err).Str("jobId", jobId).Msg("Failed to extend job lock")
+		return fmt.Errorf("failed to extend job lock: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("%s: job %s is no longer locked by %s", models.ErrInvalidJobState, jobId, owner)
+	}
+	return nil
+}
+
+// CompleteJob marks a job locked by the owner as completed
+func (s *WorkflowJobService) CompleteJob(ctx context.Context, jobId string, owner string) error {
+	return s.finishJob(ctx, jobId, owner, models.JobStatusCompleted)
+}
+
+// CancelJob marks a job locked by the owner as cancelled
+func (s *WorkflowJobService) CancelJob(ctx context.Context, jobId string, owner string) error {
+	return s.finishJob(ctx, jobId, owner, models.JobStatusCancelled)
+}
+
+// ReleaseJob returns a job locked by the owner to pending without counting an attempt
+// 实例被挂起或被并发修改时使用，作业稍后重新执行
+func (s *WorkflowJobService) ReleaseJob(ctx context.Context, jobId string, owner string) error {
+	return s.finishJob(ctx, jobId, owner, models.JobStatusPending)
+}
+
+// finishJob sets the status of a job locked by the owner and releases the lock
+// 锁已过期并被其他工作线程重新认领时不做修改
+func (s *WorkflowJobService) finishJob(ctx context.Context, jobId string, owner string, status string) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE workflow_jobs
+		SET status = $1, lock_owner = NULL, lock_expires_at = NULL, updated_at = $2
+		WHERE id = $3 AND status = $4 AND lock_owner = $5
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, status, time.Now(), jobId, models.JobStatusRunning, owner); err != nil {
+		s.logger.Error().Err(err).Str("jobId", jobId).Str("status", status).Msg("Failed to finish job")
+		return fmt.Errorf("failed to finish job: %w", err)
+	}
+	return nil
+}
+
+// FailJob records a failed attempt of a job locked by the owner
+// 次数用尽时作业进入 dead 状态等待人工重试，否则在 retryAt 之后重新执行；返回作业的新状态
+func (s *WorkflowJobService) FailJob(ctx context.Context, jobId string, owner string, errorMessage string, retryAt time.Time) (string, error) {
+	if s.db.DB == nil {
+		return "", fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE workflow_jobs
+		SET attempts = attempts + 1,
+		    status = CASE WHEN attempts + 1 >= max_attempts THEN $1 ELSE $2 END,
+		    due_at = $3, last_error = $4, lock_owner = NULL, lock_expires_at = NULL, updated_at = $5
+		WHERE id = $6 AND status = $7 AND lock_owner = $8
+		RETURNING status
+	`
+
+	var status string
+	err := s.db.QueryRowContext(ctx, query,
+		models.JobStatusDead, models.JobStatusPending, retryAt, errorMessage, time.Now(), jobId, models.JobStatusRunning, owner,
+	).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%s: job %s is no longer locked by %s", models.ErrInvalidJobState, jobId, owner)
+		}
+		s.logger.Error().Err(err).Str("jobId", jobId).Msg("Failed to record job failure")
+		return "", fmt.Errorf("failed to record job failure: %w", err)
+	}
+	return status, nil
+}
+
+// GetJob retrieves a job by ID
+func (s *WorkflowJobService) GetJob(ctx context.Context, jobId string) (*models.WorkflowJob, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `SELECT ` + workflowJobColumns + ` FROM workflow_jobs WHERE id = $1`
+	job, err := scanWorkflowJob(s.db.QueryRowContext(ctx, query, jobId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s: job %s not found", models.ErrJobNotFound, jobId)
+		}
+		s.logger.Error().Err(err).Str("jobId", jobId).Msg("Failed to get job")
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return job, nil
+}
+
+// ListJobs lists jobs with optional status and instance filters and pagination
+// 按到期时间从早到晚排序
+func (s *WorkflowJobService) ListJobs(
+	ctx context.Context,
+	status string,
+	instanceId string,
+	page, pageSize int,
+) ([]models.WorkflowJob, *models.Metadata, error) {
+	if s.db.DB == nil {
+		return nil, nil, fmt.Errorf("database not available")
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	// 按提供的条件拼接 WHERE 子句
+	where := " WHERE 1=1"
+	var args []interface{}
+	if status != "" {
+		args = append(args, status)
+		where += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if instanceId != "" {
+		args = append(args, instanceId)
+		where += fmt.Sprintf(" AND instance_id = $%d", len(args))
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_jobs`+where, args...).Scan(&total); err != nil {
+		s.logger.Error().Err(err).Msg("Failed to count jobs")
+		return nil, nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+
+	query := `
+		SELECT ` + workflowJobColumns + `
+		FROM workflow_jobs` + where + fmt.Sprintf(`
+		ORDER BY due_at ASC, created_at ASC
+		LIMIT $%d OFFSET $%d
+	`, len(args)+1, len(args)+2)
+	args = append(args, pageSize, (page-1)*pageSize)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to list jobs")
+		return nil, nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.WorkflowJob{}
+	for rows.Next() {
+		job, err := scanWorkflowJob(rows)
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Failed to scan job")
+			return nil, nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to iterate jobs: %w", err)
+	}
+
+	metadata := &models.Metadata{
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+		HasMore:  page*pageSize < total,
+	}
+	return jobs, metadata, nil
+}
+
+// RetryJob moves a dead job back to pending with a fresh set of attempts
+func (s *WorkflowJobService) RetryJob(ctx context.Context, jobId string) (*models.WorkflowJob, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	now := time.Now()
+	query := `
+		UPDATE workflow_jobs
+		SET status = $1, attempts = 0, due_at = $2, updated_at = $2
+		WHERE id = $3 AND status = $4
+		RETURNING ` + workflowJobColumns
+
+	job, err := scanWorkflowJob(s.db.QueryRowContext(ctx, query, models.JobStatusPending, now, jobId, models.JobStatusDead))
+	if err == nil {
+		s.logger.Info().Str("jobId", jobId).Str("instanceId", job.InstanceId).Msg("Dead job scheduled for retry")
+		return job, nil
+	}
+	if err != sql.ErrNoRows {
+		s.logger.Error().Err(err).Str("jobId", jobId).Msg("Failed to retry job")
+		return nil, fmt.Errorf("failed to retry job: %w", err)
+	}
+
+	current, err := s.GetJob(ctx, jobId)
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s: only dead jobs can be retried, job %s is %s", models.ErrInvalidJobState, jobId, current.Status)
+}
+
+// scanWorkflowJob scans a job selected with workflowJobColumns
+func scanWorkflowJob(row userTaskScanner) (*models.WorkflowJob, error) {
+	var job models.WorkflowJob
+	var lockExpiresAt sql.NullTime
+	var variablesBytes []byte
+	if err := row.Scan(
+		&job.Id,
+		&job.InstanceId,
+		&job.WorkflowId,
+		&job.NodeId,
+		&job.JobType,
+		&variablesBytes,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.DueAt,
+		&job.LockOwner,
+		&lockExpiresAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if lockExpiresAt.Valid {
+		job.LockExpiresAt = &lockExpiresAt.Time
+	}
+	if len(variablesBytes) > 0 {
+		if err := json.Unmarshal(variablesBytes, &job.Variables); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal job variables: %w", err)
+		}
+	}
+	return &job, nil
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// jobWorkers 同时执行作业的工作线程数量
+	jobWorkers = 4
+	// jobPollInterval 作业轮询间隔
+	jobPollInterval = 2 * time.Second
+	// jobLockDuration 作业锁的有效期，执行期间定期续期；超过该时间未续期时视为工作线程崩溃，作业可以被重新认领
+	jobLockDuration = 5 * time.Minute
+	// jobRetryBackoff 第一次失败后的重试间隔，之后每次失败翻倍
+	jobRetryBackoff = 10 * time.Second
+)
+
+// WorkflowJobExecutor executes asynchronous continuation jobs with a pool of workers
+type WorkflowJobExecutor struct {
+	logger      *zerolog.Logger
+	owner       string
+	jobSvc      *WorkflowJobService
+	workflowSvc *WorkflowService
+	instanceSvc *WorkflowInstanceService
+	engineSvc   *WorkflowEngineService
+}
+
+// NewWorkflowJobExecutor creates a new WorkflowJobExecutor
+func NewWorkflowJobExecutor(db *database.Database, logger *zerolog.Logger) *WorkflowJobExecutor {
+	workflowSvc := NewWorkflowService(db, logger)
+	instanceSvc := NewWorkflowInstanceService(db, logger)
+	executionSvc := NewWorkflowExecutionService(db, logger)
+
+	// 锁的持有者标识服务实例，便于排查由哪个实例执行
+	hostname, _ := os.Hostname()
+	return &WorkflowJobExecutor{
+		logger:      logger,
+		owner:       fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+		jobSvc:      NewWorkflowJobService(db, logger),
+		workflowSvc: workflowSvc,
+		instanceSvc: instanceSvc,
+		engineSvc:   NewWorkflowEngineService(db, logger, workflowSvc, instanceSvc, executionSvc),
+	}
+}
+
+// ExecuteDueJobs acquires due jobs for the idle workers and executes them with at most jobWorkers workers
+// 只认领空闲工作线程能立即执行的作业，认领后不会在队列中等待而使锁过期；返回执行的作业数量
+func (s *WorkflowJobExecutor) ExecuteDueJobs(ctx context.Context) (int, error) {
+	idle := make(chan struct{}, jobWorkers)
+	for i := 0; i < jobWorkers; i++ {
+		idle <- struct{}{}
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	executed := 0
+	for ctx.Err() == nil {
+		// 等待至少一个工作线程空闲，再取走当前全部空闲的工作线程
+		<-idle
+		workers := 1
+		for drained := false; !drained; {
+			select {
+			case <-idle:
+				workers++
+			default:
+				drained = true
+			}
+		}
+
+		jobs, err := s.jobSvc.AcquireJobs(ctx, s.owner, workers, jobLockDuration)
+		if err != nil {
+			return executed, err
+		}
+		for i := range jobs {
+			wg.Add(1)
+			go func(job *models.WorkflowJob) {
+				defer wg.Done()
+				s.executeJob(ctx, job)
+				idle <- struct{}{}
+			}(&jobs[i])
+		}
+		executed += len(jobs)
+		for i := len(jobs); i < workers; i++ {
+			idle <- struct{}{}
+		}
+
+		// 没有更多到期的作业时等待下一次轮询
+		if len(jobs) < workers {
+			return executed, nil
+		}
+	}
+	return executed, nil
+}
+
+// executeJob continues the instance from the job node
+// 令牌已离开作业节点或实例已结束时，作业被取消
+func (s *WorkflowJobExecutor) executeJob(ctx context.Context, job *models.WorkflowJob) {
+	instance, err := s.instanceSvc.GetWorkflowInstanceByID(ctx, job.InstanceId)
+	if err != nil {
+		s.failJob(ctx, job, err)
+		return
+	}
+
+	// 认领后实例被挂起：放回待执行状态，恢复后再执行
+	if instance.Status == models.InstanceStatusSuspended {
+		s.releaseJob(ctx, job)
+		return
+	}
+
+	if (instance.Status != models.InstanceStatusPending && instance.Status != models.InstanceStatusRunning) ||
+		countNodeId(instance.CurrentNodeIds, job.NodeId) == 0 {
+		s.logger.Info().
+			Str("jobId", job.Id).
+			Str("instanceId", instance.Id).
+			Str("status", instance.Status).
+			Msg("Job no longer applies, cancelling")
+		if err := s.jobSvc.CancelJob(ctx, job.Id, s.owner); err != nil {
+			s.logger.Error().Err(err).Str("jobId", job.Id).Msg("Failed to cancel job")
+		}
+		return
+	}
+
+	workflow, err := s.workflowSvc.GetWorkflowByID(ctx, job.WorkflowId)
+	if err != nil {
+		s.failJob(ctx, job, err)
+		return
+	}
+
+	s.logger.Info().
+		Str("jobId", job.Id).
+		Str("instanceId", instance.Id).
+		Str("nodeId", job.NodeId).
+		Str("jobType", job.JobType).
+		Int("attempt", job.Attempts+1).
+		Msg("Executing job")
+
+	// 执行前确认锁仍由当前工作线程持有并续期，执行期间持续续期；锁已被其他工作线程重新认领时不再执行
+	if err := s.jobSvc.ExtendJobLock(ctx, job.Id, s.owner, jobLockDuration); err != nil {
+		s.logger.Warn().Err(err).Str("jobId", job.Id).Msg("Job lock lost before execution, skipping")
+		return
+	}
+	keeper := keepLease(ctx, jobLockDuration/3, func(ctx context.Context) error {
+		err := s.jobSvc.ExtendJobLock(ctx, job.Id, s.owner, jobLockDuration)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("jobId", job.Id).Msg("Failed to extend job lock")
+		}
+		return err
+	})
+	_, err = s.engineSvc.ExecuteFromNode(withAsyncContinuation(ctx, job), workflow, instance, job.NodeId, job.Variables)
+	keeper.Stop()
+	if err != nil {
+		// 实例被并发推进或在执行前被挂起不算失败，放回后重新检查
+		if isInstanceVersionConflict(err) || strings.HasPrefix(err.Error(), models.ErrInstanceSuspended) {
+			s.releaseJob(ctx, job)
+			return
+		}
+		s.failJob(ctx, job, err)
+		return
+	}
+
+	if err := s.jobSvc.CompleteJob(ctx, job.Id, s.owner); err != nil {
+		s.logger.Error().Err(err).Str("jobId", job.Id).Msg("Failed to complete job")
+	}
+}
+
+// failJob records a failed attempt, retrying with exponential backoff until the job is dead
+func (s *WorkflowJobExecutor) failJob(ctx context.Context, job *models.WorkflowJob, jobErr error) {
+	retryAt := time.Now().Add(jobRetryBackoff << job.Attempts)
+	status, err := s.jobSvc.FailJob(ctx, job.Id, s.owner, jobErr.Error(), retryAt)
+	if err != nil {
+		s.logger.Error().Err(err).Str("jobId", job.Id).Msg("Failed to record job failure")
+		return
+	}
+
+	event := s.logger.Warn()
+	if status == models.JobStatusDead {
+		event = s.logger.Error()
+	}
+	event.Err(jobErr).
+		Str("jobId", job.Id).
+		Str("instanceId", job.InstanceId).
+		Str("nodeId", job.NodeId).
+		Str("status", status).
+		Msg("Job failed")
+}
+
+// releaseJob returns the job to pending, logging failures
+func (s *WorkflowJobExecutor) releaseJob(ctx context.Context, job *models.WorkflowJob) {
+	if err := s.jobSvc.ReleaseJob(ctx, job.Id, s.owner); err != nil {
+		s.logger.Error().Err(err).Str("jobId", job.Id).Msg("Failed to release job")
+	}
+}
+
+// StartPeriodicExecution starts a loop that executes due jobs every jobPollInterval
+func (s *WorkflowJobExecutor) StartPeriodicExecution(ctx context.Context) {
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	s.logger.Info().
+		Dur("interval", jobPollInterval).
+		Int("workers", jobWorkers).
+		Str("owner", s.owner).
+		Msg("Starting workflow job executor")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info().Msg("Stopping workflow job executor")
+			return
+		case <-ticker.C:
+			executed, err := s.ExecuteDueJobs(ctx)
+			if err != nil {
+				s.logger.Error().Err(err).Msg("Failed to execute due jobs")
+			} else if executed > 0 {
+				s.logger.Info().Int("executed", executed).Msg("Executed due jobs")
+			}
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var workflowJobColumnNames = []string{"id", "instance_id", "workflow_id", "node_id", "job_type", "variables", "status", "attempts", "max_attempts",
+	"due_at", "lock_owner", "lock_expires_at", "last_error", "created_at", "updated_at"}
+
+func setupWorkflowJobServiceTest(t *testing.T) (*WorkflowJobService, sqlmock.Sqlmock, *database.Database, func()) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	database := database.NewDatabase(&logger)
+	database.DB = db
+
+	service := NewWorkflowJobService(database, &logger)
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return service, mock, database, cleanup
+}
+
+func TestWorkflowJobService_CreateJob_Success(t *testing.T) {
+	service, mock, _, cleanup := setupWorkflowJobServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectExec(`INSERT INTO workflow_jobs (.+) ON CONFLICT \(instance_id, node_id, job_type\) WHERE status = 'pending' DO NOTHING`).
+		WithArgs(sqlmock.AnyArg(), "instance-1", "workflow-1", "ServiceTask_Charge", models.JobTypeAsyncBefore, `{"orderId":"o-1"}`,
+			models.JobStatusPending, models.DefaultJobMaxAttempts, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := service.CreateJob(context.Background(), &models.WorkflowJob{
+		InstanceId: "instance-1",
+		WorkflowId: "workflow-1",
+		NodeId:     "ServiceTask_Charge",
+		JobType:    models.JobTypeAsyncBefore,
+		Variables:  map[string]interface{}{"orderId": "o-1"},
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowJobService_AcquireJobs_Success(t *testing.T) {
+	service, mock, _, cleanup := setupWorkflowJobServiceTest(t)
+	defer cleanup()
+
+	now := time.Now()
+	lockExpiresAt := now.Add(jobLockDuration)
+	// 待执行且已到期的作业，以及锁已过期的执行中作业
+	mock.ExpectQuery(`UPDATE workflow_jobs SET status = \$1, lock_owner = \$2, lock_expires_at = \$3, updated_at = \$4 WHERE id IN \((.+) FOR UPDATE SKIP LOCKED \) RETURNING`).
+		WithArgs(models.JobStatusRunning, "worker-1", sqlmock.AnyArg(), sqlmock.AnyArg(), models.JobStatusPending, 2).
+		WillReturnRows(sqlmock.NewRows(workflowJobColumnNames).
+			AddRow("job-1", "instance-1", "workflow-1", "ServiceTask_Charge", models.JobTypeAsyncBefore, []byte(`{"orderId":"o-1"}`),
+				models.JobStatusRunning, 0, 3, now, "worker-1", lockExpiresAt, "", now, now).
+			AddRow("job-2", "instance-2", "workflow-1", "ServiceTask_Charge", models.JobTypeAsyncAfter, []byte(`{}`),
+				models.JobStatusRunning, 1, 3, now, "worker-1", lockExpiresAt, "timeout", now, now))
+
+	jobs, err := service.AcquireJobs(context.Background(), "worker-1", 2, jobLockDuration)
+
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, map[string]interface{}{"orderId": "o-1"}, jobs[0].Variables)
+	assert.Equal(t, "worker-1", jobs[0].LockOwner)
+	require.NotNil(t, jobs[1].LockExpiresAt)
+	assert.Equal(t, "timeout", jobs[1].LastError)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowJobService_FailJob_DeadLetter(t *testing.T) {
+	service, mock, _, cleanup := setupWorkflowJobServiceTest(t)
+	defer cleanup()
+
+	retryAt := time.Now().Add(time.Minute)
+	mock.ExpectQuery(`UPDATE workflow_jobs SET attempts = attempts \+ 1`).
+		WithArgs(models.JobStatusDead, models.JobStatusPending, retryAt, "service unavailable", sqlmock.AnyArg(), "job-1", models.JobStatusRunning, "worker-1").
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.JobStatusDead))
+
+	status, err := service.FailJob(context.Background(), "job-1", "worker-1", "service unavailable", retryAt)
+
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusDead, status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowJobService_RetryJob(t *testing.T) {
+	t.Run("dead job is pending again", func(t *testing.T) {
+		service, mock, _, cleanup := setupWorkflowJobServiceTest(t)
+		defer cleanup()
+
+		now := time.Now()
+		mock.ExpectQuery(`UPDATE workflow_jobs SET status = \$1, attempts = 0`).
+			WithArgs(models.JobStatusPending, sqlmock.AnyArg(), "job-1", models.JobStatusDead).
+			WillReturnRows(sqlmock.NewRows(workflowJobColumnNames).
+				AddRow("job-1", "instance-1", "workflow-1", "ServiceTask_Charge", models.JobTypeAsyncBefore, []byte(`{}`),
+					models.JobStatusPending, 0, 3, now, "", nil, "service unavailable", now, now))
+
+		job, err := service.RetryJob(context.Background(), "job-1")
+
+		require.NoError(t, err)
+		assert.Equal(t, models.JobStatusPending, job.Status)
+		assert.Equal(t, 0, job.Attempts)
+		assert.Nil(t, job.LockExpiresAt)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("only dead jobs can be retried", func(t *testing.T) {
+		service, mock, _, cleanup := setupWorkflowJobServiceTest(t)
+		defer cleanup()
+
+		now := time.Now()
+		mock.ExpectQuery(`UPDATE workflow_jobs SET status = \$1, attempts = 0`).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(`SELECT (.+) FROM workflow_jobs WHERE id = \$1`).
+			WithArgs("job-1").
+			WillReturnRows(sqlmock.NewRows(workflowJobColumnNames).
+				AddRow("job-1", "instance-1", "workflow-1", "ServiceTask_Charge", models.JobTypeAsyncBefore, []byte(`{}`),
+					models.JobStatusCompleted, 1, 3, now, "", nil, "", now, now))
+
+		job, err := service.RetryJob(context.Background(), "job-1")
+
+		require.Error(t, err)
+		assert.Nil(t, job)
+		assert.Contains(t, err.Error(), models.ErrInvalidJobState)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWorkflowJobService_DatabaseNotAvailable(t *testing.T) {
+	logger := zerolog.Nop()
+	service := NewWorkflowJobService(database.NewDatabase(&logger), &logger)
+
+	_, err := service.AcquireJobs(context.Background(), "worker-1", 10, jobLockDuration)
+	assert.Error(t, err)
+
+	_, _, err = service.ListJobs(context.Background(), models.JobStatusDead, "", 1, 20)
+	assert.Error(t, err)
+}
+
+func TestWorkflowJobExecutor_ExecuteDueJobs(t *testing.T) {
+	now := time.Now()
+	instanceColumns := []string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}
+
+	t.Run("job is cancelled when the token has left the node", func(t *testing.T) {
+		_, mock, db, cleanup := setupWorkflowJobServiceTest(t)
+		defer cleanup()
+
+		logger := zerolog.Nop()
+		executor := NewWorkflowJobExecutor(db, &logger)
+
+		mock.ExpectQuery(`UPDATE workflow_jobs`).
+			WillReturnRows(sqlmock.NewRows(workflowJobColumnNames).
+				AddRow("job-1", "instance-1", "workflow-1", "ServiceTask_Charge", models.JobTypeAsyncBefore, []byte(`{}`),
+					models.JobStatusRunning, 0, 3, now, executor.owner, now.Add(jobLockDuration), "", now, now))
+		mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+			WithArgs("instance-1").
+			WillReturnRows(sqlmock.NewRows(instanceColumns).
+				AddRow("instance-1", "workflow-1", "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"UserTask_1"}), 3, 0, now, now))
+		mock.ExpectExec(`UPDATE workflow_jobs`).
+			WithArgs(models.JobStatusCancelled, sqlmock.AnyArg(), "job-1", models.JobStatusRunning, executor.owner).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		executed, err := executor.ExecuteDueJobs(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, 1, executed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("job is not executed when its lock was reclaimed", func(t *testing.T) {
+		_, mock, db, cleanup := setupWorkflowJobServiceTest(t)
+		defer cleanup()
+
+		logger := zerolog.Nop()
+		executor := NewWorkflowJobExecutor(db, &logger)
+
+		// 只认领空闲工作线程能够执行的作业
+		mock.ExpectQuery(`UPDATE workflow_jobs`).
+			WithArgs(models.JobStatusRunning, executor.owner, sqlmock.AnyArg(), sqlmock.AnyArg(), models.JobStatusPending, jobWorkers).
+			WillReturnRows(sqlmock.NewRows(workflowJobColumnNames).
+				AddRow("job-1", "instance-1", "workflow-1", "ServiceTask_Charge", models.JobTypeAsyncBefore, []byte(`{}`),
+					models.JobStatusRunning, 0, 3, now, executor.owner, now.Add(jobLockDuration), "", now, now))
+		mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+			WithArgs("instance-1").
+			WillReturnRows(sqlmock.NewRows(instanceColumns).
+				AddRow("instance-1", "workflow-1", "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"ServiceTask_Charge"}), 3, 0, now, now))
+		mock.ExpectQuery(`SELECT (.+) FROM workflows`).
+			WithArgs("workflow-1").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "bpmn_xml", "version", "status", "created_by", "created_at", "updated_at"}).
+				AddRow("workflow-1", "Order", "", createTestBPMN(), "1", models.StatusActive, "", now, now))
+		// 锁已过期并被其他工作线程认领：不执行也不修改作业
+		mock.ExpectExec(`UPDATE workflow_jobs SET lock_expires_at = \$1`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "job-1", models.JobStatusRunning, executor.owner).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		executed, err := executor.ExecuteDueJobs(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, 1, executed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("failed job backs off exponentially", func(t *testing.T) {
+		_, mock, db, cleanup := setupWorkflowJobServiceTest(t)
+		defer cleanup()
+
+		logger := zerolog.Nop()
+		executor := NewWorkflowJobExecutor(db, &logger)
+
+		mock.ExpectQuery(`UPDATE workflow_jobs`).
+			WillReturnRows(sqlmock.NewRows(workflowJobColumnNames).
+				AddRow("job-1", "instance-1", "workflow-1", "ServiceTask_Charge", models.JobTypeAsyncBefore, []byte(`{}`),
+					models.JobStatusRunning, 2, 3, now, executor.owner, now.Add(jobLockDuration), "", now, now))
+		mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+			WithArgs("instance-1").
+			WillReturnError(sql.ErrNoRows)
+		// 第三次失败：重试间隔为 jobRetryBackoff 的 4 倍，次数用尽后进入死信状态
+		mock.ExpectQuery(`UPDATE workflow_jobs SET attempts = attempts \+ 1`).
+			WithArgs(models.JobStatusDead, models.JobStatusPending, timeAfter(now.Add(4*jobRetryBackoff)), sqlmock.AnyArg(), sqlmock.AnyArg(), "job-1", models.JobStatusRunning, executor.owner).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.JobStatusDead))
+
+		executed, err := executor.ExecuteDueJobs(context.Background())
+
+		require.NoError(t, err)
+		assert.Equal(t, 1, executed)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// timeAfter matches a time argument that is not before the given time
+type timeAfter time.Time
+
+// Match implements sqlmock.Argument
+func (t timeAfter) Match(v driver.Value) bool {
+	actual, ok := v.(time.Time)
+	return ok && !actual.Before(time.Time(t))
+}
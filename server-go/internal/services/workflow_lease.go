@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+)
+
+// leaseKeeper renews a lease in the background until it is stopped
+type leaseKeeper struct {
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// keepLease calls renew every interval until the keeper is stopped, the context ends or renew fails
+// 续约失败说明租约已被其他持有方取得，不再继续续约
+func keepLease(ctx context.Context, interval time.Duration, renew func(context.Context) error) *leaseKeeper {
+	keeper := &leaseKeeper{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(keeper.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-keeper.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := renew(ctx); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return keeper
+}
+
+// Stop stops renewing and waits for an in-flight renewal to finish
+func (k *leaseKeeper) Stop() {
+	k.once.Do(func() { close(k.stop) })
+	<-k.done
+}
+
+// executionLease is the lease an execution holds on its instance from the claim to the final update
+type executionLease struct {
+	keeper     *leaseKeeper
+	instanceId string
+	version    int
+	released   bool // 最终更新已经释放了租约
+}
+
+// holdExecutionLease keeps renewing the execution lease taken by the claim of the instance
+func (s *WorkflowEngineService) holdExecutionLease(ctx context.Context, instance *models.WorkflowInstance) *executionLease {
+	lease := &executionLease{instanceId: instance.Id, version: instance.InstanceVersion}
+	lease.keeper = keepLease(ctx, instanceLeaseDuration/3, func(ctx context.Context) error {
+		err := s.instanceSvc.RenewInstanceLease(ctx, lease.instanceId, lease.version)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("instanceId", lease.instanceId).Msg("Failed to renew execution lease")
+		}
+		return err
+	})
+	return lease
+}
+
+// endExecutionLease stops renewing the lease and drops it unless the final update released it
+// 执行在最终更新前中止时放弃租约，其他请求无需等待租约到期即可占用实例
+func (s *WorkflowEngineService) endExecutionLease(ctx context.Context, lease *executionLease) {
+	if lease == nil {
+		return
+	}
+	lease.keeper.Stop()
+	if lease.released {
+		return
+	}
+	if err := s.instanceSvc.DropInstanceLease(context.WithoutCancel(ctx), lease.instanceId, lease.version); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", lease.instanceId).Msg("Failed to drop execution lease")
+	}
+}
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultMigrationBatchSize 每批迁移的实例数量
+	defaultMigrationBatchSize = 100
+	// maxMigrationBatchSize 每批迁移的实例数量上限
+	maxMigrationBatchSize = 1000
+)
+
+// WorkflowMigrationService moves live instances from one workflow version to another
+type WorkflowMigrationService struct {
+	db          *database.Database
+	logger      *zerolog.Logger
+	workflowSvc *WorkflowService
+	instanceSvc *WorkflowInstanceService
+	versionSvc  *WorkflowVersionService
+	timerSvc    *WorkflowTimerService
+	messageSvc  *MessageSubscriptionService
+	engineSvc   *WorkflowEngineService
+}
+
+// NewWorkflowMigrationService creates a new WorkflowMigrationService
+func NewWorkflowMigrationService(db *database.Database, logger *zerolog.Logger) *WorkflowMigrationService {
+	workflowSvc := NewWorkflowService(db, logger)
+	instanceSvc := NewWorkflowInstanceService(db, logger)
+	executionSvc := NewWorkflowExecutionService(db, logger)
+
+	return &WorkflowMigrationService{
+		db:          db,
+		logger:      logger,
+		workflowSvc: workflowSvc,
+		instanceSvc: instanceSvc,
+		versionSvc:  NewWorkflowVersionService(db, logger),
+		timerSvc:    NewWorkflowTimerService(db, logger),
+		messageSvc:  NewMessageSubscriptionService(db, logger),
+		engineSvc:   NewWorkflowEngineService(db, logger, workflowSvc, instanceSvc, executionSvc),
+	}
+}
+
+// InstanceMigrationPlan describes how to move instances between two versions
+// 未出现在 NodeMapping 中的节点按相同 ID 映射到目标版本
+type InstanceMigrationPlan struct {
+	SourceVersion int               `json:"sourceVersion"` // 0 表示部署前创建、未固定版本的实例
+	TargetVersion int               `json:"targetVersion" binding:"required"`
+	NodeMapping   map[string]string `json:"nodeMapping,omitempty"` // 源版本节点 ID -> 目标版本节点 ID
+	DryRun        bool              `json:"dryRun"`
+	BatchSize     int               `json:"batchSize,omitempty"`
+}
+
+// InstanceMigration describes the node mapping applied to one instance
+type InstanceMigration struct {
+	InstanceId  string   `json:"instanceId"`
+	FromNodeIds []string `json:"fromNodeIds"`
+	ToNodeIds   []string `json:"toNodeIds"`
+}
+
+// InstanceMigrationFailure describes an instance that cannot be migrated
+type InstanceMigrationFailure struct {
+	InstanceId      string   `json:"instanceId"`
+	UnmappedNodeIds []string `json:"unmappedNodeIds,omitempty"`
+	Reason          string   `json:"reason"`
+}
+
+// InstanceMigrationReport summarizes a migration run or dry run
+type InstanceMigrationReport struct {
+	WorkflowId    string                     `json:"workflowId"`
+	SourceVersion int                        `json:"sourceVersion"`
+	TargetVersion int                        `json:"targetVersion"`
+	DryRun        bool                       `json:"dryRun"`
+	Total         int                        `json:"total"`
+	Migrated      []InstanceMigration        `json:"migrated"` // 试运行时为可迁移的实例
+	Failed        []InstanceMigrationFailure `json:"failed"`
+}
+
+// MigrateInstances validates every active instance of the source version against the target definition
+// and, unless DryRun is set, re-pins the mappable ones to the target version batch by batch
+func (s *WorkflowMigrationService) MigrateInstances(ctx context.Context, workflowId string, plan InstanceMigrationPlan) (*InstanceMigrationReport, error) {
+	if plan.TargetVersion < 1 {
+		return nil, fmt.Errorf("%s: targetVersion must be a deployed version", models.ErrInvalidRequest)
+	}
+	if plan.SourceVersion < 0 || plan.SourceVersion == plan.TargetVersion {
+		return nil, fmt.Errorf("%s: sourceVersion must differ from targetVersion", models.ErrInvalidRequest)
+	}
+
+	source, err := s.loadDefinition(ctx, workflowId, plan.SourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.loadDefinition(ctx, workflowId, plan.TargetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// 映射本身有误时整个计划无效
+	for sourceNodeId, targetNodeId := range plan.NodeMapping {
+		if _, exists := source.Nodes[sourceNodeId]; !exists {
+			return nil, fmt.Errorf("%s: node %s not found in version %d", models.ErrInvalidNodeId, sourceNodeId, plan.SourceVersion)
+		}
+		if _, exists := target.Nodes[targetNodeId]; !exists {
+			return nil, fmt.Errorf("%s: node %s not found in version %d", models.ErrInvalidNodeId, targetNodeId, plan.TargetVersion)
+		}
+	}
+
+	batchSize := plan.BatchSize
+	if batchSize < 1 {
+		batchSize = defaultMigrationBatchSize
+	}
+	if batchSize > maxMigrationBatchSize {
+		batchSize = maxMigrationBatchSize
+	}
+
+	report := &InstanceMigrationReport{
+		WorkflowId:    workflowId,
+		SourceVersion: plan.SourceVersion,
+		TargetVersion: plan.TargetVersion,
+		DryRun:        plan.DryRun,
+		Migrated:      []InstanceMigration{},
+		Failed:        []InstanceMigrationFailure{},
+	}
+
+	afterId := ""
+	for {
+		instances, err := s.instanceSvc.ListActiveInstancesByVersion(ctx, workflowId, plan.SourceVersion, afterId, batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range instances {
+			instance := &instances[i]
+			report.Total++
+
+			toNodeIds, unmapped := mapCurrentNodes(source, target, plan.NodeMapping, instance.CurrentNodeIds)
+			if len(unmapped) > 0 {
+				report.Failed = append(report.Failed, InstanceMigrationFailure{
+					InstanceId:      instance.Id,
+					UnmappedNodeIds: unmapped,
+					Reason:          fmt.Sprintf("current nodes have no compatible node in version %d", plan.TargetVersion),
+				})
+				continue
+			}
+
+			if !plan.DryRun {
+				if err := s.migrateInstance(ctx, target, instance, plan.TargetVersion, toNodeIds); err != nil {
+					report.Failed = append(report.Failed, InstanceMigrationFailure{InstanceId: instance.Id, Reason: err.Error()})
+					continue
+				}
+			}
+
+			report.Migrated = append(report.Migrated, InstanceMigration{
+				InstanceId:  instance.Id,
+				FromNodeIds: instance.CurrentNodeIds,
+				ToNodeIds:   toNodeIds,
+			})
+		}
+
+		if len(instances) < batchSize || ctx.Err() != nil {
+			break
+		}
+		afterId = instances[len(instances)-1].Id
+	}
+
+	s.logger.Info().
+		Str("workflowId", workflowId).
+		Int("sourceVersion", plan.SourceVersion).
+		Int("targetVersion", plan.TargetVersion).
+		Bool("dryRun", plan.DryRun).
+		Int("total", report.Total).
+		Int("migrated", len(report.Migrated)).
+		Int("failed", len(report.Failed)).
+		Msg("Workflow instance migration finished")
+	return report, nil
+}
+
+// migrateInstance re-pins one instance and moves its waiting timers, message subscriptions and user tasks
+func (s *WorkflowMigrationService) migrateInstance(
+	ctx context.Context,
+	target *models.WorkflowDefinition,
+	instance *models.WorkflowInstance,
+	targetVersion int,
+	toNodeIds []string,
+) error {
+	migrated, err := s.instanceSvc.MigrateWorkflowInstance(ctx, instance, targetVersion, toNodeIds)
+	if err != nil {
+		return err
+	}
+
+	// 映射改名的节点上的等待事件会被取消后重新登记，取消前先取出令牌到达原节点时保存的流程变量
+	keptNodeIds := make([]string, 0, len(toNodeIds))
+	var renamedNodeIds []string
+	var renamedVariables []map[string]interface{}
+	for i, nodeId := range instance.CurrentNodeIds {
+		if toNodeIds[i] == nodeId {
+			keptNodeIds = append(keptNodeIds, nodeId)
+			continue
+		}
+		renamedNodeIds = append(renamedNodeIds, toNodeIds[i])
+		renamedVariables = append(renamedVariables, s.waitingVariables(ctx, migrated.Id, nodeId))
+	}
+
+	// 令牌已不在原节点上的等待事件被取消，目标版本中等待节点上的事件重新登记
+	if _, err := s.timerSvc.CancelStaleTimers(ctx, migrated.Id, toNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", migrated.Id).Msg("Failed to cancel timers of migrated instance")
+	}
+	if _, err := s.messageSvc.CancelStaleSubscriptions(ctx, migrated.Id, toNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", migrated.Id).Msg("Failed to cancel message subscriptions of migrated instance")
+	}
+	if _, err := s.engineSvc.signalSvc.CancelStaleSubscriptions(ctx, migrated.Id, toNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", migrated.Id).Msg("Failed to cancel signal subscriptions of migrated instance")
+	}
+	if _, err := s.engineSvc.jobSvc.CancelStaleJobs(ctx, migrated.Id, toNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", migrated.Id).Msg("Failed to cancel jobs of migrated instance")
+	}
+	// 外部任务同样保留仍停在同 ID 节点上的任务，目标节点不是外部任务时取消
+	if _, err := s.engineSvc.externalTaskSvc.CancelStaleExternalTasks(ctx, migrated.Id, externalTaskNodeIds(target, toNodeIds)); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", migrated.Id).Msg("Failed to cancel external tasks of migrated instance")
+	}
+
+	s.syncWaitingEvents(ctx, target, migrated, keptNodeIds, toNodeIds, nil)
+	for i, nodeId := range renamedNodeIds {
+		s.syncWaitingEvents(ctx, target, migrated, []string{nodeId}, toNodeIds, renamedVariables[i])
+	}
+	return nil
+}
+
+// syncWaitingEvents registers the timers, subscriptions and tasks of the parked nodes in the target version
+// 仍停在同 ID 节点上的待处理记录保留，改名节点上的记录以 variables 重新创建
+func (s *WorkflowMigrationService) syncWaitingEvents(
+	ctx context.Context,
+	target *models.WorkflowDefinition,
+	migrated *models.WorkflowInstance,
+	parkedNodeIds []string,
+	toNodeIds []string,
+	variables map[string]interface{},
+) {
+	s.engineSvc.syncTimers(ctx, target, migrated.WorkflowId, migrated.Id, parkedNodeIds, toNodeIds, variables)
+	s.engineSvc.syncMessageSubscriptions(ctx, target, migrated.WorkflowId, migrated.Id, parkedNodeIds, toNodeIds, variables)
+	s.engineSvc.syncSignalSubscriptions(ctx, target, migrated.WorkflowId, migrated.Id, parkedNodeIds, toNodeIds, variables)
+	s.engineSvc.syncUserTasks(ctx, target, migrated.WorkflowId, migrated.Id, parkedNodeIds, toNodeIds, variables)
+	s.engineSvc.syncExternalTasks(ctx, target, migrated.WorkflowId, migrated.Id, parkedNodeIds, toNodeIds, variables)
+}
+
+// waitingVariables returns the variables saved with the pending task or event of the token waiting at nodeId
+// 人工任务、外部任务和等待事件登记时都保存了当时的流程变量，依次查找第一条待处理记录；找不到时返回 nil
+func (s *WorkflowMigrationService) waitingVariables(ctx context.Context, instanceId string, nodeId string) map[string]interface{} {
+	if s.db.DB == nil {
+		return nil
+	}
+
+	lookups := []struct {
+		query  string
+		status string
+	}{
+		{`SELECT variables FROM user_tasks WHERE instance_id = $1 AND node_id = $2 AND status = $3 ORDER BY created_at DESC LIMIT 1`, models.UserTaskStatusPending},
+		{`SELECT variables FROM external_tasks WHERE instance_id = $1 AND node_id = $2 AND status = $3 ORDER BY created_at DESC LIMIT 1`, models.ExternalTaskStatusPending},
+		{`SELECT variables FROM workflow_timers WHERE instance_id = $1 AND scope_node_id = $2 AND status = $3 ORDER BY created_at DESC LIMIT 1`, models.TimerStatusPending},
+		{`SELECT variables FROM message_subscriptions WHERE instance_id = $1 AND scope_node_id = $2 AND status = $3 ORDER BY created_at DESC LIMIT 1`, models.SubscriptionStatusPending},
+		{`SELECT variables FROM signal_subscriptions WHERE instance_id = $1 AND scope_node_id = $2 AND status = $3 ORDER BY created_at DESC LIMIT 1`, models.SubscriptionStatusPending},
+	}
+	for _, lookup := range lookups {
+		var variablesBytes []byte
+		err := s.db.QueryRowContext(ctx, lookup.query, instanceId, nodeId, lookup.status).Scan(&variablesBytes)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			s.logger.Warn().Err(err).Str("instanceId", instanceId).Str("nodeId", nodeId).Msg("Failed to read variables of waiting node")
+			continue
+		}
+		var variables map[string]interface{}
+		if err := json.Unmarshal(variablesBytes, &variables); err != nil {
+			s.logger.Warn().Err(err).Str("instanceId", instanceId).Str("nodeId", nodeId).Msg("Failed to unmarshal variables of waiting node")
+			continue
+		}
+		return variables
+	}
+	return nil
+}
+
+// loadDefinition returns the definition snapshot of a version, or the current workflow XML for version 0
+func (s *WorkflowMigrationService) loadDefinition(ctx context.Context, workflowId string, version int) (*models.WorkflowDefinition, error) {
+	if version == 0 {
+		workflow, err := s.workflowSvc.GetWorkflowByID(ctx, workflowId)
+		if err != nil {
+			return nil, err
+		}
+		wd, err := parser.ParseBPMN(workflow.BpmnXml)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse BPMN XML: %w", err)
+		}
+		return wd, nil
+	}
+
+	workflowVersion, err := s.versionSvc.GetWorkflowVersion(ctx, workflowId, version)
+	if err != nil {
+		return nil, err
+	}
+	if workflowVersion.Definition == nil {
+		return parser.ParseBPMN(workflowVersion.BpmnXml)
+	}
+	return workflowVersion.Definition, nil
+}
+
+// mapCurrentNodes maps current node IDs to the target definition
+// 目标节点不存在或节点类型发生变化时视为无法映射
+func mapCurrentNodes(
+	source, target *models.WorkflowDefinition,
+	mapping map[string]string,
+	currentNodeIds []string,
+) (mapped []string, unmapped []string) {
+	mapped = make([]string, 0, len(currentNodeIds))
+	for _, nodeId := range currentNodeIds {
+		targetNodeId, exists := mapping[nodeId]
+		if !exists {
+			targetNodeId = nodeId
+		}
+
+		sourceNode, inSource := source.Nodes[nodeId]
+		targetNode, inTarget := target.Nodes[targetNodeId]
+		if !inTarget || (inSource && sourceNode.Type != targetNode.Type) {
+			unmapped = append(unmapped, nodeId)
+			continue
+		}
+		mapped = append(mapped, targetNodeId)
+	}
+	sort.Strings(unmapped)
+	return mapped, unmapped
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var migrationInstanceColumns = []string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}
+
+func setupWorkflowMigrationServiceTest(t *testing.T) (*WorkflowMigrationService, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	database := database.NewDatabase(&logger)
+	database.DB = db
+
+	service := NewWorkflowMigrationService(database, &logger)
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return service, mock, cleanup
+}
+
+// expectWorkflowVersion expects a GetWorkflowVersion query returning the parsed snapshot of bpmnXml
+func expectWorkflowVersion(t *testing.T, mock sqlmock.Sqlmock, version int, bpmnXml string) {
+	wd, err := parser.ParseBPMN(bpmnXml)
+	require.NoError(t, err)
+	definition, err := json.Marshal(wd)
+	require.NoError(t, err)
+
+	mock.ExpectQuery(`SELECT id, workflow_id, version, bpmn_xml, definition, is_active, created_at`).
+		WithArgs("test-workflow-id", version).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "version", "bpmn_xml", "definition", "is_active", "created_at"}).
+			AddRow("version-id", "test-workflow-id", version, bpmnXml, definition, version == 2, time.Now()))
+}
+
+// expectMigrationCandidates expects the batch query of the migration, returning one instance at nodes
+// and one at a node that no longer exists
+func expectMigrationCandidates(mock sqlmock.Sqlmock, nodes []string) {
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("test-workflow-id", 1, sqlmock.AnyArg(), "", 100).
+		WillReturnRows(sqlmock.NewRows(migrationInstanceColumns).
+			AddRow("instance-1", "test-workflow-id", "Instance 1", models.InstanceStatusRunning, pq.Array(nodes), 3, 1, now, now).
+			AddRow("instance-2", "test-workflow-id", "Instance 2", models.InstanceStatusRunning, pq.Array([]string{"Removed_Task"}), 2, 1, now, now))
+}
+
+func TestWorkflowMigrationService_MigrateInstances_DryRun(t *testing.T) {
+	service, mock, cleanup := setupWorkflowMigrationServiceTest(t)
+	defer cleanup()
+
+	targetBPMN := strings.ReplaceAll(createParallelTestBPMN(), "UserTask_Finance", "UserTask_Budget")
+	expectWorkflowVersion(t, mock, 1, createParallelTestBPMN())
+	expectWorkflowVersion(t, mock, 2, targetBPMN)
+	expectMigrationCandidates(mock, []string{"UserTask_Finance", "Join_1"})
+
+	report, err := service.MigrateInstances(context.Background(), "test-workflow-id", InstanceMigrationPlan{
+		SourceVersion: 1,
+		TargetVersion: 2,
+		NodeMapping:   map[string]string{"UserTask_Finance": "UserTask_Budget"},
+		DryRun:        true,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Total)
+	require.Len(t, report.Migrated, 1)
+	assert.Equal(t, "instance-1", report.Migrated[0].InstanceId)
+	assert.Equal(t, []string{"UserTask_Budget", "Join_1"}, report.Migrated[0].ToNodeIds)
+	require.Len(t, report.Failed, 1)
+	assert.Equal(t, "instance-2", report.Failed[0].InstanceId)
+	assert.Equal(t, []string{"Removed_Task"}, report.Failed[0].UnmappedNodeIds)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowMigrationService_MigrateInstances_UpdatesInstances(t *testing.T) {
+	service, mock, cleanup := setupWorkflowMigrationServiceTest(t)
+	defer cleanup()
+
+	now := time.Now()
+	targetBPMN := strings.ReplaceAll(createParallelTestBPMN(), "UserTask_Finance", "UserTask_Budget")
+	expectWorkflowVersion(t, mock, 1, createParallelTestBPMN())
+	expectWorkflowVersion(t, mock, 2, targetBPMN)
+	expectMigrationCandidates(mock, []string{"UserTask_Finance"})
+
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(2, pq.Array([]string{"UserTask_Budget"}), sqlmock.AnyArg(), "instance-1", 1, 3).
+		WillReturnRows(sqlmock.NewRows(migrationInstanceColumns).
+			AddRow("instance-1", "test-workflow-id", "Instance 1", models.InstanceStatusRunning, pq.Array([]string{"UserTask_Budget"}), 4, 2, now, now))
+	mock.ExpectExec(`UPDATE workflow_timers`).
+		WithArgs(models.TimerStatusCancelled, sqlmock.AnyArg(), "instance-1", models.TimerStatusPending, pq.Array([]string{"UserTask_Budget"})).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`UPDATE message_subscriptions`).
+		WithArgs(models.SubscriptionStatusCancelled, sqlmock.AnyArg(), "instance-1", models.SubscriptionStatusPending, pq.Array([]string{"UserTask_Budget"})).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	report, err := service.MigrateInstances(context.Background(), "test-workflow-id", InstanceMigrationPlan{
+		SourceVersion: 1,
+		TargetVersion: 2,
+		NodeMapping:   map[string]string{"UserTask_Finance": "UserTask_Budget"},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, report.Migrated, 1)
+	require.Len(t, report.Failed, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowMigrationService_MigrateInstances_RenamedNodeKeepsVariables(t *testing.T) {
+	service, mock, cleanup := setupWorkflowMigrationServiceTest(t)
+	defer cleanup()
+
+	now := time.Now()
+	targetBPMN := strings.ReplaceAll(createParallelTestBPMN(), "UserTask_Finance", "UserTask_Budget")
+	expectWorkflowVersion(t, mock, 1, createParallelTestBPMN())
+	expectWorkflowVersion(t, mock, 2, targetBPMN)
+	expectMigrationCandidates(mock, []string{"UserTask_Finance"})
+
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(2, pq.Array([]string{"UserTask_Budget"}), sqlmock.AnyArg(), "instance-1", 1, 3).
+		WillReturnRows(sqlmock.NewRows(migrationInstanceColumns).
+			AddRow("instance-1", "test-workflow-id", "Instance 1", models.InstanceStatusRunning, pq.Array([]string{"UserTask_Budget"}), 4, 2, now, now))
+	// 改名节点上的人工任务取消前读取其流程变量
+	mock.ExpectQuery(`SELECT variables FROM user_tasks`).
+		WithArgs("instance-1", "UserTask_Finance", models.UserTaskStatusPending).
+		WillReturnRows(sqlmock.NewRows([]string{"variables"}).AddRow([]byte(`{"amount":1500}`)))
+	mock.ExpectExec(`UPDATE user_tasks`).
+		WithArgs(models.UserTaskStatusCancelled, sqlmock.AnyArg(), "instance-1", models.UserTaskStatusPending, pq.Array([]string{"UserTask_Budget"})).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 目标节点上的任务沿用原任务的流程变量
+	mock.ExpectExec(`INSERT INTO user_tasks`).
+		WithArgs(sqlmock.AnyArg(), "instance-1", "test-workflow-id", "UserTask_Budget", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			`{"amount":1500}`, models.UserTaskStatusPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	report, err := service.MigrateInstances(context.Background(), "test-workflow-id", InstanceMigrationPlan{
+		SourceVersion: 1,
+		TargetVersion: 2,
+		NodeMapping:   map[string]string{"UserTask_Finance": "UserTask_Budget"},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, report.Migrated, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowMigrationService_MigrateInstances_InvalidMapping(t *testing.T) {
+	service, mock, cleanup := setupWorkflowMigrationServiceTest(t)
+	defer cleanup()
+
+	expectWorkflowVersion(t, mock, 1, createParallelTestBPMN())
+	expectWorkflowVersion(t, mock, 2, createParallelTestBPMN())
+
+	_, err := service.MigrateInstances(context.Background(), "test-workflow-id", InstanceMigrationPlan{
+		SourceVersion: 1,
+		TargetVersion: 2,
+		NodeMapping:   map[string]string{"UserTask_Finance": "UserTask_Missing"},
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInvalidNodeId)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMapCurrentNodes_NodeTypeChanged(t *testing.T) {
+	source, err := parser.ParseBPMN(createParallelTestBPMN())
+	require.NoError(t, err)
+	target, err := parser.ParseBPMN(createParallelTestBPMN())
+	require.NoError(t, err)
+
+	// 同 ID 节点类型变化时不能映射
+	legal := target.Nodes["Task_Legal"]
+	legal.Type = parser.NodeTypeUserTask
+	target.Nodes["Task_Legal"] = legal
+
+	mapped, unmapped := mapCurrentNodes(source, target, nil, []string{"Task_Legal", "UserTask_Finance"})
+
+	assert.Equal(t, []string{"UserTask_Finance"}, mapped)
+	assert.Equal(t, []string{"Task_Legal"}, unmapped)
+}
@@ -0,0 +1,441 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/interceptor"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/expr-lang/expr"
+)
+
+// multiInstanceWorkers 并行多实例同时执行的实例数量上限
+const multiInstanceWorkers = 8
+
+// multiInstanceResult summarizes the instances of a multi-instance task
+type multiInstanceResult struct {
+	Instances int
+	Completed int
+	// FailedResponse 业务失败而中止多实例的实例响应，作为整个任务的业务错误抛出
+	FailedResponse *BusinessResponse
+}
+
+// loopInstanceResult is the outcome of a single instance of a multi-instance task
+type loopInstanceResult struct {
+	response  *BusinessResponse
+	output    interface{}
+	errorCode string
+	err       error
+}
+
+// subProcessLoop tracks a multi-instance SubProcess whose instances run one after another in the token loop
+type subProcessLoop struct {
+	elements  []interface{}
+	index     int
+	completed int
+	outputs   []interface{}
+	variables map[string]interface{} // 执行中的流程变量（原地修改）
+	snapshot  map[string]interface{} // 进入循环前的流程变量，循环结束后恢复
+}
+
+// executeMultiInstance runs all instances of a multi-instance task
+// 串行时逐个执行，并行时最多同时执行 multiInstanceWorkers 个实例；每个实例完成后求值完成条件，满足时不再执行（或等待）剩余实例
+// 实例的输出按顺序写入 OutputCollection，未执行的实例对应 nil
+func (s *WorkflowEngineService) executeMultiInstance(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	node *models.Node,
+	executionId string,
+	businessParams map[string]interface{},
+	variables map[string]interface{},
+) (*multiInstanceResult, error) {
+	mi := node.MultiInstance
+	elements, err := loopElements(node, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &multiInstanceResult{Instances: len(elements)}
+	outputs := make([]interface{}, len(elements))
+
+	if mi.IsSequential {
+		for i, element := range elements {
+			instance := s.runLoopInstance(ctx, wd, node, executionId, businessParams, loopVariables(mi, variables, elements, i, element), i)
+			if instance.err != nil {
+				return nil, instance.err
+			}
+			if instance.errorCode != "" {
+				result.FailedResponse = instance.response
+				return result, nil
+			}
+			outputs[i] = instance.output
+			result.Completed++
+
+			done, err := s.isLoopComplete(mi, variables, outputs, len(elements), result.Completed, 0)
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				break
+			}
+		}
+	} else {
+		loopCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// 第一个失败或满足完成条件后取消其余实例，之后完成的实例结果被忽略
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		var failed *loopInstanceResult
+		stopped := false
+		complete := func(i int, instance loopInstanceResult) {
+			mu.Lock()
+			defer mu.Unlock()
+			if stopped {
+				return
+			}
+			if instance.err != nil || instance.errorCode != "" {
+				failed = &instance
+				stopped = true
+				cancel()
+				return
+			}
+			outputs[i] = instance.output
+			result.Completed++
+
+			active := len(elements) - result.Completed
+			done, err := s.isLoopComplete(mi, variables, outputs, len(elements), result.Completed, active)
+			if err != nil {
+				failed = &loopInstanceResult{err: err}
+			}
+			if done || err != nil {
+				stopped = true
+				cancel()
+			}
+		}
+
+		// 最多 multiInstanceWorkers 个实例同时执行，取消后尚未开始的实例不再执行
+		queue := make(chan int)
+		for w := 0; w < multiInstanceWorkers && w < len(elements); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range queue {
+					if loopCtx.Err() != nil {
+						continue
+					}
+					complete(i, s.runLoopInstance(loopCtx, wd, node, executionId, businessParams, loopVariables(mi, variables, elements, i, elements[i]), i))
+				}
+			}()
+		}
+		for i := range elements {
+			queue <- i
+		}
+		close(queue)
+		wg.Wait()
+
+		if failed != nil {
+			if failed.err != nil {
+				return nil, failed.err
+			}
+			result.FailedResponse = failed.response
+			return result, nil
+		}
+	}
+
+	if mi.OutputCollection != "" {
+		variables[mi.OutputCollection] = outputs
+		if err := checkDeclaredVariables(wd, variables, []string{mi.OutputCollection}); err != nil {
+			return nil, err
+		}
+	}
+
+	s.logger.Info().
+		Str("nodeId", node.Id).
+		Bool("isSequential", mi.IsSequential).
+		Int("instances", result.Instances).
+		Int("completed", result.Completed).
+		Msg("Multi-instance task completed")
+	return result, nil
+}
+
+// runLoopInstance executes one instance of a multi-instance task with its own variables
+// 每个实例单独写入执行历史，输入中的 loopCounter 标识实例
+func (s *WorkflowEngineService) runLoopInstance(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	node *models.Node,
+	executionId string,
+	businessParams map[string]interface{},
+	variables map[string]interface{},
+	loopCounter int,
+) loopInstanceResult {
+	startTime := time.Now()
+	variablesBefore := cloneVariables(variables)
+	inputData := map[string]interface{}{"loopCounter": loopCounter}
+	if node.MultiInstance.ElementVariable != "" {
+		inputData["element"] = variables[node.MultiInstance.ElementVariable]
+	}
+	outputData := map[string]interface{}{}
+
+	var instance loopInstanceResult
+	nodeResult, err := interceptor.Intercept(ctx,
+		"ExecuteNode",
+		s.ExecuteNode,
+		ExecuteNodeParams{
+			Node:           node,
+			ExecutionID:    executionId,
+			BusinessParams: businessParams,
+			Variables:      variables,
+		},
+	)
+	if err != nil {
+		instance.err = fmt.Errorf("instance %d of node %s failed: %w", loopCounter, node.Id, err)
+	} else if nodeResult != nil && nodeResult.BusinessResponse != nil {
+		instance.response = nodeResult.BusinessResponse
+		outputData["statusCode"] = instance.response.StatusCode
+		outputData["body"] = instance.response.Body
+
+		instance.errorCode, instance.err = s.matchBusinessError(node, instance.response)
+		if instance.errorCode != "" {
+			outputData["errorCode"] = instance.errorCode
+		} else if instance.err == nil {
+			instance.err = s.applyOutputMappings(node, instance.response, variables)
+			if instance.err == nil {
+				instance.err = checkDeclaredVariables(wd, variables, mappingTargets(node.OutputMappings))
+			}
+		}
+	}
+	if changes := applyScriptVariables(nodeResult, variables); changes != nil {
+		outputData["variables"] = changes
+		if instance.err == nil {
+			instance.err = checkDeclaredVariables(wd, variables, variableNames(changes))
+		}
+	}
+
+	if instance.err == nil && instance.errorCode == "" && node.MultiInstance.OutputElement != "" {
+		instance.output, err = expr.Eval(node.MultiInstance.OutputElement, variables)
+		if err != nil {
+			instance.err = fmt.Errorf("failed to evaluate outputElement of node %s: %w", node.Id, err)
+		} else {
+			outputData["output"] = instance.output
+		}
+	}
+
+	s.recordNodeExecution(ctx, executionId, node, inputData, outputData, variablesBefore, variables, time.Since(startTime), instance.err)
+	return instance
+}
+
+// isLoopComplete evaluates the completion condition after an instance completes
+// 完成条件可以访问流程变量、已收集的输出以及 nrOfInstances、nrOfCompletedInstances、nrOfActiveInstances
+func (s *WorkflowEngineService) isLoopComplete(
+	mi *models.MultiInstance,
+	variables map[string]interface{},
+	outputs []interface{},
+	instances int,
+	completed int,
+	active int,
+) (bool, error) {
+	if mi.CompletionCondition == "" {
+		return false, nil
+	}
+
+	env := cloneVariables(variables)
+	if mi.OutputCollection != "" {
+		env[mi.OutputCollection] = outputs
+	}
+	env["nrOfInstances"] = instances
+	env["nrOfCompletedInstances"] = completed
+	env["nrOfActiveInstances"] = active
+
+	done, err := s.evaluateCondition(mi.CompletionCondition, env)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate completionCondition: %w", err)
+	}
+	return done, nil
+}
+
+// loopElements evaluates the collection (or loop cardinality) of a multi-instance node
+// 使用 loopCardinality 时元素为实例序号
+func loopElements(node *models.Node, variables map[string]interface{}) ([]interface{}, error) {
+	mi := node.MultiInstance
+	if mi.Collection == "" {
+		value, err := expr.Eval(mi.LoopCardinality, variables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate loopCardinality of node %s: %w", node.Id, err)
+		}
+		count, ok := value.(int)
+		if !ok {
+			if f, isFloat := value.(float64); isFloat && f == float64(int(f)) {
+				count, ok = int(f), true
+			}
+		}
+		if !ok || count < 0 {
+			return nil, fmt.Errorf("loopCardinality of node %s must be a non-negative integer, got %v", node.Id, value)
+		}
+		elements := make([]interface{}, count)
+		for i := range elements {
+			elements[i] = i
+		}
+		return elements, nil
+	}
+
+	value, err := expr.Eval(mi.Collection, variables)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate collection of node %s: %w", node.Id, err)
+	}
+	if value == nil {
+		return []interface{}{}, nil
+	}
+	collection := reflect.ValueOf(value)
+	if collection.Kind() != reflect.Slice && collection.Kind() != reflect.Array {
+		return nil, fmt.Errorf("collection of node %s is not a list, got %T", node.Id, value)
+	}
+	elements := make([]interface{}, collection.Len())
+	for i := range elements {
+		elements[i] = collection.Index(i).Interface()
+	}
+	return elements, nil
+}
+
+// loopVariables builds the variables of one instance: a copy of the process variables plus the element and loopCounter
+func loopVariables(
+	mi *models.MultiInstance,
+	variables map[string]interface{},
+	elements []interface{},
+	index int,
+	element interface{},
+) map[string]interface{} {
+	instanceVariables := cloneVariables(variables)
+	if mi.ElementVariable != "" {
+		instanceVariables[mi.ElementVariable] = element
+	}
+	instanceVariables["loopCounter"] = index
+	instanceVariables["nrOfInstances"] = len(elements)
+	return instanceVariables
+}
+
+// startSubProcessLoop enters the first instance of a multi-instance SubProcess
+// 子流程内的令牌没有实例标识，并行的多实例子流程同样逐个执行实例；实例内的节点直接使用（被替换的）流程变量
+func (s *WorkflowEngineService) startSubProcessLoop(
+	wd *models.WorkflowDefinition,
+	tokens *tokenState,
+	subProcess *models.Node,
+	variables map[string]interface{},
+) ([]string, error) {
+	mi := subProcess.MultiInstance
+	elements, err := loopElements(subProcess, variables)
+	if err != nil {
+		return nil, err
+	}
+	if len(elements) == 0 {
+		if mi.OutputCollection != "" {
+			variables[mi.OutputCollection] = []interface{}{}
+		}
+		return s.leaveSubProcess(wd, subProcess), nil
+	}
+
+	loop := &subProcessLoop{
+		elements:  elements,
+		outputs:   make([]interface{}, len(elements)),
+		variables: variables,
+		snapshot:  cloneVariables(variables),
+	}
+	if tokens.loops == nil {
+		tokens.loops = make(map[string]*subProcessLoop)
+	}
+	tokens.loops[subProcess.Id] = loop
+	loop.reset(loopVariables(mi, loop.snapshot, elements, 0, elements[0]))
+
+	s.logger.Info().
+		Str("subProcessId", subProcess.Id).
+		Int("instances", len(elements)).
+		Msg("Entering multi-instance SubProcess")
+	return s.enterSubProcess(wd, subProcess), nil
+}
+
+// completeSubProcessInstance is called when the last token of a SubProcess instance completes
+// 还有剩余实例且不满足完成条件时重新进入子流程，否则恢复流程变量、写入输出集合并离开子流程
+func (s *WorkflowEngineService) completeSubProcessInstance(
+	wd *models.WorkflowDefinition,
+	tokens *tokenState,
+	subProcess *models.Node,
+) ([]string, error) {
+	loop := tokens.loops[subProcess.Id]
+	if loop == nil {
+		return s.leaveSubProcess(wd, subProcess), nil
+	}
+
+	mi := subProcess.MultiInstance
+	if mi.OutputElement != "" {
+		output, err := expr.Eval(mi.OutputElement, loop.variables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate outputElement of node %s: %w", subProcess.Id, err)
+		}
+		loop.outputs[loop.index] = output
+	}
+	loop.completed++
+
+	done, err := s.isLoopComplete(mi, loop.snapshot, loop.outputs, len(loop.elements), loop.completed, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !done && loop.index+1 < len(loop.elements) {
+		loop.index++
+		loop.reset(loopVariables(mi, loop.snapshot, loop.elements, loop.index, loop.elements[loop.index]))
+		return s.enterSubProcess(wd, subProcess), nil
+	}
+
+	delete(tokens.loops, subProcess.Id)
+	loop.reset(loop.snapshot)
+	if mi.OutputCollection != "" {
+		loop.variables[mi.OutputCollection] = loop.outputs
+	}
+	s.logger.Info().
+		Str("subProcessId", subProcess.Id).
+		Int("completed", loop.completed).
+		Msg("Multi-instance SubProcess completed")
+	return s.leaveSubProcess(wd, subProcess), nil
+}
+
+// abandonSubProcessLoops stops the multi-instance SubProcesses in the scope and restores the variables
+// 由外向内恢复，最外层循环进入前的变量最后写回
+func (s *WorkflowEngineService) abandonSubProcessLoops(wd *models.WorkflowDefinition, tokens *tokenState, scopeId string) {
+	var subProcessIds []string
+	for subProcessId := range tokens.loops {
+		if subProcessId == scopeId || isNodeInScope(wd, subProcessId, scopeId) {
+			subProcessIds = append(subProcessIds, subProcessId)
+		}
+	}
+	sort.Slice(subProcessIds, func(i, j int) bool {
+		return isNodeInScope(wd, subProcessIds[i], subProcessIds[j])
+	})
+	for _, subProcessId := range subProcessIds {
+		tokens.loops[subProcessId].reset(tokens.loops[subProcessId].snapshot)
+		delete(tokens.loops, subProcessId)
+	}
+}
+
+// loopingSubProcess returns the multi-instance SubProcess that is running around the node, if any
+func loopingSubProcess(wd *models.WorkflowDefinition, tokens *tokenState, nodeId string) string {
+	for subProcessId := range tokens.loops {
+		if isNodeInScope(wd, nodeId, subProcessId) {
+			return subProcessId
+		}
+	}
+	return ""
+}
+
+// reset replaces the running variables in place so every holder of the map sees the instance variables
+func (l *subProcessLoop) reset(variables map[string]interface{}) {
+	for key := range l.variables {
+		delete(l.variables, key)
+	}
+	for key, value := range variables {
+		l.variables[key] = value
+	}
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createMultiInstanceTestBPMN 为购物车中的每个商品调用一次评分接口，之后停在 UserTask 上
+func createMultiInstanceTestBPMN(serviceURL string, loop string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1" name="Cart Scoring">
+    <bpmn:serviceTask id="ServiceTask_Score" name="Score Product">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+      <bpmn:extensionElements>
+        <xflow:url value="` + serviceURL + `"/>
+        <xflow:input source="item.sku" target="sku"/>
+        <xflow:output source="body.score" target="score"/>
+      </bpmn:extensionElements>
+      ` + loop + `
+    </bpmn:serviceTask>
+    <bpmn:boundaryEvent id="Boundary_ScoreFailed" attachedToRef="ServiceTask_Score">
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:errorEventDefinition/>
+    </bpmn:boundaryEvent>
+    <bpmn:userTask id="UserTask_Review" name="Review Scores">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:userTask id="UserTask_Fix" name="Fix Cart">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="ServiceTask_Score" targetRef="UserTask_Review"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Boundary_ScoreFailed" targetRef="UserTask_Fix"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+// newScoringServer returns score = len(sku) * 10 and records the scored SKUs in call order
+// SKU "slow" 阻塞到请求被取消，SKU "bad" 返回 422
+func newScoringServer(t *testing.T) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var skus []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		sku, _ := body["sku"].(string)
+
+		mu.Lock()
+		skus = append(skus, sku)
+		mu.Unlock()
+
+		switch sku {
+		case "slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		case "bad":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"score": len(sku) * 10})
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, skus...)
+	}
+}
+
+func cartItems(skus ...string) []interface{} {
+	items := make([]interface{}, len(skus))
+	for i, sku := range skus {
+		items[i] = map[string]interface{}{"sku": sku}
+	}
+	return items
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_MultiInstanceServiceTask(t *testing.T) {
+	tests := []struct {
+		name           string
+		loop           string
+		skus           []string
+		expectedScores []interface{}
+		expectedCalls  []string // nil 表示只比较调用集合
+		expectedNodes  []string
+	}{
+		{
+			name: "sequential calls once per item in order",
+			loop: `<bpmn:multiInstanceLoopCharacteristics isSequential="true">
+        <bpmn:extensionElements><xflow:loop collection="cart.items" elementVariable="item" outputElement="score" outputCollection="scores"/></bpmn:extensionElements>
+      </bpmn:multiInstanceLoopCharacteristics>`,
+			skus:           []string{"a", "bb", "ccc"},
+			expectedScores: []interface{}{float64(10), float64(20), float64(30)},
+			expectedCalls:  []string{"a", "bb", "ccc"},
+			expectedNodes:  []string{"UserTask_Review"},
+		},
+		{
+			name: "sequential completion condition skips remaining items",
+			loop: `<bpmn:multiInstanceLoopCharacteristics isSequential="true">
+        <bpmn:extensionElements><xflow:loop collection="cart.items" elementVariable="item" outputElement="score" outputCollection="scores"/></bpmn:extensionElements>
+        <bpmn:completionCondition>nrOfCompletedInstances >= 2</bpmn:completionCondition>
+      </bpmn:multiInstanceLoopCharacteristics>`,
+			skus:           []string{"a", "bb", "ccc"},
+			expectedScores: []interface{}{float64(10), float64(20), nil},
+			expectedCalls:  []string{"a", "bb"},
+			expectedNodes:  []string{"UserTask_Review"},
+		},
+		{
+			name: "parallel aggregates outputs in item order",
+			loop: `<bpmn:multiInstanceLoopCharacteristics>
+        <bpmn:extensionElements><xflow:loop collection="cart.items" elementVariable="item" outputElement="score" outputCollection="scores"/></bpmn:extensionElements>
+      </bpmn:multiInstanceLoopCharacteristics>`,
+			skus:           []string{"a", "bb", "ccc"},
+			expectedScores: []interface{}{float64(10), float64(20), float64(30)},
+			expectedNodes:  []string{"UserTask_Review"},
+		},
+		{
+			name: "parallel completion condition cancels the running instance",
+			loop: `<bpmn:multiInstanceLoopCharacteristics isSequential="false">
+        <bpmn:extensionElements><xflow:loop collection="cart.items" elementVariable="item" outputElement="score" outputCollection="scores"/></bpmn:extensionElements>
+        <bpmn:completionCondition>nrOfCompletedInstances == 2</bpmn:completionCondition>
+      </bpmn:multiInstanceLoopCharacteristics>`,
+			skus:           []string{"a", "slow", "ccc"},
+			expectedScores: []interface{}{float64(10), nil, float64(30)},
+			expectedNodes:  []string{"UserTask_Review"},
+		},
+		{
+			name: "empty collection completes without calls",
+			loop: `<bpmn:multiInstanceLoopCharacteristics isSequential="true">
+        <bpmn:extensionElements><xflow:loop collection="cart.items" elementVariable="item" outputElement="score" outputCollection="scores"/></bpmn:extensionElements>
+      </bpmn:multiInstanceLoopCharacteristics>`,
+			skus:           []string{},
+			expectedScores: []interface{}{},
+			expectedCalls:  []string{},
+			expectedNodes:  []string{"UserTask_Review"},
+		},
+		{
+			name: "business error of an instance is thrown from the task",
+			loop: `<bpmn:multiInstanceLoopCharacteristics isSequential="true">
+        <bpmn:extensionElements><xflow:loop collection="cart.items" elementVariable="item" outputElement="score" outputCollection="scores"/></bpmn:extensionElements>
+      </bpmn:multiInstanceLoopCharacteristics>`,
+			skus:          []string{"a", "bad", "ccc"},
+			expectedCalls: []string{"a", "bad"},
+			expectedNodes: []string{"UserTask_Fix"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+			defer cleanup()
+
+			server, calls := newScoringServer(t)
+			workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createMultiInstanceTestBPMN(server.URL, tt.loop), Status: models.StatusDraft}
+			instance := &models.WorkflowInstance{
+				Id:             "test-instance-id",
+				WorkflowId:     workflow.Id,
+				Status:         models.InstanceStatusRunning,
+				CurrentNodeIds: []string{"ServiceTask_Score"},
+			}
+
+			result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "ServiceTask_Score", map[string]interface{}{
+				"cart": map[string]interface{}{"items": cartItems(tt.skus...)},
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedNodes, result.EngineResponse.CurrentNodeIds)
+			if tt.expectedCalls != nil {
+				assert.Equal(t, tt.expectedCalls, calls())
+			} else {
+				assert.ElementsMatch(t, tt.skus, calls())
+			}
+
+			variables := result.EngineResponse.Variables
+			if tt.expectedScores != nil {
+				assert.Equal(t, tt.expectedScores, variables["scores"])
+			} else {
+				assert.NotContains(t, variables, "scores")
+			}
+			// 实例变量只在实例内可见
+			for _, name := range []string{"item", "score", "loopCounter", "nrOfInstances"} {
+				assert.NotContains(t, variables, name)
+			}
+		})
+	}
+}
+
+// createMultiInstanceSubProcessBPMN 对每个订单执行一次子流程：计算运费后经过排他网关决定是否加急
+func createMultiInstanceSubProcessBPMN(body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1" name="Ship Orders">
+    <bpmn:subProcess id="SubProcess_Ship" name="Ship Order">
+      <bpmn:outgoing>Flow_Out</bpmn:outgoing>
+      <bpmn:multiInstanceLoopCharacteristics isSequential="true">
+        <bpmn:extensionElements><xflow:loop collection="orders" elementVariable="order" outputElement="order.weight &gt; 10" outputCollection="expressFlags"/></bpmn:extensionElements>
+      </bpmn:multiInstanceLoopCharacteristics>
+      <bpmn:startEvent id="Sub_Start">
+        <bpmn:outgoing>Sub_Flow_1</bpmn:outgoing>
+      </bpmn:startEvent>
+      ` + body + `
+      <bpmn:endEvent id="Sub_End">
+        <bpmn:incoming>Sub_Flow_2</bpmn:incoming>
+      </bpmn:endEvent>
+    </bpmn:subProcess>
+    <bpmn:userTask id="UserTask_Confirm" name="Confirm Shipment">
+      <bpmn:incoming>Flow_Out</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:sequenceFlow id="Flow_Out" sourceRef="SubProcess_Ship" targetRef="UserTask_Confirm"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_MultiInstanceParallelLimit(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	// 记录同时处理的请求数量的峰值
+	var mu sync.Mutex
+	running, peak := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"score": 1}`))
+	}))
+	defer server.Close()
+
+	loop := `<bpmn:multiInstanceLoopCharacteristics>
+        <bpmn:extensionElements><xflow:loop collection="cart.items" elementVariable="item" outputElement="score" outputCollection="scores"/></bpmn:extensionElements>
+      </bpmn:multiInstanceLoopCharacteristics>`
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: createMultiInstanceTestBPMN(server.URL, loop), Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"ServiceTask_Score"},
+	}
+	skus := make([]string, 3*multiInstanceWorkers)
+	for i := range skus {
+		skus[i] = "sku"
+	}
+
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "ServiceTask_Score", map[string]interface{}{
+		"cart": map[string]interface{}{"items": cartItems(skus...)},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Review"}, result.EngineResponse.CurrentNodeIds)
+	assert.Len(t, result.EngineResponse.Variables["scores"], len(skus))
+	assert.LessOrEqual(t, peak, multiInstanceWorkers)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_MultiInstanceSubProcess(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	// 网关根据当前实例的元素变量选择分支
+	workflow := &models.Workflow{Id: "test-workflow-id", Status: models.StatusDraft, BpmnXml: createMultiInstanceSubProcessBPMN(`
+      <bpmn:exclusiveGateway id="Sub_Gateway" default="Sub_Flow_Standard">
+        <bpmn:incoming>Sub_Flow_1</bpmn:incoming>
+        <bpmn:outgoing>Sub_Flow_Express</bpmn:outgoing>
+        <bpmn:outgoing>Sub_Flow_Standard</bpmn:outgoing>
+      </bpmn:exclusiveGateway>
+      <bpmn:task id="Sub_Express">
+        <bpmn:incoming>Sub_Flow_Express</bpmn:incoming>
+        <bpmn:outgoing>Sub_Flow_2</bpmn:outgoing>
+      </bpmn:task>
+      <bpmn:sequenceFlow id="Sub_Flow_1" sourceRef="Sub_Start" targetRef="Sub_Gateway"/>
+      <bpmn:sequenceFlow id="Sub_Flow_Express" sourceRef="Sub_Gateway" targetRef="Sub_Express">
+        <bpmn:conditionExpression>order.weight > 10</bpmn:conditionExpression>
+      </bpmn:sequenceFlow>
+      <bpmn:sequenceFlow id="Sub_Flow_Standard" sourceRef="Sub_Gateway" targetRef="Sub_End"/>
+      <bpmn:sequenceFlow id="Sub_Flow_2" sourceRef="Sub_Express" targetRef="Sub_End"/>`)}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"SubProcess_Ship"},
+	}
+
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "SubProcess_Ship", map[string]interface{}{
+		"orders": []interface{}{
+			map[string]interface{}{"id": "o-1", "weight": 3},
+			map[string]interface{}{"id": "o-2", "weight": 25},
+		},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Confirm"}, result.EngineResponse.CurrentNodeIds)
+	// 输出表达式基于实例内的元素变量求值
+	assert.Equal(t, []interface{}{false, true}, result.EngineResponse.Variables["expressFlags"])
+	assert.NotContains(t, result.EngineResponse.Variables, "order")
+	assert.NotContains(t, result.EngineResponse.Variables, "loopCounter")
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_MultiInstanceSubProcessCannotWait(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "test-workflow-id", Status: models.StatusDraft, BpmnXml: createMultiInstanceSubProcessBPMN(`
+      <bpmn:intermediateCatchEvent id="Sub_Wait">
+        <bpmn:incoming>Sub_Flow_1</bpmn:incoming>
+        <bpmn:outgoing>Sub_Flow_2</bpmn:outgoing>
+        <bpmn:timerEventDefinition><bpmn:timeDuration>PT1H</bpmn:timeDuration></bpmn:timerEventDefinition>
+      </bpmn:intermediateCatchEvent>
+      <bpmn:sequenceFlow id="Sub_Flow_1" sourceRef="Sub_Start" targetRef="Sub_Wait"/>
+      <bpmn:sequenceFlow id="Sub_Flow_2" sourceRef="Sub_Wait" targetRef="Sub_End"/>`)}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"SubProcess_Ship"},
+	}
+
+	_, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "SubProcess_Ship", map[string]interface{}{
+		"orders": []interface{}{"o-1"},
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "multi-instance SubProcess SubProcess_Ship must complete within one execution")
+}
+
+func TestLoopElements(t *testing.T) {
+	variables := map[string]interface{}{
+		"items": []string{"a", "b"},
+		"count": 3,
+		"name":  "cart",
+	}
+
+	node := &models.Node{Id: "Task_1", MultiInstance: &models.MultiInstance{Collection: "items"}}
+	elements, err := loopElements(node, variables)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b"}, elements)
+
+	node.MultiInstance = &models.MultiInstance{LoopCardinality: "count"}
+	elements, err = loopElements(node, variables)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{0, 1, 2}, elements)
+
+	node.MultiInstance = &models.MultiInstance{Collection: "name"}
+	_, err = loopElements(node, variables)
+	assert.Error(t, err)
+
+	node.MultiInstance = &models.MultiInstance{LoopCardinality: "-1"}
+	_, err = loopElements(node, variables)
+	assert.Error(t, err)
+}
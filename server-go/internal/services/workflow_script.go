@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// scriptFunctions 脚本允许调用的 expr 内置函数
+// 不包含 now、date、duration、timezone 等依赖执行时刻的函数，同样的输入总是得到同样的变量
+var scriptFunctions = []string{
+	"all", "none", "any", "one", "filter", "map", "find", "findIndex", "findLast", "findLastIndex",
+	"count", "sum", "groupBy", "sortBy", "reduce",
+	"len", "type", "abs", "ceil", "floor", "round", "int", "float", "string",
+	"trim", "trimPrefix", "trimSuffix", "upper", "lower", "split", "splitAfter", "replace", "repeat", "join",
+	"indexOf", "lastIndexOf", "hasPrefix", "hasSuffix",
+	"max", "min", "mean", "median",
+	"toJSON", "fromJSON",
+	"first", "last", "get", "take", "keys", "values", "toPairs", "fromPairs",
+	"reverse", "uniq", "concat", "flatten", "sort",
+}
+
+// compiledScripts 已编译的脚本表达式（表达式原文 -> *vm.Program）
+// 流程版本的 XML 不再变化，同一版本的脚本只在第一次执行时编译
+var compiledScripts sync.Map
+
+// compileScript compiles a script expression with the allow-listed functions, reusing earlier compilations
+func compileScript(source string) (*vm.Program, error) {
+	if program, ok := compiledScripts.Load(source); ok {
+		return program.(*vm.Program), nil
+	}
+
+	options := []expr.Option{expr.DisableAllBuiltins()}
+	for _, name := range scriptFunctions {
+		options = append(options, expr.EnableBuiltin(name))
+	}
+	program, err := expr.Compile(source, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, _ := compiledScripts.LoadOrStore(source, program)
+	return actual.(*vm.Program), nil
+}
+
+// executeScriptTask runs the script of a ScriptTask and returns the variables it sets
+// 脚本基于流程变量的副本执行，超时后返回错误；返回的变量由调用方写入流程变量
+func (s *WorkflowEngineService) executeScriptTask(
+	ctx context.Context,
+	node *models.Node,
+	variables map[string]interface{},
+) (map[string]interface{}, error) {
+	script := node.Script
+	if script == nil {
+		return nil, fmt.Errorf("script not configured for ScriptTask %s", node.Id)
+	}
+
+	timeout := time.Duration(script.TimeoutMs) * time.Millisecond
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type scriptResult struct {
+		changes map[string]interface{}
+		err     error
+	}
+	// expr 程序不支持中途取消，超时后结果被丢弃
+	done := make(chan scriptResult, 1)
+	go func() {
+		changes, err := runScript(script, cloneVariables(variables))
+		done <- scriptResult{changes: changes, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err != nil {
+			return nil, fmt.Errorf("script of ScriptTask %s failed: %w", node.Id, result.err)
+		}
+		s.logger.Info().
+			Str("nodeId", node.Id).
+			Int("variables", len(result.changes)).
+			Msg("ScriptTask executed")
+		return result.changes, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("script of ScriptTask %s timed out after %s", node.Id, timeout)
+	}
+}
+
+// runScript evaluates the assignments (or the whole program) of a script against env
+// 赋值按顺序执行，后面的表达式可以使用前面赋值的结果
+func runScript(script *models.Script, env map[string]interface{}) (map[string]interface{}, error) {
+	changes := make(map[string]interface{})
+
+	if len(script.Assignments) > 0 {
+		for _, assignment := range script.Assignments {
+			program, err := compileScript(assignment.Expression)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile assignment to %s: %w", assignment.Target, err)
+			}
+			value, err := expr.Run(program, env)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate assignment to %s: %w", assignment.Target, err)
+			}
+			env[assignment.Target] = value
+			changes[assignment.Target] = value
+		}
+		return changes, nil
+	}
+
+	program, err := compileScript(script.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile script: %w", err)
+	}
+	value, err := expr.Run(program, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate script: %w", err)
+	}
+
+	if script.ResultVariable != "" {
+		changes[script.ResultVariable] = value
+		return changes, nil
+	}
+	result, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("script must return a map of variables or declare resultVariable, got %T", value)
+	}
+	for key, v := range result {
+		changes[key] = v
+	}
+	return changes, nil
+}
+
+// applyScriptVariables writes the variables computed by a ScriptTask into the process variables
+// Returns the computed variables, or nil when the node result carries none
+func applyScriptVariables(nodeResult *ExecuteResult, variables map[string]interface{}) map[string]interface{} {
+	if nodeResult == nil || nodeResult.EngineResponse == nil || nodeResult.EngineResponse.Variables == nil {
+		return nil
+	}
+	for key, value := range nodeResult.EngineResponse.Variables {
+		variables[key] = value
+	}
+	return nodeResult.EngineResponse.Variables
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonContains matches a JSON argument that contains the given fragment
+type jsonContains string
+
+func (m jsonContains) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	return ok && strings.Contains(s, string(m))
+}
+
+func TestRunScript(t *testing.T) {
+	variables := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": 20, "qty": 2},
+			map[string]interface{}{"price": 5, "qty": 3},
+		},
+		"customer": map[string]interface{}{"name": " ada "},
+	}
+
+	tests := []struct {
+		name     string
+		script   *models.Script
+		expected map[string]interface{}
+		errorMsg string
+	}{
+		{
+			name: "assignments see earlier results",
+			script: &models.Script{Assignments: []models.ScriptAssignment{
+				{Target: "total", Expression: "sum(map(items, .price * .qty))"},
+				{Target: "discount", Expression: "total > 50 ? 5 : 0"},
+				{Target: "name", Expression: "upper(trim(customer.name))"},
+			}},
+			expected: map[string]interface{}{"total": 55, "discount": 5, "name": "ADA"},
+		},
+		{
+			name:     "program returning a map",
+			script:   &models.Script{Source: `{"count": len(items), "first": items[0].price}`},
+			expected: map[string]interface{}{"count": 2, "first": 20},
+		},
+		{
+			name:     "program with result variable",
+			script:   &models.Script{Source: "let n = len(items); n * 10", ResultVariable: "points"},
+			expected: map[string]interface{}{"points": 20},
+		},
+		{
+			name:     "program must return a map without result variable",
+			script:   &models.Script{Source: "len(items)"},
+			errorMsg: "must return a map of variables",
+		},
+		{
+			name:     "functions outside the allow list are rejected",
+			script:   &models.Script{Source: "now()", ResultVariable: "at"},
+			errorMsg: "unknown name now",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := runScript(tt.script, cloneVariables(variables))
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, changes)
+		})
+	}
+}
+
+func TestCompileScript_Cached(t *testing.T) {
+	first, err := compileScript("a + b")
+	require.NoError(t, err)
+	second, err := compileScript("a + b")
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+}
+
+func TestWorkflowEngineService_ExecuteScriptTask_Timeout(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	node := &models.Node{
+		Id:     "Script_Slow",
+		Type:   parser.NodeTypeScriptTask,
+		Script: &models.Script{Source: "reduce(1..500000, #acc + len(string(#)), 0)", ResultVariable: "n", TimeoutMs: 10},
+	}
+
+	startedAt := time.Now()
+	_, err := engineSvc.executeScriptTask(context.Background(), node, map[string]interface{}{})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out after 10ms")
+	assert.Less(t, time.Since(startedAt), 100*time.Millisecond)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_ScriptTask(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	bpmnXML := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:process id="Process_1" name="Pricing">
+    <bpmn:scriptTask id="Script_Total" name="Compute Total" scriptFormat="expr">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+      <bpmn:script>
+        total = sum(map(items, .price * .qty))
+        discount = total > 100 ? 10 : 0
+      </bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:exclusiveGateway id="Gateway_Discount" default="Flow_None">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_Discount</bpmn:outgoing>
+      <bpmn:outgoing>Flow_None</bpmn:outgoing>
+    </bpmn:exclusiveGateway>
+    <bpmn:userTask id="UserTask_Approve" name="Approve Discount">
+      <bpmn:incoming>Flow_Discount</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_None</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="Script_Total" targetRef="Gateway_Discount"/>
+    <bpmn:sequenceFlow id="Flow_Discount" sourceRef="Gateway_Discount" targetRef="UserTask_Approve">
+      <bpmn:conditionExpression>discount > 0</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_None" sourceRef="Gateway_Discount" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+
+	workflow := &models.Workflow{Id: "test-workflow-id", BpmnXml: bpmnXML, Status: models.StatusDraft}
+	instance := &models.WorkflowInstance{
+		Id:             "test-instance-id",
+		WorkflowId:     workflow.Id,
+		Status:         models.InstanceStatusRunning,
+		CurrentNodeIds: []string{"Script_Total"},
+	}
+
+	// 脚本计算出的变量记录在执行历史的输出中
+	mock.ExpectQuery(`INSERT INTO execution_histories`).
+		WithArgs(sqlmock.AnyArg(), "mock-execution-test-instance-id", "Script_Total", "Compute Total", int(parser.NodeTypeScriptTask),
+			sqlmock.AnyArg(), jsonContains(`"variables":{"discount":10,"total":150}`), sqlmock.AnyArg(), jsonContains(`"total":150`),
+			sqlmock.AnyArg(), "", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(compensationHistoryColumns).
+			AddRow("h-1", "mock-execution-test-instance-id", "Script_Total", "Compute Total", int(parser.NodeTypeScriptTask), []byte(`{}`), []byte(`{}`), []byte(`{}`), []byte(`{}`), 0, "", time.Now()))
+
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "Script_Total", map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"price": 50, "qty": 2},
+			map[string]interface{}{"price": 25, "qty": 2},
+		},
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Approve"}, result.EngineResponse.CurrentNodeIds)
+	assert.Equal(t, 150, result.EngineResponse.Variables["total"])
+	assert.Equal(t, 10, result.EngineResponse.Variables["discount"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+)
+
+// signalBatchSize 广播时每批认领和唤醒的订阅数量
+const signalBatchSize = 100
+
+// SignalBroadcast represents the result of broadcasting a signal
+type SignalBroadcast struct {
+	SignalName string           `json:"signalName"`
+	Resumed    []SignalDelivery `json:"resumed"` // 被唤醒的等待实例
+	Started    []SignalDelivery `json:"started"` // 信号开始事件启动的新实例
+}
+
+// SignalDelivery represents the result of delivering a signal to one instance
+type SignalDelivery struct {
+	InstanceId     string          `json:"instanceId,omitempty"`
+	WorkflowId     string          `json:"workflowId"`
+	NodeId         string          `json:"nodeId"`
+	EngineResponse *EngineResponse `json:"engineResponse,omitempty"`
+	Error          string          `json:"error,omitempty"`
+
+	result  *ExecuteResult
+	refused bool // 实例拒绝推进，信号没有被消费
+}
+
+// isSignalEvent checks whether the node is a signal catch event or signal boundary event
+func isSignalEvent(node models.Node) bool {
+	return node.SignalRef != "" &&
+		(node.Type == parser.NodeTypeIntermediateCatchEvent || node.Type == parser.NodeTypeBoundaryEvent)
+}
+
+// isSignalThrowEvent checks whether reaching the node broadcasts a signal
+func isSignalThrowEvent(node models.Node) bool {
+	return node.SignalRef != "" &&
+		(node.Type == parser.NodeTypeIntermediateEvent || node.Type == parser.NodeTypeEndEvent)
+}
+
+// signalName resolves the signal name referenced by a signal event (falls back to the signal ID)
+func signalName(wd *models.WorkflowDefinition, node *models.Node) string {
+	if signal, exists := wd.Signals[node.SignalRef]; exists && signal.Name != "" {
+		return signal.Name
+	}
+	return node.SignalRef
+}
+
+// signalEventsForNode returns the signal events that a token waiting at the node subscribes to
+func signalEventsForNode(wd *models.WorkflowDefinition, nodeId string) []models.Node {
+	return waitingEventsForNode(wd, nodeId, isSignalEvent)
+}
+
+// syncSignalSubscriptions subscribes newly parked tokens to their signal events and cancels stale subscriptions
+// 订阅记录失败只输出日志，不影响流程执行
+func (s *WorkflowEngineService) syncSignalSubscriptions(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	workflowId string,
+	instanceId string,
+	parkedNodeIds []string,
+	currentNodeIds []string,
+	variables map[string]interface{},
+) {
+	if !hasWaitingEvents(wd, isSignalEvent) {
+		return
+	}
+
+	if _, err := s.signalSvc.CancelStaleSubscriptions(ctx, instanceId, currentNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale signal subscriptions")
+	}
+
+	for _, scopeNodeId := range parkedNodeIds {
+		for _, signalNode := range signalEventsForNode(wd, scopeNodeId) {
+			err := s.signalSvc.Subscribe(ctx, &models.SignalSubscription{
+				InstanceId:  instanceId,
+				WorkflowId:  workflowId,
+				NodeId:      signalNode.Id,
+				ScopeNodeId: scopeNodeId,
+				SignalName:  signalName(wd, &signalNode),
+				Variables:   variables,
+			})
+			if err != nil {
+				s.logger.Warn().Err(err).Str("instanceId", instanceId).Str("nodeId", signalNode.Id).Msg("Failed to subscribe to signal")
+			}
+		}
+	}
+}
+
+// BroadcastSignal wakes every instance waiting for the signal and starts instances of workflows with a matching signal start event
+// 订阅分批认领并逐个唤醒，单个实例失败只记录在结果中，不影响其他实例；没有任何实例等待该信号不是错误
+func (s *WorkflowEngineService) BroadcastSignal(ctx context.Context, name string, variables map[string]interface{}) (*SignalBroadcast, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%s: signal name is required", models.ErrInvalidRequest)
+	}
+
+	broadcast := &SignalBroadcast{
+		SignalName: name,
+		Resumed:    []SignalDelivery{},
+		Started:    []SignalDelivery{},
+	}
+
+	// 只唤醒广播开始前已经在等待的实例，被唤醒后再次等待同一信号的实例留给下一次广播
+	// 拒绝推进的实例的订阅在全部批次认领完后才恢复，避免在本次广播中被反复认领
+	broadcastAt := time.Now()
+	var refusedIds []string
+	for {
+		subscriptions, err := s.signalSvc.ClaimSubscriptions(ctx, name, broadcastAt, signalBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for i := range subscriptions {
+			delivery := s.deliverSignal(ctx, &subscriptions[i], variables)
+			if delivery.refused {
+				refusedIds = append(refusedIds, subscriptions[i].Id)
+			}
+			broadcast.Resumed = append(broadcast.Resumed, delivery)
+		}
+		if len(subscriptions) < signalBatchSize {
+			break
+		}
+	}
+	if len(refusedIds) > 0 {
+		if err := s.signalSvc.ReleaseSubscriptions(ctx, refusedIds); err != nil {
+			s.logger.Warn().Err(err).Str("signalName", name).Msg("Failed to release signal subscriptions")
+		}
+	}
+
+	startEvents, err := s.versionSvc.ListSignalStartEvents(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, startEvent := range startEvents {
+		broadcast.Started = append(broadcast.Started, s.startFromSignal(ctx, startEvent, variables))
+	}
+
+	s.logger.Info().
+		Str("signalName", name).
+		Int("resumed", len(broadcast.Resumed)).
+		Int("started", len(broadcast.Started)).
+		Msg("Signal broadcast")
+	return broadcast, nil
+}
+
+// deliverSignal resumes one instance at the subscribed signal event
+func (s *WorkflowEngineService) deliverSignal(
+	ctx context.Context,
+	subscription *models.SignalSubscription,
+	signalVariables map[string]interface{},
+) SignalDelivery {
+	delivery := SignalDelivery{
+		InstanceId: subscription.InstanceId,
+		WorkflowId: subscription.WorkflowId,
+		NodeId:     subscription.NodeId,
+	}
+
+	instance, err := s.instanceSvc.GetWorkflowInstanceByID(ctx, subscription.InstanceId)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	// 同一令牌上的其他信号已先唤醒了实例（如事件网关的多个分支等待同一信号）
+	if countNodeId(instance.CurrentNodeIds, subscription.ScopeNodeId) == 0 {
+		delivery.Error = fmt.Sprintf("instance is no longer waiting at node %s", subscription.ScopeNodeId)
+		return delivery
+	}
+
+	workflow, err := s.workflowSvc.GetWorkflowByID(ctx, subscription.WorkflowId)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	// 订阅时的流程变量与信号变量合并，信号变量优先
+	variables := make(map[string]interface{}, len(subscription.Variables)+len(signalVariables))
+	for key, value := range subscription.Variables {
+		variables[key] = value
+	}
+	for key, value := range signalVariables {
+		variables[key] = value
+	}
+
+	result, err := s.TriggerNode(ctx, workflow, instance, subscription.NodeId, variables)
+	if err != nil {
+		s.logger.Error().Err(err).
+			Str("instanceId", subscription.InstanceId).
+			Str("nodeId", subscription.NodeId).
+			Msg("Failed to resume instance from signal")
+		delivery.Error = err.Error()
+		delivery.refused = !isExecutionFailure(err)
+		return delivery
+	}
+
+	delivery.EngineResponse = result.EngineResponse
+	delivery.result = result
+	return delivery
+}
+
+// startFromSignal starts a new instance of the workflow from its signal start event
+func (s *WorkflowEngineService) startFromSignal(ctx context.Context, startEvent SignalStartEvent, variables map[string]interface{}) SignalDelivery {
+	delivery := SignalDelivery{
+		WorkflowId: startEvent.WorkflowId,
+		NodeId:     startEvent.NodeId,
+	}
+
+	workflow, err := s.workflowSvc.GetWorkflowByID(ctx, startEvent.WorkflowId)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	instance, result, err := s.StartInstance(ctx, workflow, "", startEvent.NodeId, variables)
+	if instance != nil {
+		delivery.InstanceId = instance.Id
+	}
+	if err != nil {
+		s.logger.Error().Err(err).
+			Str("workflowId", startEvent.WorkflowId).
+			Str("nodeId", startEvent.NodeId).
+			Msg("Failed to start instance from signal")
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	delivery.EngineResponse = result.EngineResponse
+	return delivery
+}
+
+// broadcastThrownSignals broadcasts the signals thrown while executing an instance
+// 抛出信号的实例自身也在等待该信号时会被唤醒，此时返回该实例最新的执行结果；否则返回 nil
+func (s *WorkflowEngineService) broadcastThrownSignals(ctx context.Context, instanceId string, names []string) *ExecuteResult {
+	var resumed *ExecuteResult
+	for _, name := range names {
+		broadcast, err := s.BroadcastSignal(ctx, name, nil)
+		if err != nil {
+			s.logger.Error().Err(err).Str("instanceId", instanceId).Str("signalName", name).Msg("Failed to broadcast thrown signal")
+			continue
+		}
+		for _, delivery := range broadcast.Resumed {
+			if delivery.InstanceId == instanceId && delivery.result != nil {
+				resumed = delivery.result
+			}
+		}
+	}
+	return resumed
+}
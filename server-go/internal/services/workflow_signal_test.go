@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createOrderSignalBPMN 订单流程：发货前等待召回信号或支付消息，发货任务上有召回信号边界事件
+func createOrderSignalBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:signal id="Signal_Recall" name="ProductRecall"/>
+  <bpmn:message id="Message_Paid" name="PaymentReceived"/>
+  <bpmn:process id="Process_Order" name="Order">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:eventBasedGateway id="Gateway_Wait">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_Recall</bpmn:outgoing>
+      <bpmn:outgoing>Flow_Paid</bpmn:outgoing>
+    </bpmn:eventBasedGateway>
+    <bpmn:intermediateCatchEvent id="Catch_Recall">
+      <bpmn:incoming>Flow_Recall</bpmn:incoming>
+      <bpmn:outgoing>Flow_Recalled</bpmn:outgoing>
+      <bpmn:signalEventDefinition signalRef="Signal_Recall"/>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:intermediateCatchEvent id="Catch_Paid">
+      <bpmn:incoming>Flow_Paid</bpmn:incoming>
+      <bpmn:outgoing>Flow_Ship</bpmn:outgoing>
+      <bpmn:messageEventDefinition messageRef="Message_Paid"/>
+    </bpmn:intermediateCatchEvent>
+    <bpmn:userTask id="UserTask_Ship" name="Ship">
+      <bpmn:incoming>Flow_Ship</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:boundaryEvent id="Boundary_Recall" attachedToRef="UserTask_Ship">
+      <bpmn:outgoing>Flow_Stop</bpmn:outgoing>
+      <bpmn:signalEventDefinition signalRef="Signal_Recall"/>
+    </bpmn:boundaryEvent>
+    <bpmn:boundaryEvent id="Boundary_Shipped" attachedToRef="UserTask_Ship">
+      <bpmn:outgoing>Flow_Shipped</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:endEvent id="End_Recalled">
+      <bpmn:incoming>Flow_Recalled</bpmn:incoming>
+      <bpmn:incoming>Flow_Stop</bpmn:incoming>
+      <bpmn:signalEventDefinition signalRef="Signal_Recall"/>
+    </bpmn:endEvent>
+    <bpmn:endEvent id="End_Shipped">
+      <bpmn:incoming>Flow_Shipped</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Gateway_Wait"/>
+    <bpmn:sequenceFlow id="Flow_Recall" sourceRef="Gateway_Wait" targetRef="Catch_Recall"/>
+    <bpmn:sequenceFlow id="Flow_Paid" sourceRef="Gateway_Wait" targetRef="Catch_Paid"/>
+    <bpmn:sequenceFlow id="Flow_Recalled" sourceRef="Catch_Recall" targetRef="End_Recalled"/>
+    <bpmn:sequenceFlow id="Flow_Ship" sourceRef="Catch_Paid" targetRef="UserTask_Ship"/>
+    <bpmn:sequenceFlow id="Flow_Stop" sourceRef="Boundary_Recall" targetRef="End_Recalled"/>
+    <bpmn:sequenceFlow id="Flow_Shipped" sourceRef="Boundary_Shipped" targetRef="End_Shipped"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+// createRecallBPMN 召回处理流程：由召回信号启动
+func createRecallBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL">
+  <bpmn:signal id="Signal_Recall" name="ProductRecall"/>
+  <bpmn:process id="Process_Recall" name="Recall">
+    <bpmn:startEvent id="Start_Recall">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+      <bpmn:signalEventDefinition signalRef="Signal_Recall"/>
+    </bpmn:startEvent>
+    <bpmn:scriptTask id="Script_Notify" scriptFormat="expr">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:script>notified = batch + "-notified"</bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:endEvent id="End_Recall">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="Start_Recall" targetRef="Script_Notify"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Script_Notify" targetRef="End_Recall"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestSignalEventsForNode(t *testing.T) {
+	wd, err := parser.ParseBPMN(createOrderSignalBPMN())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		nodeId   string
+		expected []string
+	}{
+		{"event-based gateway listens to its signal branch only", "Gateway_Wait", []string{"Catch_Recall"}},
+		{"user task listens to its signal boundary event", "UserTask_Ship", []string{"Boundary_Recall"}},
+		{"message catch event has no signal", "Catch_Paid", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []string
+			for _, node := range signalEventsForNode(wd, tt.nodeId) {
+				ids = append(ids, node.Id)
+			}
+			assert.Equal(t, tt.expected, ids)
+		})
+	}
+
+	// 信号结束事件抛出信号，信号捕获事件不抛出
+	assert.True(t, isSignalThrowEvent(wd.Nodes["End_Recalled"]))
+	assert.False(t, isSignalThrowEvent(wd.Nodes["Catch_Recall"]))
+	boundary := wd.Nodes["Boundary_Recall"]
+	assert.Equal(t, "ProductRecall", signalName(wd, &boundary))
+
+	// 信号边界事件不能用来完成人工任务
+	outcome, err := resolveTaskOutcome(wd, "UserTask_Ship", "")
+	require.NoError(t, err)
+	assert.Equal(t, "Boundary_Shipped", outcome)
+}
+
+func TestWorkflowEngineService_BroadcastSignal(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	order := &models.Workflow{Id: "order-workflow", Name: "Order", BpmnXml: createOrderSignalBPMN(), Status: models.StatusActive}
+	recall := &models.Workflow{Id: "recall-workflow", Name: "Recall", BpmnXml: createRecallBPMN(), Status: models.StatusActive}
+	engineSvc.workflowSvc.SetWorkflowInMemory(order)
+	engineSvc.workflowSvc.SetWorkflowInMemory(recall)
+	recallDefinition, err := parser.ParseBPMN(recall.BpmnXml)
+	require.NoError(t, err)
+	definitionJSON, err := json.Marshal(recallDefinition)
+	require.NoError(t, err)
+	now := time.Now()
+
+	// 认领等待信号的订阅：instance-1 停在事件网关上，instance-2 的令牌已被消息带走
+	mock.ExpectQuery(`UPDATE signal_subscriptions`).
+		WithArgs(models.SubscriptionStatusTriggered, sqlmock.AnyArg(), models.SubscriptionStatusPending, "ProductRecall", sqlmock.AnyArg(), signalBatchSize).
+		WillReturnRows(sqlmock.NewRows(signalSubscriptionColumns).
+			AddRow("sub-1", "instance-1", order.Id, "Catch_Recall", "Gateway_Wait", "ProductRecall", []byte(`{"orderId":"o-1"}`), models.SubscriptionStatusTriggered, now, now).
+			AddRow("sub-2", "instance-2", order.Id, "Catch_Recall", "Gateway_Wait", "ProductRecall", []byte(`{"orderId":"o-2"}`), models.SubscriptionStatusTriggered, now, now))
+	for _, waiting := range []struct{ id, nodeId string }{{"instance-1", "Gateway_Wait"}, {"instance-2", "UserTask_Ship"}} {
+		mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+			WithArgs(waiting.id).
+			WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+				AddRow(waiting.id, order.Id, "Order", models.InstanceStatusRunning, pq.Array([]string{waiting.nodeId}), 3, 0, now, now))
+	}
+
+	// 激活版本中监听该信号的开始事件启动新实例
+	mock.ExpectQuery(`SELECT workflow_id, version, definition FROM workflow_versions WHERE is_active`).
+		WithArgs("ProductRecall").
+		WillReturnRows(sqlmock.NewRows([]string{"workflow_id", "version", "definition"}).
+			AddRow(recall.Id, 2, definitionJSON))
+	mock.ExpectQuery(`SELECT version FROM workflow_versions WHERE workflow_id = \$1 AND is_active`).
+		WithArgs(recall.Id).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+	mock.ExpectQuery(`INSERT INTO workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), recall.Id, recall.Name, models.InstanceStatusPending, pq.Array([]string{}), 1, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow("recall-instance", recall.Id, recall.Name, models.InstanceStatusPending, pq.Array([]string{}), 1, 2, now, now))
+
+	broadcast, err := engineSvc.BroadcastSignal(newFullMockContext(), "ProductRecall", map[string]interface{}{"batch": "b-7"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "ProductRecall", broadcast.SignalName)
+	require.Len(t, broadcast.Resumed, 2)
+	// 等待的实例从信号捕获事件继续，订阅时的变量与信号变量合并
+	resumed := broadcast.Resumed[0]
+	assert.Empty(t, resumed.Error)
+	assert.Equal(t, models.InstanceStatusCompleted, resumed.EngineResponse.Status)
+	assert.Equal(t, "o-1", resumed.EngineResponse.Variables["orderId"])
+	assert.Equal(t, "b-7", resumed.EngineResponse.Variables["batch"])
+	assert.Contains(t, broadcast.Resumed[1].Error, "no longer waiting at node Gateway_Wait")
+
+	require.Len(t, broadcast.Started, 1)
+	started := broadcast.Started[0]
+	assert.Empty(t, started.Error)
+	assert.Equal(t, "recall-instance", started.InstanceId)
+	assert.Equal(t, "Start_Recall", started.NodeId)
+	assert.Equal(t, models.InstanceStatusCompleted, started.EngineResponse.Status)
+	assert.Equal(t, "b-7-notified", started.EngineResponse.Variables["notified"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowEngineService_BroadcastSignal_NameRequired(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	broadcast, err := engineSvc.BroadcastSignal(context.Background(), "", nil)
+
+	require.Error(t, err)
+	assert.Nil(t, broadcast)
+	assert.Contains(t, err.Error(), models.ErrInvalidRequest)
+}
+
+func TestWorkflowEngineService_BroadcastSignal_VersionConflict(t *testing.T) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	order := &models.Workflow{Id: "order-workflow", Name: "Order", BpmnXml: createOrderSignalBPMN(), Status: models.StatusActive}
+	engineSvc.workflowSvc.SetWorkflowInMemory(order)
+	now := time.Now()
+
+	mock.ExpectQuery(`UPDATE signal_subscriptions`).
+		WithArgs(models.SubscriptionStatusTriggered, sqlmock.AnyArg(), models.SubscriptionStatusPending, "ProductRecall", sqlmock.AnyArg(), signalBatchSize).
+		WillReturnRows(sqlmock.NewRows(signalSubscriptionColumns).
+			AddRow("sub-1", "instance-1", order.Id, "Catch_Recall", "Gateway_Wait", "ProductRecall", []byte(`{}`), models.SubscriptionStatusTriggered, now, now))
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow("instance-1", order.Id, "Order", models.InstanceStatusRunning, pq.Array([]string{"Gateway_Wait"}), 3, 0, now, now))
+
+	// 实例的另一个分支正在执行：占用版本失败
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), "instance-1", 3).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow("instance-1", order.Id, "Order", models.InstanceStatusRunning, pq.Array([]string{"Gateway_Wait"}), 4, 0, now, now))
+
+	// 订阅恢复为待触发，下一次广播时再次唤醒
+	mock.ExpectExec(`UPDATE signal_subscriptions`).
+		WithArgs(models.SubscriptionStatusPending, sqlmock.AnyArg(), pq.Array([]string{"sub-1"}), models.SubscriptionStatusTriggered).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT workflow_id, version, definition FROM workflow_versions WHERE is_active`).
+		WithArgs("ProductRecall").
+		WillReturnRows(sqlmock.NewRows([]string{"workflow_id", "version", "definition"}))
+
+	broadcast, err := engineSvc.BroadcastSignal(context.Background(), "ProductRecall", nil)
+
+	require.NoError(t, err)
+	require.Len(t, broadcast.Resumed, 1)
+	assert.Contains(t, broadcast.Resumed[0].Error, models.ErrInstanceVersionConflict)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
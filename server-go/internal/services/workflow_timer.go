@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+)
+
+// timerLockDuration 定时器触发锁的有效期，触发期间定期续期；超过该时间未续期时视为调度器崩溃，定时器可以被重新领取
+const timerLockDuration = 5 * time.Minute
+
+// WorkflowTimerService handles persistence of due timers
+type WorkflowTimerService struct {
+	db     *database.Database
+	logger *zerolog.Logger
+}
+
+// NewWorkflowTimerService creates a new WorkflowTimerService
+func NewWorkflowTimerService(db *database.Database, logger *zerolog.Logger) *WorkflowTimerService {
+	return &WorkflowTimerService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// ScheduleTimer stores a pending timer
+// 同一实例的同一定时器节点已存在待触发定时器时不会重复创建
+func (s *WorkflowTimerService) ScheduleTimer(ctx context.Context, timer *models.WorkflowTimer) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	variables := timer.Variables
+	if variables == nil {
+		variables = make(map[string]interface{})
+	}
+	variablesJSON, err := json.Marshal(variables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal timer variables: %w", err)
+	}
+
+	query := `
+		INSERT INTO workflow_timers (
+			id, instance_id, workflow_id, node_id, scope_node_id,
+			due_at, fire_count, variables, status, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8::jsonb, $9, $10, $10)
+		ON CONFLICT (instance_id, node_id) WHERE status = 'pending' DO NOTHING
+	`
+
+	_, err = s.db.ExecContext(ctx, query,
+		uuid.New().String(), timer.InstanceId, timer.WorkflowId, timer.NodeId, timer.ScopeNodeId,
+		timer.DueAt, timer.FireCount, string(variablesJSON), models.TimerStatusPending, time.Now(),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", timer.InstanceId).Str("nodeId", timer.NodeId).Msg("Failed to schedule timer")
+		return fmt.Errorf("failed to schedule timer: %w", err)
+	}
+
+	s.logger.Info().
+		Str("instanceId", timer.InstanceId).
+		Str("nodeId", timer.NodeId).
+		Time("dueAt", timer.DueAt).
+		Msg("Timer scheduled")
+	return nil
+}
+
+// CancelStaleTimers cancels pending timers whose token is no longer waiting at the scope node
+func (s *WorkflowTimerService) CancelStaleTimers(ctx context.Context, instanceId string, activeNodeIds []string) (int64, error) {
+	if s.db.DB == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+
+	if activeNodeIds == nil {
+		activeNodeIds = []string{}
+	}
+
+	query := `
+		UPDATE workflow_timers
+		SET status = $1, updated_at = $2
+		WHERE instance_id = $3 AND status = $4 AND NOT (scope_node_id = ANY($5))
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		models.TimerStatusCancelled, time.Now(), instanceId, models.TimerStatusPending, pq.Array(activeNodeIds),
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale timers")
+		return 0, fmt.Errorf("failed to cancel stale timers: %w", err)
+	}
+
+	cancelled, _ := result.RowsAffected()
+	if cancelled > 0 {
+		s.logger.Info().Str("instanceId", instanceId).Int64("cancelled", cancelled).Msg("Stale timers cancelled")
+	}
+	return cancelled, nil
+}
+
+// ClaimDueTimers marks up to limit due timers as firing, locked by the owner, and returns them
+// 使用 FOR UPDATE SKIP LOCKED，多个服务实例同时轮询时不会重复触发同一个定时器；挂起实例的定时器在恢复后才会被领取；
+// 锁已过期的触发中定时器视为调度器崩溃，可以被重新领取
+func (s *WorkflowTimerService) ClaimDueTimers(ctx context.Context, owner string, limit int, lockDuration time.Duration) ([]models.WorkflowTimer, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	now := time.Now()
+	query := `
+		UPDATE workflow_timers
+		SET status = $1, lock_owner = $2, lock_expires_at = $3, updated_at = $4
+		WHERE id IN (
+			SELECT id FROM workflow_timers
+			WHERE ((status = $5 AND due_at <= $4)
+			   OR (status = $1 AND lock_expires_at < $4))
+			  AND NOT EXISTS (
+			      SELECT 1 FROM workflow_instances i
+			      WHERE i.id = workflow_timers.instance_id AND i.status = 'suspended'
+			  )
+			ORDER BY due_at
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, instance_id, workflow_id, node_id, scope_node_id, due_at, fire_count, variables, status, created_at, updated_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, query,
+		models.TimerStatusFiring, owner, now.Add(lockDuration), now, models.TimerStatusPending, limit,
+	)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("Failed to claim due timers")
+		return nil, fmt.Errorf("failed to claim due timers: %w", err)
+	}
+	defer rows.Close()
+
+	var timers []models.WorkflowTimer
+	for rows.Next() {
+		var timer models.WorkflowTimer
+		var variablesBytes []byte
+		if err := rows.Scan(
+			&timer.Id,
+			&timer.InstanceId,
+			&timer.WorkflowId,
+			&timer.NodeId,
+			&timer.ScopeNodeId,
+			&timer.DueAt,
+			&timer.FireCount,
+			&variablesBytes,
+			&timer.Status,
+			&timer.CreatedAt,
+			&timer.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan timer: %w", err)
+		}
+		if len(variablesBytes) > 0 {
+			if err := json.Unmarshal(variablesBytes, &timer.Variables); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal timer variables: %w", err)
+			}
+		}
+		timers = append(timers, timer)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate timers: %w", err)
+	}
+
+	return timers, nil
+}
+
+// ExtendTimerLocks extends the locks of the firing timers still locked by the owner and returns how many were extended
+// 锁已过期并被其他调度器重新领取的定时器不做修改
+func (s *WorkflowTimerService) ExtendTimerLocks(ctx context.Context, owner string, timerIds []string, lockDuration time.Duration) (int64, error) {
+	if s.db.DB == nil {
+		return 0, fmt.Errorf("database not available")
+	}
+
+	now := time.Now()
+	query := `
+		UPDATE workflow_timers
+		SET lock_expires_at = $1, updated_at = $2
+		WHERE id = ANY($3) AND status = $4 AND lock_owner = $5
+	`
+
+	result, err := s.db.ExecContext(ctx, query, now.Add(lockDuration), now, pq.Array(timerIds), models.TimerStatusFiring, owner)
+	if err != nil {
+		s.logger.Error().Err(err).Str("owner", owner).Msg("Failed to extend timer locks")
+		return 0, fmt.Errorf("failed to extend timer locks: %w", err)
+	}
+	extended, _ := result.RowsAffected()
+	return extended, nil
+}
+
+// FinishTimer records the final status of a timer locked by the owner and releases the lock
+// 锁已过期并被其他调度器重新领取时不做修改
+func (s *WorkflowTimerService) FinishTimer(ctx context.Context, timerId string, owner string, status string, errorMessage string) error {
+	if s.db.DB == nil {
+		return fmt.Errorf("database not available")
+	}
+
+	query := `
+		UPDATE workflow_timers
+		SET status = $1, error_message = NULLIF($2, ''), lock_owner = NULL, lock_expires_at = NULL, updated_at = $3
+		WHERE id = $4 AND status = $5 AND lock_owner = $6
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, status, errorMessage, time.Now(), timerId, models.TimerStatusFiring, owner); err != nil {
+		s.logger.Error().Err(err).Str("timerId", timerId).Msg("Failed to finish timer")
+		return fmt.Errorf("failed to finish timer: %w", err)
+	}
+	return nil
+}
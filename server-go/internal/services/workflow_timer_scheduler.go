@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// timerPollInterval 定时器轮询间隔
+	timerPollInterval = 10 * time.Second
+	// timerBatchSize 每次轮询最多触发的定时器数量
+	timerBatchSize = 100
+)
+
+// WorkflowTimerScheduler fires due timers and resumes the waiting workflow instances
+type WorkflowTimerScheduler struct {
+	logger      *zerolog.Logger
+	owner       string
+	timerSvc    *WorkflowTimerService
+	workflowSvc *WorkflowService
+	instanceSvc *WorkflowInstanceService
+	engineSvc   *WorkflowEngineService
+}
+
+// NewWorkflowTimerScheduler creates a new WorkflowTimerScheduler
+func NewWorkflowTimerScheduler(db *database.Database, logger *zerolog.Logger) *WorkflowTimerScheduler {
+	workflowSvc := NewWorkflowService(db, logger)
+	instanceSvc := NewWorkflowInstanceService(db, logger)
+	executionSvc := NewWorkflowExecutionService(db, logger)
+
+	// 锁的持有者标识服务实例，定时器被其他调度器重新领取后不会再由原调度器修改
+	hostname, _ := os.Hostname()
+	return &WorkflowTimerScheduler{
+		logger:      logger,
+		owner:       fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8]),
+		timerSvc:    NewWorkflowTimerService(db, logger),
+		workflowSvc: workflowSvc,
+		instanceSvc: instanceSvc,
+		engineSvc:   NewWorkflowEngineService(db, logger, workflowSvc, instanceSvc, executionSvc),
+	}
+}
+
+// FireDueTimers fires all due timers and returns how many were processed
+// 一批定时器依次触发，触发完成前持续为整批定时器的锁续期，排在后面的定时器不会因等待而被其他调度器重新领取
+func (s *WorkflowTimerScheduler) FireDueTimers(ctx context.Context) (int, error) {
+	fired := 0
+	for {
+		timers, err := s.timerSvc.ClaimDueTimers(ctx, s.owner, timerBatchSize, timerLockDuration)
+		if err != nil {
+			return fired, err
+		}
+
+		timerIds := make([]string, 0, len(timers))
+		for _, timer := range timers {
+			timerIds = append(timerIds, timer.Id)
+		}
+		keeper := keepLease(ctx, timerLockDuration/3, func(ctx context.Context) error {
+			_, err := s.timerSvc.ExtendTimerLocks(ctx, s.owner, timerIds, timerLockDuration)
+			if err != nil {
+				s.logger.Warn().Err(err).Msg("Failed to extend timer locks")
+			}
+			return err
+		})
+		for i := range timers {
+			s.fireTimer(ctx, &timers[i])
+			fired++
+		}
+		keeper.Stop()
+
+		if len(timers) < timerBatchSize || ctx.Err() != nil {
+			return fired, nil
+		}
+	}
+}
+
+// fireTimer resumes the instance at the timer event node
+// 令牌已离开定时器所在节点或实例已结束时，定时器被取消
+func (s *WorkflowTimerScheduler) fireTimer(ctx context.Context, timer *models.WorkflowTimer) {
+	instance, err := s.instanceSvc.GetWorkflowInstanceByID(ctx, timer.InstanceId)
+	if err != nil {
+		s.finishTimer(ctx, timer, models.TimerStatusFailed, err.Error())
+		return
+	}
+
+	// 领取后实例被挂起：放回待触发状态，恢复后再触发
+	if instance.Status == models.InstanceStatusSuspended {
+		s.finishTimer(ctx, timer, models.TimerStatusPending, "")
+		return
+	}
+
+	if (instance.Status != models.InstanceStatusPending && instance.Status != models.InstanceStatusRunning) ||
+		countNodeId(instance.CurrentNodeIds, timer.ScopeNodeId) == 0 {
+		s.logger.Info().
+			Str("timerId", timer.Id).
+			Str("instanceId", instance.Id).
+			Str("status", instance.Status).
+			Msg("Timer no longer applies, cancelling")
+		s.finishTimer(ctx, timer, models.TimerStatusCancelled, "")
+		return
+	}
+
+	workflow, err := s.workflowSvc.GetWorkflowByID(ctx, timer.WorkflowId)
+	if err != nil {
+		s.finishTimer(ctx, timer, models.TimerStatusFailed, err.Error())
+		return
+	}
+
+	// 触发前确认锁仍由当前调度器持有；锁已过期并被其他调度器重新领取时由对方触发
+	if extended, err := s.timerSvc.ExtendTimerLocks(ctx, s.owner, []string{timer.Id}, timerLockDuration); err != nil || extended == 0 {
+		s.logger.Warn().Err(err).Str("timerId", timer.Id).Msg("Timer lock lost before firing, skipping")
+		return
+	}
+
+	s.logger.Info().
+		Str("timerId", timer.Id).
+		Str("instanceId", instance.Id).
+		Str("nodeId", timer.NodeId).
+		Msg("Firing timer")
+
+	if _, err := s.engineSvc.TriggerNode(ctx, workflow, instance, timer.NodeId, timer.Variables); err != nil {
+		// 实例被并发推进或在触发前被挂起不算失败，放回待触发状态，下一次轮询再触发
+		if isInstanceVersionConflict(err) || strings.HasPrefix(err.Error(), models.ErrInstanceSuspended) {
+			s.logger.Warn().Err(err).Str("timerId", timer.Id).Msg("Instance refused timer, releasing")
+			s.finishTimer(ctx, timer, models.TimerStatusPending, "")
+			return
+		}
+		s.logger.Error().Err(err).Str("timerId", timer.Id).Msg("Failed to resume instance from timer")
+		s.finishTimer(ctx, timer, models.TimerStatusFailed, err.Error())
+		return
+	}
+	s.finishTimer(ctx, timer, models.TimerStatusFired, "")
+
+	s.scheduleNextCycle(ctx, workflow, instance.WorkflowVersion, timer)
+}
+
+// scheduleNextCycle schedules the next occurrence of a non-interrupting timeCycle boundary event
+func (s *WorkflowTimerScheduler) scheduleNextCycle(ctx context.Context, workflow *models.Workflow, version int, timer *models.WorkflowTimer) {
+	workflow, err := s.engineSvc.resolveWorkflowVersion(ctx, workflow, version)
+	if err != nil {
+		return
+	}
+	wd, err := parser.ParseBPMN(workflow.BpmnXml)
+	if err != nil {
+		return
+	}
+
+	node, exists := wd.Nodes[timer.NodeId]
+	if !exists || node.Type != parser.NodeTypeBoundaryEvent || node.CancelActivity ||
+		node.TimerDefinition == nil || node.TimerDefinition.Type != models.TimerTypeCycle {
+		return
+	}
+
+	repetitions, _, interval, err := parser.ParseTimeCycle(node.TimerDefinition.Expression)
+	if err != nil || (repetitions >= 0 && timer.FireCount+1 >= repetitions) {
+		return
+	}
+
+	next := *timer
+	next.FireCount = timer.FireCount + 1
+	next.DueAt = timer.DueAt.Add(interval)
+	if err := s.timerSvc.ScheduleTimer(ctx, &next); err != nil {
+		s.logger.Error().Err(err).Str("timerId", timer.Id).Msg("Failed to schedule next timer cycle")
+	}
+}
+
+// finishTimer records the timer result, logging failures
+func (s *WorkflowTimerScheduler) finishTimer(ctx context.Context, timer *models.WorkflowTimer, status string, errorMessage string) {
+	if err := s.timerSvc.FinishTimer(ctx, timer.Id, s.owner, status, errorMessage); err != nil {
+		s.logger.Error().Err(err).Str("timerId", timer.Id).Str("status", status).Msg("Failed to record timer result")
+	}
+}
+
+// StartPeriodicFiring starts a loop that fires due timers every timerPollInterval
+func (s *WorkflowTimerScheduler) StartPeriodicFiring(ctx context.Context) {
+	ticker := time.NewTicker(timerPollInterval)
+	defer ticker.Stop()
+
+	s.logger.Info().Dur("interval", timerPollInterval).Msg("Starting workflow timer scheduler")
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info().Msg("Stopping workflow timer scheduler")
+			return
+		case <-ticker.C:
+			fired, err := s.FireDueTimers(ctx)
+			if err != nil {
+				s.logger.Error().Err(err).Msg("Failed to fire due timers")
+			} else if fired > 0 {
+				s.logger.Info().Int("fired", fired).Msg("Fired due timers")
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var timerColumns = []string{"id", "instance_id", "workflow_id", "node_id", "scope_node_id", "due_at", "fire_count", "variables", "status", "created_at", "updated_at"}
+
+func setupWorkflowTimerServiceTest(t *testing.T) (*WorkflowTimerService, sqlmock.Sqlmock, *database.Database, func()) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	database := database.NewDatabase(&logger)
+	database.DB = db
+
+	service := NewWorkflowTimerService(database, &logger)
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return service, mock, database, cleanup
+}
+
+func TestWorkflowTimerService_ScheduleTimer_Success(t *testing.T) {
+	service, mock, _, cleanup := setupWorkflowTimerServiceTest(t)
+	defer cleanup()
+
+	dueAt := time.Now().Add(72 * time.Hour)
+	mock.ExpectExec(`INSERT INTO workflow_timers`).
+		WithArgs(sqlmock.AnyArg(), "instance-1", "workflow-1", "Timer_Wait", "Timer_Wait", dueAt, 0, `{"customerId":"C-1"}`, models.TimerStatusPending, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := service.ScheduleTimer(context.Background(), &models.WorkflowTimer{
+		InstanceId:  "instance-1",
+		WorkflowId:  "workflow-1",
+		NodeId:      "Timer_Wait",
+		ScopeNodeId: "Timer_Wait",
+		DueAt:       dueAt,
+		Variables:   map[string]interface{}{"customerId": "C-1"},
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowTimerService_CancelStaleTimers_Success(t *testing.T) {
+	service, mock, _, cleanup := setupWorkflowTimerServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectExec(`UPDATE workflow_timers`).
+		WithArgs(models.TimerStatusCancelled, sqlmock.AnyArg(), "instance-1", models.TimerStatusPending, pq.Array([]string{"UserTask_1"})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	cancelled, err := service.CancelStaleTimers(context.Background(), "instance-1", []string{"UserTask_1"})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cancelled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowTimerService_ClaimDueTimers_Success(t *testing.T) {
+	service, mock, _, cleanup := setupWorkflowTimerServiceTest(t)
+	defer cleanup()
+
+	now := time.Now()
+	mock.ExpectQuery(`UPDATE workflow_timers SET status = \$1, lock_owner = \$2, lock_expires_at = \$3`).
+		WithArgs(models.TimerStatusFiring, "scheduler-1", sqlmock.AnyArg(), sqlmock.AnyArg(), models.TimerStatusPending, 10).
+		WillReturnRows(sqlmock.NewRows(timerColumns).
+			AddRow("timer-1", "instance-1", "workflow-1", "Timer_Wait", "Timer_Wait", now, 0, []byte(`{"customerId":"C-1"}`), models.TimerStatusFiring, now, now))
+
+	timers, err := service.ClaimDueTimers(context.Background(), "scheduler-1", 10, timerLockDuration)
+
+	require.NoError(t, err)
+	require.Len(t, timers, 1)
+	assert.Equal(t, "Timer_Wait", timers[0].NodeId)
+	assert.Equal(t, "C-1", timers[0].Variables["customerId"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowTimerService_DatabaseNotAvailable(t *testing.T) {
+	logger := zerolog.Nop()
+	service := NewWorkflowTimerService(database.NewDatabase(&logger), &logger)
+
+	err := service.ScheduleTimer(context.Background(), &models.WorkflowTimer{})
+	assert.Error(t, err)
+
+	_, err = service.ClaimDueTimers(context.Background(), "scheduler-1", 10, timerLockDuration)
+	assert.Error(t, err)
+}
+
+func TestWorkflowTimerScheduler_FireDueTimers_CancelsStaleTimer(t *testing.T) {
+	_, mock, db, cleanup := setupWorkflowTimerServiceTest(t)
+	defer cleanup()
+
+	logger := zerolog.Nop()
+	scheduler := NewWorkflowTimerScheduler(db, &logger)
+	now := time.Now()
+
+	// 定时器等待的令牌已离开 Timer_Wait
+	mock.ExpectQuery(`UPDATE workflow_timers`).
+		WillReturnRows(sqlmock.NewRows(timerColumns).
+			AddRow("timer-1", "instance-1", "workflow-1", "Timer_Wait", "Timer_Wait", now, 0, []byte(`{}`), models.TimerStatusFiring, now, now))
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow("instance-1", "workflow-1", "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"UserTask_1"}), 3, 0, now, now))
+	mock.ExpectExec(`UPDATE workflow_timers`).
+		WithArgs(models.TimerStatusCancelled, "", sqlmock.AnyArg(), "timer-1", models.TimerStatusFiring, scheduler.owner).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	fired, err := scheduler.FireDueTimers(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, fired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowTimerScheduler_FireDueTimers_ReleasesOnVersionConflict(t *testing.T) {
+	_, mock, db, cleanup := setupWorkflowTimerServiceTest(t)
+	defer cleanup()
+
+	logger := zerolog.Nop()
+	scheduler := NewWorkflowTimerScheduler(db, &logger)
+	scheduler.workflowSvc.SetWorkflowInMemory(&models.Workflow{Id: "workflow-1", BpmnXml: createTimerTestBPMN(), Status: models.StatusActive})
+	instanceColumns := []string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}
+	now := time.Now()
+
+	mock.ExpectQuery(`UPDATE workflow_timers`).
+		WillReturnRows(sqlmock.NewRows(timerColumns).
+			AddRow("timer-1", "instance-1", "workflow-1", "Timer_Wait", "Timer_Wait", now, 0, []byte(`{}`), models.TimerStatusFiring, now, now))
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows(instanceColumns).
+			AddRow("instance-1", "workflow-1", "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"Timer_Wait"}), 3, 0, now, now))
+	mock.ExpectExec(`UPDATE workflow_timers SET lock_expires_at = \$1`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), pq.Array([]string{"timer-1"}), models.TimerStatusFiring, scheduler.owner).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// 实例的另一个分支正在执行：占用版本失败
+	mock.ExpectQuery(`UPDATE workflow_instances`).
+		WithArgs(sqlmock.AnyArg(), models.InstanceStatusRunning, sqlmock.AnyArg(), "instance-1", 3).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows(instanceColumns).
+			AddRow("instance-1", "workflow-1", "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"Timer_Wait"}), 4, 0, now, now))
+	// 定时器放回待触发状态，不标记为失败
+	mock.ExpectExec(`UPDATE workflow_timers`).
+		WithArgs(models.TimerStatusPending, "", sqlmock.AnyArg(), "timer-1", models.TimerStatusFiring, scheduler.owner).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	fired, err := scheduler.FireDueTimers(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, fired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowTimerScheduler_FireDueTimers_SkipsTimerWithLostLock(t *testing.T) {
+	_, mock, db, cleanup := setupWorkflowTimerServiceTest(t)
+	defer cleanup()
+
+	logger := zerolog.Nop()
+	scheduler := NewWorkflowTimerScheduler(db, &logger)
+	scheduler.workflowSvc.SetWorkflowInMemory(&models.Workflow{Id: "workflow-1", BpmnXml: createTimerTestBPMN(), Status: models.StatusActive})
+	now := time.Now()
+
+	mock.ExpectQuery(`UPDATE workflow_timers`).
+		WillReturnRows(sqlmock.NewRows(timerColumns).
+			AddRow("timer-1", "instance-1", "workflow-1", "Timer_Wait", "Timer_Wait", now, 0, []byte(`{}`), models.TimerStatusFiring, now, now))
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "name", "status", "current_node_ids", "instance_version", "workflow_version", "created_at", "updated_at"}).
+			AddRow("instance-1", "workflow-1", "Test Instance", models.InstanceStatusRunning, pq.Array([]string{"Timer_Wait"}), 3, 0, now, now))
+	// 锁已过期并被其他调度器重新领取：不触发也不修改定时器
+	mock.ExpectExec(`UPDATE workflow_timers SET lock_expires_at = \$1`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), pq.Array([]string{"timer-1"}), models.TimerStatusFiring, scheduler.owner).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	fired, err := scheduler.FireDueTimers(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, fired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
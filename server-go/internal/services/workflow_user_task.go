@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/expr-lang/expr"
+)
+
+// isUserTask checks whether the node is a user task
+func isUserTask(node models.Node) bool {
+	return node.Type == parser.NodeTypeUserTask
+}
+
+// syncUserTasks creates human tasks for tokens newly parked at user tasks and cancels tasks whose token has left
+// 任务记录失败只输出日志，不影响流程执行
+func (s *WorkflowEngineService) syncUserTasks(
+	ctx context.Context,
+	wd *models.WorkflowDefinition,
+	workflowId string,
+	instanceId string,
+	parkedNodeIds []string,
+	currentNodeIds []string,
+	variables map[string]interface{},
+) {
+	if !hasWaitingEvents(wd, isUserTask) {
+		return
+	}
+
+	if _, err := s.taskSvc.CancelStaleUserTasks(ctx, instanceId, currentNodeIds); err != nil {
+		s.logger.Warn().Err(err).Str("instanceId", instanceId).Msg("Failed to cancel stale user tasks")
+	}
+
+	now := time.Now()
+	for _, nodeId := range parkedNodeIds {
+		node := wd.Nodes[nodeId]
+		if !isUserTask(node) {
+			continue
+		}
+		task, err := newUserTask(&node, variables, now)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("instanceId", instanceId).Str("nodeId", nodeId).Msg("Failed to resolve user task assignment")
+			continue
+		}
+		task.InstanceId = instanceId
+		task.WorkflowId = workflowId
+		if err := s.taskSvc.CreateUserTask(ctx, task); err != nil {
+			s.logger.Warn().Err(err).Str("instanceId", instanceId).Str("nodeId", nodeId).Msg("Failed to create user task")
+		}
+	}
+}
+
+// newUserTask builds the human task of a user task node, evaluating ${expression} values against the variables
+func newUserTask(node *models.Node, variables map[string]interface{}, now time.Time) (*models.UserTask, error) {
+	name := node.Name
+	if name == "" {
+		name = node.Id
+	}
+	task := &models.UserTask{
+		NodeId:    node.Id,
+		Name:      name,
+		Priority:  models.DefaultUserTaskPriority,
+		Variables: variables,
+	}
+
+	assignment := node.TaskAssignment
+	if assignment == nil {
+		return withLaneCandidates(task, node), nil
+	}
+	task.Priority = assignment.Priority
+	task.FormKey = assignment.FormKey
+
+	assignees, err := resolveTaskValues([]string{assignment.Assignee}, variables)
+	if err != nil {
+		return nil, fmt.Errorf("assignee: %w", err)
+	}
+	if len(assignees) > 1 {
+		return nil, fmt.Errorf("assignee must resolve to a single user, got %v", assignees)
+	}
+	if len(assignees) == 1 {
+		task.Assignee = assignees[0]
+	}
+	if task.CandidateUsers, err = resolveTaskValues(assignment.CandidateUsers, variables); err != nil {
+		return nil, fmt.Errorf("candidateUsers: %w", err)
+	}
+	if task.CandidateGroups, err = resolveTaskValues(assignment.CandidateGroups, variables); err != nil {
+		return nil, fmt.Errorf("candidateGroups: %w", err)
+	}
+
+	if assignment.DueDate != "" {
+		dueDates, err := resolveTaskValues([]string{assignment.DueDate}, variables)
+		if err != nil {
+			return nil, fmt.Errorf("dueDate: %w", err)
+		}
+		if len(dueDates) == 1 {
+			dueDate, err := parser.TaskDueDate(dueDates[0], now)
+			if err != nil {
+				return nil, fmt.Errorf("dueDate: %w", err)
+			}
+			task.DueDate = &dueDate
+		}
+	}
+	return withLaneCandidates(task, node), nil
+}
+
+// withLaneCandidates lets the candidate groups of the node's lane claim a task that has no assignee and no candidates
+func withLaneCandidates(task *models.UserTask, node *models.Node) *models.UserTask {
+	if node.Lane != nil && task.Assignee == "" && len(task.CandidateUsers) == 0 && len(task.CandidateGroups) == 0 {
+		task.CandidateGroups = node.Lane.CandidateGroups
+	}
+	return task
+}
+
+// resolveTaskValues evaluates ${expression} items against the variables
+// 表达式可以返回字符串或字符串列表，空值被忽略
+func resolveTaskValues(items []string, variables map[string]interface{}) ([]string, error) {
+	var values []string
+	for _, item := range items {
+		if !parser.IsTaskExpression(item) {
+			if item != "" {
+				values = append(values, item)
+			}
+			continue
+		}
+
+		source := strings.TrimSpace(item[2 : len(item)-1])
+		result, err := expr.Eval(source, variables)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate %s: %w", item, err)
+		}
+		switch v := result.(type) {
+		case nil:
+		case string:
+			if v != "" {
+				values = append(values, v)
+			}
+		case []string:
+			values = append(values, v...)
+		case []interface{}:
+			for _, element := range v {
+				s, ok := element.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s must evaluate to strings, got %T", item, element)
+				}
+				values = append(values, s)
+			}
+		default:
+			return nil, fmt.Errorf("%s must evaluate to a string or a list of strings, got %T", item, result)
+		}
+	}
+	return values, nil
+}
+
+// resolveTaskOutcome returns the node to trigger when a user task is completed
+// UserTask 的出边都从边界事件出发（见 validateUserTaskConstraints），完成任务即触发其中一个中断型的普通边界事件；
+// outcome 为空时要求只有一个这样的边界事件；任务没有任何边界事件时直接触发任务本身，令牌在此结束
+func resolveTaskOutcome(wd *models.WorkflowDefinition, taskNodeId string, outcome string) (string, error) {
+	var candidates []string
+	hasBoundary := false
+	for id, node := range wd.Nodes {
+		if node.Type != parser.NodeTypeBoundaryEvent || node.AttachedNodeId != taskNodeId {
+			continue
+		}
+		hasBoundary = true
+		// 定时器、消息、信号和错误边界事件由各自的事件触发，不能用来完成任务
+		if node.CancelActivity && node.TimerDefinition == nil && node.MessageRef == "" && node.SignalRef == "" && node.ErrorDefinition == nil {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Strings(candidates)
+
+	if outcome != "" {
+		if countNodeId(candidates, outcome) == 0 {
+			return "", fmt.Errorf("%s: %s is not a completion outcome of user task %s, expected one of %v",
+				models.ErrInvalidRequest, outcome, taskNodeId, candidates)
+		}
+		return outcome, nil
+	}
+
+	switch {
+	case len(candidates) == 1:
+		return candidates[0], nil
+	case len(candidates) > 1:
+		return "", fmt.Errorf("%s: user task %s has several outcomes, outcome must be one of %v",
+			models.ErrInvalidRequest, taskNodeId, candidates)
+	case !hasBoundary && len(wd.Nodes[taskNodeId].OutgoingSequenceFlowIds) == 0:
+		return taskNodeId, nil
+	default:
+		return "", fmt.Errorf("%s: user task %s has no boundary event without an event definition to complete through",
+			models.ErrInvalidRequest, taskNodeId)
+	}
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createApprovalBPMN 审批流程：经理组审批，批准或驳回通过各自的边界事件离开，超时升级
+func createApprovalBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_Approval" name="Approval">
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:userTask id="UserTask_Approve" name="Approve Expense" xflow:candidateGroups="managers">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:boundaryEvent id="Boundary_Approved" attachedToRef="UserTask_Approve">
+      <bpmn:outgoing>Flow_Approved</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:boundaryEvent id="Boundary_Rejected" attachedToRef="UserTask_Approve">
+      <bpmn:outgoing>Flow_Rejected</bpmn:outgoing>
+    </bpmn:boundaryEvent>
+    <bpmn:boundaryEvent id="Boundary_Escalate" attachedToRef="UserTask_Approve">
+      <bpmn:outgoing>Flow_Escalate</bpmn:outgoing>
+      <bpmn:timerEventDefinition>
+        <bpmn:timeDuration>P3D</bpmn:timeDuration>
+      </bpmn:timerEventDefinition>
+    </bpmn:boundaryEvent>
+    <bpmn:endEvent id="EndEvent_Approved">
+      <bpmn:incoming>Flow_Approved</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:userTask id="UserTask_Rework" name="Rework">
+      <bpmn:incoming>Flow_Rejected</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:userTask id="UserTask_Escalated" name="Escalated">
+      <bpmn:incoming>Flow_Escalate</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="UserTask_Approve"/>
+    <bpmn:sequenceFlow id="Flow_Approved" sourceRef="Boundary_Approved" targetRef="EndEvent_Approved"/>
+    <bpmn:sequenceFlow id="Flow_Rejected" sourceRef="Boundary_Rejected" targetRef="UserTask_Rework"/>
+    <bpmn:sequenceFlow id="Flow_Escalate" sourceRef="Boundary_Escalate" targetRef="UserTask_Escalated"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+// setupUserTaskCompletionTest creates a completion service sharing the engine's mocked database
+func setupUserTaskCompletionTest(t *testing.T) (*UserTaskCompletionService, sqlmock.Sqlmock, func()) {
+	engineSvc, mock, cleanup := setupWorkflowEngineServiceTest(t)
+
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Approval", BpmnXml: createApprovalBPMN(), Status: models.StatusDraft}
+	engineSvc.workflowSvc.SetWorkflowInMemory(workflow)
+
+	service := NewUserTaskCompletionService(engineSvc.db, engineSvc.logger, engineSvc.workflowSvc, engineSvc.instanceSvc, engineSvc)
+	return service, mock, cleanup
+}
+
+// expectTaskInstance mocks loading instance-1 waiting at the approval task
+func expectTaskInstance(mock sqlmock.Sqlmock, status string) {
+	now := time.Now()
+	mock.ExpectQuery(`SELECT (.+) FROM workflow_instances`).
+		WithArgs("instance-1").
+		WillReturnRows(sqlmock.NewRows(callActivityInstanceColumns).
+			AddRow("instance-1", "workflow-1", "Approval", status, pq.Array([]string{"UserTask_Approve"}), 3, 0, now, now))
+}
+
+func TestNewUserTask_ResolvesAssignment(t *testing.T) {
+	now := time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC)
+	variables := map[string]interface{}{
+		"initiator": "alice",
+		"reviewers": []interface{}{"bob", "carol"},
+		"deadline":  "2026-02-01T00:00:00Z",
+	}
+
+	tests := []struct {
+		name       string
+		assignment *models.TaskAssignment
+		lane       *models.Lane
+		expected   *models.UserTask
+		errorText  string
+	}{
+		{
+			name:     "no assignment",
+			expected: &models.UserTask{Priority: models.DefaultUserTaskPriority},
+		},
+		{
+			name: "expressions and duration",
+			assignment: &models.TaskAssignment{
+				Assignee:        "${initiator}",
+				CandidateUsers:  []string{"${reviewers}", "dave"},
+				CandidateGroups: []string{"managers"},
+				DueDate:         "P2D",
+				Priority:        80,
+				FormKey:         "approve-form",
+			},
+			expected: &models.UserTask{
+				Assignee:        "alice",
+				CandidateUsers:  []string{"bob", "carol", "dave"},
+				CandidateGroups: []string{"managers"},
+				DueDate:         timePtr(now.Add(48 * time.Hour)),
+				Priority:        80,
+				FormKey:         "approve-form",
+			},
+		},
+		{
+			name:       "due date expression",
+			assignment: &models.TaskAssignment{DueDate: "${deadline}", Priority: 50},
+			expected:   &models.UserTask{DueDate: timePtr(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)), Priority: 50},
+		},
+		{
+			name:     "lane candidate groups",
+			lane:     &models.Lane{Id: "Lane_Finance", Name: "Finance", CandidateGroups: []string{"finance"}},
+			expected: &models.UserTask{CandidateGroups: []string{"finance"}, Priority: models.DefaultUserTaskPriority},
+		},
+		{
+			name:       "assignment overrides lane",
+			assignment: &models.TaskAssignment{Assignee: "${initiator}", Priority: 50},
+			lane:       &models.Lane{Id: "Lane_Finance", Name: "Finance", CandidateGroups: []string{"finance"}},
+			expected:   &models.UserTask{Assignee: "alice", Priority: 50},
+		},
+		{
+			name:       "assignee resolves to several users",
+			assignment: &models.TaskAssignment{Assignee: "${reviewers}"},
+			errorText:  "assignee must resolve to a single user",
+		},
+		{
+			name:       "candidate expression of the wrong type",
+			assignment: &models.TaskAssignment{CandidateGroups: []string{"${1 + 1}"}},
+			errorText:  "must evaluate to a string or a list of strings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &models.Node{Id: "UserTask_Approve", Name: "Approve", Type: parser.NodeTypeUserTask, TaskAssignment: tt.assignment, Lane: tt.lane}
+
+			task, err := newUserTask(node, variables, now)
+
+			if tt.errorText != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorText)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "UserTask_Approve", task.NodeId)
+			assert.Equal(t, "Approve", task.Name)
+			assert.Equal(t, tt.expected.Assignee, task.Assignee)
+			assert.Equal(t, tt.expected.CandidateUsers, task.CandidateUsers)
+			assert.Equal(t, tt.expected.CandidateGroups, task.CandidateGroups)
+			assert.Equal(t, tt.expected.DueDate, task.DueDate)
+			assert.Equal(t, tt.expected.Priority, task.Priority)
+			assert.Equal(t, tt.expected.FormKey, task.FormKey)
+		})
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestResolveTaskOutcome(t *testing.T) {
+	wd, err := parser.ParseBPMN(createApprovalBPMN())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		nodeId    string
+		outcome   string
+		expected  string
+		errorText string
+	}{
+		{name: "chosen outcome", nodeId: "UserTask_Approve", outcome: "Boundary_Rejected", expected: "Boundary_Rejected"},
+		{name: "several outcomes require a choice", nodeId: "UserTask_Approve", errorText: "outcome must be one of [Boundary_Approved Boundary_Rejected]"},
+		// 定时器边界事件由定时器触发，不能用来完成任务
+		{name: "timer boundary is not an outcome", nodeId: "UserTask_Approve", outcome: "Boundary_Escalate", errorText: "is not a completion outcome"},
+		{name: "task without boundary events", nodeId: "UserTask_Rework", expected: "UserTask_Rework"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outcome, err := resolveTaskOutcome(wd, tt.nodeId, tt.outcome)
+
+			if tt.errorText != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), models.ErrInvalidRequest)
+				assert.Contains(t, err.Error(), tt.errorText)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, outcome)
+		})
+	}
+}
+
+func TestUserTaskCompletionService_CompleteTask(t *testing.T) {
+	tests := []struct {
+		name           string
+		outcome        string
+		expectedStatus string
+		expectedNodes  []string
+	}{
+		{
+			name:           "approved instance completes",
+			outcome:        "Boundary_Approved",
+			expectedStatus: models.InstanceStatusCompleted,
+			expectedNodes:  []string{},
+		},
+		{
+			name:           "rejected instance waits for rework",
+			outcome:        "Boundary_Rejected",
+			expectedStatus: models.InstanceStatusRunning,
+			expectedNodes:  []string{"UserTask_Rework"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, mock, cleanup := setupUserTaskCompletionTest(t)
+			defer cleanup()
+
+			mock.ExpectQuery(`SELECT (.+) FROM user_tasks WHERE id = \$1`).
+				WithArgs("task-1").
+				WillReturnRows(userTaskRow("alice", models.UserTaskStatusPending))
+			expectTaskInstance(mock, models.InstanceStatusRunning)
+			mock.ExpectQuery(`UPDATE user_tasks SET status = \$5`).
+				WithArgs("alice", sqlmock.AnyArg(), "task-1", models.UserTaskStatusPending, models.UserTaskStatusCompleted).
+				WillReturnRows(userTaskRow("alice", models.UserTaskStatusCompleted))
+
+			completion, err := service.CompleteTask(newFullMockContext(), "task-1", CompleteUserTaskRequest{
+				UserId:    "alice",
+				Outcome:   tt.outcome,
+				Variables: map[string]interface{}{"comment": "looks good"},
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.outcome, completion.Outcome)
+			assert.Equal(t, models.UserTaskStatusCompleted, completion.Task.Status)
+			assert.Equal(t, tt.expectedStatus, completion.EngineResponse.Status)
+			assert.ElementsMatch(t, tt.expectedNodes, completion.EngineResponse.CurrentNodeIds)
+			// 创建任务时的变量与提交的变量合并
+			assert.Equal(t, float64(100), completion.EngineResponse.Variables["amount"])
+			assert.Equal(t, "looks good", completion.EngineResponse.Variables["comment"])
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserTaskCompletionService_CompleteTask_ReopensWhenInstanceRejects(t *testing.T) {
+	service, mock, cleanup := setupUserTaskCompletionTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT (.+) FROM user_tasks WHERE id = \$1`).
+		WithArgs("task-1").
+		WillReturnRows(userTaskRow("alice", models.UserTaskStatusPending))
+	expectTaskInstance(mock, models.InstanceStatusSuspended)
+	mock.ExpectQuery(`UPDATE user_tasks SET status = \$5`).
+		WithArgs("alice", sqlmock.AnyArg(), "task-1", models.UserTaskStatusPending, models.UserTaskStatusCompleted).
+		WillReturnRows(userTaskRow("alice", models.UserTaskStatusCompleted))
+	// 挂起的实例拒绝推进，任务恢复为待处理
+	mock.ExpectExec(`UPDATE user_tasks SET status = \$1`).
+		WithArgs(models.UserTaskStatusPending, sqlmock.AnyArg(), "task-1", models.UserTaskStatusCompleted).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	completion, err := service.CompleteTask(newFullMockContext(), "task-1", CompleteUserTaskRequest{
+		UserId:  "alice",
+		Outcome: "Boundary_Approved",
+	})
+
+	require.Error(t, err)
+	assert.Nil(t, completion)
+	assert.Contains(t, err.Error(), models.ErrInstanceSuspended)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserTaskCompletionService_CompleteTask_OutcomeRequired(t *testing.T) {
+	service, mock, cleanup := setupUserTaskCompletionTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT (.+) FROM user_tasks WHERE id = \$1`).
+		WithArgs("task-1").
+		WillReturnRows(userTaskRow("alice", models.UserTaskStatusPending))
+	expectTaskInstance(mock, models.InstanceStatusRunning)
+
+	// 出口无法确定时不修改任务
+	completion, err := service.CompleteTask(newFullMockContext(), "task-1", CompleteUserTaskRequest{UserId: "alice"})
+
+	require.Error(t, err)
+	assert.Nil(t, completion)
+	assert.Contains(t, err.Error(), models.ErrInvalidRequest)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+)
+
+// prepareStartVariables returns the variables an instance starts with: the given params plus the defaults of missing declared variables
+// 必填变量缺失或变量类型与声明不符时返回 INVALID_VARIABLES 错误；声明为整数的变量转换为 int64/uint64；没有变量声明的流程原样返回
+func prepareStartVariables(wd *models.WorkflowDefinition, params map[string]interface{}) (map[string]interface{}, error) {
+	if len(wd.VariableDeclarations) == 0 {
+		return params, nil
+	}
+
+	variables := cloneVariables(params)
+	for _, decl := range wd.VariableDeclarations {
+		if value, exists := variables[decl.Name]; (!exists || value == nil) && decl.Default != nil {
+			variables[decl.Name] = decl.Default
+		}
+		if err := checkVariable(&decl, variables); err != nil {
+			return nil, err
+		}
+	}
+	return variables, nil
+}
+
+// checkDeclaredVariables checks the named variables against their declarations after they were written by a mapping
+// 没有声明的变量不检查；声明为整数的变量转换为运行时表示（见 normalizeVariableValue）
+func checkDeclaredVariables(wd *models.WorkflowDefinition, variables map[string]interface{}, names []string) error {
+	for _, name := range names {
+		if decl := parser.FindVariableDeclaration(wd, name); decl != nil {
+			if err := checkVariable(decl, variables); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mappingTargets 返回映射写入的变量名
+func mappingTargets(mappings []models.VariableMapping) []string {
+	names := make([]string, 0, len(mappings))
+	for _, mapping := range mappings {
+		names = append(names, mapping.Target)
+	}
+	return names
+}
+
+// variableNames 返回写入的变量名，按名称排序使错误信息稳定
+func variableNames(variables map[string]interface{}) []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkVariable 检查声明的变量：必填变量不能缺失或为 null，有值时必须符合声明的类型
+func checkVariable(decl *models.VariableDeclaration, variables map[string]interface{}) error {
+	value := variables[decl.Name]
+	if value == nil {
+		if decl.Required {
+			return fmt.Errorf("%s: variable %s is required", models.ErrInvalidVariables, decl.Name)
+		}
+		return nil
+	}
+	if !matchesVariableType(decl.Type, value) {
+		return fmt.Errorf("%s: variable %s must be %s, got %T", models.ErrInvalidVariables, decl.Name, parser.VariableTypeName(decl.Type), value)
+	}
+	variables[decl.Name] = normalizeVariableValue(decl.Type, value)
+	return nil
+}
+
+// normalizeDeclaredVariables converts the values of declared integer variables to their runtime representation
+// 实例变量以 JSON 保存，重新读取后整数变为 float64，执行前统一转换，与部署时条件的类型检查一致
+func normalizeDeclaredVariables(wd *models.WorkflowDefinition, variables map[string]interface{}) {
+	for _, decl := range wd.VariableDeclarations {
+		if value, exists := variables[decl.Name]; exists && value != nil {
+			variables[decl.Name] = normalizeVariableValue(decl.Type, value)
+		}
+	}
+}
+
+// normalizeVariableValue 返回整数类型变量的运行时表示：有符号整数为 int64，无符号整数为 uint64
+// 条件按声明类型检查时整数变量是整数（如 amount % 2），运行时的值也必须是整数而不是 JSON 解析出的 float64；
+// 其他类型或不符合声明的值原样返回
+func normalizeVariableValue(t uint32, value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch t {
+	case models.VariableTypeInt32, models.VariableTypeInt64:
+		if n, ok := integerValue(v); ok {
+			return n
+		}
+	case models.VariableTypeUint32, models.VariableTypeUint64:
+		if v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64 {
+			return v.Uint()
+		}
+		if n, ok := integerValue(v); ok && n >= 0 {
+			return uint64(n)
+		}
+	}
+	return value
+}
+
+// matchesVariableType 按 FieldDescriptor::CppType 的语义检查值的类型
+// JSON 中的数字解析为 float64，整数类型接受没有小数部分且在取值范围内的数字
+func matchesVariableType(t uint32, value interface{}) bool {
+	v := reflect.ValueOf(value)
+	switch t {
+	case models.VariableTypeInt32:
+		n, ok := integerValue(v)
+		return ok && n >= math.MinInt32 && n <= math.MaxInt32
+	case models.VariableTypeInt64:
+		_, ok := integerValue(v)
+		return ok
+	case models.VariableTypeUint32:
+		n, ok := integerValue(v)
+		return ok && n >= 0 && n <= math.MaxUint32
+	case models.VariableTypeUint64:
+		if v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64 {
+			return true
+		}
+		n, ok := integerValue(v)
+		return ok && n >= 0
+	case models.VariableTypeDouble, models.VariableTypeFloat:
+		return (v.Kind() >= reflect.Int && v.Kind() <= reflect.Uint64) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+	case models.VariableTypeBool:
+		return v.Kind() == reflect.Bool
+	case models.VariableTypeString, models.VariableTypeEnum:
+		return v.Kind() == reflect.String
+	case models.VariableTypeMessage:
+		return v.Kind() == reflect.Map || v.Kind() == reflect.Struct
+	}
+	return true
+}
+
+// integerValue 返回整数或没有小数部分的浮点数的值
+func integerValue(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(f), true
+	}
+	return 0, false
+}
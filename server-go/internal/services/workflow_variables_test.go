@@ -0,0 +1,269 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTypedVariablesBPMN 声明了变量的订单审批流程：金额超过 1000 的欧洲订单需要审批
+func createTypedVariablesBPMN() string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:extensionElements>
+      <xflow:declarations>
+        <xflow:declaration name="amount" type="Integer" required="true"/>
+        <xflow:declaration name="region" type="String" default="EU"/>
+        <xflow:declaration name="express" type="Boolean"/>
+      </xflow:declarations>
+    </bpmn:extensionElements>
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:exclusiveGateway id="Gateway_1" default="Flow_3">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:outgoing>Flow_3</bpmn:outgoing>
+    </bpmn:exclusiveGateway>
+    <bpmn:userTask id="UserTask_Approve">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:userTask>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_3</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="Gateway_1"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="Gateway_1" targetRef="UserTask_Approve">
+      <bpmn:conditionExpression>amount &gt; 1000 &amp;&amp; region == "EU"</bpmn:conditionExpression>
+    </bpmn:sequenceFlow>
+    <bpmn:sequenceFlow id="Flow_3" sourceRef="Gateway_1" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+}
+
+func TestPrepareStartVariables(t *testing.T) {
+	wd, err := parser.ParseBPMN(createTypedVariablesBPMN())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		params   map[string]interface{}
+		expected map[string]interface{}
+		errorMsg string
+	}{
+		{
+			name:     "defaults fill missing variables",
+			params:   map[string]interface{}{"amount": float64(1500)},
+			expected: map[string]interface{}{"amount": int64(1500), "region": "EU"},
+		},
+		{
+			name:     "given values and undeclared variables are kept",
+			params:   map[string]interface{}{"amount": 20, "region": "US", "express": true, "channel": "web"},
+			expected: map[string]interface{}{"amount": int64(20), "region": "US", "express": true, "channel": "web"},
+		},
+		{
+			name:     "required variable missing",
+			params:   map[string]interface{}{"region": "US"},
+			errorMsg: "INVALID_VARIABLES: variable amount is required",
+		},
+		{
+			name:     "wrong type",
+			params:   map[string]interface{}{"amount": "1500"},
+			errorMsg: "INVALID_VARIABLES: variable amount must be int64, got string",
+		},
+		{
+			name:     "fractional number for an integer",
+			params:   map[string]interface{}{"amount": 15.5},
+			errorMsg: "variable amount must be int64",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variables, err := prepareStartVariables(wd, tt.params)
+			if tt.errorMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errorMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, variables)
+		})
+	}
+
+	// 传入的参数不被修改
+	params := map[string]interface{}{"amount": 1}
+	_, err = prepareStartVariables(wd, params)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"amount": 1}, params)
+}
+
+func TestMatchesVariableType(t *testing.T) {
+	tests := []struct {
+		name     string
+		varType  uint32
+		value    interface{}
+		expected bool
+	}{
+		{"int32 from JSON number", models.VariableTypeInt32, float64(42), true},
+		{"int32 out of range", models.VariableTypeInt32, int64(1) << 40, false},
+		{"int64 from int", models.VariableTypeInt64, 7, true},
+		{"int64 rejects fraction", models.VariableTypeInt64, 1.5, false},
+		{"uint32 rejects negative", models.VariableTypeUint32, -1, false},
+		{"uint64 from uint64", models.VariableTypeUint64, uint64(1) << 63, true},
+		{"double from int", models.VariableTypeDouble, 3, true},
+		{"double rejects string", models.VariableTypeDouble, "3", false},
+		{"bool", models.VariableTypeBool, false, true},
+		{"string rejects number", models.VariableTypeString, 1, false},
+		{"enum as string", models.VariableTypeEnum, "GOLD", true},
+		{"object from JSON object", models.VariableTypeMessage, map[string]interface{}{"tier": "gold"}, true},
+		{"object rejects list", models.VariableTypeMessage, []interface{}{1}, false},
+		{"untyped accepts anything", 0, []interface{}{1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, matchesVariableType(tt.varType, tt.value))
+		})
+	}
+}
+
+func TestNormalizeVariableValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		varType  uint32
+		value    interface{}
+		expected interface{}
+	}{
+		{"int32 from JSON number", models.VariableTypeInt32, float64(42), int64(42)},
+		{"int64 from int", models.VariableTypeInt64, 7, int64(7)},
+		{"uint32 from JSON number", models.VariableTypeUint32, float64(3), uint64(3)},
+		{"uint64 keeps large values", models.VariableTypeUint64, uint64(1) << 63, uint64(1) << 63},
+		{"fraction is kept", models.VariableTypeInt64, 1.5, 1.5},
+		{"double is kept", models.VariableTypeDouble, float64(2), float64(2)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizeVariableValue(tt.varType, tt.value))
+		})
+	}
+}
+
+func TestCheckDeclaredVariables(t *testing.T) {
+	wd, err := parser.ParseBPMN(createTypedVariablesBPMN())
+	require.NoError(t, err)
+
+	variables := map[string]interface{}{"amount": nil, "express": "yes", "score": "high"}
+
+	// 只检查映射写入的变量，未声明的变量不检查
+	assert.NoError(t, checkDeclaredVariables(wd, variables, []string{"score", "region"}))
+
+	err = checkDeclaredVariables(wd, variables, []string{"express"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "INVALID_VARIABLES: variable express must be bool, got string")
+
+	err = checkDeclaredVariables(wd, variables, []string{"amount"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "variable amount is required")
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_StartVariables(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Order", BpmnXml: createTypedVariablesBPMN(), Status: models.StatusActive}
+
+	// 默认的 region 参与网关条件，订单进入审批
+	instance := &models.WorkflowInstance{Id: "instance-1", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_1"}}
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", map[string]interface{}{"amount": float64(1500)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Approve"}, result.EngineResponse.CurrentNodeIds)
+	assert.Equal(t, "EU", result.EngineResponse.Variables["region"])
+
+	// 缺少必填变量时实例不会启动
+	instance = &models.WorkflowInstance{Id: "instance-2", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_1"}}
+	_, err = engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", map[string]interface{}{"region": "EU"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "INVALID_VARIABLES: variable amount is required")
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_IntegerConditionWithJSONInput(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	bpmnXml := strings.Replace(createTypedVariablesBPMN(),
+		`amount &gt; 1000 &amp;&amp; region == "EU"`, `amount % 2 == 0`, 1)
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Order", BpmnXml: bpmnXml, Status: models.StatusActive}
+
+	// 请求中的变量按 JSON 解析，整数变量为 float64
+	var variables map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"amount": 1500}`), &variables))
+
+	instance := &models.WorkflowInstance{Id: "instance-1", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_1"}}
+	result, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", variables)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"UserTask_Approve"}, result.EngineResponse.CurrentNodeIds)
+	assert.Equal(t, int64(1500), result.EngineResponse.Variables["amount"])
+
+	// 从保存的变量继续时同样按整数求值
+	require.NoError(t, json.Unmarshal([]byte(`{"amount": 1501}`), &variables))
+	instance = &models.WorkflowInstance{Id: "instance-2", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"Gateway_1"}}
+	result, err = engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "Gateway_1", variables)
+	require.NoError(t, err)
+	assert.Empty(t, result.EngineResponse.CurrentNodeIds)
+}
+
+func TestWorkflowEngineService_ExecuteFromNode_ScriptWritesDeclaredVariable(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	bpmnXml := `<?xml version="1.0" encoding="UTF-8"?>
+<bpmn:definitions xmlns:bpmn="http://www.omg.org/spec/BPMN/20100524/MODEL" xmlns:xflow="http://example.com/bpmn/xflow-extension">
+  <bpmn:process id="Process_1">
+    <bpmn:extensionElements>
+      <xflow:declarations>
+        <xflow:declaration name="express" type="Boolean"/>
+      </xflow:declarations>
+    </bpmn:extensionElements>
+    <bpmn:startEvent id="StartEvent_1">
+      <bpmn:outgoing>Flow_1</bpmn:outgoing>
+    </bpmn:startEvent>
+    <bpmn:scriptTask id="ScriptTask_Express" scriptFormat="expr">
+      <bpmn:incoming>Flow_1</bpmn:incoming>
+      <bpmn:outgoing>Flow_2</bpmn:outgoing>
+      <bpmn:script>express = "yes"</bpmn:script>
+    </bpmn:scriptTask>
+    <bpmn:endEvent id="EndEvent_1">
+      <bpmn:incoming>Flow_2</bpmn:incoming>
+    </bpmn:endEvent>
+    <bpmn:sequenceFlow id="Flow_1" sourceRef="StartEvent_1" targetRef="ScriptTask_Express"/>
+    <bpmn:sequenceFlow id="Flow_2" sourceRef="ScriptTask_Express" targetRef="EndEvent_1"/>
+  </bpmn:process>
+</bpmn:definitions>`
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Order", BpmnXml: bpmnXml, Status: models.StatusActive}
+	instance := &models.WorkflowInstance{Id: "instance-1", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"StartEvent_1"}}
+
+	_, err := engineSvc.ExecuteFromNode(newFullMockContext(), workflow, instance, "StartEvent_1", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "INVALID_VARIABLES: variable express must be bool, got string")
+}
+
+func TestWorkflowEngineService_TriggerNode_InvalidVariables(t *testing.T) {
+	engineSvc, _, cleanup := setupWorkflowEngineServiceTest(t)
+	defer cleanup()
+
+	workflow := &models.Workflow{Id: "workflow-1", Name: "Order", BpmnXml: createTypedVariablesBPMN(), Status: models.StatusActive}
+	instance := &models.WorkflowInstance{Id: "instance-1", WorkflowId: workflow.Id, Status: models.InstanceStatusRunning, CurrentNodeIds: []string{"UserTask_Approve"}}
+
+	// 完成人工任务时提交的变量同样要符合声明，实例停留在任务上
+	_, err := engineSvc.TriggerNode(newFullMockContext(), workflow, instance, "UserTask_Approve", map[string]interface{}{"amount": float64(1500), "express": "yes"})
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "INVALID_VARIABLES: variable express must be bool"), err.Error())
+	assert.False(t, isExecutionFailure(err))
+}
@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// WorkflowVersionService handles deployment and lookup of immutable workflow versions
+type WorkflowVersionService struct {
+	db     *database.Database
+	logger *zerolog.Logger
+}
+
+// NewWorkflowVersionService creates a new WorkflowVersionService
+func NewWorkflowVersionService(db *database.Database, logger *zerolog.Logger) *WorkflowVersionService {
+	return &WorkflowVersionService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// WorkflowVersionDiff describes the differences between two workflow versions
+type WorkflowVersionDiff struct {
+	WorkflowId   string   `json:"workflowId"`
+	FromVersion  int      `json:"fromVersion"`
+	ToVersion    int      `json:"toVersion"`
+	AddedNodes   []string `json:"addedNodes"`
+	RemovedNodes []string `json:"removedNodes"`
+	ChangedNodes []string `json:"changedNodes"`
+	AddedFlows   []string `json:"addedFlows"`
+	RemovedFlows []string `json:"removedFlows"`
+	ChangedFlows []string `json:"changedFlows"`
+}
+
+// DeployWorkflow snapshots the current BPMN XML of a workflow as the next version and activates it
+// 版本号在流程行锁内计算，并发部署不会产生重复版本
+func (s *WorkflowVersionService) DeployWorkflow(ctx context.Context, workflowId string) (*models.WorkflowVersion, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var bpmnXml string
+	err = tx.QueryRowContext(ctx, `SELECT bpmn_xml FROM workflows WHERE id = $1 FOR UPDATE`, workflowId).Scan(&bpmnXml)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s: %s", models.ErrWorkflowNotFound, "workflow not found")
+		}
+		s.logger.Error().Err(err).Str("workflowId", workflowId).Msg("Failed to lock workflow for deployment")
+		return nil, fmt.Errorf("failed to lock workflow: %w", err)
+	}
+
+	// 只有能够解析的流程才允许部署
+	wd, err := parser.ParseBPMN(bpmnXml)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid BPMN XML: %v", models.ErrInvalidRequest, err)
+	}
+	// 声明了变量的流程按声明的类型检查条件，类型不符或引用未声明变量的条件在执行时才会失败
+	if err := parser.CheckTypedConditions(wd); err != nil {
+		return nil, fmt.Errorf("%s: %v", models.ErrInvalidRequest, err)
+	}
+	if nodeId := selfCallingNode(wd, workflowId); nodeId != "" {
+		return nil, fmt.Errorf("%s: call activity %s calls its own workflow %s", models.ErrInvalidRequest, nodeId, workflowId)
+	}
+	definitionJSON, err := json.Marshal(wd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal workflow definition: %w", err)
+	}
+
+	var version int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(version), 0) + 1 FROM workflow_versions WHERE workflow_id = $1`, workflowId,
+	).Scan(&version); err != nil {
+		return nil, fmt.Errorf("failed to compute next workflow version: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE workflow_versions SET is_active = FALSE WHERE workflow_id = $1 AND is_active`, workflowId,
+	); err != nil {
+		return nil, fmt.Errorf("failed to deactivate workflow versions: %w", err)
+	}
+
+	workflowVersion := models.WorkflowVersion{
+		Id:         uuid.New().String(),
+		WorkflowId: workflowId,
+		Version:    version,
+		BpmnXml:    bpmnXml,
+		Definition: wd,
+		IsActive:   true,
+		CreatedAt:  time.Now(),
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO workflow_versions (id, workflow_id, version, bpmn_xml, definition, is_active, created_at)
+		VALUES ($1, $2, $3, $4, $5::jsonb, TRUE, $6)
+	`, workflowVersion.Id, workflowId, version, bpmnXml, string(definitionJSON), workflowVersion.CreatedAt); err != nil {
+		s.logger.Error().Err(err).Str("workflowId", workflowId).Msg("Failed to insert workflow version")
+		return nil, fmt.Errorf("failed to create workflow version: %w", err)
+	}
+
+	if err := s.markWorkflowActive(ctx, tx, workflowId, version); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit workflow deployment: %w", err)
+	}
+
+	s.logger.Info().Str("workflowId", workflowId).Int("version", version).Msg("Workflow deployed")
+	return &workflowVersion, nil
+}
+
+// selfCallingNode returns the first call activity that calls the workflow it belongs to
+// 直接调用自身的流程每次执行都会无限嵌套启动子实例，部署时即拒绝
+func selfCallingNode(wd *models.WorkflowDefinition, workflowId string) string {
+	nodeIds := make([]string, 0, len(wd.Nodes))
+	for id, node := range wd.Nodes {
+		if node.CalledElement != nil && node.CalledElement.WorkflowId == workflowId {
+			nodeIds = append(nodeIds, id)
+		}
+	}
+	if len(nodeIds) == 0 {
+		return ""
+	}
+	sort.Strings(nodeIds)
+	return nodeIds[0]
+}
+
+// ListWorkflowVersions lists all deployed versions of a workflow, newest first
+// 列表不包含 BPMN XML 和流程定义快照
+func (s *WorkflowVersionService) ListWorkflowVersions(ctx context.Context, workflowId string) ([]models.WorkflowVersion, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		SELECT id, workflow_id, version, is_active, created_at
+		FROM workflow_versions
+		WHERE workflow_id = $1
+		ORDER BY version DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, workflowId)
+	if err != nil {
+		s.logger.Error().Err(err).Str("workflowId", workflowId).Msg("Failed to list workflow versions")
+		return nil, fmt.Errorf("failed to list workflow versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []models.WorkflowVersion{}
+	for rows.Next() {
+		var version models.WorkflowVersion
+		if err := rows.Scan(&version.Id, &version.WorkflowId, &version.Version, &version.IsActive, &version.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan workflow version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate workflow versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+// GetWorkflowVersion retrieves one deployed version of a workflow
+func (s *WorkflowVersionService) GetWorkflowVersion(ctx context.Context, workflowId string, version int) (*models.WorkflowVersion, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		SELECT id, workflow_id, version, bpmn_xml, definition, is_active, created_at
+		FROM workflow_versions
+		WHERE workflow_id = $1 AND version = $2
+	`
+
+	var workflowVersion models.WorkflowVersion
+	var definitionBytes []byte
+	err := s.db.QueryRowContext(ctx, query, workflowId, version).Scan(
+		&workflowVersion.Id,
+		&workflowVersion.WorkflowId,
+		&workflowVersion.Version,
+		&workflowVersion.BpmnXml,
+		&definitionBytes,
+		&workflowVersion.IsActive,
+		&workflowVersion.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s: workflow %s has no version %d", models.ErrWorkflowVersionNotFound, workflowId, version)
+		}
+		s.logger.Error().Err(err).Str("workflowId", workflowId).Int("version", version).Msg("Failed to get workflow version")
+		return nil, fmt.Errorf("failed to get workflow version: %w", err)
+	}
+
+	if len(definitionBytes) > 0 {
+		if err := json.Unmarshal(definitionBytes, &workflowVersion.Definition); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal workflow definition: %w", err)
+		}
+	}
+
+	return &workflowVersion, nil
+}
+
+// ActiveVersion returns the active version number of a workflow, 0 if it has never been deployed
+func (s *WorkflowVersionService) ActiveVersion(ctx context.Context, workflowId string) (int, error) {
+	if s.db.DB == nil {
+		return 0, nil
+	}
+
+	var version int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT version FROM workflow_versions WHERE workflow_id = $1 AND is_active`, workflowId,
+	).Scan(&version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		s.logger.Error().Err(err).Str("workflowId", workflowId).Msg("Failed to get active workflow version")
+		return 0, fmt.Errorf("failed to get active workflow version: %w", err)
+	}
+	return version, nil
+}
+
+// SetActiveVersion activates a deployed version; new instances start on the active version
+func (s *WorkflowVersionService) SetActiveVersion(ctx context.Context, workflowId string, version int) (*models.WorkflowVersion, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE workflow_versions SET is_active = FALSE WHERE workflow_id = $1 AND is_active AND version <> $2`, workflowId, version,
+	); err != nil {
+		return nil, fmt.Errorf("failed to deactivate workflow versions: %w", err)
+	}
+
+	var workflowVersion models.WorkflowVersion
+	err = tx.QueryRowContext(ctx, `
+		UPDATE workflow_versions SET is_active = TRUE
+		WHERE workflow_id = $1 AND version = $2
+		RETURNING id, workflow_id, version, is_active, created_at
+	`, workflowId, version).Scan(
+		&workflowVersion.Id,
+		&workflowVersion.WorkflowId,
+		&workflowVersion.Version,
+		&workflowVersion.IsActive,
+		&workflowVersion.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%s: workflow %s has no version %d", models.ErrWorkflowVersionNotFound, workflowId, version)
+		}
+		s.logger.Error().Err(err).Str("workflowId", workflowId).Int("version", version).Msg("Failed to activate workflow version")
+		return nil, fmt.Errorf("failed to activate workflow version: %w", err)
+	}
+
+	if err := s.markWorkflowActive(ctx, tx, workflowId, version); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit workflow version activation: %w", err)
+	}
+
+	s.logger.Info().Str("workflowId", workflowId).Int("version", version).Msg("Workflow version activated")
+	return &workflowVersion, nil
+}
+
+// DiffWorkflowVersions compares the definition snapshots of two versions
+func (s *WorkflowVersionService) DiffWorkflowVersions(ctx context.Context, workflowId string, fromVersion, toVersion int) (*WorkflowVersionDiff, error) {
+	from, err := s.GetWorkflowVersion(ctx, workflowId, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.GetWorkflowVersion(ctx, workflowId, toVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := DiffWorkflowDefinitions(from.Definition, to.Definition)
+	diff.WorkflowId = workflowId
+	diff.FromVersion = fromVersion
+	diff.ToVersion = toVersion
+	return diff, nil
+}
+
+// SignalStartEvent is a signal start event of an active workflow version
+type SignalStartEvent struct {
+	WorkflowId string `json:"workflowId"`
+	Version    int    `json:"version"`
+	NodeId     string `json:"nodeId"`
+}
+
+// ListSignalStartEvents returns the start events of active workflow versions that listen to the signal
+// 先按定义快照中的信号名称筛选激活版本，再从快照中找出引用该信号的开始事件；未部署的流程不会被信号启动
+func (s *WorkflowVersionService) ListSignalStartEvents(ctx context.Context, name string) ([]SignalStartEvent, error) {
+	if s.db.DB == nil {
+		return nil, fmt.Errorf("database not available")
+	}
+
+	query := `
+		SELECT workflow_id, version, definition
+		FROM workflow_versions
+		WHERE is_active
+		  AND jsonb_path_exists(definition, '$.signals.* ? (@.name == $name)', jsonb_build_object('name', $1::text))
+		ORDER BY workflow_id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, name)
+	if err != nil {
+		s.logger.Error().Err(err).Str("signalName", name).Msg("Failed to list signal start events")
+		return nil, fmt.Errorf("failed to list signal start events: %w", err)
+	}
+	defer rows.Close()
+
+	var startEvents []SignalStartEvent
+	for rows.Next() {
+		var workflowId string
+		var version int
+		var definitionBytes []byte
+		if err := rows.Scan(&workflowId, &version, &definitionBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan workflow version: %w", err)
+		}
+		var wd models.WorkflowDefinition
+		if err := json.Unmarshal(definitionBytes, &wd); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal workflow definition: %w", err)
+		}
+		for _, nodeId := range wd.StartEvents {
+			node := wd.Nodes[nodeId]
+			if node.SignalRef != "" && signalName(&wd, &node) == name {
+				startEvents = append(startEvents, SignalStartEvent{WorkflowId: workflowId, Version: version, NodeId: nodeId})
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate workflow versions: %w", err)
+	}
+
+	return startEvents, nil
+}
+
+// markWorkflowActive records the active version number on the workflow row
+// workflows.version 保存当前激活的版本号
+func (s *WorkflowVersionService) markWorkflowActive(ctx context.Context, tx *sql.Tx, workflowId string, version int) error {
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE workflows SET version = $1, status = $2, updated_at = $3 WHERE id = $4`,
+		strconv.Itoa(version), models.StatusActive, time.Now(), workflowId,
+	); err != nil {
+		s.logger.Error().Err(err).Str("workflowId", workflowId).Msg("Failed to update workflow active version")
+		return fmt.Errorf("failed to update workflow active version: %w", err)
+	}
+	return nil
+}
+
+// DiffWorkflowDefinitions compares nodes and sequence flows of two workflow definitions by ID
+func DiffWorkflowDefinitions(from, to *models.WorkflowDefinition) *WorkflowVersionDiff {
+	if from == nil {
+		from = &models.WorkflowDefinition{}
+	}
+	if to == nil {
+		to = &models.WorkflowDefinition{}
+	}
+
+	diff := &WorkflowVersionDiff{}
+	diff.AddedNodes, diff.RemovedNodes, diff.ChangedNodes = diffMaps(from.Nodes, to.Nodes)
+	diff.AddedFlows, diff.RemovedFlows, diff.ChangedFlows = diffMaps(from.SequenceFlows, to.SequenceFlows)
+	return diff
+}
+
+// diffMaps returns the sorted keys added to, removed from and changed between two maps
+func diffMaps[V any](from, to map[string]V) (added, removed, changed []string) {
+	added, removed, changed = []string{}, []string{}, []string{}
+	for id, toValue := range to {
+		fromValue, exists := from[id]
+		if !exists {
+			added = append(added, id)
+		} else if !reflect.DeepEqual(fromValue, toValue) {
+			changed = append(changed, id)
+		}
+	}
+	for id := range from {
+		if _, exists := to[id]; !exists {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/bpmn-explorer/server/internal/models"
+	"github.com/bpmn-explorer/server/internal/parser"
+	"github.com/bpmn-explorer/server/pkg/database"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWorkflowVersionServiceTest(t *testing.T) (*WorkflowVersionService, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+
+	logger := zerolog.Nop()
+	database := database.NewDatabase(&logger)
+	database.DB = db
+
+	service := NewWorkflowVersionService(database, &logger)
+
+	cleanup := func() {
+		db.Close()
+	}
+
+	return service, mock, cleanup
+}
+
+func TestWorkflowVersionService_DeployWorkflow_Success(t *testing.T) {
+	service, mock, cleanup := setupWorkflowVersionServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT bpmn_xml FROM workflows WHERE id = \$1 FOR UPDATE`).
+		WithArgs("test-workflow-id").
+		WillReturnRows(sqlmock.NewRows([]string{"bpmn_xml"}).AddRow(createTestBPMN()))
+	mock.ExpectQuery(`SELECT COALESCE\(MAX\(version\), 0\) \+ 1 FROM workflow_versions`).
+		WithArgs("test-workflow-id").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(3))
+	mock.ExpectExec(`UPDATE workflow_versions SET is_active = FALSE`).
+		WithArgs("test-workflow-id").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO workflow_versions`).
+		WithArgs(sqlmock.AnyArg(), "test-workflow-id", 3, createTestBPMN(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE workflows SET version`).
+		WithArgs("3", models.StatusActive, sqlmock.AnyArg(), "test-workflow-id").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	version, err := service.DeployWorkflow(context.Background(), "test-workflow-id")
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, version.Version)
+	assert.True(t, version.IsActive)
+	require.NotNil(t, version.Definition)
+	assert.Contains(t, version.Definition.Nodes, "ServiceTask_1")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowVersionService_DeployWorkflow_InvalidXML(t *testing.T) {
+	service, mock, cleanup := setupWorkflowVersionServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT bpmn_xml FROM workflows WHERE id = \$1 FOR UPDATE`).
+		WithArgs("test-workflow-id").
+		WillReturnRows(sqlmock.NewRows([]string{"bpmn_xml"}).AddRow("<not-bpmn"))
+	mock.ExpectRollback()
+
+	_, err := service.DeployWorkflow(context.Background(), "test-workflow-id")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInvalidRequest)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowVersionService_DeployWorkflow_SelfCallingWorkflow(t *testing.T) {
+	service, mock, cleanup := setupWorkflowVersionServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT bpmn_xml FROM workflows WHERE id = \$1 FOR UPDATE`).
+		WithArgs("onboarding-workflow").
+		WillReturnRows(sqlmock.NewRows([]string{"bpmn_xml"}).AddRow(createCallActivityParentBPMN("onboarding-workflow")))
+	mock.ExpectRollback()
+
+	_, err := service.DeployWorkflow(context.Background(), "onboarding-workflow")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInvalidRequest)
+	assert.Contains(t, err.Error(), "Call_KYC")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowVersionService_DeployWorkflow_InvalidTypedCondition(t *testing.T) {
+	service, mock, cleanup := setupWorkflowVersionServiceTest(t)
+	defer cleanup()
+
+	// 条件引用了未声明的变量，解析时不报错，部署时拒绝
+	bpmnXml := strings.Replace(createTypedVariablesBPMN(), `amount &gt; 1000`, `amonut &gt; 1000`, 1)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT bpmn_xml FROM workflows WHERE id = \$1 FOR UPDATE`).
+		WithArgs("test-workflow-id").
+		WillReturnRows(sqlmock.NewRows([]string{"bpmn_xml"}).AddRow(bpmnXml))
+	mock.ExpectRollback()
+
+	_, err := service.DeployWorkflow(context.Background(), "test-workflow-id")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrInvalidRequest)
+	assert.Contains(t, err.Error(), "unknown variable amonut")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowVersionService_SetActiveVersion_NotFound(t *testing.T) {
+	service, mock, cleanup := setupWorkflowVersionServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE workflow_versions SET is_active = FALSE`).
+		WithArgs("test-workflow-id", 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`UPDATE workflow_versions SET is_active = TRUE`).
+		WithArgs("test-workflow-id", 9).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err := service.SetActiveVersion(context.Background(), "test-workflow-id", 9)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), models.ErrWorkflowVersionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkflowVersionService_GetWorkflowVersion_Success(t *testing.T) {
+	service, mock, cleanup := setupWorkflowVersionServiceTest(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT id, workflow_id, version, bpmn_xml, definition, is_active, created_at`).
+		WithArgs("test-workflow-id", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workflow_id", "version", "bpmn_xml", "definition", "is_active", "created_at"}).
+			AddRow("version-id", "test-workflow-id", 2, "<xml/>", []byte(`{"nodes":{"Task_1":{"id":"Task_1","name":"Task"}}}`), false, time.Now()))
+
+	version, err := service.GetWorkflowVersion(context.Background(), "test-workflow-id", 2)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, version.Version)
+	assert.Equal(t, "Task", version.Definition.Nodes["Task_1"].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDiffWorkflowDefinitions(t *testing.T) {
+	from, err := parser.ParseBPMN(createTestBPMN())
+	require.NoError(t, err)
+	to, err := parser.ParseBPMN(createParallelTestBPMN())
+	require.NoError(t, err)
+
+	diff := DiffWorkflowDefinitions(from, to)
+
+	assert.Contains(t, diff.RemovedNodes, "ServiceTask_1")
+	assert.Contains(t, diff.AddedNodes, "Fork_1")
+	assert.Contains(t, diff.ChangedNodes, "EndEvent_1")
+	assert.NotContains(t, diff.ChangedNodes, "StartEvent_1")
+
+	same := DiffWorkflowDefinitions(from, from)
+	assert.Empty(t, same.AddedNodes)
+	assert.Empty(t, same.RemovedNodes)
+	assert.Empty(t, same.ChangedNodes)
+	assert.Empty(t, same.ChangedFlows)
+}
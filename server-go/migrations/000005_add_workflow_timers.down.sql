@@ -0,0 +1,6 @@
+-- 回滚流程定时器表
+
+DROP INDEX IF EXISTS idx_workflow_timers_pending_node;
+DROP INDEX IF EXISTS idx_workflow_timers_instance;
+DROP INDEX IF EXISTS idx_workflow_timers_due;
+DROP TABLE IF EXISTS workflow_timers;
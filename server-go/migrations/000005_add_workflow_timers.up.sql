@@ -0,0 +1,28 @@
+-- 添加流程定时器表
+-- 定时器中间捕获事件和定时器边界事件的到期时间持久化在此表中，由后台调度器轮询触发
+
+-- 确保 uuid-ossp 扩展已安装
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- 表：workflow_timers
+CREATE TABLE IF NOT EXISTS workflow_timers (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  node_id VARCHAR(255) NOT NULL,       -- 定时器事件节点 ID（触发时从该节点继续执行）
+  scope_node_id VARCHAR(255) NOT NULL, -- 令牌所在节点 ID，令牌离开该节点时定时器被取消
+  due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  fire_count INTEGER NOT NULL DEFAULT 0,
+  variables JSONB DEFAULT '{}',
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  error_message TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+  CONSTRAINT valid_timer_status CHECK (status IN ('pending', 'firing', 'fired', 'cancelled', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_workflow_timers_due ON workflow_timers(status, due_at);
+CREATE INDEX IF NOT EXISTS idx_workflow_timers_instance ON workflow_timers(instance_id, status);
+-- 同一实例的同一定时器节点只允许存在一个待触发的定时器
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workflow_timers_pending_node ON workflow_timers(instance_id, node_id) WHERE status = 'pending';
@@ -0,0 +1,8 @@
+-- 回滚消息订阅表
+
+DROP INDEX IF EXISTS idx_message_subscriptions_pending_node;
+DROP INDEX IF EXISTS idx_message_subscriptions_variables;
+DROP INDEX IF EXISTS idx_message_subscriptions_instance;
+DROP INDEX IF EXISTS idx_message_subscriptions_business_key;
+DROP INDEX IF EXISTS idx_message_subscriptions_name;
+DROP TABLE IF EXISTS message_subscriptions;
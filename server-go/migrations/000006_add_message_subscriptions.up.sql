@@ -0,0 +1,29 @@
+-- 添加消息订阅表
+-- 令牌停留在消息中间捕获事件、事件网关分支或消息边界事件上时创建订阅，POST /api/messages 按消息名称关联
+
+-- 确保 uuid-ossp 扩展已安装
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- 表：message_subscriptions
+CREATE TABLE IF NOT EXISTS message_subscriptions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  node_id VARCHAR(255) NOT NULL,       -- 消息事件节点 ID（关联成功后从该节点继续执行）
+  scope_node_id VARCHAR(255) NOT NULL, -- 令牌所在节点 ID，令牌离开该节点时订阅被取消
+  message_name VARCHAR(255) NOT NULL,
+  business_key VARCHAR(255),
+  variables JSONB DEFAULT '{}',
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+  CONSTRAINT valid_subscription_status CHECK (status IN ('pending', 'correlated', 'cancelled'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_subscriptions_name ON message_subscriptions(message_name, status, created_at);
+CREATE INDEX IF NOT EXISTS idx_message_subscriptions_business_key ON message_subscriptions(business_key) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_message_subscriptions_instance ON message_subscriptions(instance_id, status);
+CREATE INDEX IF NOT EXISTS idx_message_subscriptions_variables ON message_subscriptions USING GIN (variables);
+-- 同一实例的同一消息事件节点只允许存在一个待关联的订阅
+CREATE UNIQUE INDEX IF NOT EXISTS idx_message_subscriptions_pending_node ON message_subscriptions(instance_id, node_id) WHERE status = 'pending';
@@ -0,0 +1,9 @@
+-- 回滚流程实例挂起状态
+-- 挂起中的实例恢复为运行状态，否则无法重新添加约束
+
+UPDATE workflow_instances SET status = 'running' WHERE status = 'suspended';
+
+ALTER TABLE workflow_instances DROP CONSTRAINT IF EXISTS valid_instance_status;
+ALTER TABLE workflow_instances ADD CONSTRAINT valid_instance_status CHECK (
+  status IN ('pending', 'running', 'completed', 'failed', 'cancelled')
+);
@@ -0,0 +1,7 @@
+-- 流程实例支持挂起状态
+-- 挂起的实例拒绝执行，定时器和消息订阅保留到恢复后再处理
+
+ALTER TABLE workflow_instances DROP CONSTRAINT IF EXISTS valid_instance_status;
+ALTER TABLE workflow_instances ADD CONSTRAINT valid_instance_status CHECK (
+  status IN ('pending', 'running', 'completed', 'failed', 'cancelled', 'suspended')
+);
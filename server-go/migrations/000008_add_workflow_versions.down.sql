@@ -0,0 +1,5 @@
+-- 回滚流程版本表
+
+ALTER TABLE workflow_instances DROP COLUMN IF EXISTS workflow_version;
+DROP INDEX IF EXISTS idx_workflow_versions_active;
+DROP TABLE IF EXISTS workflow_versions;
@@ -0,0 +1,25 @@
+-- 添加流程版本表
+-- 部署时将 BPMN XML 及解析结果快照为不可变版本，版本号按流程单调递增；实例固定在启动时的激活版本上
+
+-- 确保 uuid-ossp 扩展已安装
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- 表：workflow_versions
+CREATE TABLE IF NOT EXISTS workflow_versions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  version INTEGER NOT NULL,
+  bpmn_xml TEXT NOT NULL,
+  definition JSONB NOT NULL,            -- 解析后的流程定义快照
+  is_active BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+  CONSTRAINT unique_workflow_version UNIQUE (workflow_id, version),
+  CONSTRAINT valid_workflow_version CHECK (version > 0)
+);
+
+-- 每个流程只允许一个激活版本
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workflow_versions_active ON workflow_versions(workflow_id) WHERE is_active;
+
+-- 实例固定的流程版本，NULL 表示使用流程当前的 BPMN XML（部署前创建的实例）
+ALTER TABLE workflow_instances ADD COLUMN IF NOT EXISTS workflow_version INTEGER;
@@ -0,0 +1,6 @@
+-- 回滚调用活动表
+
+DROP INDEX IF EXISTS idx_call_activities_pending_node;
+DROP INDEX IF EXISTS idx_call_activities_parent;
+DROP INDEX IF EXISTS idx_call_activities_child;
+DROP TABLE IF EXISTS call_activities;
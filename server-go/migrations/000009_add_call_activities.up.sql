@@ -0,0 +1,26 @@
+-- 添加调用活动表
+-- 令牌到达 callActivity 时启动被调用流程的子实例并记录父子关联；子实例完成后父实例从调用活动继续，失败时在调用活动上抛出 BPMN 错误
+
+-- 确保 uuid-ossp 扩展已安装
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- 表：call_activities
+CREATE TABLE IF NOT EXISTS call_activities (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  parent_instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  parent_workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  parent_node_id VARCHAR(255) NOT NULL, -- 父流程中的调用活动节点 ID
+  child_instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  variables JSONB DEFAULT '{}',         -- 调用时父实例的流程变量，子实例结束后与输出映射合并
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  error_message TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+  CONSTRAINT valid_call_activity_status CHECK (status IN ('pending', 'completed', 'failed', 'cancelled'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_call_activities_child ON call_activities(child_instance_id);
+CREATE INDEX IF NOT EXISTS idx_call_activities_parent ON call_activities(parent_instance_id, status);
+-- 同一父实例的同一调用活动只允许存在一个进行中的子实例
+CREATE UNIQUE INDEX IF NOT EXISTS idx_call_activities_pending_node ON call_activities(parent_instance_id, parent_node_id) WHERE status = 'pending';
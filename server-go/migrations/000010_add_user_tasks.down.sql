@@ -0,0 +1,8 @@
+-- 回滚人工任务表
+
+DROP INDEX IF EXISTS idx_user_tasks_pending_node;
+DROP INDEX IF EXISTS idx_user_tasks_candidate_groups;
+DROP INDEX IF EXISTS idx_user_tasks_candidate_users;
+DROP INDEX IF EXISTS idx_user_tasks_assignee;
+DROP INDEX IF EXISTS idx_user_tasks_instance;
+DROP TABLE IF EXISTS user_tasks;
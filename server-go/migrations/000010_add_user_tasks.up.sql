@@ -0,0 +1,34 @@
+-- 添加人工任务表
+-- 令牌到达 userTask 时创建任务，记录处理人、候选人/候选组、期限、优先级和表单；任务完成时通过依附的边界事件推进实例
+
+-- 确保 uuid-ossp 扩展已安装
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- 表：user_tasks
+CREATE TABLE IF NOT EXISTS user_tasks (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  node_id VARCHAR(255) NOT NULL,         -- userTask 节点 ID
+  name VARCHAR(255) NOT NULL DEFAULT '',
+  assignee VARCHAR(255),                 -- 当前处理人，为空表示候选人均可认领
+  owner VARCHAR(255),                    -- 委派前的处理人
+  candidate_users TEXT[] NOT NULL DEFAULT '{}',
+  candidate_groups TEXT[] NOT NULL DEFAULT '{}',
+  due_date TIMESTAMP WITH TIME ZONE,
+  priority INTEGER NOT NULL DEFAULT 50,
+  form_key VARCHAR(255),
+  variables JSONB DEFAULT '{}',          -- 创建任务时的流程变量，完成时与提交的变量合并
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+  CONSTRAINT valid_user_task_status CHECK (status IN ('pending', 'completed', 'cancelled'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_tasks_instance ON user_tasks(instance_id, status);
+CREATE INDEX IF NOT EXISTS idx_user_tasks_assignee ON user_tasks(assignee, status);
+CREATE INDEX IF NOT EXISTS idx_user_tasks_candidate_users ON user_tasks USING GIN (candidate_users);
+CREATE INDEX IF NOT EXISTS idx_user_tasks_candidate_groups ON user_tasks USING GIN (candidate_groups);
+-- 同一实例的同一 userTask 只允许存在一个待处理任务
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_tasks_pending_node ON user_tasks(instance_id, node_id) WHERE status = 'pending';
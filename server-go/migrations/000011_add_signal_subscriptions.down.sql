@@ -0,0 +1,6 @@
+-- 回滚信号订阅表
+
+DROP INDEX IF EXISTS idx_signal_subscriptions_pending_node;
+DROP INDEX IF EXISTS idx_signal_subscriptions_instance;
+DROP INDEX IF EXISTS idx_signal_subscriptions_name;
+DROP TABLE IF EXISTS signal_subscriptions;
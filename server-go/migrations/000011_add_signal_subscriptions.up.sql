@@ -0,0 +1,27 @@
+-- 添加信号订阅表
+-- 令牌停留在信号中间捕获事件、事件网关分支或信号边界事件上时创建订阅；信号按名称广播，唤醒所有等待该信号的实例
+
+-- 确保 uuid-ossp 扩展已安装
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- 表：signal_subscriptions
+CREATE TABLE IF NOT EXISTS signal_subscriptions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  node_id VARCHAR(255) NOT NULL,       -- 信号事件节点 ID（收到信号后从该节点继续执行）
+  scope_node_id VARCHAR(255) NOT NULL, -- 令牌所在节点 ID，令牌离开该节点时订阅被取消
+  signal_name VARCHAR(255) NOT NULL,
+  variables JSONB DEFAULT '{}',
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+  CONSTRAINT valid_signal_subscription_status CHECK (status IN ('pending', 'triggered', 'cancelled'))
+);
+
+-- 广播时按信号名称分批认领待触发的订阅
+CREATE INDEX IF NOT EXISTS idx_signal_subscriptions_name ON signal_subscriptions(signal_name, created_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_signal_subscriptions_instance ON signal_subscriptions(instance_id, status);
+-- 同一实例的同一信号事件节点只允许存在一个待触发的订阅
+CREATE UNIQUE INDEX IF NOT EXISTS idx_signal_subscriptions_pending_node ON signal_subscriptions(instance_id, node_id) WHERE status = 'pending';
@@ -0,0 +1,6 @@
+-- 回滚异步作业表
+
+DROP INDEX IF EXISTS idx_workflow_jobs_pending_node;
+DROP INDEX IF EXISTS idx_workflow_jobs_instance;
+DROP INDEX IF EXISTS idx_workflow_jobs_due;
+DROP TABLE IF EXISTS workflow_jobs;
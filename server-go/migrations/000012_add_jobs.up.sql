@@ -0,0 +1,33 @@
+-- 添加异步作业表
+-- 标记了 asyncBefore/asyncAfter 的节点不在请求中同步执行，而是创建作业，由后台工作池认领后继续执行流程
+
+-- 确保 uuid-ossp 扩展已安装
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- 表：workflow_jobs
+CREATE TABLE IF NOT EXISTS workflow_jobs (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  node_id VARCHAR(255) NOT NULL,   -- 令牌停留的节点 ID（作业从该节点继续执行）
+  job_type VARCHAR(20) NOT NULL,   -- async-before：执行节点前；async-after：节点执行完成、离开节点前
+  variables JSONB DEFAULT '{}',
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  attempts INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 3,
+  due_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+  lock_owner VARCHAR(255),
+  lock_expires_at TIMESTAMP WITH TIME ZONE,
+  last_error TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+  CONSTRAINT valid_job_type CHECK (job_type IN ('async-before', 'async-after')),
+  CONSTRAINT valid_job_status CHECK (status IN ('pending', 'running', 'completed', 'dead', 'cancelled'))
+);
+
+-- 工作池按到期时间认领待执行的作业，以及锁已过期的执行中作业
+CREATE INDEX IF NOT EXISTS idx_workflow_jobs_due ON workflow_jobs(status, due_at);
+CREATE INDEX IF NOT EXISTS idx_workflow_jobs_instance ON workflow_jobs(instance_id, status);
+-- 同一实例的同一节点只允许存在一个同类型的待执行作业
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workflow_jobs_pending_node ON workflow_jobs(instance_id, node_id, job_type) WHERE status = 'pending';
@@ -0,0 +1,6 @@
+-- 回滚外部任务表
+
+DROP INDEX IF EXISTS idx_external_tasks_open_node;
+DROP INDEX IF EXISTS idx_external_tasks_instance;
+DROP INDEX IF EXISTS idx_external_tasks_topic;
+DROP TABLE IF EXISTS external_tasks;
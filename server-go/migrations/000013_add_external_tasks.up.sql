@@ -0,0 +1,32 @@
+-- 添加外部任务表
+-- type="external" 的 ServiceTask 不调用业务接口，令牌停在节点上并创建外部任务，
+-- 由工作者按主题拉取并锁定（fetch-and-lock），处理后完成、报告失败或延长锁
+
+-- 确保 uuid-ossp 扩展已安装
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+-- 表：external_tasks
+CREATE TABLE IF NOT EXISTS external_tasks (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  instance_id UUID NOT NULL REFERENCES workflow_instances(id) ON DELETE CASCADE,
+  workflow_id UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+  node_id VARCHAR(255) NOT NULL,         -- ServiceTask 节点 ID
+  topic VARCHAR(255) NOT NULL,
+  variables JSONB DEFAULT '{}',          -- 创建任务时的流程变量，工作者拉取时一并返回
+  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+  worker_id VARCHAR(255),                -- 当前锁定任务的工作者
+  lock_expires_at TIMESTAMP WITH TIME ZONE, -- 锁过期后其他工作者可以重新拉取；失败重试时为重试时间
+  retries INTEGER,                       -- 工作者报告的剩余重试次数，未报告失败时为空
+  error_message TEXT,
+  error_details TEXT,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+  CONSTRAINT valid_external_task_status CHECK (status IN ('pending', 'completed', 'failed', 'cancelled'))
+);
+
+-- 工作者按主题拉取未锁定的待处理任务
+CREATE INDEX IF NOT EXISTS idx_external_tasks_topic ON external_tasks(topic, status, lock_expires_at);
+CREATE INDEX IF NOT EXISTS idx_external_tasks_instance ON external_tasks(instance_id, status);
+-- 同一实例的同一 ServiceTask 只允许存在一个待处理或失败的任务
+CREATE UNIQUE INDEX IF NOT EXISTS idx_external_tasks_open_node ON external_tasks(instance_id, node_id) WHERE status IN ('pending', 'failed');
@@ -0,0 +1,3 @@
+-- 回滚流程实例的执行租约
+
+ALTER TABLE workflow_instances DROP COLUMN IF EXISTS execution_lease_until;
@@ -0,0 +1,4 @@
+-- 流程实例的执行租约
+-- 执行在运行任何节点之前占用实例并设置租约，租约有效期间其他执行的占用被拒绝；执行结束时释放，执行方崩溃时租约到期后自动失效
+
+ALTER TABLE workflow_instances ADD COLUMN IF NOT EXISTS execution_lease_until TIMESTAMP WITH TIME ZONE;
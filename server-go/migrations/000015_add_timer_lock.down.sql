@@ -0,0 +1,4 @@
+-- 回滚定时器的触发锁
+
+ALTER TABLE workflow_timers DROP COLUMN IF EXISTS lock_expires_at;
+ALTER TABLE workflow_timers DROP COLUMN IF EXISTS lock_owner;
@@ -0,0 +1,8 @@
+-- 定时器的触发锁
+-- 调度器领取定时器时记录持有者和锁的到期时间，触发期间定期续期；锁到期后才视为调度器崩溃，定时器可以被重新领取
+
+ALTER TABLE workflow_timers ADD COLUMN IF NOT EXISTS lock_owner VARCHAR(255);
+ALTER TABLE workflow_timers ADD COLUMN IF NOT EXISTS lock_expires_at TIMESTAMP WITH TIME ZONE;
+
+-- 升级时正在触发的定时器按原有的超时时间计算锁的到期时间
+UPDATE workflow_timers SET lock_expires_at = updated_at + INTERVAL '5 minutes' WHERE status = 'firing';
@@ -0,0 +1,3 @@
+-- 回滚汇聚型并行网关上等待的令牌
+
+ALTER TABLE workflow_instances DROP COLUMN IF EXISTS join_flow_ids;
@@ -0,0 +1,4 @@
+-- 汇聚型并行网关上等待的令牌
+-- 记录停在汇聚型并行网关上的令牌到达时经过的入边，网关在每条入边都有令牌到达时才合并，每条入边消耗一个令牌
+
+ALTER TABLE workflow_instances ADD COLUMN IF NOT EXISTS join_flow_ids TEXT[];